@@ -0,0 +1,16 @@
+module gitlab.com/gitops-poc-dzha/api/gen/user-service/go
+
+go 1.24.0
+
+require (
+	connectrpc.com/connect v1.19.1
+	google.golang.org/grpc v1.68.1
+	google.golang.org/protobuf v1.36.9
+)
+
+require (
+	golang.org/x/net v0.29.0 // indirect
+	golang.org/x/sys v0.25.0 // indirect
+	golang.org/x/text v0.18.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240903143218-8af14fe29dc1 // indirect
+)
@@ -0,0 +1,138 @@
+// Code generated by protoc-gen-connect-go. DO NOT EDIT.
+//
+// Source: user/v1/auth.proto
+
+package userv1connect
+
+import (
+	connect "connectrpc.com/connect"
+	context "context"
+	errors "errors"
+	v1 "gitlab.com/gitops-poc-dzha/api/gen/user-service/go/user/v1"
+	http "net/http"
+	strings "strings"
+)
+
+// This is a compile-time assertion to ensure that this generated file and the connect package are
+// compatible. If you get a compiler error that this constant is not defined, this code was
+// generated with a version of connect newer than the one compiled into your binary. You can fix the
+// problem by either regenerating this code with an older version of connect or updating the connect
+// version compiled into your binary.
+const _ = connect.IsAtLeastVersion1_13_0
+
+const (
+	// AuthSessionServiceName is the fully-qualified name of the AuthSessionService service.
+	AuthSessionServiceName = "user.v1.AuthSessionService"
+)
+
+// These constants are the fully-qualified names of the RPCs defined in this package. They're
+// exposed at runtime as Spec.Procedure and as the final two segments of the HTTP route.
+//
+// Note that these are different from the fully-qualified method names used by
+// google.golang.org/protobuf/reflect/protoreflect. To convert from these constants to
+// reflection-formatted method names, remove the leading slash and convert the remaining slash to a
+// period.
+const (
+	// AuthSessionServiceValidateSessionProcedure is the fully-qualified name of the
+	// AuthSessionService's ValidateSession RPC.
+	AuthSessionServiceValidateSessionProcedure = "/user.v1.AuthSessionService/ValidateSession"
+	// AuthSessionServiceValidateApiKeyProcedure is the fully-qualified name of the AuthSessionService's
+	// ValidateApiKey RPC.
+	AuthSessionServiceValidateApiKeyProcedure = "/user.v1.AuthSessionService/ValidateApiKey"
+)
+
+// AuthSessionServiceClient is a client for the user.v1.AuthSessionService service.
+type AuthSessionServiceClient interface {
+	ValidateSession(context.Context, *connect.Request[v1.ValidateSessionRequest]) (*connect.Response[v1.ValidateSessionResponse], error)
+	ValidateApiKey(context.Context, *connect.Request[v1.ValidateApiKeyRequest]) (*connect.Response[v1.ValidateApiKeyResponse], error)
+}
+
+// NewAuthSessionServiceClient constructs a client for the user.v1.AuthSessionService service. By
+// default, it uses the Connect protocol with the binary Protobuf Codec, asks for gzipped responses,
+// and sends uncompressed requests. To use the gRPC or gRPC-Web protocols, supply the
+// connect.WithGRPC() or connect.WithGRPCWeb() options.
+//
+// The URL supplied here should be the base URL for the Connect or gRPC server (for example,
+// http://api.acme.com or https://acme.com/grpc).
+func NewAuthSessionServiceClient(httpClient connect.HTTPClient, baseURL string, opts ...connect.ClientOption) AuthSessionServiceClient {
+	baseURL = strings.TrimRight(baseURL, "/")
+	authSessionServiceMethods := v1.File_user_v1_auth_proto.Services().ByName("AuthSessionService").Methods()
+	return &authSessionServiceClient{
+		validateSession: connect.NewClient[v1.ValidateSessionRequest, v1.ValidateSessionResponse](
+			httpClient,
+			baseURL+AuthSessionServiceValidateSessionProcedure,
+			connect.WithSchema(authSessionServiceMethods.ByName("ValidateSession")),
+			connect.WithClientOptions(opts...),
+		),
+		validateApiKey: connect.NewClient[v1.ValidateApiKeyRequest, v1.ValidateApiKeyResponse](
+			httpClient,
+			baseURL+AuthSessionServiceValidateApiKeyProcedure,
+			connect.WithSchema(authSessionServiceMethods.ByName("ValidateApiKey")),
+			connect.WithClientOptions(opts...),
+		),
+	}
+}
+
+// authSessionServiceClient implements AuthSessionServiceClient.
+type authSessionServiceClient struct {
+	validateSession *connect.Client[v1.ValidateSessionRequest, v1.ValidateSessionResponse]
+	validateApiKey  *connect.Client[v1.ValidateApiKeyRequest, v1.ValidateApiKeyResponse]
+}
+
+// ValidateSession calls user.v1.AuthSessionService.ValidateSession.
+func (c *authSessionServiceClient) ValidateSession(ctx context.Context, req *connect.Request[v1.ValidateSessionRequest]) (*connect.Response[v1.ValidateSessionResponse], error) {
+	return c.validateSession.CallUnary(ctx, req)
+}
+
+// ValidateApiKey calls user.v1.AuthSessionService.ValidateApiKey.
+func (c *authSessionServiceClient) ValidateApiKey(ctx context.Context, req *connect.Request[v1.ValidateApiKeyRequest]) (*connect.Response[v1.ValidateApiKeyResponse], error) {
+	return c.validateApiKey.CallUnary(ctx, req)
+}
+
+// AuthSessionServiceHandler is an implementation of the user.v1.AuthSessionService service.
+type AuthSessionServiceHandler interface {
+	ValidateSession(context.Context, *connect.Request[v1.ValidateSessionRequest]) (*connect.Response[v1.ValidateSessionResponse], error)
+	ValidateApiKey(context.Context, *connect.Request[v1.ValidateApiKeyRequest]) (*connect.Response[v1.ValidateApiKeyResponse], error)
+}
+
+// NewAuthSessionServiceHandler builds an HTTP handler from the service implementation. It returns
+// the path on which to mount the handler and the handler itself.
+//
+// By default, handlers support the Connect, gRPC, and gRPC-Web protocols with the binary Protobuf
+// and JSON codecs. They also support gzip compression.
+func NewAuthSessionServiceHandler(svc AuthSessionServiceHandler, opts ...connect.HandlerOption) (string, http.Handler) {
+	authSessionServiceMethods := v1.File_user_v1_auth_proto.Services().ByName("AuthSessionService").Methods()
+	authSessionServiceValidateSessionHandler := connect.NewUnaryHandler(
+		AuthSessionServiceValidateSessionProcedure,
+		svc.ValidateSession,
+		connect.WithSchema(authSessionServiceMethods.ByName("ValidateSession")),
+		connect.WithHandlerOptions(opts...),
+	)
+	authSessionServiceValidateApiKeyHandler := connect.NewUnaryHandler(
+		AuthSessionServiceValidateApiKeyProcedure,
+		svc.ValidateApiKey,
+		connect.WithSchema(authSessionServiceMethods.ByName("ValidateApiKey")),
+		connect.WithHandlerOptions(opts...),
+	)
+	return "/user.v1.AuthSessionService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case AuthSessionServiceValidateSessionProcedure:
+			authSessionServiceValidateSessionHandler.ServeHTTP(w, r)
+		case AuthSessionServiceValidateApiKeyProcedure:
+			authSessionServiceValidateApiKeyHandler.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// UnimplementedAuthSessionServiceHandler returns CodeUnimplemented from all methods.
+type UnimplementedAuthSessionServiceHandler struct{}
+
+func (UnimplementedAuthSessionServiceHandler) ValidateSession(context.Context, *connect.Request[v1.ValidateSessionRequest]) (*connect.Response[v1.ValidateSessionResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.AuthSessionService.ValidateSession is not implemented"))
+}
+
+func (UnimplementedAuthSessionServiceHandler) ValidateApiKey(context.Context, *connect.Request[v1.ValidateApiKeyRequest]) (*connect.Response[v1.ValidateApiKeyResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.AuthSessionService.ValidateApiKey is not implemented"))
+}
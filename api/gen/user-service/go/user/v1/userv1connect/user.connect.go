@@ -0,0 +1,1021 @@
+// Code generated by protoc-gen-connect-go. DO NOT EDIT.
+//
+// Source: user/v1/user.proto
+
+package userv1connect
+
+import (
+	connect "connectrpc.com/connect"
+	context "context"
+	errors "errors"
+	v1 "gitlab.com/gitops-poc-dzha/api/gen/user-service/go/user/v1"
+	http "net/http"
+	strings "strings"
+)
+
+// This is a compile-time assertion to ensure that this generated file and the connect package are
+// compatible. If you get a compiler error that this constant is not defined, this code was
+// generated with a version of connect newer than the one compiled into your binary. You can fix the
+// problem by either regenerating this code with an older version of connect or updating the connect
+// version compiled into your binary.
+const _ = connect.IsAtLeastVersion1_13_0
+
+const (
+	// UserServiceName is the fully-qualified name of the UserService service.
+	UserServiceName = "user.v1.UserService"
+)
+
+// These constants are the fully-qualified names of the RPCs defined in this package. They're
+// exposed at runtime as Spec.Procedure and as the final two segments of the HTTP route.
+//
+// Note that these are different from the fully-qualified method names used by
+// google.golang.org/protobuf/reflect/protoreflect. To convert from these constants to
+// reflection-formatted method names, remove the leading slash and convert the remaining slash to a
+// period.
+const (
+	// UserServiceRegisterProcedure is the fully-qualified name of the UserService's Register RPC.
+	UserServiceRegisterProcedure = "/user.v1.UserService/Register"
+	// UserServiceLoginProcedure is the fully-qualified name of the UserService's Login RPC.
+	UserServiceLoginProcedure = "/user.v1.UserService/Login"
+	// UserServiceVerifyLoginTotpProcedure is the fully-qualified name of the UserService's
+	// VerifyLoginTotp RPC.
+	UserServiceVerifyLoginTotpProcedure = "/user.v1.UserService/VerifyLoginTotp"
+	// UserServiceEnrollTotpProcedure is the fully-qualified name of the UserService's EnrollTotp RPC.
+	UserServiceEnrollTotpProcedure = "/user.v1.UserService/EnrollTotp"
+	// UserServiceConfirmTotpProcedure is the fully-qualified name of the UserService's ConfirmTotp RPC.
+	UserServiceConfirmTotpProcedure = "/user.v1.UserService/ConfirmTotp"
+	// UserServiceDisableTotpProcedure is the fully-qualified name of the UserService's DisableTotp RPC.
+	UserServiceDisableTotpProcedure = "/user.v1.UserService/DisableTotp"
+	// UserServiceStartOidcLoginProcedure is the fully-qualified name of the UserService's
+	// StartOidcLogin RPC.
+	UserServiceStartOidcLoginProcedure = "/user.v1.UserService/StartOidcLogin"
+	// UserServiceCompleteOidcLoginProcedure is the fully-qualified name of the UserService's
+	// CompleteOidcLogin RPC.
+	UserServiceCompleteOidcLoginProcedure = "/user.v1.UserService/CompleteOidcLogin"
+	// UserServiceVerifyEmailProcedure is the fully-qualified name of the UserService's VerifyEmail RPC.
+	UserServiceVerifyEmailProcedure = "/user.v1.UserService/VerifyEmail"
+	// UserServiceResendVerificationEmailProcedure is the fully-qualified name of the UserService's
+	// ResendVerificationEmail RPC.
+	UserServiceResendVerificationEmailProcedure = "/user.v1.UserService/ResendVerificationEmail"
+	// UserServiceRequestPasswordResetProcedure is the fully-qualified name of the UserService's
+	// RequestPasswordReset RPC.
+	UserServiceRequestPasswordResetProcedure = "/user.v1.UserService/RequestPasswordReset"
+	// UserServiceResetPasswordProcedure is the fully-qualified name of the UserService's ResetPassword
+	// RPC.
+	UserServiceResetPasswordProcedure = "/user.v1.UserService/ResetPassword"
+	// UserServiceLogoutProcedure is the fully-qualified name of the UserService's Logout RPC.
+	UserServiceLogoutProcedure = "/user.v1.UserService/Logout"
+	// UserServiceRefreshTokenProcedure is the fully-qualified name of the UserService's RefreshToken
+	// RPC.
+	UserServiceRefreshTokenProcedure = "/user.v1.UserService/RefreshToken"
+	// UserServiceGetProfileProcedure is the fully-qualified name of the UserService's GetProfile RPC.
+	UserServiceGetProfileProcedure = "/user.v1.UserService/GetProfile"
+	// UserServiceUpdateProfileProcedure is the fully-qualified name of the UserService's UpdateProfile
+	// RPC.
+	UserServiceUpdateProfileProcedure = "/user.v1.UserService/UpdateProfile"
+	// UserServiceChangePasswordProcedure is the fully-qualified name of the UserService's
+	// ChangePassword RPC.
+	UserServiceChangePasswordProcedure = "/user.v1.UserService/ChangePassword"
+	// UserServiceChangeEmailProcedure is the fully-qualified name of the UserService's ChangeEmail RPC.
+	UserServiceChangeEmailProcedure = "/user.v1.UserService/ChangeEmail"
+	// UserServiceDeleteAccountProcedure is the fully-qualified name of the UserService's DeleteAccount
+	// RPC.
+	UserServiceDeleteAccountProcedure = "/user.v1.UserService/DeleteAccount"
+	// UserServiceListSessionsProcedure is the fully-qualified name of the UserService's ListSessions
+	// RPC.
+	UserServiceListSessionsProcedure = "/user.v1.UserService/ListSessions"
+	// UserServiceRevokeSessionProcedure is the fully-qualified name of the UserService's RevokeSession
+	// RPC.
+	UserServiceRevokeSessionProcedure = "/user.v1.UserService/RevokeSession"
+	// UserServiceLogoutAllProcedure is the fully-qualified name of the UserService's LogoutAll RPC.
+	UserServiceLogoutAllProcedure = "/user.v1.UserService/LogoutAll"
+	// UserServiceAdminRevokeSessionProcedure is the fully-qualified name of the UserService's
+	// AdminRevokeSession RPC.
+	UserServiceAdminRevokeSessionProcedure = "/user.v1.UserService/AdminRevokeSession"
+	// UserServiceUnlockUserProcedure is the fully-qualified name of the UserService's UnlockUser RPC.
+	UserServiceUnlockUserProcedure = "/user.v1.UserService/UnlockUser"
+	// UserServiceListRolesProcedure is the fully-qualified name of the UserService's ListRoles RPC.
+	UserServiceListRolesProcedure = "/user.v1.UserService/ListRoles"
+	// UserServiceCreateRoleProcedure is the fully-qualified name of the UserService's CreateRole RPC.
+	UserServiceCreateRoleProcedure = "/user.v1.UserService/CreateRole"
+	// UserServiceUpdateRoleProcedure is the fully-qualified name of the UserService's UpdateRole RPC.
+	UserServiceUpdateRoleProcedure = "/user.v1.UserService/UpdateRole"
+	// UserServiceDeleteRoleProcedure is the fully-qualified name of the UserService's DeleteRole RPC.
+	UserServiceDeleteRoleProcedure = "/user.v1.UserService/DeleteRole"
+	// UserServiceGrantPermissionProcedure is the fully-qualified name of the UserService's
+	// GrantPermission RPC.
+	UserServiceGrantPermissionProcedure = "/user.v1.UserService/GrantPermission"
+	// UserServiceRevokePermissionProcedure is the fully-qualified name of the UserService's
+	// RevokePermission RPC.
+	UserServiceRevokePermissionProcedure = "/user.v1.UserService/RevokePermission"
+	// UserServiceCreateApiKeyProcedure is the fully-qualified name of the UserService's CreateApiKey
+	// RPC.
+	UserServiceCreateApiKeyProcedure = "/user.v1.UserService/CreateApiKey"
+	// UserServiceListApiKeysProcedure is the fully-qualified name of the UserService's ListApiKeys RPC.
+	UserServiceListApiKeysProcedure = "/user.v1.UserService/ListApiKeys"
+	// UserServiceRevokeApiKeyProcedure is the fully-qualified name of the UserService's RevokeApiKey
+	// RPC.
+	UserServiceRevokeApiKeyProcedure = "/user.v1.UserService/RevokeApiKey"
+)
+
+// UserServiceClient is a client for the user.v1.UserService service.
+type UserServiceClient interface {
+	Register(context.Context, *connect.Request[v1.RegisterRequest]) (*connect.Response[v1.RegisterResponse], error)
+	Login(context.Context, *connect.Request[v1.LoginRequest]) (*connect.Response[v1.LoginResponse], error)
+	VerifyLoginTotp(context.Context, *connect.Request[v1.VerifyLoginTotpRequest]) (*connect.Response[v1.VerifyLoginTotpResponse], error)
+	EnrollTotp(context.Context, *connect.Request[v1.EnrollTotpRequest]) (*connect.Response[v1.EnrollTotpResponse], error)
+	ConfirmTotp(context.Context, *connect.Request[v1.ConfirmTotpRequest]) (*connect.Response[v1.ConfirmTotpResponse], error)
+	DisableTotp(context.Context, *connect.Request[v1.DisableTotpRequest]) (*connect.Response[v1.DisableTotpResponse], error)
+	StartOidcLogin(context.Context, *connect.Request[v1.StartOidcLoginRequest]) (*connect.Response[v1.StartOidcLoginResponse], error)
+	CompleteOidcLogin(context.Context, *connect.Request[v1.CompleteOidcLoginRequest]) (*connect.Response[v1.CompleteOidcLoginResponse], error)
+	VerifyEmail(context.Context, *connect.Request[v1.VerifyEmailRequest]) (*connect.Response[v1.VerifyEmailResponse], error)
+	ResendVerificationEmail(context.Context, *connect.Request[v1.ResendVerificationEmailRequest]) (*connect.Response[v1.ResendVerificationEmailResponse], error)
+	RequestPasswordReset(context.Context, *connect.Request[v1.RequestPasswordResetRequest]) (*connect.Response[v1.RequestPasswordResetResponse], error)
+	ResetPassword(context.Context, *connect.Request[v1.ResetPasswordRequest]) (*connect.Response[v1.ResetPasswordResponse], error)
+	Logout(context.Context, *connect.Request[v1.LogoutRequest]) (*connect.Response[v1.LogoutResponse], error)
+	RefreshToken(context.Context, *connect.Request[v1.RefreshTokenRequest]) (*connect.Response[v1.RefreshTokenResponse], error)
+	GetProfile(context.Context, *connect.Request[v1.GetProfileRequest]) (*connect.Response[v1.GetProfileResponse], error)
+	UpdateProfile(context.Context, *connect.Request[v1.UpdateProfileRequest]) (*connect.Response[v1.UpdateProfileResponse], error)
+	ChangePassword(context.Context, *connect.Request[v1.ChangePasswordRequest]) (*connect.Response[v1.ChangePasswordResponse], error)
+	ChangeEmail(context.Context, *connect.Request[v1.ChangeEmailRequest]) (*connect.Response[v1.ChangeEmailResponse], error)
+	DeleteAccount(context.Context, *connect.Request[v1.DeleteAccountRequest]) (*connect.Response[v1.DeleteAccountResponse], error)
+	ListSessions(context.Context, *connect.Request[v1.ListSessionsRequest]) (*connect.Response[v1.ListSessionsResponse], error)
+	RevokeSession(context.Context, *connect.Request[v1.RevokeSessionRequest]) (*connect.Response[v1.RevokeSessionResponse], error)
+	LogoutAll(context.Context, *connect.Request[v1.LogoutAllRequest]) (*connect.Response[v1.LogoutAllResponse], error)
+	AdminRevokeSession(context.Context, *connect.Request[v1.AdminRevokeSessionRequest]) (*connect.Response[v1.AdminRevokeSessionResponse], error)
+	UnlockUser(context.Context, *connect.Request[v1.UnlockUserRequest]) (*connect.Response[v1.UnlockUserResponse], error)
+	ListRoles(context.Context, *connect.Request[v1.ListRolesRequest]) (*connect.Response[v1.ListRolesResponse], error)
+	CreateRole(context.Context, *connect.Request[v1.CreateRoleRequest]) (*connect.Response[v1.CreateRoleResponse], error)
+	UpdateRole(context.Context, *connect.Request[v1.UpdateRoleRequest]) (*connect.Response[v1.UpdateRoleResponse], error)
+	DeleteRole(context.Context, *connect.Request[v1.DeleteRoleRequest]) (*connect.Response[v1.DeleteRoleResponse], error)
+	GrantPermission(context.Context, *connect.Request[v1.GrantPermissionRequest]) (*connect.Response[v1.GrantPermissionResponse], error)
+	RevokePermission(context.Context, *connect.Request[v1.RevokePermissionRequest]) (*connect.Response[v1.RevokePermissionResponse], error)
+	CreateApiKey(context.Context, *connect.Request[v1.CreateApiKeyRequest]) (*connect.Response[v1.CreateApiKeyResponse], error)
+	ListApiKeys(context.Context, *connect.Request[v1.ListApiKeysRequest]) (*connect.Response[v1.ListApiKeysResponse], error)
+	RevokeApiKey(context.Context, *connect.Request[v1.RevokeApiKeyRequest]) (*connect.Response[v1.RevokeApiKeyResponse], error)
+}
+
+// NewUserServiceClient constructs a client for the user.v1.UserService service. By default, it uses
+// the Connect protocol with the binary Protobuf Codec, asks for gzipped responses, and sends
+// uncompressed requests. To use the gRPC or gRPC-Web protocols, supply the connect.WithGRPC() or
+// connect.WithGRPCWeb() options.
+//
+// The URL supplied here should be the base URL for the Connect or gRPC server (for example,
+// http://api.acme.com or https://acme.com/grpc).
+func NewUserServiceClient(httpClient connect.HTTPClient, baseURL string, opts ...connect.ClientOption) UserServiceClient {
+	baseURL = strings.TrimRight(baseURL, "/")
+	userServiceMethods := v1.File_user_v1_user_proto.Services().ByName("UserService").Methods()
+	return &userServiceClient{
+		register: connect.NewClient[v1.RegisterRequest, v1.RegisterResponse](
+			httpClient,
+			baseURL+UserServiceRegisterProcedure,
+			connect.WithSchema(userServiceMethods.ByName("Register")),
+			connect.WithClientOptions(opts...),
+		),
+		login: connect.NewClient[v1.LoginRequest, v1.LoginResponse](
+			httpClient,
+			baseURL+UserServiceLoginProcedure,
+			connect.WithSchema(userServiceMethods.ByName("Login")),
+			connect.WithClientOptions(opts...),
+		),
+		verifyLoginTotp: connect.NewClient[v1.VerifyLoginTotpRequest, v1.VerifyLoginTotpResponse](
+			httpClient,
+			baseURL+UserServiceVerifyLoginTotpProcedure,
+			connect.WithSchema(userServiceMethods.ByName("VerifyLoginTotp")),
+			connect.WithClientOptions(opts...),
+		),
+		enrollTotp: connect.NewClient[v1.EnrollTotpRequest, v1.EnrollTotpResponse](
+			httpClient,
+			baseURL+UserServiceEnrollTotpProcedure,
+			connect.WithSchema(userServiceMethods.ByName("EnrollTotp")),
+			connect.WithClientOptions(opts...),
+		),
+		confirmTotp: connect.NewClient[v1.ConfirmTotpRequest, v1.ConfirmTotpResponse](
+			httpClient,
+			baseURL+UserServiceConfirmTotpProcedure,
+			connect.WithSchema(userServiceMethods.ByName("ConfirmTotp")),
+			connect.WithClientOptions(opts...),
+		),
+		disableTotp: connect.NewClient[v1.DisableTotpRequest, v1.DisableTotpResponse](
+			httpClient,
+			baseURL+UserServiceDisableTotpProcedure,
+			connect.WithSchema(userServiceMethods.ByName("DisableTotp")),
+			connect.WithClientOptions(opts...),
+		),
+		startOidcLogin: connect.NewClient[v1.StartOidcLoginRequest, v1.StartOidcLoginResponse](
+			httpClient,
+			baseURL+UserServiceStartOidcLoginProcedure,
+			connect.WithSchema(userServiceMethods.ByName("StartOidcLogin")),
+			connect.WithClientOptions(opts...),
+		),
+		completeOidcLogin: connect.NewClient[v1.CompleteOidcLoginRequest, v1.CompleteOidcLoginResponse](
+			httpClient,
+			baseURL+UserServiceCompleteOidcLoginProcedure,
+			connect.WithSchema(userServiceMethods.ByName("CompleteOidcLogin")),
+			connect.WithClientOptions(opts...),
+		),
+		verifyEmail: connect.NewClient[v1.VerifyEmailRequest, v1.VerifyEmailResponse](
+			httpClient,
+			baseURL+UserServiceVerifyEmailProcedure,
+			connect.WithSchema(userServiceMethods.ByName("VerifyEmail")),
+			connect.WithClientOptions(opts...),
+		),
+		resendVerificationEmail: connect.NewClient[v1.ResendVerificationEmailRequest, v1.ResendVerificationEmailResponse](
+			httpClient,
+			baseURL+UserServiceResendVerificationEmailProcedure,
+			connect.WithSchema(userServiceMethods.ByName("ResendVerificationEmail")),
+			connect.WithClientOptions(opts...),
+		),
+		requestPasswordReset: connect.NewClient[v1.RequestPasswordResetRequest, v1.RequestPasswordResetResponse](
+			httpClient,
+			baseURL+UserServiceRequestPasswordResetProcedure,
+			connect.WithSchema(userServiceMethods.ByName("RequestPasswordReset")),
+			connect.WithClientOptions(opts...),
+		),
+		resetPassword: connect.NewClient[v1.ResetPasswordRequest, v1.ResetPasswordResponse](
+			httpClient,
+			baseURL+UserServiceResetPasswordProcedure,
+			connect.WithSchema(userServiceMethods.ByName("ResetPassword")),
+			connect.WithClientOptions(opts...),
+		),
+		logout: connect.NewClient[v1.LogoutRequest, v1.LogoutResponse](
+			httpClient,
+			baseURL+UserServiceLogoutProcedure,
+			connect.WithSchema(userServiceMethods.ByName("Logout")),
+			connect.WithClientOptions(opts...),
+		),
+		refreshToken: connect.NewClient[v1.RefreshTokenRequest, v1.RefreshTokenResponse](
+			httpClient,
+			baseURL+UserServiceRefreshTokenProcedure,
+			connect.WithSchema(userServiceMethods.ByName("RefreshToken")),
+			connect.WithClientOptions(opts...),
+		),
+		getProfile: connect.NewClient[v1.GetProfileRequest, v1.GetProfileResponse](
+			httpClient,
+			baseURL+UserServiceGetProfileProcedure,
+			connect.WithSchema(userServiceMethods.ByName("GetProfile")),
+			connect.WithClientOptions(opts...),
+		),
+		updateProfile: connect.NewClient[v1.UpdateProfileRequest, v1.UpdateProfileResponse](
+			httpClient,
+			baseURL+UserServiceUpdateProfileProcedure,
+			connect.WithSchema(userServiceMethods.ByName("UpdateProfile")),
+			connect.WithClientOptions(opts...),
+		),
+		changePassword: connect.NewClient[v1.ChangePasswordRequest, v1.ChangePasswordResponse](
+			httpClient,
+			baseURL+UserServiceChangePasswordProcedure,
+			connect.WithSchema(userServiceMethods.ByName("ChangePassword")),
+			connect.WithClientOptions(opts...),
+		),
+		changeEmail: connect.NewClient[v1.ChangeEmailRequest, v1.ChangeEmailResponse](
+			httpClient,
+			baseURL+UserServiceChangeEmailProcedure,
+			connect.WithSchema(userServiceMethods.ByName("ChangeEmail")),
+			connect.WithClientOptions(opts...),
+		),
+		deleteAccount: connect.NewClient[v1.DeleteAccountRequest, v1.DeleteAccountResponse](
+			httpClient,
+			baseURL+UserServiceDeleteAccountProcedure,
+			connect.WithSchema(userServiceMethods.ByName("DeleteAccount")),
+			connect.WithClientOptions(opts...),
+		),
+		listSessions: connect.NewClient[v1.ListSessionsRequest, v1.ListSessionsResponse](
+			httpClient,
+			baseURL+UserServiceListSessionsProcedure,
+			connect.WithSchema(userServiceMethods.ByName("ListSessions")),
+			connect.WithClientOptions(opts...),
+		),
+		revokeSession: connect.NewClient[v1.RevokeSessionRequest, v1.RevokeSessionResponse](
+			httpClient,
+			baseURL+UserServiceRevokeSessionProcedure,
+			connect.WithSchema(userServiceMethods.ByName("RevokeSession")),
+			connect.WithClientOptions(opts...),
+		),
+		logoutAll: connect.NewClient[v1.LogoutAllRequest, v1.LogoutAllResponse](
+			httpClient,
+			baseURL+UserServiceLogoutAllProcedure,
+			connect.WithSchema(userServiceMethods.ByName("LogoutAll")),
+			connect.WithClientOptions(opts...),
+		),
+		adminRevokeSession: connect.NewClient[v1.AdminRevokeSessionRequest, v1.AdminRevokeSessionResponse](
+			httpClient,
+			baseURL+UserServiceAdminRevokeSessionProcedure,
+			connect.WithSchema(userServiceMethods.ByName("AdminRevokeSession")),
+			connect.WithClientOptions(opts...),
+		),
+		unlockUser: connect.NewClient[v1.UnlockUserRequest, v1.UnlockUserResponse](
+			httpClient,
+			baseURL+UserServiceUnlockUserProcedure,
+			connect.WithSchema(userServiceMethods.ByName("UnlockUser")),
+			connect.WithClientOptions(opts...),
+		),
+		listRoles: connect.NewClient[v1.ListRolesRequest, v1.ListRolesResponse](
+			httpClient,
+			baseURL+UserServiceListRolesProcedure,
+			connect.WithSchema(userServiceMethods.ByName("ListRoles")),
+			connect.WithClientOptions(opts...),
+		),
+		createRole: connect.NewClient[v1.CreateRoleRequest, v1.CreateRoleResponse](
+			httpClient,
+			baseURL+UserServiceCreateRoleProcedure,
+			connect.WithSchema(userServiceMethods.ByName("CreateRole")),
+			connect.WithClientOptions(opts...),
+		),
+		updateRole: connect.NewClient[v1.UpdateRoleRequest, v1.UpdateRoleResponse](
+			httpClient,
+			baseURL+UserServiceUpdateRoleProcedure,
+			connect.WithSchema(userServiceMethods.ByName("UpdateRole")),
+			connect.WithClientOptions(opts...),
+		),
+		deleteRole: connect.NewClient[v1.DeleteRoleRequest, v1.DeleteRoleResponse](
+			httpClient,
+			baseURL+UserServiceDeleteRoleProcedure,
+			connect.WithSchema(userServiceMethods.ByName("DeleteRole")),
+			connect.WithClientOptions(opts...),
+		),
+		grantPermission: connect.NewClient[v1.GrantPermissionRequest, v1.GrantPermissionResponse](
+			httpClient,
+			baseURL+UserServiceGrantPermissionProcedure,
+			connect.WithSchema(userServiceMethods.ByName("GrantPermission")),
+			connect.WithClientOptions(opts...),
+		),
+		revokePermission: connect.NewClient[v1.RevokePermissionRequest, v1.RevokePermissionResponse](
+			httpClient,
+			baseURL+UserServiceRevokePermissionProcedure,
+			connect.WithSchema(userServiceMethods.ByName("RevokePermission")),
+			connect.WithClientOptions(opts...),
+		),
+		createApiKey: connect.NewClient[v1.CreateApiKeyRequest, v1.CreateApiKeyResponse](
+			httpClient,
+			baseURL+UserServiceCreateApiKeyProcedure,
+			connect.WithSchema(userServiceMethods.ByName("CreateApiKey")),
+			connect.WithClientOptions(opts...),
+		),
+		listApiKeys: connect.NewClient[v1.ListApiKeysRequest, v1.ListApiKeysResponse](
+			httpClient,
+			baseURL+UserServiceListApiKeysProcedure,
+			connect.WithSchema(userServiceMethods.ByName("ListApiKeys")),
+			connect.WithClientOptions(opts...),
+		),
+		revokeApiKey: connect.NewClient[v1.RevokeApiKeyRequest, v1.RevokeApiKeyResponse](
+			httpClient,
+			baseURL+UserServiceRevokeApiKeyProcedure,
+			connect.WithSchema(userServiceMethods.ByName("RevokeApiKey")),
+			connect.WithClientOptions(opts...),
+		),
+	}
+}
+
+// userServiceClient implements UserServiceClient.
+type userServiceClient struct {
+	register                *connect.Client[v1.RegisterRequest, v1.RegisterResponse]
+	login                   *connect.Client[v1.LoginRequest, v1.LoginResponse]
+	verifyLoginTotp         *connect.Client[v1.VerifyLoginTotpRequest, v1.VerifyLoginTotpResponse]
+	enrollTotp              *connect.Client[v1.EnrollTotpRequest, v1.EnrollTotpResponse]
+	confirmTotp             *connect.Client[v1.ConfirmTotpRequest, v1.ConfirmTotpResponse]
+	disableTotp             *connect.Client[v1.DisableTotpRequest, v1.DisableTotpResponse]
+	startOidcLogin          *connect.Client[v1.StartOidcLoginRequest, v1.StartOidcLoginResponse]
+	completeOidcLogin       *connect.Client[v1.CompleteOidcLoginRequest, v1.CompleteOidcLoginResponse]
+	verifyEmail             *connect.Client[v1.VerifyEmailRequest, v1.VerifyEmailResponse]
+	resendVerificationEmail *connect.Client[v1.ResendVerificationEmailRequest, v1.ResendVerificationEmailResponse]
+	requestPasswordReset    *connect.Client[v1.RequestPasswordResetRequest, v1.RequestPasswordResetResponse]
+	resetPassword           *connect.Client[v1.ResetPasswordRequest, v1.ResetPasswordResponse]
+	logout                  *connect.Client[v1.LogoutRequest, v1.LogoutResponse]
+	refreshToken            *connect.Client[v1.RefreshTokenRequest, v1.RefreshTokenResponse]
+	getProfile              *connect.Client[v1.GetProfileRequest, v1.GetProfileResponse]
+	updateProfile           *connect.Client[v1.UpdateProfileRequest, v1.UpdateProfileResponse]
+	changePassword          *connect.Client[v1.ChangePasswordRequest, v1.ChangePasswordResponse]
+	changeEmail             *connect.Client[v1.ChangeEmailRequest, v1.ChangeEmailResponse]
+	deleteAccount           *connect.Client[v1.DeleteAccountRequest, v1.DeleteAccountResponse]
+	listSessions            *connect.Client[v1.ListSessionsRequest, v1.ListSessionsResponse]
+	revokeSession           *connect.Client[v1.RevokeSessionRequest, v1.RevokeSessionResponse]
+	logoutAll               *connect.Client[v1.LogoutAllRequest, v1.LogoutAllResponse]
+	adminRevokeSession      *connect.Client[v1.AdminRevokeSessionRequest, v1.AdminRevokeSessionResponse]
+	unlockUser              *connect.Client[v1.UnlockUserRequest, v1.UnlockUserResponse]
+	listRoles               *connect.Client[v1.ListRolesRequest, v1.ListRolesResponse]
+	createRole              *connect.Client[v1.CreateRoleRequest, v1.CreateRoleResponse]
+	updateRole              *connect.Client[v1.UpdateRoleRequest, v1.UpdateRoleResponse]
+	deleteRole              *connect.Client[v1.DeleteRoleRequest, v1.DeleteRoleResponse]
+	grantPermission         *connect.Client[v1.GrantPermissionRequest, v1.GrantPermissionResponse]
+	revokePermission        *connect.Client[v1.RevokePermissionRequest, v1.RevokePermissionResponse]
+	createApiKey            *connect.Client[v1.CreateApiKeyRequest, v1.CreateApiKeyResponse]
+	listApiKeys             *connect.Client[v1.ListApiKeysRequest, v1.ListApiKeysResponse]
+	revokeApiKey            *connect.Client[v1.RevokeApiKeyRequest, v1.RevokeApiKeyResponse]
+}
+
+// Register calls user.v1.UserService.Register.
+func (c *userServiceClient) Register(ctx context.Context, req *connect.Request[v1.RegisterRequest]) (*connect.Response[v1.RegisterResponse], error) {
+	return c.register.CallUnary(ctx, req)
+}
+
+// Login calls user.v1.UserService.Login.
+func (c *userServiceClient) Login(ctx context.Context, req *connect.Request[v1.LoginRequest]) (*connect.Response[v1.LoginResponse], error) {
+	return c.login.CallUnary(ctx, req)
+}
+
+// VerifyLoginTotp calls user.v1.UserService.VerifyLoginTotp.
+func (c *userServiceClient) VerifyLoginTotp(ctx context.Context, req *connect.Request[v1.VerifyLoginTotpRequest]) (*connect.Response[v1.VerifyLoginTotpResponse], error) {
+	return c.verifyLoginTotp.CallUnary(ctx, req)
+}
+
+// EnrollTotp calls user.v1.UserService.EnrollTotp.
+func (c *userServiceClient) EnrollTotp(ctx context.Context, req *connect.Request[v1.EnrollTotpRequest]) (*connect.Response[v1.EnrollTotpResponse], error) {
+	return c.enrollTotp.CallUnary(ctx, req)
+}
+
+// ConfirmTotp calls user.v1.UserService.ConfirmTotp.
+func (c *userServiceClient) ConfirmTotp(ctx context.Context, req *connect.Request[v1.ConfirmTotpRequest]) (*connect.Response[v1.ConfirmTotpResponse], error) {
+	return c.confirmTotp.CallUnary(ctx, req)
+}
+
+// DisableTotp calls user.v1.UserService.DisableTotp.
+func (c *userServiceClient) DisableTotp(ctx context.Context, req *connect.Request[v1.DisableTotpRequest]) (*connect.Response[v1.DisableTotpResponse], error) {
+	return c.disableTotp.CallUnary(ctx, req)
+}
+
+// StartOidcLogin calls user.v1.UserService.StartOidcLogin.
+func (c *userServiceClient) StartOidcLogin(ctx context.Context, req *connect.Request[v1.StartOidcLoginRequest]) (*connect.Response[v1.StartOidcLoginResponse], error) {
+	return c.startOidcLogin.CallUnary(ctx, req)
+}
+
+// CompleteOidcLogin calls user.v1.UserService.CompleteOidcLogin.
+func (c *userServiceClient) CompleteOidcLogin(ctx context.Context, req *connect.Request[v1.CompleteOidcLoginRequest]) (*connect.Response[v1.CompleteOidcLoginResponse], error) {
+	return c.completeOidcLogin.CallUnary(ctx, req)
+}
+
+// VerifyEmail calls user.v1.UserService.VerifyEmail.
+func (c *userServiceClient) VerifyEmail(ctx context.Context, req *connect.Request[v1.VerifyEmailRequest]) (*connect.Response[v1.VerifyEmailResponse], error) {
+	return c.verifyEmail.CallUnary(ctx, req)
+}
+
+// ResendVerificationEmail calls user.v1.UserService.ResendVerificationEmail.
+func (c *userServiceClient) ResendVerificationEmail(ctx context.Context, req *connect.Request[v1.ResendVerificationEmailRequest]) (*connect.Response[v1.ResendVerificationEmailResponse], error) {
+	return c.resendVerificationEmail.CallUnary(ctx, req)
+}
+
+// RequestPasswordReset calls user.v1.UserService.RequestPasswordReset.
+func (c *userServiceClient) RequestPasswordReset(ctx context.Context, req *connect.Request[v1.RequestPasswordResetRequest]) (*connect.Response[v1.RequestPasswordResetResponse], error) {
+	return c.requestPasswordReset.CallUnary(ctx, req)
+}
+
+// ResetPassword calls user.v1.UserService.ResetPassword.
+func (c *userServiceClient) ResetPassword(ctx context.Context, req *connect.Request[v1.ResetPasswordRequest]) (*connect.Response[v1.ResetPasswordResponse], error) {
+	return c.resetPassword.CallUnary(ctx, req)
+}
+
+// Logout calls user.v1.UserService.Logout.
+func (c *userServiceClient) Logout(ctx context.Context, req *connect.Request[v1.LogoutRequest]) (*connect.Response[v1.LogoutResponse], error) {
+	return c.logout.CallUnary(ctx, req)
+}
+
+// RefreshToken calls user.v1.UserService.RefreshToken.
+func (c *userServiceClient) RefreshToken(ctx context.Context, req *connect.Request[v1.RefreshTokenRequest]) (*connect.Response[v1.RefreshTokenResponse], error) {
+	return c.refreshToken.CallUnary(ctx, req)
+}
+
+// GetProfile calls user.v1.UserService.GetProfile.
+func (c *userServiceClient) GetProfile(ctx context.Context, req *connect.Request[v1.GetProfileRequest]) (*connect.Response[v1.GetProfileResponse], error) {
+	return c.getProfile.CallUnary(ctx, req)
+}
+
+// UpdateProfile calls user.v1.UserService.UpdateProfile.
+func (c *userServiceClient) UpdateProfile(ctx context.Context, req *connect.Request[v1.UpdateProfileRequest]) (*connect.Response[v1.UpdateProfileResponse], error) {
+	return c.updateProfile.CallUnary(ctx, req)
+}
+
+// ChangePassword calls user.v1.UserService.ChangePassword.
+func (c *userServiceClient) ChangePassword(ctx context.Context, req *connect.Request[v1.ChangePasswordRequest]) (*connect.Response[v1.ChangePasswordResponse], error) {
+	return c.changePassword.CallUnary(ctx, req)
+}
+
+// ChangeEmail calls user.v1.UserService.ChangeEmail.
+func (c *userServiceClient) ChangeEmail(ctx context.Context, req *connect.Request[v1.ChangeEmailRequest]) (*connect.Response[v1.ChangeEmailResponse], error) {
+	return c.changeEmail.CallUnary(ctx, req)
+}
+
+// DeleteAccount calls user.v1.UserService.DeleteAccount.
+func (c *userServiceClient) DeleteAccount(ctx context.Context, req *connect.Request[v1.DeleteAccountRequest]) (*connect.Response[v1.DeleteAccountResponse], error) {
+	return c.deleteAccount.CallUnary(ctx, req)
+}
+
+// ListSessions calls user.v1.UserService.ListSessions.
+func (c *userServiceClient) ListSessions(ctx context.Context, req *connect.Request[v1.ListSessionsRequest]) (*connect.Response[v1.ListSessionsResponse], error) {
+	return c.listSessions.CallUnary(ctx, req)
+}
+
+// RevokeSession calls user.v1.UserService.RevokeSession.
+func (c *userServiceClient) RevokeSession(ctx context.Context, req *connect.Request[v1.RevokeSessionRequest]) (*connect.Response[v1.RevokeSessionResponse], error) {
+	return c.revokeSession.CallUnary(ctx, req)
+}
+
+// LogoutAll calls user.v1.UserService.LogoutAll.
+func (c *userServiceClient) LogoutAll(ctx context.Context, req *connect.Request[v1.LogoutAllRequest]) (*connect.Response[v1.LogoutAllResponse], error) {
+	return c.logoutAll.CallUnary(ctx, req)
+}
+
+// AdminRevokeSession calls user.v1.UserService.AdminRevokeSession.
+func (c *userServiceClient) AdminRevokeSession(ctx context.Context, req *connect.Request[v1.AdminRevokeSessionRequest]) (*connect.Response[v1.AdminRevokeSessionResponse], error) {
+	return c.adminRevokeSession.CallUnary(ctx, req)
+}
+
+// UnlockUser calls user.v1.UserService.UnlockUser.
+func (c *userServiceClient) UnlockUser(ctx context.Context, req *connect.Request[v1.UnlockUserRequest]) (*connect.Response[v1.UnlockUserResponse], error) {
+	return c.unlockUser.CallUnary(ctx, req)
+}
+
+// ListRoles calls user.v1.UserService.ListRoles.
+func (c *userServiceClient) ListRoles(ctx context.Context, req *connect.Request[v1.ListRolesRequest]) (*connect.Response[v1.ListRolesResponse], error) {
+	return c.listRoles.CallUnary(ctx, req)
+}
+
+// CreateRole calls user.v1.UserService.CreateRole.
+func (c *userServiceClient) CreateRole(ctx context.Context, req *connect.Request[v1.CreateRoleRequest]) (*connect.Response[v1.CreateRoleResponse], error) {
+	return c.createRole.CallUnary(ctx, req)
+}
+
+// UpdateRole calls user.v1.UserService.UpdateRole.
+func (c *userServiceClient) UpdateRole(ctx context.Context, req *connect.Request[v1.UpdateRoleRequest]) (*connect.Response[v1.UpdateRoleResponse], error) {
+	return c.updateRole.CallUnary(ctx, req)
+}
+
+// DeleteRole calls user.v1.UserService.DeleteRole.
+func (c *userServiceClient) DeleteRole(ctx context.Context, req *connect.Request[v1.DeleteRoleRequest]) (*connect.Response[v1.DeleteRoleResponse], error) {
+	return c.deleteRole.CallUnary(ctx, req)
+}
+
+// GrantPermission calls user.v1.UserService.GrantPermission.
+func (c *userServiceClient) GrantPermission(ctx context.Context, req *connect.Request[v1.GrantPermissionRequest]) (*connect.Response[v1.GrantPermissionResponse], error) {
+	return c.grantPermission.CallUnary(ctx, req)
+}
+
+// RevokePermission calls user.v1.UserService.RevokePermission.
+func (c *userServiceClient) RevokePermission(ctx context.Context, req *connect.Request[v1.RevokePermissionRequest]) (*connect.Response[v1.RevokePermissionResponse], error) {
+	return c.revokePermission.CallUnary(ctx, req)
+}
+
+// CreateApiKey calls user.v1.UserService.CreateApiKey.
+func (c *userServiceClient) CreateApiKey(ctx context.Context, req *connect.Request[v1.CreateApiKeyRequest]) (*connect.Response[v1.CreateApiKeyResponse], error) {
+	return c.createApiKey.CallUnary(ctx, req)
+}
+
+// ListApiKeys calls user.v1.UserService.ListApiKeys.
+func (c *userServiceClient) ListApiKeys(ctx context.Context, req *connect.Request[v1.ListApiKeysRequest]) (*connect.Response[v1.ListApiKeysResponse], error) {
+	return c.listApiKeys.CallUnary(ctx, req)
+}
+
+// RevokeApiKey calls user.v1.UserService.RevokeApiKey.
+func (c *userServiceClient) RevokeApiKey(ctx context.Context, req *connect.Request[v1.RevokeApiKeyRequest]) (*connect.Response[v1.RevokeApiKeyResponse], error) {
+	return c.revokeApiKey.CallUnary(ctx, req)
+}
+
+// UserServiceHandler is an implementation of the user.v1.UserService service.
+type UserServiceHandler interface {
+	Register(context.Context, *connect.Request[v1.RegisterRequest]) (*connect.Response[v1.RegisterResponse], error)
+	Login(context.Context, *connect.Request[v1.LoginRequest]) (*connect.Response[v1.LoginResponse], error)
+	VerifyLoginTotp(context.Context, *connect.Request[v1.VerifyLoginTotpRequest]) (*connect.Response[v1.VerifyLoginTotpResponse], error)
+	EnrollTotp(context.Context, *connect.Request[v1.EnrollTotpRequest]) (*connect.Response[v1.EnrollTotpResponse], error)
+	ConfirmTotp(context.Context, *connect.Request[v1.ConfirmTotpRequest]) (*connect.Response[v1.ConfirmTotpResponse], error)
+	DisableTotp(context.Context, *connect.Request[v1.DisableTotpRequest]) (*connect.Response[v1.DisableTotpResponse], error)
+	StartOidcLogin(context.Context, *connect.Request[v1.StartOidcLoginRequest]) (*connect.Response[v1.StartOidcLoginResponse], error)
+	CompleteOidcLogin(context.Context, *connect.Request[v1.CompleteOidcLoginRequest]) (*connect.Response[v1.CompleteOidcLoginResponse], error)
+	VerifyEmail(context.Context, *connect.Request[v1.VerifyEmailRequest]) (*connect.Response[v1.VerifyEmailResponse], error)
+	ResendVerificationEmail(context.Context, *connect.Request[v1.ResendVerificationEmailRequest]) (*connect.Response[v1.ResendVerificationEmailResponse], error)
+	RequestPasswordReset(context.Context, *connect.Request[v1.RequestPasswordResetRequest]) (*connect.Response[v1.RequestPasswordResetResponse], error)
+	ResetPassword(context.Context, *connect.Request[v1.ResetPasswordRequest]) (*connect.Response[v1.ResetPasswordResponse], error)
+	Logout(context.Context, *connect.Request[v1.LogoutRequest]) (*connect.Response[v1.LogoutResponse], error)
+	RefreshToken(context.Context, *connect.Request[v1.RefreshTokenRequest]) (*connect.Response[v1.RefreshTokenResponse], error)
+	GetProfile(context.Context, *connect.Request[v1.GetProfileRequest]) (*connect.Response[v1.GetProfileResponse], error)
+	UpdateProfile(context.Context, *connect.Request[v1.UpdateProfileRequest]) (*connect.Response[v1.UpdateProfileResponse], error)
+	ChangePassword(context.Context, *connect.Request[v1.ChangePasswordRequest]) (*connect.Response[v1.ChangePasswordResponse], error)
+	ChangeEmail(context.Context, *connect.Request[v1.ChangeEmailRequest]) (*connect.Response[v1.ChangeEmailResponse], error)
+	DeleteAccount(context.Context, *connect.Request[v1.DeleteAccountRequest]) (*connect.Response[v1.DeleteAccountResponse], error)
+	ListSessions(context.Context, *connect.Request[v1.ListSessionsRequest]) (*connect.Response[v1.ListSessionsResponse], error)
+	RevokeSession(context.Context, *connect.Request[v1.RevokeSessionRequest]) (*connect.Response[v1.RevokeSessionResponse], error)
+	LogoutAll(context.Context, *connect.Request[v1.LogoutAllRequest]) (*connect.Response[v1.LogoutAllResponse], error)
+	AdminRevokeSession(context.Context, *connect.Request[v1.AdminRevokeSessionRequest]) (*connect.Response[v1.AdminRevokeSessionResponse], error)
+	UnlockUser(context.Context, *connect.Request[v1.UnlockUserRequest]) (*connect.Response[v1.UnlockUserResponse], error)
+	ListRoles(context.Context, *connect.Request[v1.ListRolesRequest]) (*connect.Response[v1.ListRolesResponse], error)
+	CreateRole(context.Context, *connect.Request[v1.CreateRoleRequest]) (*connect.Response[v1.CreateRoleResponse], error)
+	UpdateRole(context.Context, *connect.Request[v1.UpdateRoleRequest]) (*connect.Response[v1.UpdateRoleResponse], error)
+	DeleteRole(context.Context, *connect.Request[v1.DeleteRoleRequest]) (*connect.Response[v1.DeleteRoleResponse], error)
+	GrantPermission(context.Context, *connect.Request[v1.GrantPermissionRequest]) (*connect.Response[v1.GrantPermissionResponse], error)
+	RevokePermission(context.Context, *connect.Request[v1.RevokePermissionRequest]) (*connect.Response[v1.RevokePermissionResponse], error)
+	CreateApiKey(context.Context, *connect.Request[v1.CreateApiKeyRequest]) (*connect.Response[v1.CreateApiKeyResponse], error)
+	ListApiKeys(context.Context, *connect.Request[v1.ListApiKeysRequest]) (*connect.Response[v1.ListApiKeysResponse], error)
+	RevokeApiKey(context.Context, *connect.Request[v1.RevokeApiKeyRequest]) (*connect.Response[v1.RevokeApiKeyResponse], error)
+}
+
+// NewUserServiceHandler builds an HTTP handler from the service implementation. It returns the path
+// on which to mount the handler and the handler itself.
+//
+// By default, handlers support the Connect, gRPC, and gRPC-Web protocols with the binary Protobuf
+// and JSON codecs. They also support gzip compression.
+func NewUserServiceHandler(svc UserServiceHandler, opts ...connect.HandlerOption) (string, http.Handler) {
+	userServiceMethods := v1.File_user_v1_user_proto.Services().ByName("UserService").Methods()
+	userServiceRegisterHandler := connect.NewUnaryHandler(
+		UserServiceRegisterProcedure,
+		svc.Register,
+		connect.WithSchema(userServiceMethods.ByName("Register")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceLoginHandler := connect.NewUnaryHandler(
+		UserServiceLoginProcedure,
+		svc.Login,
+		connect.WithSchema(userServiceMethods.ByName("Login")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceVerifyLoginTotpHandler := connect.NewUnaryHandler(
+		UserServiceVerifyLoginTotpProcedure,
+		svc.VerifyLoginTotp,
+		connect.WithSchema(userServiceMethods.ByName("VerifyLoginTotp")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceEnrollTotpHandler := connect.NewUnaryHandler(
+		UserServiceEnrollTotpProcedure,
+		svc.EnrollTotp,
+		connect.WithSchema(userServiceMethods.ByName("EnrollTotp")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceConfirmTotpHandler := connect.NewUnaryHandler(
+		UserServiceConfirmTotpProcedure,
+		svc.ConfirmTotp,
+		connect.WithSchema(userServiceMethods.ByName("ConfirmTotp")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceDisableTotpHandler := connect.NewUnaryHandler(
+		UserServiceDisableTotpProcedure,
+		svc.DisableTotp,
+		connect.WithSchema(userServiceMethods.ByName("DisableTotp")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceStartOidcLoginHandler := connect.NewUnaryHandler(
+		UserServiceStartOidcLoginProcedure,
+		svc.StartOidcLogin,
+		connect.WithSchema(userServiceMethods.ByName("StartOidcLogin")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceCompleteOidcLoginHandler := connect.NewUnaryHandler(
+		UserServiceCompleteOidcLoginProcedure,
+		svc.CompleteOidcLogin,
+		connect.WithSchema(userServiceMethods.ByName("CompleteOidcLogin")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceVerifyEmailHandler := connect.NewUnaryHandler(
+		UserServiceVerifyEmailProcedure,
+		svc.VerifyEmail,
+		connect.WithSchema(userServiceMethods.ByName("VerifyEmail")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceResendVerificationEmailHandler := connect.NewUnaryHandler(
+		UserServiceResendVerificationEmailProcedure,
+		svc.ResendVerificationEmail,
+		connect.WithSchema(userServiceMethods.ByName("ResendVerificationEmail")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceRequestPasswordResetHandler := connect.NewUnaryHandler(
+		UserServiceRequestPasswordResetProcedure,
+		svc.RequestPasswordReset,
+		connect.WithSchema(userServiceMethods.ByName("RequestPasswordReset")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceResetPasswordHandler := connect.NewUnaryHandler(
+		UserServiceResetPasswordProcedure,
+		svc.ResetPassword,
+		connect.WithSchema(userServiceMethods.ByName("ResetPassword")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceLogoutHandler := connect.NewUnaryHandler(
+		UserServiceLogoutProcedure,
+		svc.Logout,
+		connect.WithSchema(userServiceMethods.ByName("Logout")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceRefreshTokenHandler := connect.NewUnaryHandler(
+		UserServiceRefreshTokenProcedure,
+		svc.RefreshToken,
+		connect.WithSchema(userServiceMethods.ByName("RefreshToken")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceGetProfileHandler := connect.NewUnaryHandler(
+		UserServiceGetProfileProcedure,
+		svc.GetProfile,
+		connect.WithSchema(userServiceMethods.ByName("GetProfile")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceUpdateProfileHandler := connect.NewUnaryHandler(
+		UserServiceUpdateProfileProcedure,
+		svc.UpdateProfile,
+		connect.WithSchema(userServiceMethods.ByName("UpdateProfile")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceChangePasswordHandler := connect.NewUnaryHandler(
+		UserServiceChangePasswordProcedure,
+		svc.ChangePassword,
+		connect.WithSchema(userServiceMethods.ByName("ChangePassword")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceChangeEmailHandler := connect.NewUnaryHandler(
+		UserServiceChangeEmailProcedure,
+		svc.ChangeEmail,
+		connect.WithSchema(userServiceMethods.ByName("ChangeEmail")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceDeleteAccountHandler := connect.NewUnaryHandler(
+		UserServiceDeleteAccountProcedure,
+		svc.DeleteAccount,
+		connect.WithSchema(userServiceMethods.ByName("DeleteAccount")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceListSessionsHandler := connect.NewUnaryHandler(
+		UserServiceListSessionsProcedure,
+		svc.ListSessions,
+		connect.WithSchema(userServiceMethods.ByName("ListSessions")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceRevokeSessionHandler := connect.NewUnaryHandler(
+		UserServiceRevokeSessionProcedure,
+		svc.RevokeSession,
+		connect.WithSchema(userServiceMethods.ByName("RevokeSession")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceLogoutAllHandler := connect.NewUnaryHandler(
+		UserServiceLogoutAllProcedure,
+		svc.LogoutAll,
+		connect.WithSchema(userServiceMethods.ByName("LogoutAll")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceAdminRevokeSessionHandler := connect.NewUnaryHandler(
+		UserServiceAdminRevokeSessionProcedure,
+		svc.AdminRevokeSession,
+		connect.WithSchema(userServiceMethods.ByName("AdminRevokeSession")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceUnlockUserHandler := connect.NewUnaryHandler(
+		UserServiceUnlockUserProcedure,
+		svc.UnlockUser,
+		connect.WithSchema(userServiceMethods.ByName("UnlockUser")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceListRolesHandler := connect.NewUnaryHandler(
+		UserServiceListRolesProcedure,
+		svc.ListRoles,
+		connect.WithSchema(userServiceMethods.ByName("ListRoles")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceCreateRoleHandler := connect.NewUnaryHandler(
+		UserServiceCreateRoleProcedure,
+		svc.CreateRole,
+		connect.WithSchema(userServiceMethods.ByName("CreateRole")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceUpdateRoleHandler := connect.NewUnaryHandler(
+		UserServiceUpdateRoleProcedure,
+		svc.UpdateRole,
+		connect.WithSchema(userServiceMethods.ByName("UpdateRole")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceDeleteRoleHandler := connect.NewUnaryHandler(
+		UserServiceDeleteRoleProcedure,
+		svc.DeleteRole,
+		connect.WithSchema(userServiceMethods.ByName("DeleteRole")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceGrantPermissionHandler := connect.NewUnaryHandler(
+		UserServiceGrantPermissionProcedure,
+		svc.GrantPermission,
+		connect.WithSchema(userServiceMethods.ByName("GrantPermission")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceRevokePermissionHandler := connect.NewUnaryHandler(
+		UserServiceRevokePermissionProcedure,
+		svc.RevokePermission,
+		connect.WithSchema(userServiceMethods.ByName("RevokePermission")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceCreateApiKeyHandler := connect.NewUnaryHandler(
+		UserServiceCreateApiKeyProcedure,
+		svc.CreateApiKey,
+		connect.WithSchema(userServiceMethods.ByName("CreateApiKey")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceListApiKeysHandler := connect.NewUnaryHandler(
+		UserServiceListApiKeysProcedure,
+		svc.ListApiKeys,
+		connect.WithSchema(userServiceMethods.ByName("ListApiKeys")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceRevokeApiKeyHandler := connect.NewUnaryHandler(
+		UserServiceRevokeApiKeyProcedure,
+		svc.RevokeApiKey,
+		connect.WithSchema(userServiceMethods.ByName("RevokeApiKey")),
+		connect.WithHandlerOptions(opts...),
+	)
+	return "/user.v1.UserService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case UserServiceRegisterProcedure:
+			userServiceRegisterHandler.ServeHTTP(w, r)
+		case UserServiceLoginProcedure:
+			userServiceLoginHandler.ServeHTTP(w, r)
+		case UserServiceVerifyLoginTotpProcedure:
+			userServiceVerifyLoginTotpHandler.ServeHTTP(w, r)
+		case UserServiceEnrollTotpProcedure:
+			userServiceEnrollTotpHandler.ServeHTTP(w, r)
+		case UserServiceConfirmTotpProcedure:
+			userServiceConfirmTotpHandler.ServeHTTP(w, r)
+		case UserServiceDisableTotpProcedure:
+			userServiceDisableTotpHandler.ServeHTTP(w, r)
+		case UserServiceStartOidcLoginProcedure:
+			userServiceStartOidcLoginHandler.ServeHTTP(w, r)
+		case UserServiceCompleteOidcLoginProcedure:
+			userServiceCompleteOidcLoginHandler.ServeHTTP(w, r)
+		case UserServiceVerifyEmailProcedure:
+			userServiceVerifyEmailHandler.ServeHTTP(w, r)
+		case UserServiceResendVerificationEmailProcedure:
+			userServiceResendVerificationEmailHandler.ServeHTTP(w, r)
+		case UserServiceRequestPasswordResetProcedure:
+			userServiceRequestPasswordResetHandler.ServeHTTP(w, r)
+		case UserServiceResetPasswordProcedure:
+			userServiceResetPasswordHandler.ServeHTTP(w, r)
+		case UserServiceLogoutProcedure:
+			userServiceLogoutHandler.ServeHTTP(w, r)
+		case UserServiceRefreshTokenProcedure:
+			userServiceRefreshTokenHandler.ServeHTTP(w, r)
+		case UserServiceGetProfileProcedure:
+			userServiceGetProfileHandler.ServeHTTP(w, r)
+		case UserServiceUpdateProfileProcedure:
+			userServiceUpdateProfileHandler.ServeHTTP(w, r)
+		case UserServiceChangePasswordProcedure:
+			userServiceChangePasswordHandler.ServeHTTP(w, r)
+		case UserServiceChangeEmailProcedure:
+			userServiceChangeEmailHandler.ServeHTTP(w, r)
+		case UserServiceDeleteAccountProcedure:
+			userServiceDeleteAccountHandler.ServeHTTP(w, r)
+		case UserServiceListSessionsProcedure:
+			userServiceListSessionsHandler.ServeHTTP(w, r)
+		case UserServiceRevokeSessionProcedure:
+			userServiceRevokeSessionHandler.ServeHTTP(w, r)
+		case UserServiceLogoutAllProcedure:
+			userServiceLogoutAllHandler.ServeHTTP(w, r)
+		case UserServiceAdminRevokeSessionProcedure:
+			userServiceAdminRevokeSessionHandler.ServeHTTP(w, r)
+		case UserServiceUnlockUserProcedure:
+			userServiceUnlockUserHandler.ServeHTTP(w, r)
+		case UserServiceListRolesProcedure:
+			userServiceListRolesHandler.ServeHTTP(w, r)
+		case UserServiceCreateRoleProcedure:
+			userServiceCreateRoleHandler.ServeHTTP(w, r)
+		case UserServiceUpdateRoleProcedure:
+			userServiceUpdateRoleHandler.ServeHTTP(w, r)
+		case UserServiceDeleteRoleProcedure:
+			userServiceDeleteRoleHandler.ServeHTTP(w, r)
+		case UserServiceGrantPermissionProcedure:
+			userServiceGrantPermissionHandler.ServeHTTP(w, r)
+		case UserServiceRevokePermissionProcedure:
+			userServiceRevokePermissionHandler.ServeHTTP(w, r)
+		case UserServiceCreateApiKeyProcedure:
+			userServiceCreateApiKeyHandler.ServeHTTP(w, r)
+		case UserServiceListApiKeysProcedure:
+			userServiceListApiKeysHandler.ServeHTTP(w, r)
+		case UserServiceRevokeApiKeyProcedure:
+			userServiceRevokeApiKeyHandler.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// UnimplementedUserServiceHandler returns CodeUnimplemented from all methods.
+type UnimplementedUserServiceHandler struct{}
+
+func (UnimplementedUserServiceHandler) Register(context.Context, *connect.Request[v1.RegisterRequest]) (*connect.Response[v1.RegisterResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.Register is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) Login(context.Context, *connect.Request[v1.LoginRequest]) (*connect.Response[v1.LoginResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.Login is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) VerifyLoginTotp(context.Context, *connect.Request[v1.VerifyLoginTotpRequest]) (*connect.Response[v1.VerifyLoginTotpResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.VerifyLoginTotp is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) EnrollTotp(context.Context, *connect.Request[v1.EnrollTotpRequest]) (*connect.Response[v1.EnrollTotpResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.EnrollTotp is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) ConfirmTotp(context.Context, *connect.Request[v1.ConfirmTotpRequest]) (*connect.Response[v1.ConfirmTotpResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.ConfirmTotp is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) DisableTotp(context.Context, *connect.Request[v1.DisableTotpRequest]) (*connect.Response[v1.DisableTotpResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.DisableTotp is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) StartOidcLogin(context.Context, *connect.Request[v1.StartOidcLoginRequest]) (*connect.Response[v1.StartOidcLoginResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.StartOidcLogin is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) CompleteOidcLogin(context.Context, *connect.Request[v1.CompleteOidcLoginRequest]) (*connect.Response[v1.CompleteOidcLoginResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.CompleteOidcLogin is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) VerifyEmail(context.Context, *connect.Request[v1.VerifyEmailRequest]) (*connect.Response[v1.VerifyEmailResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.VerifyEmail is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) ResendVerificationEmail(context.Context, *connect.Request[v1.ResendVerificationEmailRequest]) (*connect.Response[v1.ResendVerificationEmailResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.ResendVerificationEmail is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) RequestPasswordReset(context.Context, *connect.Request[v1.RequestPasswordResetRequest]) (*connect.Response[v1.RequestPasswordResetResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.RequestPasswordReset is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) ResetPassword(context.Context, *connect.Request[v1.ResetPasswordRequest]) (*connect.Response[v1.ResetPasswordResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.ResetPassword is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) Logout(context.Context, *connect.Request[v1.LogoutRequest]) (*connect.Response[v1.LogoutResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.Logout is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) RefreshToken(context.Context, *connect.Request[v1.RefreshTokenRequest]) (*connect.Response[v1.RefreshTokenResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.RefreshToken is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) GetProfile(context.Context, *connect.Request[v1.GetProfileRequest]) (*connect.Response[v1.GetProfileResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.GetProfile is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) UpdateProfile(context.Context, *connect.Request[v1.UpdateProfileRequest]) (*connect.Response[v1.UpdateProfileResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.UpdateProfile is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) ChangePassword(context.Context, *connect.Request[v1.ChangePasswordRequest]) (*connect.Response[v1.ChangePasswordResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.ChangePassword is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) ChangeEmail(context.Context, *connect.Request[v1.ChangeEmailRequest]) (*connect.Response[v1.ChangeEmailResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.ChangeEmail is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) DeleteAccount(context.Context, *connect.Request[v1.DeleteAccountRequest]) (*connect.Response[v1.DeleteAccountResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.DeleteAccount is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) ListSessions(context.Context, *connect.Request[v1.ListSessionsRequest]) (*connect.Response[v1.ListSessionsResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.ListSessions is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) RevokeSession(context.Context, *connect.Request[v1.RevokeSessionRequest]) (*connect.Response[v1.RevokeSessionResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.RevokeSession is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) LogoutAll(context.Context, *connect.Request[v1.LogoutAllRequest]) (*connect.Response[v1.LogoutAllResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.LogoutAll is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) AdminRevokeSession(context.Context, *connect.Request[v1.AdminRevokeSessionRequest]) (*connect.Response[v1.AdminRevokeSessionResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.AdminRevokeSession is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) UnlockUser(context.Context, *connect.Request[v1.UnlockUserRequest]) (*connect.Response[v1.UnlockUserResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.UnlockUser is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) ListRoles(context.Context, *connect.Request[v1.ListRolesRequest]) (*connect.Response[v1.ListRolesResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.ListRoles is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) CreateRole(context.Context, *connect.Request[v1.CreateRoleRequest]) (*connect.Response[v1.CreateRoleResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.CreateRole is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) UpdateRole(context.Context, *connect.Request[v1.UpdateRoleRequest]) (*connect.Response[v1.UpdateRoleResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.UpdateRole is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) DeleteRole(context.Context, *connect.Request[v1.DeleteRoleRequest]) (*connect.Response[v1.DeleteRoleResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.DeleteRole is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) GrantPermission(context.Context, *connect.Request[v1.GrantPermissionRequest]) (*connect.Response[v1.GrantPermissionResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.GrantPermission is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) RevokePermission(context.Context, *connect.Request[v1.RevokePermissionRequest]) (*connect.Response[v1.RevokePermissionResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.RevokePermission is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) CreateApiKey(context.Context, *connect.Request[v1.CreateApiKeyRequest]) (*connect.Response[v1.CreateApiKeyResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.CreateApiKey is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) ListApiKeys(context.Context, *connect.Request[v1.ListApiKeysRequest]) (*connect.Response[v1.ListApiKeysResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.ListApiKeys is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) RevokeApiKey(context.Context, *connect.Request[v1.RevokeApiKeyRequest]) (*connect.Response[v1.RevokeApiKeyResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.v1.UserService.RevokeApiKey is not implemented"))
+}
@@ -2,12 +2,16 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"connectrpc.com/connect"
 	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/jwt"
 	"gitlab.com/gitops-poc-dzha/user-service/internal/repository/mongodb"
 	"gitlab.com/gitops-poc-dzha/user-service/internal/service"
 
@@ -43,6 +47,14 @@ func (s *UserServiceServer) Register(ctx context.Context, req *connect.Request[u
 			log.Printf("[DEBUG] Register failed: user already exists (email=%s)", req.Msg.Email)
 			return nil, connect.NewError(connect.CodeAlreadyExists, errors.New("user with this email already exists"))
 		}
+		if errors.Is(err, service.ErrInvalidEmail) {
+			log.Printf("[DEBUG] Register failed: invalid email (email=%s)", req.Msg.Email)
+			return nil, connect.NewError(connect.CodeInvalidArgument, err)
+		}
+		if errors.Is(err, service.ErrWeakPassword) {
+			log.Printf("[DEBUG] Register failed: weak password (email=%s)", req.Msg.Email)
+			return nil, connect.NewError(connect.CodeInvalidArgument, err)
+		}
 		log.Printf("[DEBUG] Register failed: %v", err)
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("failed to register: %w", err))
 	}
@@ -66,24 +78,229 @@ func (s *UserServiceServer) Login(ctx context.Context, req *connect.Request[user
 		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("email and password are required"))
 	}
 
-	userID, tokens, err := s.svc.Login(ctx, req.Msg.Email, req.Msg.Password)
+	login, err := s.svc.Login(ctx, req.Msg.Email, req.Msg.Password)
 	if err != nil {
 		if errors.Is(err, service.ErrInvalidCredentials) {
 			log.Printf("[DEBUG] Login failed: invalid credentials (email=%s)", req.Msg.Email)
 			return nil, connect.NewError(connect.CodeUnauthenticated, errors.New("invalid email or password"))
 		}
+		if errors.Is(err, service.ErrAccountDisabled) {
+			log.Printf("[WARN] Login rejected: account disabled (email=%s)", req.Msg.Email)
+			return nil, connect.NewError(connect.CodePermissionDenied, errors.New("account is disabled"))
+		}
+		// the client isn't told about the lockout, that would confirm the account exists;
+		// admins see it in the user details
+		var locked *service.LockedError
+		if errors.As(err, &locked) {
+			log.Printf("[WARN] Login rejected: account locked until %s (email=%s)", locked.Until.Format(time.RFC3339), req.Msg.Email)
+			return nil, connect.NewError(connect.CodeUnauthenticated, errors.New("invalid email or password"))
+		}
 		log.Printf("[DEBUG] Login failed: %v", err)
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("failed to login: %w", err))
 	}
 
-	log.Printf("[DEBUG] Login success: userID=%s", userID)
-	return connect.NewResponse(&userv1.LoginResponse{
-		UserId:       userID,
-		AccessToken:  tokens.AccessToken,
-		RefreshToken: tokens.RefreshToken,
+	resp := &userv1.LoginResponse{UserId: login.UserID}
+	if login.Tokens == nil {
+		log.Printf("[DEBUG] Login needs TOTP: userID=%s, enrollment=%v", login.UserID, login.EnrollmentRequired)
+		resp.MfaRequired = true
+		resp.ChallengeToken = login.Challenge
+		resp.TotpEnrollmentRequired = login.EnrollmentRequired
+		return connect.NewResponse(resp), nil
+	}
+
+	log.Printf("[DEBUG] Login success: userID=%s", login.UserID)
+	resp.AccessToken = login.Tokens.AccessToken
+	resp.RefreshToken = login.Tokens.RefreshToken
+	return connect.NewResponse(resp), nil
+}
+
+func (s *UserServiceServer) VerifyLoginTotp(ctx context.Context, req *connect.Request[userv1.VerifyLoginTotpRequest]) (*connect.Response[userv1.VerifyLoginTotpResponse], error) {
+	if req.Msg.ChallengeToken == "" || req.Msg.Code == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("challenge_token and code are required"))
+	}
+
+	login, err := s.svc.VerifyLoginTOTP(ctx, req.Msg.ChallengeToken, req.Msg.Code)
+	if err != nil {
+		log.Printf("[WARN] VerifyLoginTotp failed: %v", err)
+		return nil, totpError(err, "failed to verify TOTP")
+	}
+
+	log.Printf("[INFO] VerifyLoginTotp success: userID=%s", login.UserID)
+	return connect.NewResponse(&userv1.VerifyLoginTotpResponse{
+		UserId:       login.UserID,
+		AccessToken:  login.Tokens.AccessToken,
+		RefreshToken: login.Tokens.RefreshToken,
+	}), nil
+}
+
+func (s *UserServiceServer) EnrollTotp(ctx context.Context, req *connect.Request[userv1.EnrollTotpRequest]) (*connect.Response[userv1.EnrollTotpResponse], error) {
+	// set by auth-adapter for a valid session only, otherwise the challenge identifies the user
+	userID := req.Header().Get("user-id")
+	if userID == "" && req.Msg.ChallengeToken == "" {
+		return nil, connect.NewError(connect.CodeUnauthenticated, errors.New("session or challenge_token required"))
+	}
+
+	secret, otpauthURL, err := s.svc.EnrollTOTP(ctx, userID, req.Msg.ChallengeToken)
+	if err != nil {
+		log.Printf("[DEBUG] EnrollTotp failed: %v", err)
+		return nil, totpError(err, "failed to enroll TOTP")
+	}
+
+	return connect.NewResponse(&userv1.EnrollTotpResponse{
+		Secret:     secret,
+		OtpauthUrl: otpauthURL,
 	}), nil
 }
 
+func (s *UserServiceServer) ConfirmTotp(ctx context.Context, req *connect.Request[userv1.ConfirmTotpRequest]) (*connect.Response[userv1.ConfirmTotpResponse], error) {
+	userID := req.Header().Get("user-id")
+	if userID == "" && req.Msg.ChallengeToken == "" {
+		return nil, connect.NewError(connect.CodeUnauthenticated, errors.New("session or challenge_token required"))
+	}
+	if req.Msg.Code == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("code is required"))
+	}
+
+	enrollment, err := s.svc.ConfirmTOTP(ctx, userID, req.Msg.ChallengeToken, req.Msg.Code)
+	if err != nil {
+		log.Printf("[WARN] ConfirmTotp failed: %v", err)
+		return nil, totpError(err, "failed to confirm TOTP")
+	}
+
+	resp := &userv1.ConfirmTotpResponse{RecoveryCodes: enrollment.RecoveryCodes}
+	if enrollment.Login != nil {
+		userID = enrollment.Login.UserID
+		resp.UserId = userID
+		resp.AccessToken = enrollment.Login.Tokens.AccessToken
+		resp.RefreshToken = enrollment.Login.Tokens.RefreshToken
+	}
+
+	log.Printf("[INFO] ConfirmTotp: TOTP enabled, userID=%s", userID)
+	return connect.NewResponse(resp), nil
+}
+
+func (s *UserServiceServer) DisableTotp(ctx context.Context, req *connect.Request[userv1.DisableTotpRequest]) (*connect.Response[userv1.DisableTotpResponse], error) {
+	userID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.Msg.Code == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("code is required"))
+	}
+
+	if err := s.svc.DisableTOTP(ctx, userID, req.Msg.Code); err != nil {
+		log.Printf("[WARN] DisableTotp failed: userID=%s: %v", userID, err)
+		return nil, totpError(err, "failed to disable TOTP")
+	}
+
+	log.Printf("[INFO] DisableTotp: TOTP disabled, userID=%s", userID)
+	return connect.NewResponse(&userv1.DisableTotpResponse{}), nil
+}
+
+func (s *UserServiceServer) StartOidcLogin(ctx context.Context, req *connect.Request[userv1.StartOidcLoginRequest]) (*connect.Response[userv1.StartOidcLoginResponse], error) {
+	if req.Msg.Provider == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("provider is required"))
+	}
+
+	// set by auth-adapter for a valid session only, the identity is linked to that user
+	userID := req.Header().Get("user-id")
+
+	start, err := s.svc.StartOIDCLogin(ctx, req.Msg.Provider, userID)
+	if err != nil {
+		log.Printf("[DEBUG] StartOidcLogin failed: provider=%s: %v", req.Msg.Provider, err)
+		return nil, oidcError(err, "failed to start OIDC login")
+	}
+
+	log.Printf("[DEBUG] StartOidcLogin: provider=%s, linkTo=%s", req.Msg.Provider, userID)
+	return connect.NewResponse(&userv1.StartOidcLoginResponse{
+		AuthorizationUrl: start.AuthURL,
+		State:            start.State,
+		Binding:          start.Binding,
+	}), nil
+}
+
+func (s *UserServiceServer) CompleteOidcLogin(ctx context.Context, req *connect.Request[userv1.CompleteOidcLoginRequest]) (*connect.Response[userv1.CompleteOidcLoginResponse], error) {
+	if req.Msg.State == "" || req.Msg.Code == "" || req.Msg.Binding == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("state, binding and code are required"))
+	}
+
+	login, err := s.svc.CompleteOIDCLogin(ctx, req.Msg.State, req.Msg.Binding, req.Msg.Code)
+	if err != nil {
+		log.Printf("[WARN] CompleteOidcLogin failed: %v", err)
+		return nil, oidcError(err, "failed to complete OIDC login")
+	}
+
+	resp := &userv1.CompleteOidcLoginResponse{UserId: login.UserID, NewUser: login.NewUser}
+	if login.Tokens == nil {
+		log.Printf("[INFO] CompleteOidcLogin needs TOTP: userID=%s, enrollment=%v", login.UserID, login.EnrollmentRequired)
+		resp.MfaRequired = true
+		resp.ChallengeToken = login.Challenge
+		resp.TotpEnrollmentRequired = login.EnrollmentRequired
+		return connect.NewResponse(resp), nil
+	}
+
+	log.Printf("[INFO] CompleteOidcLogin success: userID=%s, newUser=%v", login.UserID, login.NewUser)
+	resp.AccessToken = login.Tokens.AccessToken
+	resp.RefreshToken = login.Tokens.RefreshToken
+	return connect.NewResponse(resp), nil
+}
+
+func (s *UserServiceServer) VerifyEmail(ctx context.Context, req *connect.Request[userv1.VerifyEmailRequest]) (*connect.Response[userv1.VerifyEmailResponse], error) {
+	if req.Msg.Token == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("token is required"))
+	}
+
+	userID, err := s.svc.VerifyEmail(ctx, req.Msg.Token)
+	if err != nil {
+		log.Printf("[DEBUG] VerifyEmail failed: %v", err)
+		return nil, accountError(err, "failed to verify email")
+	}
+
+	log.Printf("[INFO] Email verified: userID=%s", userID)
+	return connect.NewResponse(&userv1.VerifyEmailResponse{UserId: userID}), nil
+}
+
+func (s *UserServiceServer) ResendVerificationEmail(ctx context.Context, req *connect.Request[userv1.ResendVerificationEmailRequest]) (*connect.Response[userv1.ResendVerificationEmailResponse], error) {
+	userID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.svc.RequestEmailVerification(ctx, userID); err != nil {
+		log.Printf("[WARN] ResendVerificationEmail failed: userID=%s: %v", userID, err)
+		return nil, accountError(err, "failed to send verification email")
+	}
+
+	return connect.NewResponse(&userv1.ResendVerificationEmailResponse{}), nil
+}
+
+func (s *UserServiceServer) RequestPasswordReset(ctx context.Context, req *connect.Request[userv1.RequestPasswordResetRequest]) (*connect.Response[userv1.RequestPasswordResetResponse], error) {
+	if req.Msg.Email == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("email is required"))
+	}
+
+	if err := s.svc.RequestPasswordReset(ctx, req.Msg.Email); err != nil {
+		log.Printf("[WARN] RequestPasswordReset failed: email=%s: %v", req.Msg.Email, err)
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("failed to request password reset: %w", err))
+	}
+
+	return connect.NewResponse(&userv1.RequestPasswordResetResponse{}), nil
+}
+
+func (s *UserServiceServer) ResetPassword(ctx context.Context, req *connect.Request[userv1.ResetPasswordRequest]) (*connect.Response[userv1.ResetPasswordResponse], error) {
+	if req.Msg.Token == "" || req.Msg.NewPassword == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("token and new_password are required"))
+	}
+
+	if err := s.svc.ResetPassword(ctx, req.Msg.Token, req.Msg.NewPassword); err != nil {
+		log.Printf("[WARN] ResetPassword failed: %v", err)
+		return nil, accountError(err, "failed to reset password")
+	}
+
+	log.Printf("[INFO] Password reset")
+	return connect.NewResponse(&userv1.ResetPasswordResponse{}), nil
+}
+
 func (s *UserServiceServer) Logout(ctx context.Context, req *connect.Request[userv1.LogoutRequest]) (*connect.Response[userv1.LogoutResponse], error) {
 	userID, err := getUserIDFromRequest(req)
 	if err != nil {
@@ -109,7 +326,14 @@ func (s *UserServiceServer) RefreshToken(ctx context.Context, req *connect.Reque
 
 	tokens, err := s.svc.RefreshToken(ctx, req.Msg.RefreshToken)
 	if err != nil {
-		if errors.Is(err, mongodb.ErrRefreshTokenNotFound) || errors.Is(err, mongodb.ErrRefreshTokenExpired) {
+		if errors.Is(err, mongodb.ErrRefreshTokenReused) {
+			log.Printf("[WARN] RefreshToken reuse detected, session revoked")
+		}
+		if errors.Is(err, service.ErrAccountDisabled) {
+			return nil, connect.NewError(connect.CodePermissionDenied, errors.New("account is disabled"))
+		}
+		if errors.Is(err, mongodb.ErrRefreshTokenNotFound) || errors.Is(err, mongodb.ErrRefreshTokenExpired) ||
+			errors.Is(err, mongodb.ErrRefreshTokenReused) {
 			return nil, connect.NewError(connect.CodeUnauthenticated, errors.New("invalid or expired refresh token"))
 		}
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("failed to refresh token: %w", err))
@@ -135,12 +359,357 @@ func (s *UserServiceServer) GetProfile(ctx context.Context, req *connect.Request
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("failed to get profile: %w", err))
 	}
 
-	return connect.NewResponse(&userv1.GetProfileResponse{
-		UserId:   user.ID.Hex(),
-		Email:    user.Email,
-		Username: user.Username,
-		Roles:    user.Roles,
-	}), nil
+	return connect.NewResponse(profileToProto(user)), nil
+}
+
+func (s *UserServiceServer) UpdateProfile(ctx context.Context, req *connect.Request[userv1.UpdateProfileRequest]) (*connect.Response[userv1.UpdateProfileResponse], error) {
+	userID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(req.Msg.Username) == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("username is required"))
+	}
+
+	user, err := s.svc.UpdateProfile(ctx, userID, req.Msg.Username)
+	if err != nil {
+		return nil, accountError(err, "failed to update profile")
+	}
+
+	log.Printf("[INFO] Profile updated: userID=%s", userID)
+	return connect.NewResponse(&userv1.UpdateProfileResponse{Profile: profileToProto(user)}), nil
+}
+
+func (s *UserServiceServer) ChangePassword(ctx context.Context, req *connect.Request[userv1.ChangePasswordRequest]) (*connect.Response[userv1.ChangePasswordResponse], error) {
+	userID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Msg.NewPassword == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("new_password is required"))
+	}
+
+	if err := s.svc.ChangePassword(ctx, userID, req.Header().Get("session-id"), req.Msg.CurrentPassword, req.Msg.NewPassword); err != nil {
+		log.Printf("[WARN] ChangePassword failed: userID=%s: %v", userID, err)
+		return nil, accountError(err, "failed to change password")
+	}
+
+	log.Printf("[INFO] Password changed, sessions revoked: userID=%s", userID)
+	return connect.NewResponse(&userv1.ChangePasswordResponse{}), nil
+}
+
+func (s *UserServiceServer) ChangeEmail(ctx context.Context, req *connect.Request[userv1.ChangeEmailRequest]) (*connect.Response[userv1.ChangeEmailResponse], error) {
+	userID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Msg.NewEmail == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("new_email is required"))
+	}
+
+	if err := s.svc.ChangeEmail(ctx, userID, req.Header().Get("session-id"), req.Msg.Password, req.Msg.NewEmail); err != nil {
+		log.Printf("[WARN] ChangeEmail failed: userID=%s: %v", userID, err)
+		return nil, accountError(err, "failed to change email")
+	}
+
+	log.Printf("[INFO] Email changed: userID=%s", userID)
+	return connect.NewResponse(&userv1.ChangeEmailResponse{}), nil
+}
+
+func (s *UserServiceServer) DeleteAccount(ctx context.Context, req *connect.Request[userv1.DeleteAccountRequest]) (*connect.Response[userv1.DeleteAccountResponse], error) {
+	userID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.svc.DeleteAccount(ctx, userID, req.Header().Get("session-id"), req.Msg.Password); err != nil {
+		log.Printf("[WARN] DeleteAccount failed: userID=%s: %v", userID, err)
+		return nil, accountError(err, "failed to delete account")
+	}
+
+	log.Printf("[INFO] Account deleted: userID=%s", userID)
+	return connect.NewResponse(&userv1.DeleteAccountResponse{}), nil
+}
+
+func (s *UserServiceServer) LogoutAll(ctx context.Context, req *connect.Request[userv1.LogoutAllRequest]) (*connect.Response[userv1.LogoutAllResponse], error) {
+	userID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := s.svc.LogoutAll(ctx, userID)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			return nil, connect.NewError(connect.CodeNotFound, errors.New("user not found"))
+		}
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("failed to logout: %w", err))
+	}
+
+	log.Printf("[DEBUG] LogoutAll success: userID=%s, sessions=%d", userID, revoked)
+	return connect.NewResponse(&userv1.LogoutAllResponse{RevokedSessions: int32(revoked)}), nil
+}
+
+func (s *UserServiceServer) ListSessions(ctx context.Context, req *connect.Request[userv1.ListSessionsRequest]) (*connect.Response[userv1.ListSessionsResponse], error) {
+	userID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.svc.ListSessions(ctx, userID)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("failed to list sessions: %w", err))
+	}
+
+	current := req.Header().Get("session-id")
+	resp := &userv1.ListSessionsResponse{Sessions: make([]*userv1.Session, 0, len(sessions))}
+	for _, sess := range sessions {
+		resp.Sessions = append(resp.Sessions, &userv1.Session{
+			SessionId:  sess.SessionID,
+			UserAgent:  sess.Device.UserAgent,
+			Ip:         sess.Device.IP,
+			StartedAt:  sess.StartedAt.Unix(),
+			LastUsedAt: sess.LastUsedAt.Unix(),
+			ExpiresAt:  sess.ExpiresAt.Unix(),
+			Current:    sess.SessionID == current,
+		})
+	}
+
+	return connect.NewResponse(resp), nil
+}
+
+func (s *UserServiceServer) RevokeSession(ctx context.Context, req *connect.Request[userv1.RevokeSessionRequest]) (*connect.Response[userv1.RevokeSessionResponse], error) {
+	userID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Msg.SessionId == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("session_id is required"))
+	}
+
+	if err := s.svc.RevokeSession(ctx, userID, req.Msg.SessionId); err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			return nil, connect.NewError(connect.CodeNotFound, errors.New("session not found"))
+		}
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("failed to revoke session: %w", err))
+	}
+
+	log.Printf("[INFO] Session revoked by user: userID=%s, sessionID=%s", userID, req.Msg.SessionId)
+	return connect.NewResponse(&userv1.RevokeSessionResponse{}), nil
+}
+
+func (s *UserServiceServer) AdminRevokeSession(ctx context.Context, req *connect.Request[userv1.AdminRevokeSessionRequest]) (*connect.Response[userv1.AdminRevokeSessionResponse], error) {
+	adminID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Msg.SessionId == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("session_id is required"))
+	}
+
+	if err := s.svc.AdminRevokeSession(ctx, adminID, req.Msg.SessionId); err != nil {
+		if errors.Is(err, service.ErrPermissionDenied) {
+			return nil, connect.NewError(connect.CodePermissionDenied, errors.New("admin permission required"))
+		}
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("failed to revoke session: %w", err))
+	}
+
+	log.Printf("[INFO] Session revoked by admin: adminID=%s, sessionID=%s", adminID, req.Msg.SessionId)
+	return connect.NewResponse(&userv1.AdminRevokeSessionResponse{}), nil
+}
+
+func (s *UserServiceServer) UnlockUser(ctx context.Context, req *connect.Request[userv1.UnlockUserRequest]) (*connect.Response[userv1.UnlockUserResponse], error) {
+	adminID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Msg.UserId == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("user_id is required"))
+	}
+
+	if err := s.svc.UnlockUser(ctx, adminID, req.Msg.UserId); err != nil {
+		return nil, roleError(err, "failed to unlock user")
+	}
+
+	log.Printf("[INFO] User unlocked by admin: adminID=%s, userID=%s", adminID, req.Msg.UserId)
+	return connect.NewResponse(&userv1.UnlockUserResponse{}), nil
+}
+
+func (s *UserServiceServer) ListRoles(ctx context.Context, req *connect.Request[userv1.ListRolesRequest]) (*connect.Response[userv1.ListRolesResponse], error) {
+	adminID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := s.svc.ListRoles(ctx, adminID)
+	if err != nil {
+		return nil, roleError(err, "failed to list roles")
+	}
+
+	resp := &userv1.ListRolesResponse{Roles: make([]*userv1.Role, 0, len(roles))}
+	for _, role := range roles {
+		resp.Roles = append(resp.Roles, roleToProto(role))
+	}
+
+	return connect.NewResponse(resp), nil
+}
+
+func (s *UserServiceServer) CreateRole(ctx context.Context, req *connect.Request[userv1.CreateRoleRequest]) (*connect.Response[userv1.CreateRoleResponse], error) {
+	adminID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Msg.Name == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("name is required"))
+	}
+
+	role, err := s.svc.CreateRole(ctx, adminID, req.Msg.Name, req.Msg.Permissions)
+	if err != nil {
+		return nil, roleError(err, "failed to create role")
+	}
+
+	log.Printf("[INFO] Role created: adminID=%s, role=%s, permissions=%v", adminID, role.Name, role.Permissions)
+	return connect.NewResponse(&userv1.CreateRoleResponse{Role: roleToProto(role)}), nil
+}
+
+func (s *UserServiceServer) UpdateRole(ctx context.Context, req *connect.Request[userv1.UpdateRoleRequest]) (*connect.Response[userv1.UpdateRoleResponse], error) {
+	adminID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Msg.Name == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("name is required"))
+	}
+
+	role, err := s.svc.UpdateRole(ctx, adminID, req.Msg.Name, req.Msg.Permissions)
+	if err != nil {
+		return nil, roleError(err, "failed to update role")
+	}
+
+	log.Printf("[INFO] Role updated: adminID=%s, role=%s, permissions=%v", adminID, role.Name, role.Permissions)
+	return connect.NewResponse(&userv1.UpdateRoleResponse{Role: roleToProto(role)}), nil
+}
+
+func (s *UserServiceServer) DeleteRole(ctx context.Context, req *connect.Request[userv1.DeleteRoleRequest]) (*connect.Response[userv1.DeleteRoleResponse], error) {
+	adminID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Msg.Name == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("name is required"))
+	}
+
+	if err := s.svc.DeleteRole(ctx, adminID, req.Msg.Name); err != nil {
+		return nil, roleError(err, "failed to delete role")
+	}
+
+	log.Printf("[INFO] Role deleted: adminID=%s, role=%s", adminID, req.Msg.Name)
+	return connect.NewResponse(&userv1.DeleteRoleResponse{}), nil
+}
+
+func (s *UserServiceServer) GrantPermission(ctx context.Context, req *connect.Request[userv1.GrantPermissionRequest]) (*connect.Response[userv1.GrantPermissionResponse], error) {
+	adminID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Msg.UserId == "" || req.Msg.Permission == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("user_id and permission are required"))
+	}
+
+	permissions, err := s.svc.GrantPermission(ctx, adminID, req.Msg.UserId, req.Msg.Permission)
+	if err != nil {
+		return nil, roleError(err, "failed to grant permission")
+	}
+
+	log.Printf("[INFO] Permission granted: adminID=%s, userID=%s, permission=%s", adminID, req.Msg.UserId, req.Msg.Permission)
+	return connect.NewResponse(&userv1.GrantPermissionResponse{Permissions: permissions}), nil
+}
+
+func (s *UserServiceServer) RevokePermission(ctx context.Context, req *connect.Request[userv1.RevokePermissionRequest]) (*connect.Response[userv1.RevokePermissionResponse], error) {
+	adminID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Msg.UserId == "" || req.Msg.Permission == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("user_id and permission are required"))
+	}
+
+	permissions, err := s.svc.RevokePermission(ctx, adminID, req.Msg.UserId, req.Msg.Permission)
+	if err != nil {
+		return nil, roleError(err, "failed to revoke permission")
+	}
+
+	log.Printf("[INFO] Permission revoked: adminID=%s, userID=%s, permission=%s", adminID, req.Msg.UserId, req.Msg.Permission)
+	return connect.NewResponse(&userv1.RevokePermissionResponse{Permissions: permissions}), nil
+}
+
+func (s *UserServiceServer) CreateApiKey(ctx context.Context, req *connect.Request[userv1.CreateApiKeyRequest]) (*connect.Response[userv1.CreateApiKeyResponse], error) {
+	adminID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Msg.ClientId == "" || len(req.Msg.Scopes) == 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("client_id and scopes are required"))
+	}
+	if req.Msg.TtlSeconds < 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("ttl_seconds cannot be negative"))
+	}
+
+	apiKey, key, err := s.svc.CreateAPIKey(ctx, adminID, req.Msg.ClientId, req.Msg.Scopes, time.Duration(req.Msg.TtlSeconds)*time.Second)
+	if err != nil {
+		return nil, apiKeyError(err, "failed to create api key")
+	}
+
+	log.Printf("[INFO] API key created: adminID=%s, clientID=%s, keyID=%s, scopes=%v", adminID, apiKey.ClientID, apiKey.ID.Hex(), apiKey.Scopes)
+	return connect.NewResponse(&userv1.CreateApiKeyResponse{Key: apiKeyToProto(apiKey), ApiKey: key}), nil
+}
+
+func (s *UserServiceServer) ListApiKeys(ctx context.Context, req *connect.Request[userv1.ListApiKeysRequest]) (*connect.Response[userv1.ListApiKeysResponse], error) {
+	adminID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := s.svc.ListAPIKeys(ctx, adminID, req.Msg.ClientId)
+	if err != nil {
+		return nil, apiKeyError(err, "failed to list api keys")
+	}
+
+	resp := &userv1.ListApiKeysResponse{Keys: make([]*userv1.ApiKey, 0, len(keys))}
+	for _, k := range keys {
+		resp.Keys = append(resp.Keys, apiKeyToProto(k))
+	}
+
+	return connect.NewResponse(resp), nil
+}
+
+func (s *UserServiceServer) RevokeApiKey(ctx context.Context, req *connect.Request[userv1.RevokeApiKeyRequest]) (*connect.Response[userv1.RevokeApiKeyResponse], error) {
+	adminID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Msg.KeyId == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("key_id is required"))
+	}
+
+	if err := s.svc.RevokeAPIKey(ctx, adminID, req.Msg.KeyId); err != nil {
+		return nil, apiKeyError(err, "failed to revoke api key")
+	}
+
+	log.Printf("[INFO] API key revoked: adminID=%s, keyID=%s", adminID, req.Msg.KeyId)
+	return connect.NewResponse(&userv1.RevokeApiKeyResponse{}), nil
 }
 
 // ============================================================================
@@ -166,6 +735,19 @@ func (s *AuthSessionServiceServer) ValidateSession(ctx context.Context, req *con
 	info, err := s.svc.ValidateSession(ctx, req.Msg.SessionToken)
 	if err != nil {
 		log.Printf("[DEBUG] ValidateSession failed: %v", err)
+		if errors.Is(err, service.ErrSessionRevoked) {
+			return nil, connect.NewError(connect.CodeUnauthenticated, errors.New("session revoked"))
+		}
+		if errors.Is(err, mongodb.ErrUserNotFound) {
+			return nil, connect.NewError(connect.CodeUnauthenticated, errors.New("user not found"))
+		}
+		if errors.Is(err, service.ErrAccountDisabled) {
+			return nil, connect.NewError(connect.CodeUnauthenticated, errors.New("account disabled"))
+		}
+		if !errors.Is(err, jwt.ErrInvalidToken) && !errors.Is(err, jwt.ErrExpiredToken) {
+			// revocation or permission lookup failed, the token may be fine
+			return nil, connect.NewError(connect.CodeUnavailable, errors.New("session check failed"))
+		}
 		return nil, connect.NewError(connect.CodeUnauthenticated, errors.New("invalid or expired token"))
 	}
 	log.Printf("[DEBUG] ValidateSession success: userID=%s, sessionID=%s", info.UserID, info.SessionID)
@@ -183,13 +765,191 @@ func (s *AuthSessionServiceServer) ValidateSession(ctx context.Context, req *con
 		})
 	}
 
+	permissions := make([]*userv1.Permission, 0, len(info.Permissions))
+	for _, p := range info.Permissions {
+		permissions = append(permissions, &userv1.Permission{Name: p})
+	}
+
 	return connect.NewResponse(&userv1.ValidateSessionResponse{
-		UserId:    info.UserID,
-		SessionId: info.SessionID,
-		Roles:     roles,
+		UserId:      info.UserID,
+		SessionId:   info.SessionID,
+		Roles:       roles,
+		Permissions: permissions,
 	}), nil
 }
 
+func (s *AuthSessionServiceServer) ValidateApiKey(ctx context.Context, req *connect.Request[userv1.ValidateApiKeyRequest]) (*connect.Response[userv1.ValidateApiKeyResponse], error) {
+	if req.Msg.ApiKey == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("api_key is required"))
+	}
+
+	info, err := s.svc.ValidateAPIKey(ctx, req.Msg.ApiKey)
+	if err != nil {
+		if errors.Is(err, mongodb.ErrAPIKeyNotFound) || errors.Is(err, mongodb.ErrAPIKeyRevoked) || errors.Is(err, mongodb.ErrAPIKeyExpired) {
+			log.Printf("[DEBUG] ValidateApiKey failed: %v", err)
+			return nil, connect.NewError(connect.CodeUnauthenticated, errors.New("invalid api key"))
+		}
+		return nil, connect.NewError(connect.CodeUnavailable, errors.New("api key check failed"))
+	}
+
+	scopes := make([]*userv1.Permission, 0, len(info.Scopes))
+	for _, scope := range info.Scopes {
+		scopes = append(scopes, &userv1.Permission{Name: scope})
+	}
+
+	return connect.NewResponse(&userv1.ValidateApiKeyResponse{
+		ClientId: info.ClientID,
+		KeyId:    info.KeyID,
+		Scopes:   scopes,
+	}), nil
+}
+
+// ============================================================================
+// AdminServiceServer - implements userv1connect.AdminServiceHandler
+// ============================================================================
+
+type AdminServiceServer struct {
+	svc *service.AdminService
+}
+
+func NewAdminServiceServer(svc *service.AdminService) *AdminServiceServer {
+	return &AdminServiceServer{svc: svc}
+}
+
+func (s *AdminServiceServer) ListUsers(ctx context.Context, req *connect.Request[userv1.ListUsersRequest]) (*connect.Response[userv1.ListUsersResponse], error) {
+	adminID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.Msg.Status {
+	case "", mongodb.UserStatusActive, mongodb.UserStatusDisabled, mongodb.UserStatusDeleted:
+	default:
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("status must be active, disabled or deleted"))
+	}
+
+	filter := mongodb.UserFilter{Query: req.Msg.Query, Role: req.Msg.Role, Status: req.Msg.Status}
+	users, next, err := s.svc.ListUsers(ctx, adminID, filter, int(req.Msg.PageSize), req.Msg.PageToken)
+	if err != nil {
+		return nil, adminError(err, "failed to list users")
+	}
+
+	resp := &userv1.ListUsersResponse{Users: make([]*userv1.AdminUser, 0, len(users)), NextPageToken: next}
+	for _, u := range users {
+		resp.Users = append(resp.Users, adminUserToProto(u))
+	}
+
+	return connect.NewResponse(resp), nil
+}
+
+func (s *AdminServiceServer) GetUser(ctx context.Context, req *connect.Request[userv1.GetUserRequest]) (*connect.Response[userv1.GetUserResponse], error) {
+	adminID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Msg.UserId == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("user_id is required"))
+	}
+
+	user, err := s.svc.GetUser(ctx, adminID, req.Msg.UserId)
+	if err != nil {
+		return nil, adminError(err, "failed to get user")
+	}
+
+	return connect.NewResponse(&userv1.GetUserResponse{User: adminUserToProto(user)}), nil
+}
+
+func (s *AdminServiceServer) SetRoles(ctx context.Context, req *connect.Request[userv1.SetRolesRequest]) (*connect.Response[userv1.SetRolesResponse], error) {
+	adminID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Msg.UserId == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("user_id is required"))
+	}
+
+	user, err := s.svc.SetRoles(ctx, adminID, req.Msg.UserId, req.Msg.Roles)
+	if err != nil {
+		return nil, adminError(err, "failed to set roles")
+	}
+
+	log.Printf("[INFO] Roles set by admin: adminID=%s, userID=%s, roles=%v", adminID, req.Msg.UserId, user.Roles)
+	return connect.NewResponse(&userv1.SetRolesResponse{User: adminUserToProto(user)}), nil
+}
+
+func (s *AdminServiceServer) DisableUser(ctx context.Context, req *connect.Request[userv1.DisableUserRequest]) (*connect.Response[userv1.DisableUserResponse], error) {
+	adminID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Msg.UserId == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("user_id is required"))
+	}
+
+	if err := s.svc.DisableUser(ctx, adminID, req.Msg.UserId, req.Msg.Reason); err != nil {
+		return nil, adminError(err, "failed to disable user")
+	}
+
+	log.Printf("[INFO] User disabled by admin: adminID=%s, userID=%s", adminID, req.Msg.UserId)
+	return connect.NewResponse(&userv1.DisableUserResponse{}), nil
+}
+
+func (s *AdminServiceServer) EnableUser(ctx context.Context, req *connect.Request[userv1.EnableUserRequest]) (*connect.Response[userv1.EnableUserResponse], error) {
+	adminID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Msg.UserId == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("user_id is required"))
+	}
+
+	if err := s.svc.EnableUser(ctx, adminID, req.Msg.UserId); err != nil {
+		return nil, adminError(err, "failed to enable user")
+	}
+
+	log.Printf("[INFO] User enabled by admin: adminID=%s, userID=%s", adminID, req.Msg.UserId)
+	return connect.NewResponse(&userv1.EnableUserResponse{}), nil
+}
+
+func (s *AdminServiceServer) ListAuditLog(ctx context.Context, req *connect.Request[userv1.ListAuditLogRequest]) (*connect.Response[userv1.ListAuditLogResponse], error) {
+	adminID, err := getUserIDFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, next, err := s.svc.ListAuditLog(ctx, adminID, req.Msg.UserId, int(req.Msg.PageSize), req.Msg.PageToken)
+	if err != nil {
+		return nil, adminError(err, "failed to list audit log")
+	}
+
+	resp := &userv1.ListAuditLogResponse{Entries: make([]*userv1.AuditEntry, 0, len(entries)), NextPageToken: next}
+	for _, e := range entries {
+		entry := &userv1.AuditEntry{
+			Id:        e.ID.Hex(),
+			ActorId:   e.ActorID.Hex(),
+			Action:    e.Action,
+			CreatedAt: e.CreatedAt.Unix(),
+		}
+		if !e.TargetID.IsZero() {
+			entry.TargetId = e.TargetID.Hex()
+		}
+		if len(e.Details) > 0 {
+			details, err := json.Marshal(e.Details)
+			if err != nil {
+				return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("failed to encode audit details: %w", err))
+			}
+			entry.Details = string(details)
+		}
+		resp.Entries = append(resp.Entries, entry)
+	}
+
+	return connect.NewResponse(resp), nil
+}
+
 // ============================================================================
 // Helpers
 // ============================================================================
@@ -212,13 +972,198 @@ func getSessionIDFromRequest[T any](req *connect.Request[T]) (string, error) {
 	return sessionID, nil
 }
 
-// Ensure domain package is used
-var _ = domain.RoleClient
+// adminUserToProto converts a user to its admin view
+func adminUserToProto(u *domain.User) *userv1.AdminUser {
+	msg := &userv1.AdminUser{
+		UserId:        u.ID.Hex(),
+		Email:         u.Email,
+		Username:      u.Username,
+		Roles:         u.Roles,
+		Permissions:   u.Permissions,
+		EmailVerified: u.EmailVerified,
+		TotpEnabled:   u.TOTPEnabled(),
+		CreatedAt:     u.CreatedAt.Unix(),
+	}
+	for _, identity := range u.Identities {
+		msg.IdentityProviders = append(msg.IdentityProviders, identity.Provider)
+	}
+	if u.DisabledAt != nil {
+		msg.DisabledAt = u.DisabledAt.Unix()
+	}
+	if u.DeletedAt != nil {
+		msg.DeletedAt = u.DeletedAt.Unix()
+	}
+	if until, locked := u.LockedUntil(time.Now()); locked {
+		msg.LockedUntil = until.Unix()
+	}
+	return msg
+}
+
+// roleToProto converts a stored role to its proto message
+func profileToProto(user *domain.User) *userv1.GetProfileResponse {
+	return &userv1.GetProfileResponse{
+		UserId:        user.ID.Hex(),
+		Email:         user.Email,
+		Username:      user.Username,
+		Roles:         user.Roles,
+		TotpEnabled:   user.TOTPEnabled(),
+		EmailVerified: user.EmailVerified,
+	}
+}
+
+func roleToProto(role *domain.Role) *userv1.Role {
+	perms := make([]*userv1.Permission, 0, len(role.Permissions))
+	for _, p := range role.Permissions {
+		perms = append(perms, &userv1.Permission{Name: p})
+	}
+	return &userv1.Role{Name: role.Name, Permissions: perms}
+}
+
+// apiKeyToProto converts a stored API key to its proto message, without the key hash
+func apiKeyToProto(k *domain.APIKey) *userv1.ApiKey {
+	msg := &userv1.ApiKey{
+		KeyId:     k.ID.Hex(),
+		ClientId:  k.ClientID,
+		Prefix:    k.Prefix,
+		Scopes:    k.Scopes,
+		CreatedAt: k.CreatedAt.Unix(),
+		Revoked:   k.RevokedAt != nil,
+	}
+	if k.ExpiresAt != nil {
+		msg.ExpiresAt = k.ExpiresAt.Unix()
+	}
+	return msg
+}
+
+// apiKeyError maps errors of the API key management to connect errors
+func apiKeyError(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrPermissionDenied):
+		return connect.NewError(connect.CodePermissionDenied, errors.New("admin permission required"))
+	case errors.Is(err, mongodb.ErrAPIKeyNotFound):
+		return connect.NewError(connect.CodeNotFound, errors.New("api key not found"))
+	default:
+		return connect.NewError(connect.CodeInternal, fmt.Errorf("%s: %w", msg, err))
+	}
+}
+
+// oidcError maps errors of the OIDC login to connect errors
+func oidcError(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrAccountDisabled):
+		return connect.NewError(connect.CodePermissionDenied, errors.New("account is disabled"))
+	case errors.Is(err, service.ErrUnknownProvider):
+		return connect.NewError(connect.CodeNotFound, errors.New("unknown OIDC provider"))
+	case errors.Is(err, service.ErrInvalidOIDCState), errors.Is(err, service.ErrOIDCAuthFailed):
+		return connect.NewError(connect.CodeUnauthenticated, errors.New("OIDC login failed, start it again"))
+	case errors.Is(err, mongodb.ErrIdentityAlreadyLinked):
+		return connect.NewError(connect.CodeAlreadyExists, errors.New("identity is linked to another user"))
+	case errors.Is(err, service.ErrAccountExists):
+		return connect.NewError(connect.CodeAlreadyExists, errors.New("an account with this email exists, log in and link the identity"))
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, mongodb.ErrUserNotFound):
+		return connect.NewError(connect.CodeNotFound, errors.New("user not found"))
+	default:
+		return connect.NewError(connect.CodeInternal, fmt.Errorf("%s: %w", msg, err))
+	}
+}
+
+// accountError maps errors of the profile, email verification and password operations to connect errors
+func accountError(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidToken):
+		return connect.NewError(connect.CodeUnauthenticated, errors.New("the link is invalid or expired, request a new one"))
+	case errors.Is(err, service.ErrInvalidCredentials):
+		return connect.NewError(connect.CodePermissionDenied, errors.New("wrong password"))
+	case errors.Is(err, mongodb.ErrUserAlreadyExists):
+		return connect.NewError(connect.CodeAlreadyExists, errors.New("user with this email already exists"))
+	case errors.Is(err, service.ErrWeakPassword), errors.Is(err, service.ErrInvalidEmail):
+		return connect.NewError(connect.CodeInvalidArgument, err)
+	case errors.Is(err, service.ErrReauthRequired):
+		return connect.NewError(connect.CodeFailedPrecondition, err)
+	case errors.Is(err, service.ErrEmailAlreadyVerified):
+		return connect.NewError(connect.CodeFailedPrecondition, err)
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, mongodb.ErrUserNotFound):
+		return connect.NewError(connect.CodeNotFound, errors.New("user not found"))
+	default:
+		return connect.NewError(connect.CodeInternal, fmt.Errorf("%s: %w", msg, err))
+	}
+}
+
+// totpError maps errors of the TOTP enrollment and verification to connect errors
+func totpError(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrAccountDisabled):
+		return connect.NewError(connect.CodePermissionDenied, errors.New("account is disabled"))
+	case errors.Is(err, service.ErrInvalidChallenge):
+		return connect.NewError(connect.CodeUnauthenticated, errors.New("login challenge is invalid or expired, log in again"))
+	// wrong codes lock the account like wrong passwords, the lock is answered like them
+	case errors.Is(err, service.ErrInvalidTOTPCode), errors.Is(err, service.ErrAccountLocked):
+		return connect.NewError(connect.CodeUnauthenticated, errors.New("invalid code"))
+	case errors.Is(err, service.ErrTOTPEnrollmentRequired):
+		return connect.NewError(connect.CodeFailedPrecondition, errors.New("TOTP enrollment is required, use EnrollTotp and ConfirmTotp"))
+	case errors.Is(err, service.ErrTOTPAlreadyEnabled):
+		return connect.NewError(connect.CodeAlreadyExists, err)
+	case errors.Is(err, service.ErrTOTPNotEnrolled), errors.Is(err, service.ErrTOTPRequired):
+		return connect.NewError(connect.CodeFailedPrecondition, err)
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, mongodb.ErrUserNotFound):
+		return connect.NewError(connect.CodeNotFound, errors.New("user not found"))
+	default:
+		return connect.NewError(connect.CodeInternal, fmt.Errorf("%s: %w", msg, err))
+	}
+}
+
+// adminError maps errors of the admin user management to connect errors
+func adminError(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrPermissionDenied):
+		return connect.NewError(connect.CodePermissionDenied, errors.New("admin permission required"))
+	case errors.Is(err, service.ErrSelfChange):
+		return connect.NewError(connect.CodeFailedPrecondition, err)
+	case errors.Is(err, service.ErrUnknownRole), errors.Is(err, service.ErrInvalidPageToken):
+		return connect.NewError(connect.CodeInvalidArgument, err)
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, mongodb.ErrUserNotFound):
+		return connect.NewError(connect.CodeNotFound, errors.New("user not found"))
+	default:
+		return connect.NewError(connect.CodeInternal, fmt.Errorf("%s: %w", msg, err))
+	}
+}
+
+// roleError maps errors of the role and permission operations to connect errors
+func roleError(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrPermissionDenied):
+		return connect.NewError(connect.CodePermissionDenied, errors.New("admin permission required"))
+	case errors.Is(err, mongodb.ErrRoleNotFound):
+		return connect.NewError(connect.CodeNotFound, errors.New("role not found"))
+	case errors.Is(err, mongodb.ErrRoleAlreadyExists):
+		return connect.NewError(connect.CodeAlreadyExists, errors.New("role already exists"))
+	case errors.Is(err, service.ErrRoleProtected), errors.Is(err, service.ErrLastAdminRole):
+		return connect.NewError(connect.CodeFailedPrecondition, err)
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, mongodb.ErrUserNotFound):
+		return connect.NewError(connect.CodeNotFound, errors.New("user not found"))
+	default:
+		return connect.NewError(connect.CodeInternal, fmt.Errorf("%s: %w", msg, err))
+	}
+}
 
 // ============================================================================
 // Interceptors
 // ============================================================================
 
+// NewDeviceInterceptor puts the client of the request into the context, sessions record
+// the user agent and the x-real-ip the gateway sets
+func NewDeviceInterceptor() connect.UnaryInterceptorFunc {
+	return func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+			ctx = service.WithDevice(ctx, domain.Device{
+				UserAgent: req.Header().Get("User-Agent"),
+				IP:        req.Header().Get("x-real-ip"),
+			})
+			return next(ctx, req)
+		}
+	}
+}
+
 // NewLoggingInterceptor creates an interceptor for request/response logging
 func NewLoggingInterceptor() connect.UnaryInterceptorFunc {
 	return func(next connect.UnaryFunc) connect.UnaryFunc {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"flag"
@@ -13,10 +14,15 @@ import (
 
 	"connectrpc.com/connect"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
 	"gitlab.com/gitops-poc-dzha/user-service/internal/config"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
 	"gitlab.com/gitops-poc-dzha/user-service/internal/events"
 	"gitlab.com/gitops-poc-dzha/user-service/internal/jwt"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/mailer"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/oidc"
 	"gitlab.com/gitops-poc-dzha/user-service/internal/repository/mongodb"
+	redisrepo "gitlab.com/gitops-poc-dzha/user-service/internal/repository/redis"
 	"gitlab.com/gitops-poc-dzha/user-service/internal/service"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -42,6 +48,10 @@ func main() {
 	if *metricsPort != "" {
 		cfg.MetricsPort = *metricsPort
 	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Printf("Invalid configuration: %v\n", err)
+		os.Exit(1)
+	}
 
 	fmt.Printf("Starting user-service on port %s (metrics: %s)\n", cfg.Port, cfg.MetricsPort)
 
@@ -77,6 +87,73 @@ func main() {
 	if err := refreshTokenRepo.EnsureIndexes(ctx); err != nil {
 		fmt.Printf("Failed to create refresh token indexes: %v\n", err)
 	}
+	signingKeyRepo := mongodb.NewSigningKeyRepository(db)
+	if err := signingKeyRepo.EnsureIndexes(ctx); err != nil {
+		fmt.Printf("Failed to create signing key indexes: %v\n", err)
+	}
+
+	roleRepo := mongodb.NewRoleRepository(db)
+	if err := roleRepo.EnsureIndexes(ctx); err != nil {
+		fmt.Printf("Failed to create role indexes: %v\n", err)
+	}
+	if err := roleRepo.EnsureDefaults(ctx, domain.DefaultRoles()); err != nil {
+		fmt.Printf("Failed to create default roles: %v\n", err)
+	}
+
+	apiKeyRepo := mongodb.NewAPIKeyRepository(db)
+	if err := apiKeyRepo.EnsureIndexes(ctx); err != nil {
+		fmt.Printf("Failed to create API key indexes: %v\n", err)
+	}
+
+	oidcStateRepo := mongodb.NewOIDCStateRepository(db)
+	if err := oidcStateRepo.EnsureIndexes(ctx); err != nil {
+		fmt.Printf("Failed to create OIDC state indexes: %v\n", err)
+	}
+
+	loginChallengeRepo := mongodb.NewLoginChallengeRepository(db)
+	if err := loginChallengeRepo.EnsureIndexes(ctx); err != nil {
+		fmt.Printf("Failed to create login challenge indexes: %v\n", err)
+	}
+
+	userTokenRepo := mongodb.NewUserTokenRepository(db)
+	if err := userTokenRepo.EnsureIndexes(ctx); err != nil {
+		fmt.Printf("Failed to create user token indexes: %v\n", err)
+	}
+
+	auditLogRepo := mongodb.NewAuditLogRepository(db)
+	if err := auditLogRepo.EnsureIndexes(ctx); err != nil {
+		fmt.Printf("Failed to create audit log indexes: %v\n", err)
+	}
+
+	// RS256/EdDSA private keys are sealed in MongoDB
+	var keyCipher *jwt.KeyCipher
+	if cfg.JWTSigningAlg != jwt.AlgHS256 {
+		keyCipher, err = jwt.NewKeyCipher(cfg.JWTKeyEncryptionKey)
+		if err != nil {
+			fmt.Printf("Invalid JWT_KEY_ENCRYPTION_KEY: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if flag.Arg(0) == "rotate-keys" {
+		rotateKeys(ctx, signingKeyRepo, keyCipher, cfg)
+		return
+	}
+
+	// Revoked sessions are checked on every ValidateSession, Redis is optional
+	var revokedSessions service.RevokedSessionStore
+	if cfg.RedisAddr != "" {
+		redisClient := redis.NewClient(&redis.Options{Addr: cfg.RedisAddr, Password: cfg.RedisPassword})
+		defer redisClient.Close()
+		revokedSessions = redisrepo.NewRevokedSessionRepository(redisClient)
+		fmt.Println("Revoked sessions are stored in Redis")
+	} else {
+		revokedSessionRepo := mongodb.NewRevokedSessionRepository(db)
+		if err := revokedSessionRepo.EnsureIndexes(ctx); err != nil {
+			fmt.Printf("Failed to create revoked session indexes: %v\n", err)
+		}
+		revokedSessions = revokedSessionRepo
+	}
 
 	// Connect to RabbitMQ (optional - continue if fails)
 	var eventPublisher *events.Publisher
@@ -91,14 +168,55 @@ func main() {
 	}
 
 	// Create JWT manager
-	jwtManager := jwt.NewManager(cfg.JWTSecret, cfg.AccessTokenTTL)
+	var jwtManager *jwt.Manager
+	if cfg.JWTSigningAlg == jwt.AlgHS256 {
+		jwtManager = jwt.NewManager(cfg.JWTSecret, cfg.AccessTokenTTL)
+	} else {
+		jwtManager, err = jwt.NewKeyManager(ctx, signingKeyRepo, keyCipher, cfg.JWTSigningAlg, cfg.AccessTokenTTL)
+		if err != nil {
+			fmt.Printf("Failed to load signing keys: %v\n", err)
+			os.Exit(1)
+		}
+		go jwtManager.Run(ctx, cfg.JWTKeyReloadInterval)
+	}
+
+	// OIDC providers are discovered on first use, a provider being down doesn't stop the service
+	var oidcProviders []*oidc.Provider
+	for _, pc := range cfg.OIDCProviders {
+		if pc.Issuer == "" || pc.ClientID == "" || pc.RedirectURL == "" {
+			fmt.Printf("OIDC provider %s skipped: issuer, client ID and redirect URL are required\n", pc.Name)
+			continue
+		}
+		oidcProviders = append(oidcProviders, oidc.NewProvider(pc, nil))
+		fmt.Printf("OIDC provider %s: %s\n", pc.Name, pc.Issuer)
+	}
+
+	// Verification and password reset mails, the file sink is for local runs
+	var mail mailer.Mailer
+	switch cfg.Mailer {
+	case "smtp":
+		mail = mailer.NewSMTPMailer(mailer.SMTPConfig{
+			Addr:     cfg.SMTPAddr,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		})
+		fmt.Printf("Mails are sent through %s\n", cfg.SMTPAddr)
+	case "file":
+		mail = mailer.NewFileMailer(cfg.MailFile, cfg.MailFrom)
+		fmt.Printf("Mails are written to %s\n", cmp.Or(cfg.MailFile, "the log"))
+	default:
+		fmt.Printf("Unknown MAILER %q, use smtp or file\n", cfg.Mailer)
+		os.Exit(1)
+	}
 
 	// Create services
-	userService := service.NewUserService(userRepo, refreshTokenRepo, jwtManager, eventPublisher, cfg)
-	authService := service.NewAuthService(jwtManager)
+	userService := service.NewUserService(userRepo, refreshTokenRepo, roleRepo, apiKeyRepo, oidcStateRepo, loginChallengeRepo, userTokenRepo, auditLogRepo, oidcProviders, revokedSessions, jwtManager, eventPublisher, mail, cfg)
+	adminService := service.NewAdminService(userService, userRepo, roleRepo, auditLogRepo)
+	authService := service.NewAuthService(jwtManager, revokedSessions, userRepo, roleRepo, apiKeyRepo)
 
-	// Create Connect interceptors for logging
-	interceptors := connect.WithInterceptors(NewLoggingInterceptor())
+	// Create Connect interceptors for logging and the device of the sessions
+	interceptors := connect.WithInterceptors(NewLoggingInterceptor(), NewDeviceInterceptor())
 
 	// Create HTTP mux for Connect handlers
 	mux := http.NewServeMux()
@@ -118,6 +236,16 @@ func main() {
 	)
 	mux.Handle(authPath, authHandler)
 
+	// Register AdminService handler
+	adminPath, adminHandler := userv1connect.NewAdminServiceHandler(
+		NewAdminServiceServer(adminService),
+		interceptors,
+	)
+	mux.Handle(adminPath, adminHandler)
+
+	// Public keys of the access tokens, for services verifying them locally
+	mux.Handle("/.well-known/jwks.json", jwtManager.JWKSHandler())
+
 	// Health check endpoint
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -171,3 +299,15 @@ func main() {
 
 	fmt.Println("Server stopped")
 }
+
+// rotateKeys runs "server rotate-keys": a new signing key is published in the JWKS right away
+// and signs tokens after JWT_KEY_ACTIVATION_DELAY, the current one is kept until its tokens expire
+func rotateKeys(ctx context.Context, store jwt.KeyStore, keyCipher *jwt.KeyCipher, cfg *config.Config) {
+	key, err := jwt.Rotate(ctx, store, keyCipher, cfg.JWTSigningAlg, cfg.JWTKeyActivationDelay, cfg.AccessTokenTTL)
+	if err != nil {
+		fmt.Printf("Failed to rotate signing keys: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Created %s signing key %s, active from %s\n", key.Algorithm, key.Kid, key.ActivatesAt.Format(time.RFC3339))
+}
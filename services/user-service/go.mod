@@ -9,6 +9,7 @@ require (
 	github.com/golang-jwt/jwt/v5 v5.2.1
 	github.com/prometheus/client_golang v1.20.5
 	github.com/rabbitmq/amqp091-go v1.10.0
+	github.com/redis/go-redis/v9 v9.7.0
 	gitlab.com/gitops-poc-dzha/api/gen/user-service/go v0.0.0-20251220133652-2be40e78cfa9
 	go.mongodb.org/mongo-driver v1.17.1
 	golang.org/x/crypto v0.31.0
@@ -18,6 +19,7 @@ require (
 require (
 	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/golang/snappy v0.0.4 // indirect
 	github.com/klauspost/compress v1.17.9 // indirect
 	github.com/montanaflynn/stats v0.7.1 // indirect
@@ -36,3 +38,7 @@ require (
 	google.golang.org/grpc v1.68.1 // indirect
 	google.golang.org/protobuf v1.36.9 // indirect
 )
+
+// Generated code of api/proto/user-service in this tree, drop once the proto-gen pipeline
+// publishes a version with the same RPCs
+replace gitlab.com/gitops-poc-dzha/api/gen/user-service/go => ../../api/gen/user-service/go
@@ -8,13 +8,105 @@ import (
 
 // User represents a user in the system
 type User struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty"`
-	Email        string             `bson:"email"`
-	PasswordHash string             `bson:"password_hash"`
-	Username     string             `bson:"username"`
-	Roles        []string           `bson:"roles"`
-	CreatedAt    time.Time          `bson:"created_at"`
-	UpdatedAt    time.Time          `bson:"updated_at"`
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	Email         string             `bson:"email"`
+	EmailVerified bool               `bson:"email_verified"` // by a mailed link or the OIDC provider
+	PasswordHash  string             `bson:"password_hash"`
+	Username      string             `bson:"username"`
+	Roles         []string           `bson:"roles"`
+	Permissions   []string           `bson:"permissions,omitempty"` // granted on top of the roles
+	Identities    []Identity         `bson:"identities,omitempty"`  // linked OIDC accounts
+	TOTP          *TOTP              `bson:"totp,omitempty"`        // second factor
+	Lockout       *Lockout           `bson:"lockout,omitempty"`     // failed password logins
+	CreatedAt     time.Time          `bson:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at"`
+	DeletedAt     *time.Time         `bson:"deleted_at,omitempty"`  // personal data is anonymized
+	DisabledAt    *time.Time         `bson:"disabled_at,omitempty"` // by an admin, no logins
+}
+
+// Identity is an account at an OIDC provider linked to a user, the user logs in with it
+// instead of a password. Users created by an OIDC login have no password
+type Identity struct {
+	Provider string    `bson:"provider"`
+	Subject  string    `bson:"subject"` // sub claim, stable per provider
+	Email    string    `bson:"email,omitempty"`
+	LinkedAt time.Time `bson:"linked_at"`
+}
+
+// TOTP is the authenticator app second factor of a user. The secret is stored on enrollment
+// and enabled once the user confirms a code, recovery codes are stored hashed and used once
+type TOTP struct {
+	Secret        string     `bson:"secret"` // base32
+	Enabled       bool       `bson:"enabled"`
+	EnabledAt     *time.Time `bson:"enabled_at,omitempty"`
+	RecoveryCodes []string   `bson:"recovery_codes,omitempty"`
+	// LastStep is the time step of the last accepted code, a code is accepted once
+	LastStep int64 `bson:"last_step"`
+}
+
+// TOTPEnabled reports whether logins need the second factor
+func (u *User) TOTPEnabled() bool {
+	return u.TOTP != nil && u.TOTP.Enabled
+}
+
+// Lockout counts the failed password logins of a user, cleared by a successful login.
+// Failures past a threshold delay the next attempt until LockedUntil, growing exponentially
+type Lockout struct {
+	FailedAttempts int        `bson:"failed_attempts"`
+	LastFailedAt   time.Time  `bson:"last_failed_at"`
+	LockedUntil    *time.Time `bson:"locked_until,omitempty"`
+}
+
+// LockedUntil returns the end of the lockout of the user when it is locked at now
+func (u *User) LockedUntil(now time.Time) (time.Time, bool) {
+	if u.Lockout == nil || u.Lockout.LockedUntil == nil || !u.Lockout.LockedUntil.After(now) {
+		return time.Time{}, false
+	}
+	return *u.Lockout.LockedUntil, true
+}
+
+// LoginChallenge is a login that passed the password and waits for the second factor.
+// With Enrollment the user must enroll TOTP first, required by the user's roles
+type LoginChallenge struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	TokenHash  string             `bson:"token_hash"`
+	UserID     primitive.ObjectID `bson:"user_id"`
+	Enrollment bool               `bson:"enrollment"`
+	Attempts   int                `bson:"attempts"`
+	CreatedAt  time.Time          `bson:"created_at"`
+	ExpiresAt  time.Time          `bson:"expires_at"`
+}
+
+// Purposes of user tokens
+const (
+	TokenEmailVerification = "email_verification"
+	TokenPasswordReset     = "password_reset"
+)
+
+// UserToken is a single-use token mailed to a user, stored hashed. Email is the address
+// the token was sent to, a verification only applies while it is still the user's email
+type UserToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	TokenHash string             `bson:"token_hash"`
+	Purpose   string             `bson:"purpose"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	Email     string             `bson:"email"`
+	CreatedAt time.Time          `bson:"created_at"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+}
+
+// OIDCState is a started OIDC login waiting for the provider redirect. It is looked up
+// by the state parameter once and keeps the PKCE verifier and nonce of the request
+type OIDCState struct {
+	ID           primitive.ObjectID  `bson:"_id,omitempty"`
+	StateHash    string              `bson:"state_hash"`
+	Provider     string              `bson:"provider"`
+	CodeVerifier string              `bson:"code_verifier"`
+	Nonce        string              `bson:"nonce"`
+	UserID       *primitive.ObjectID `bson:"user_id,omitempty"` // set when linking to a logged in user
+	BindingHash  string              `bson:"binding_hash"`      // of the secret the starting browser echoes
+	CreatedAt    time.Time           `bson:"created_at"`
+	ExpiresAt    time.Time           `bson:"expires_at"`
 }
 
 // RefreshToken represents a refresh token stored in MongoDB
@@ -25,6 +117,78 @@ type RefreshToken struct {
 	SessionID string             `bson:"session_id"`
 	ExpiresAt time.Time          `bson:"expires_at"`
 	CreatedAt time.Time          `bson:"created_at"`
+	// UsedAt is set once the token is exchanged, the spent token is kept
+	// until it expires to detect a replay of a stolen copy
+	UsedAt *time.Time `bson:"used_at,omitempty"`
+	// Successor is the token that replaced this one, sealed with this token so that
+	// a client retrying the exchange within the reuse grace gets it again
+	Successor []byte `bson:"successor,omitempty"`
+
+	// Device of the session as of the last login or refresh, shown in the session list
+	Device     Device    `bson:"device"`
+	LastUsedAt time.Time `bson:"last_used_at"`
+	// SessionStartedAt is the login of the session, kept by the rotated tokens
+	SessionStartedAt time.Time `bson:"session_started_at"`
+}
+
+// Device is the client a session was used from
+type Device struct {
+	UserAgent string `bson:"user_agent,omitempty"`
+	IP        string `bson:"ip,omitempty"` // x-real-ip set by the gateway
+}
+
+// SigningKey is an access token signing key shared by all user-service replicas.
+// It is published in the JWKS from creation, signs tokens from ActivatesAt on and
+// is kept until ExpiresAt, set once a newer key takes over
+type SigningKey struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Kid         string             `bson:"kid"`
+	Algorithm   string             `bson:"algorithm"`
+	Generation  int                `bson:"generation"`  // unique, one more than the key it replaces
+	PrivateKey  []byte             `bson:"private_key"` // PKCS #8 DER sealed with JWT_KEY_ENCRYPTION_KEY
+	CreatedAt   time.Time          `bson:"created_at"`
+	ActivatesAt time.Time          `bson:"activates_at"`
+	ExpiresAt   *time.Time         `bson:"expires_at,omitempty"`
+}
+
+// APIKey authenticates a machine client (partner, batch job) without a user session.
+// Only the hash of the key is stored, its scopes are permission names
+type APIKey struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	ClientID  string             `bson:"client_id"`
+	Prefix    string             `bson:"prefix"` // first characters of the key, to tell keys apart
+	KeyHash   string             `bson:"key_hash"`
+	Scopes    []string           `bson:"scopes"`
+	CreatedBy primitive.ObjectID `bson:"created_by"`
+	CreatedAt time.Time          `bson:"created_at"`
+	ExpiresAt *time.Time         `bson:"expires_at,omitempty"`
+	RevokedAt *time.Time         `bson:"revoked_at,omitempty"`
+}
+
+// Audit actions of the admin user and role management
+const (
+	AuditSetRoles         = "set_roles"
+	AuditDisableUser      = "disable_user"
+	AuditEnableUser       = "enable_user"
+	AuditUnlockUser       = "unlock_user"
+	AuditGrantPermission  = "grant_permission"
+	AuditRevokePermission = "revoke_permission"
+	AuditCreateRole       = "create_role"
+	AuditUpdateRole       = "update_role"
+	AuditDeleteRole       = "delete_role"
+)
+
+// AuditEntry records a change of an admin to a user or a role: who changed what, and from
+// what to what
+type AuditEntry struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty"`
+	ActorID primitive.ObjectID `bson:"actor_id"`
+	Action  string             `bson:"action"`
+	// User the change applies to, zero for a change of a role
+	TargetID primitive.ObjectID `bson:"target_id"`
+	// Details of the change, e.g. the roles before and after
+	Details   map[string]interface{} `bson:"details,omitempty"`
+	CreatedAt time.Time              `bson:"created_at"`
 }
 
 // Role constants
@@ -40,14 +204,24 @@ const (
 	PermissionAdmin = "admin"
 )
 
-// DefaultPermissions returns default permissions for a role
-func DefaultPermissions(role string) []string {
-	switch role {
-	case RoleAdmin:
-		return []string{PermissionRead, PermissionWrite, PermissionAdmin}
-	case RoleClient:
-		return []string{PermissionRead, PermissionWrite}
-	default:
-		return []string{PermissionRead}
+// Role is a named set of permissions, roles are managed through the role RPCs
+type Role struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Name        string             `bson:"name"`
+	Permissions []string           `bson:"permissions"`
+	CreatedAt   time.Time          `bson:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at"`
+}
+
+// DefaultRoles returns the roles created on startup when missing
+func DefaultRoles() []*Role {
+	return []*Role{
+		{Name: RoleClient, Permissions: []string{PermissionRead, PermissionWrite}},
+		{Name: RoleAdmin, Permissions: []string{PermissionRead, PermissionWrite, PermissionAdmin}},
 	}
 }
+
+// IsBuiltinRole reports whether the role is relied on by the service itself and can't be deleted
+func IsBuiltinRole(name string) bool {
+	return name == RoleClient || name == RoleAdmin
+}
@@ -19,6 +19,19 @@ const (
 	EventUserRegistered = "user.registered"
 	EventUserLogin      = "user.login"
 	EventUserLogout     = "user.logout"
+	// EventSessionCompromised is published when a spent refresh token is replayed
+	EventSessionCompromised = "user.session_compromised"
+	// EventLoginFailed is published for a wrong password of an existing user
+	EventLoginFailed = "user.login_failed"
+	// EventUserLocked is published when failed logins lock the account
+	EventUserLocked    = "user.locked"
+	EventEmailVerified = "user.email_verified"
+	// EventPasswordChanged is published after a password reset or change, all sessions end
+	EventPasswordChanged = "user.password_changed"
+	EventProfileUpdated  = "user.profile_updated"
+	EventEmailChanged    = "user.email_changed"
+	// EventUserDeleted is published when an account is deleted and anonymized
+	EventUserDeleted = "user.deleted"
 )
 
 // UserEvent represents a user-related event
@@ -141,3 +154,90 @@ func (p *Publisher) PublishUserLogout(ctx context.Context, userID, sessionID str
 		},
 	})
 }
+
+// PublishSessionCompromised publishes a user.session_compromised event
+func (p *Publisher) PublishSessionCompromised(ctx context.Context, userID, sessionID string) error {
+	return p.Publish(ctx, &UserEvent{
+		Type:   EventSessionCompromised,
+		UserID: userID,
+		Metadata: map[string]interface{}{
+			"session_id": sessionID,
+		},
+	})
+}
+
+// PublishLoginFailed publishes a user.login_failed event
+func (p *Publisher) PublishLoginFailed(ctx context.Context, userID string, failedAttempts int) error {
+	return p.Publish(ctx, &UserEvent{
+		Type:   EventLoginFailed,
+		UserID: userID,
+		Metadata: map[string]interface{}{
+			"failed_attempts": failedAttempts,
+		},
+	})
+}
+
+// PublishUserLocked publishes a user.locked event
+func (p *Publisher) PublishUserLocked(ctx context.Context, userID string, failedAttempts int, lockedUntil time.Time) error {
+	return p.Publish(ctx, &UserEvent{
+		Type:   EventUserLocked,
+		UserID: userID,
+		Metadata: map[string]interface{}{
+			"failed_attempts": failedAttempts,
+			"locked_until":    lockedUntil,
+		},
+	})
+}
+
+// PublishEmailVerified publishes a user.email_verified event
+func (p *Publisher) PublishEmailVerified(ctx context.Context, userID, email string) error {
+	return p.Publish(ctx, &UserEvent{
+		Type:   EventEmailVerified,
+		UserID: userID,
+		Metadata: map[string]interface{}{
+			"email": email,
+		},
+	})
+}
+
+// PublishPasswordChanged publishes a user.password_changed event, reason is reset or change
+func (p *Publisher) PublishPasswordChanged(ctx context.Context, userID, reason string) error {
+	return p.Publish(ctx, &UserEvent{
+		Type:   EventPasswordChanged,
+		UserID: userID,
+		Metadata: map[string]interface{}{
+			"reason": reason,
+		},
+	})
+}
+
+// PublishProfileUpdated publishes a user.profile_updated event
+func (p *Publisher) PublishProfileUpdated(ctx context.Context, userID, username string) error {
+	return p.Publish(ctx, &UserEvent{
+		Type:   EventProfileUpdated,
+		UserID: userID,
+		Metadata: map[string]interface{}{
+			"username": username,
+		},
+	})
+}
+
+// PublishEmailChanged publishes a user.email_changed event
+func (p *Publisher) PublishEmailChanged(ctx context.Context, userID, oldEmail, newEmail string) error {
+	return p.Publish(ctx, &UserEvent{
+		Type:   EventEmailChanged,
+		UserID: userID,
+		Metadata: map[string]interface{}{
+			"old_email": oldEmail,
+			"new_email": newEmail,
+		},
+	})
+}
+
+// PublishUserDeleted publishes a user.deleted event, consumers drop their personal data of the user
+func (p *Publisher) PublishUserDeleted(ctx context.Context, userID string) error {
+	return p.Publish(ctx, &UserEvent{
+		Type:   EventUserDeleted,
+		UserID: userID,
+	})
+}
@@ -1,17 +1,24 @@
 package jwt
 
 import (
+	"cmp"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 var (
-	ErrInvalidToken = errors.New("invalid token")
-	ErrExpiredToken = errors.New("token expired")
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrExpiredToken     = errors.New("token expired")
+	ErrNoSigningKey     = errors.New("no active signing key")
+	ErrUnsupportedAlg   = errors.New("unsupported signing algorithm")
+	ErrSymmetricSigning = errors.New("signing keys are not used with HS256")
 )
 
 // Claims represents JWT claims
@@ -22,13 +29,19 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
-// Manager handles JWT operations
+// Manager handles JWT operations. Tokens are signed either with a shared HMAC secret
+// or with the asymmetric keys of a KeyStore, published as JWKS
 type Manager struct {
 	secret         []byte
 	accessTokenTTL time.Duration
+
+	store  KeyStore
+	cipher *KeyCipher
+	mx     sync.RWMutex
+	keys   map[string]*signingKey
 }
 
-// NewManager creates a new JWT manager
+// NewManager creates a new JWT manager signing with HS256
 func NewManager(secret string, accessTokenTTL time.Duration) *Manager {
 	return &Manager{
 		secret:         []byte(secret),
@@ -36,6 +49,33 @@ func NewManager(secret string, accessTokenTTL time.Duration) *Manager {
 	}
 }
 
+// NewKeyManager creates a new JWT manager signing with the keys of the store, sealed with
+// keyCipher. An empty store gets an alg key active right away
+func NewKeyManager(ctx context.Context, store KeyStore, keyCipher *KeyCipher, alg string, accessTokenTTL time.Duration) (*Manager, error) {
+	m := &Manager{
+		accessTokenTTL: accessTokenTTL,
+		store:          store,
+		cipher:         keyCipher,
+	}
+
+	if err := m.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	if len(m.keys) == 0 {
+		// replicas starting together race for the first key, the one stored first wins
+		_, rotateErr := Rotate(ctx, store, keyCipher, alg, 0, accessTokenTTL)
+		if err := m.Reload(ctx); err != nil {
+			return nil, err
+		}
+		if len(m.keys) == 0 {
+			return nil, fmt.Errorf("create signing key: %w", cmp.Or(rotateErr, ErrNoSigningKey))
+		}
+	}
+
+	return m, nil
+}
+
 // GenerateAccessToken creates a new JWT access token
 func (m *Manager) GenerateAccessToken(userID, sessionID string, roles []string) (string, error) {
 	now := time.Now()
@@ -51,17 +91,38 @@ func (m *Manager) GenerateAccessToken(userID, sessionID string, roles []string)
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(m.secret)
+	if m.store == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString(m.secret)
+	}
+
+	key := m.currentKey(now)
+	if key == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
 }
 
 // ValidateToken validates a JWT token and returns claims
 func (m *Manager) ValidateToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		if m.store == nil {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, ErrInvalidToken
+			}
+			return m.secret, nil
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		key := m.key(kid)
+		// the algorithm comes from the token, it must be the one of the key
+		if key == nil || token.Method.Alg() != key.method.Alg() {
 			return nil, ErrInvalidToken
 		}
-		return m.secret, nil
+		return key.private.Public(), nil
 	})
 
 	if err != nil {
@@ -0,0 +1,333 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+)
+
+// Signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+const (
+	rsaKeyBits = 2048
+	// clockSkew keeps a retired key verifiable a bit longer than the tokens it signed
+	clockSkew = time.Minute
+)
+
+// KeyStore persists the signing keys shared by all replicas
+type KeyStore interface {
+	// List returns the keys that have not expired yet
+	List(ctx context.Context) ([]*domain.SigningKey, error)
+	// Create stores a new key, it fails when its generation is taken by a concurrent rotation
+	Create(ctx context.Context, key *domain.SigningKey) error
+	// ExpireOthers sets the expiration of all keys but kid that don't expire yet
+	ExpireOthers(ctx context.Context, kid string, expiresAt time.Time) error
+}
+
+// KeyCipher seals the private signing keys at rest with AES-256-GCM. The kid is the
+// additional data, a sealed key can't be moved under another kid
+type KeyCipher struct {
+	aead cipher.AEAD
+}
+
+// NewKeyCipher creates a cipher from a base64 encoded 32 byte key (JWT_KEY_ENCRYPTION_KEY)
+func NewKeyCipher(encoded string) (*KeyCipher, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decode key encryption key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key encryption key is %d bytes, want 32", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeyCipher{aead: aead}, nil
+}
+
+// seal returns the nonce followed by the encrypted key
+func (c *KeyCipher) seal(kid string, der []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return c.aead.Seal(nonce, nonce, der, []byte(kid)), nil
+}
+
+func (c *KeyCipher) open(kid string, sealed []byte) ([]byte, error) {
+	if len(sealed) < c.aead.NonceSize() {
+		return nil, errors.New("sealed key too short")
+	}
+
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	der, err := c.aead.Open(nil, nonce, ciphertext, []byte(kid))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt private key: %w", err)
+	}
+
+	return der, nil
+}
+
+type signingKey struct {
+	kid         string
+	method      jwt.SigningMethod
+	private     crypto.Signer
+	activatesAt time.Time
+	expiresAt   *time.Time
+}
+
+// Reload reads the keys from the store, picking up keys rotated by other replicas
+func (m *Manager) Reload(ctx context.Context) error {
+	stored, err := m.store.List(ctx)
+	if err != nil {
+		return fmt.Errorf("list signing keys: %w", err)
+	}
+
+	keys := make(map[string]*signingKey, len(stored))
+	for _, sk := range stored {
+		key, err := parseSigningKey(sk, m.cipher)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", sk.Kid, err)
+		}
+		keys[key.kid] = key
+	}
+
+	m.mx.Lock()
+	m.keys = keys
+	m.mx.Unlock()
+
+	return nil
+}
+
+// Run reloads the keys every interval until ctx is done
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Reload(ctx); err != nil {
+				log.Printf("[ERROR] Failed to reload signing keys: %v", err)
+			}
+		}
+	}
+}
+
+// currentKey is the latest activated key that has not expired
+func (m *Manager) currentKey(now time.Time) *signingKey {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	var current *signingKey
+	for _, key := range m.keys {
+		if key.activatesAt.After(now) || (key.expiresAt != nil && !key.expiresAt.After(now)) {
+			continue
+		}
+		if current == nil || key.activatesAt.After(current.activatesAt) {
+			current = key
+		}
+	}
+
+	return current
+}
+
+func (m *Manager) key(kid string) *signingKey {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	key, ok := m.keys[kid]
+	if !ok || (key.expiresAt != nil && !key.expiresAt.After(time.Now())) {
+		return nil
+	}
+
+	return key
+}
+
+// Rotate creates a new alg signing key taking over after activationDelay. Verifiers get it
+// in the JWKS meanwhile. The keys in use expire once the tokens they have signed by then have.
+// The key takes the next generation, of concurrent rotations only one is stored
+func Rotate(ctx context.Context, store KeyStore, keyCipher *KeyCipher, alg string, activationDelay, accessTokenTTL time.Duration) (*domain.SigningKey, error) {
+	var (
+		private crypto.Signer
+		err     error
+	)
+	switch alg {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case AlgHS256:
+		return nil, ErrSymmetricSigning
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlg, alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	kidBytes := make([]byte, 8)
+	if _, err := rand.Read(kidBytes); err != nil {
+		return nil, err
+	}
+	kid := hex.EncodeToString(kidBytes)
+
+	sealed, err := keyCipher.seal(kid, der)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list signing keys: %w", err)
+	}
+	generation := 0
+	for _, sk := range stored {
+		generation = max(generation, sk.Generation)
+	}
+
+	key := &domain.SigningKey{
+		Kid:         kid,
+		Algorithm:   alg,
+		Generation:  generation + 1,
+		PrivateKey:  sealed,
+		ActivatesAt: time.Now().Add(activationDelay),
+	}
+	if err := store.Create(ctx, key); err != nil {
+		return nil, err
+	}
+
+	if err := store.ExpireOthers(ctx, key.Kid, key.ActivatesAt.Add(accessTokenTTL+clockSkew)); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func parseSigningKey(sk *domain.SigningKey, keyCipher *KeyCipher) (*signingKey, error) {
+	der, err := keyCipher.open(sk.Kid, sk.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{
+		kid:         sk.Kid,
+		activatesAt: sk.ActivatesAt,
+		expiresAt:   sk.ExpiresAt,
+	}
+
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.private = jwt.SigningMethodRS256, private
+	case ed25519.PrivateKey:
+		key.method, key.private = jwt.SigningMethodEdDSA, private
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedAlg, parsed)
+	}
+
+	if key.method.Alg() != sk.Algorithm {
+		return nil, fmt.Errorf("%s key stored as %s", key.method.Alg(), sk.Algorithm)
+	}
+
+	return key, nil
+}
+
+// jsonWebKey is the public part of a signing key (RFC 7517)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// jwks returns the public keys tokens may be signed with, including keys not active yet
+func (m *Manager) jwks() []jsonWebKey {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	now := time.Now()
+	enc := base64.RawURLEncoding.EncodeToString
+
+	keys := make([]jsonWebKey, 0, len(m.keys))
+	for _, key := range m.keys {
+		if key.expiresAt != nil && !key.expiresAt.After(now) {
+			continue
+		}
+
+		jwk := jsonWebKey{Kid: key.kid, Use: "sig", Alg: key.method.Alg()}
+		switch pub := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty, jwk.N, jwk.E = "RSA", enc(pub.N.Bytes()), enc(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty, jwk.Crv, jwk.X = "OKP", "Ed25519", enc(pub)
+		}
+		keys = append(keys, jwk)
+	}
+
+	return keys
+}
+
+// JWKSHandler serves the JWKS at /.well-known/jwks.json
+func (m *Manager) JWKSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := json.Marshal(map[string]interface{}{"keys": m.jwks()})
+		if err != nil {
+			log.Printf("[ERROR] Failed to encode JWKS: %v", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		// verifiers refetch on an unknown kid, a short cache is enough
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		if _, err := w.Write(body); err != nil {
+			log.Printf("[ERROR] Failed to write JWKS: %v", err)
+		}
+	})
+}
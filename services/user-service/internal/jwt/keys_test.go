@@ -0,0 +1,266 @@
+package jwt
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+)
+
+// memKeyStore keeps the keys in memory, generations are unique like the MongoDB index
+type memKeyStore struct {
+	mx   sync.Mutex
+	keys []*domain.SigningKey
+}
+
+func (s *memKeyStore) List(ctx context.Context) ([]*domain.SigningKey, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	var keys []*domain.SigningKey
+	for _, key := range s.keys {
+		if key.ExpiresAt == nil || key.ExpiresAt.After(time.Now()) {
+			copied := *key
+			keys = append(keys, &copied)
+		}
+	}
+
+	return keys, nil
+}
+
+func (s *memKeyStore) Create(ctx context.Context, key *domain.SigningKey) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for _, stored := range s.keys {
+		if stored.Generation == key.Generation {
+			return errors.New("duplicate generation")
+		}
+	}
+
+	copied := *key
+	s.keys = append(s.keys, &copied)
+	return nil
+}
+
+func (s *memKeyStore) ExpireOthers(ctx context.Context, kid string, expiresAt time.Time) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for _, key := range s.keys {
+		if key.Kid != kid && key.ExpiresAt == nil {
+			key.ExpiresAt = &expiresAt
+		}
+	}
+
+	return nil
+}
+
+func testKeyCipher(t *testing.T, b byte) *KeyCipher {
+	t.Helper()
+
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = b
+	}
+	c, err := NewKeyCipher(base64.StdEncoding.EncodeToString(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestNewKeyCipher(t *testing.T) {
+	for _, encoded := range []string{"", "not base64!", base64.StdEncoding.EncodeToString(make([]byte, 16))} {
+		if _, err := NewKeyCipher(encoded); err == nil {
+			t.Errorf("Key %q should be rejected", encoded)
+		}
+	}
+}
+
+func TestRotateSealsPrivateKey(t *testing.T) {
+	ctx := context.Background()
+	store := &memKeyStore{}
+	keyCipher := testKeyCipher(t, 1)
+
+	key, err := Rotate(ctx, store, keyCipher, AlgEdDSA, 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := x509.ParsePKCS8PrivateKey(key.PrivateKey); err == nil {
+		t.Error("Private key is stored in plaintext")
+	}
+	if _, err := parseSigningKey(key, keyCipher); err != nil {
+		t.Errorf("Sealed key should open: %v", err)
+	}
+	if _, err := parseSigningKey(key, testKeyCipher(t, 2)); err == nil {
+		t.Error("Sealed key should not open with another key")
+	}
+
+	moved := *key
+	moved.Kid = "other"
+	if _, err := parseSigningKey(&moved, keyCipher); err == nil {
+		t.Error("Sealed key should not open under another kid")
+	}
+
+	if _, err := Rotate(ctx, store, keyCipher, AlgHS256, 0, time.Minute); !errors.Is(err, ErrSymmetricSigning) {
+		t.Errorf("HS256 rotation should fail with ErrSymmetricSigning, got %v", err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	ctx := context.Background()
+	store := &memKeyStore{}
+	keyCipher := testKeyCipher(t, 1)
+	const ttl = 15 * time.Minute
+
+	m, err := NewKeyManager(ctx, store, keyCipher, AlgEdDSA, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := m.currentKey(time.Now())
+	if first == nil {
+		t.Fatal("New store should get an active key")
+	}
+
+	second, err := Rotate(ctx, store, keyCipher, AlgRS256, 10*time.Minute, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Generation != 2 {
+		t.Errorf("Rotated key generation = %d, want 2", second.Generation)
+	}
+	if err := m.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// the new key is published first, the current one signs until it activates
+	if kid := m.currentKey(time.Now()).kid; kid != first.kid {
+		t.Errorf("Current key = %s before activation, want %s", kid, first.kid)
+	}
+	if kid := m.currentKey(second.ActivatesAt).kid; kid != second.Kid {
+		t.Errorf("Current key = %s after activation, want %s", kid, second.Kid)
+	}
+
+	// the retired key is kept until the tokens it signed have expired
+	retired := m.key(first.kid)
+	if retired == nil || retired.expiresAt == nil {
+		t.Fatal("Retired key should be kept with an expiration")
+	}
+	if want := second.ActivatesAt.Add(ttl + clockSkew); !retired.expiresAt.Equal(want) {
+		t.Errorf("Retired key expires at %s, want %s", retired.expiresAt, want)
+	}
+	if key := m.currentKey(*retired.expiresAt); key == nil || key.kid != second.Kid {
+		t.Errorf("Expired key should not be current, got %v", key)
+	}
+
+	token, err := m.GenerateAccessToken("user-1", "session-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims, err := m.ValidateToken(token); err != nil || claims.UserID != "user-1" {
+		t.Errorf("Token of the current key should validate: %v, %v", claims, err)
+	}
+}
+
+func TestNewKeyManagerConcurrentStart(t *testing.T) {
+	ctx := context.Background()
+	store := &memKeyStore{}
+	keyCipher := testKeyCipher(t, 1)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = NewKeyManager(ctx, store, keyCipher, AlgEdDSA, time.Minute)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Errorf("Replica failed to start: %v", err)
+		}
+	}
+
+	keys, _ := store.List(ctx)
+	active := 0
+	for _, key := range keys {
+		if key.ExpiresAt == nil {
+			active++
+		}
+	}
+	if active != 1 {
+		t.Errorf("Replicas starting together should share one key, got %d", active)
+	}
+}
+
+func TestJWKSHandler(t *testing.T) {
+	ctx := context.Background()
+	store := &memKeyStore{}
+	keyCipher := testKeyCipher(t, 1)
+
+	m, err := NewKeyManager(ctx, store, keyCipher, AlgEdDSA, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := Rotate(ctx, store, keyCipher, AlgRS256, time.Hour, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	m.JWKSHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Unexpected response %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var jwks struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &jwks); err != nil {
+		t.Fatal(err)
+	}
+
+	// the retired key overlaps with the key not active yet
+	var kids []string
+	for _, jwk := range jwks.Keys {
+		kids = append(kids, jwk["kid"])
+		if _, ok := jwk["d"]; ok {
+			t.Errorf("JWK %s leaks the private key", jwk["kid"])
+		}
+
+		switch jwk["alg"] {
+		case AlgEdDSA:
+			if jwk["kty"] != "OKP" || jwk["crv"] != "Ed25519" || jwk["x"] == "" {
+				t.Errorf("Unexpected EdDSA JWK: %v", jwk)
+			}
+		case AlgRS256:
+			if jwk["kty"] != "RSA" || jwk["n"] == "" || jwk["e"] != "AQAB" {
+				t.Errorf("Unexpected RS256 JWK: %v", jwk)
+			}
+		default:
+			t.Errorf("Unexpected JWK: %v", jwk)
+		}
+	}
+	current := m.currentKey(time.Now())
+	if len(kids) != 2 || !slices.Contains(kids, current.kid) || !slices.Contains(kids, next.Kid) {
+		t.Errorf("JWKS kids = %v, want %s and %s", kids, current.kid, next.Kid)
+	}
+}
@@ -0,0 +1,113 @@
+// Package mailer sends the account emails of user-service: email verification and
+// password reset links
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages, SMTP in production and a log or file sink for local runs
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPConfig of the relay the messages are sent through
+type SMTPConfig struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPMailer sends messages through an SMTP relay, STARTTLS is used when the server offers it
+type SMTPMailer struct {
+	cfg SMTPConfig
+}
+
+// NewSMTPMailer creates a mailer for the relay
+func NewSMTPMailer(cfg SMTPConfig) *SMTPMailer {
+	return &SMTPMailer{cfg: cfg}
+}
+
+// Send delivers the message, net/smtp has no context support so ctx is unused
+func (m *SMTPMailer) Send(_ context.Context, msg Message) error {
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		host, _, err := net.SplitHostPort(m.cfg.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid SMTP address %q: %w", m.cfg.Addr, err)
+		}
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, host)
+	}
+
+	if err := smtp.SendMail(m.cfg.Addr, auth, m.cfg.From, []string{msg.To}, format(m.cfg.From, msg)); err != nil {
+		return fmt.Errorf("send mail to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// FileMailer appends messages to a file, or writes them to the log without a path.
+// For local runs and tests, the links of the messages are read from there
+type FileMailer struct {
+	path string
+	from string
+	mx   sync.Mutex
+}
+
+// NewFileMailer creates a sink writing to path, or to the log when path is empty
+func NewFileMailer(path, from string) *FileMailer {
+	return &FileMailer{path: path, from: from}
+}
+
+// Send writes the message
+func (m *FileMailer) Send(_ context.Context, msg Message) error {
+	if m.path == "" {
+		log.Printf("[INFO] Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+		return nil
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(format(m.from, msg), "\r\n"...))
+	return err
+}
+
+// headerValue drops line breaks, addresses come from user input and must not add headers
+var headerValue = strings.NewReplacer("\r", "", "\n", "")
+
+// format renders the message as RFC 5322 text
+func format(from string, msg Message) []byte {
+	from, msg.To, msg.Subject = headerValue.Replace(from), headerValue.Replace(msg.To), headerValue.Replace(msg.Subject)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
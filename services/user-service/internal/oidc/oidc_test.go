@@ -0,0 +1,227 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockProvider is a local OIDC provider issuing a code for every authorization request
+type mockProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mx    sync.Mutex
+	codes map[string]authRequest
+	// claims overrides the ID token claims of the next exchange
+	claims func(c jwt.MapClaims)
+}
+
+type authRequest struct {
+	challenge string
+	nonce     string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &mockProvider{key: key, codes: make(map[string]authRequest)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		enc := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1", "use": "sig", "alg": "RS256",
+			"n": enc(key.N.Bytes()), "e": enc(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("client_id") != "web" || q.Get("code_challenge_method") != "S256" || q.Get("response_type") != "code" {
+			http.Error(w, "bad authorization request", http.StatusBadRequest)
+			return
+		}
+
+		code := "code-" + q.Get("state")
+		m.mx.Lock()
+		m.codes[code] = authRequest{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+		m.mx.Unlock()
+
+		http.Redirect(w, r, q.Get("redirect_uri")+"?code="+code+"&state="+q.Get("state"), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "web" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+
+		m.mx.Lock()
+		ar, ok := m.codes[r.FormValue("code")]
+		delete(m.codes, r.FormValue("code"))
+		m.mx.Unlock()
+
+		if !ok || Challenge(r.FormValue("code_verifier")) != ar.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"iss":            m.URL,
+			"aud":            "web",
+			"sub":            "ext-42",
+			"exp":            time.Now().Add(time.Minute).Unix(),
+			"iat":            time.Now().Unix(),
+			"nonce":          ar.nonce,
+			"email":          "jane@example.com",
+			"email_verified": true,
+			"name":           "Jane",
+		}
+		if m.claims != nil {
+			m.claims(claims)
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "k1"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "access_token": "at", "token_type": "Bearer"})
+	})
+
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+
+	return m
+}
+
+// authorize follows AuthCodeURL like a browser and returns the code of the callback
+func (m *mockProvider) authorize(t *testing.T, p *Provider, state, nonce, verifier string) string {
+	t.Helper()
+
+	authURL, err := p.AuthCodeURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || !strings.HasPrefix(callback.String(), "https://app.example.com/oidc/callback") {
+		t.Fatalf("Unexpected redirect %q (%d)", resp.Header.Get("Location"), resp.StatusCode)
+	}
+	if callback.Query().Get("state") != state {
+		t.Fatalf("State %q not returned", state)
+	}
+
+	return callback.Query().Get("code")
+}
+
+func newTestProvider(m *mockProvider) *Provider {
+	return NewProvider(Config{
+		Name:         "mock",
+		Issuer:       m.URL,
+		ClientID:     "web",
+		ClientSecret: "s3cret",
+		RedirectURL:  "https://app.example.com/oidc/callback",
+	}, m.Client())
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	m := newMockProvider(t)
+	p := newTestProvider(m)
+
+	verifier, _ := RandomString()
+	code := m.authorize(t, p, "state-1", "nonce-1", verifier)
+
+	claims, err := p.Authenticate(context.Background(), code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "ext-42" || claims.Email != "jane@example.com" || !claims.EmailVerified || claims.Name != "Jane" {
+		t.Errorf("Unexpected claims %+v", claims)
+	}
+
+	// a code is redeemed once
+	if _, err := p.Authenticate(context.Background(), code, verifier, "nonce-1"); !errors.Is(err, ErrExchange) {
+		t.Errorf("Code reuse should fail the exchange, got %v", err)
+	}
+}
+
+func TestAuthenticateErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		verifier string
+		nonce    string
+		claims   func(c jwt.MapClaims)
+		err      error
+	}{
+		{name: "wrong verifier", verifier: "other-verifier", nonce: "nonce-1", err: ErrExchange},
+		{name: "wrong nonce", nonce: "nonce-2", err: ErrInvalidIDToken},
+		{name: "other audience", nonce: "nonce-1", claims: func(c jwt.MapClaims) { c["aud"] = "mobile" }, err: ErrInvalidIDToken},
+		{name: "other issuer", nonce: "nonce-1", claims: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, err: ErrInvalidIDToken},
+		{name: "expired", nonce: "nonce-1", claims: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, err: ErrInvalidIDToken},
+		{name: "no subject", nonce: "nonce-1", claims: func(c jwt.MapClaims) { c["sub"] = "" }, err: ErrInvalidIDToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockProvider(t)
+			m.claims = tt.claims
+			p := newTestProvider(m)
+
+			verifier, _ := RandomString()
+			code := m.authorize(t, p, "state-1", "nonce-1", verifier)
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+
+			if _, err := p.Authenticate(context.Background(), code, verifier, tt.nonce); !errors.Is(err, tt.err) {
+				t.Errorf("Authenticate() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	// RFC 7636 appendix B
+	if got := Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("Challenge() = %q", got)
+	}
+}
@@ -0,0 +1,119 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrAPIKeyRevoked  = errors.New("api key revoked")
+	ErrAPIKeyExpired  = errors.New("api key expired")
+)
+
+// APIKeyRepository handles API key persistence
+type APIKeyRepository struct {
+	collection *mongo.Collection
+}
+
+// NewAPIKeyRepository creates a new API key repository
+func NewAPIKeyRepository(db *mongo.Database) *APIKeyRepository {
+	return &APIKeyRepository{
+		collection: db.Collection("api_keys"),
+	}
+}
+
+// EnsureIndexes creates required indexes
+func (r *APIKeyRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "key_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "client_id", Value: 1}},
+			Options: options.Index(),
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// Create stores a new API key, key is hashed
+func (r *APIKeyRepository) Create(ctx context.Context, apiKey *domain.APIKey, key string) error {
+	apiKey.KeyHash = hashToken(key)
+	apiKey.CreatedAt = time.Now()
+
+	result, err := r.collection.InsertOne(ctx, apiKey)
+	if err != nil {
+		return err
+	}
+
+	apiKey.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// FindByKey finds an API key and checks it is neither revoked nor expired
+func (r *APIKeyRepository) FindByKey(ctx context.Context, key string) (*domain.APIKey, error) {
+	var apiKey domain.APIKey
+	err := r.collection.FindOne(ctx, bson.M{"key_hash": hashToken(key)}).Decode(&apiKey)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, err
+	}
+
+	if apiKey.RevokedAt != nil {
+		return nil, ErrAPIKeyRevoked
+	}
+	if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+		return nil, ErrAPIKeyExpired
+	}
+
+	return &apiKey, nil
+}
+
+// List returns the API keys of a client, of all clients if clientID is empty
+func (r *APIKeyRepository) List(ctx context.Context, clientID string) ([]*domain.APIKey, error) {
+	filter := bson.M{}
+	if clientID != "" {
+		filter["client_id"] = clientID
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*domain.APIKey
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Revoke marks an API key as revoked, revoking it again keeps the first revocation time
+func (r *APIKeyRepository) Revoke(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id},
+		[]bson.M{{"$set": bson.M{"revoked_at": bson.M{"$ifNull": bson.A{"$revoked_at", time.Now()}}}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
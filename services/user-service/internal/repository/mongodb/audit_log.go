@@ -0,0 +1,81 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditLogRepository keeps the audit trail of the admin user management, entries are never
+// updated or removed
+type AuditLogRepository struct {
+	collection *mongo.Collection
+}
+
+// NewAuditLogRepository creates a new audit log repository
+func NewAuditLogRepository(db *mongo.Database) *AuditLogRepository {
+	return &AuditLogRepository{
+		collection: db.Collection("audit_log"),
+	}
+}
+
+// EnsureIndexes creates required indexes
+func (r *AuditLogRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "target_id", Value: 1}, {Key: "_id", Value: -1}},
+			Options: options.Index(),
+		},
+		{
+			Keys:    bson.D{{Key: "actor_id", Value: 1}, {Key: "_id", Value: -1}},
+			Options: options.Index(),
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// Create appends an entry
+func (r *AuditLogRepository) Create(ctx context.Context, entry *domain.AuditEntry) error {
+	entry.CreatedAt = time.Now()
+
+	result, err := r.collection.InsertOne(ctx, entry)
+	if err != nil {
+		return err
+	}
+
+	entry.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// List returns entries newest first, of the target user when targetID isn't zero. Entries
+// before the cursor entry are returned when after isn't zero, for the next page
+func (r *AuditLogRepository) List(ctx context.Context, targetID, after primitive.ObjectID, limit int64) ([]*domain.AuditEntry, error) {
+	filter := bson.M{}
+	if !targetID.IsZero() {
+		filter["target_id"] = targetID
+	}
+	if !after.IsZero() {
+		filter["_id"] = bson.M{"$lt": after}
+	}
+
+	cursor, err := r.collection.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var entries []*domain.AuditEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
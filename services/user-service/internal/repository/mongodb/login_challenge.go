@@ -0,0 +1,101 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrLoginChallengeNotFound = errors.New("login challenge not found")
+
+// LoginChallengeRepository keeps logins waiting for the second factor
+type LoginChallengeRepository struct {
+	collection *mongo.Collection
+}
+
+// NewLoginChallengeRepository creates a new login challenge repository
+func NewLoginChallengeRepository(db *mongo.Database) *LoginChallengeRepository {
+	return &LoginChallengeRepository{
+		collection: db.Collection("login_challenges"),
+	}
+}
+
+// EnsureIndexes creates required indexes
+func (r *LoginChallengeRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0), // TTL index
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// Create stores a challenge of the user under the hash of its token
+func (r *LoginChallengeRepository) Create(ctx context.Context, token string, userID primitive.ObjectID, enrollment bool, ttl time.Duration) error {
+	now := time.Now()
+	_, err := r.collection.InsertOne(ctx, &domain.LoginChallenge{
+		TokenHash:  hashToken(token),
+		UserID:     userID,
+		Enrollment: enrollment,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(ttl),
+	})
+	return err
+}
+
+// Find returns the challenge of the token
+func (r *LoginChallengeRepository) Find(ctx context.Context, token string) (*domain.LoginChallenge, error) {
+	var ch domain.LoginChallenge
+	err := r.collection.FindOne(ctx, bson.M{
+		"token_hash": hashToken(token),
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&ch)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrLoginChallengeNotFound
+		}
+		return nil, err
+	}
+	return &ch, nil
+}
+
+// Attempt counts a code check against the challenge, a challenge with maxAttempts
+// checks is not found anymore
+func (r *LoginChallengeRepository) Attempt(ctx context.Context, token string, maxAttempts int) (*domain.LoginChallenge, error) {
+	var ch domain.LoginChallenge
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{
+			"token_hash": hashToken(token),
+			"expires_at": bson.M{"$gt": time.Now()},
+			"attempts":   bson.M{"$lt": maxAttempts},
+		},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&ch)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrLoginChallengeNotFound
+		}
+		return nil, err
+	}
+	return &ch, nil
+}
+
+// Delete removes the challenge once the login completed
+func (r *LoginChallengeRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
@@ -0,0 +1,75 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrOIDCStateNotFound = errors.New("OIDC state not found")
+
+// OIDCStateRepository keeps started OIDC logins until the provider redirects back
+type OIDCStateRepository struct {
+	collection *mongo.Collection
+}
+
+// NewOIDCStateRepository creates a new OIDC state repository
+func NewOIDCStateRepository(db *mongo.Database) *OIDCStateRepository {
+	return &OIDCStateRepository{
+		collection: db.Collection("oidc_states"),
+	}
+}
+
+// EnsureIndexes creates required indexes
+func (r *OIDCStateRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "state_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0), // TTL index
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// Create stores a started login under the hash of its state
+func (r *OIDCStateRepository) Create(ctx context.Context, state string, st *domain.OIDCState) error {
+	st.StateHash = hashToken(state)
+	st.CreatedAt = time.Now()
+
+	result, err := r.collection.InsertOne(ctx, st)
+	if err != nil {
+		return err
+	}
+
+	st.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// Take returns the login of the state and deletes it, a state completes one login only
+func (r *OIDCStateRepository) Take(ctx context.Context, state string) (*domain.OIDCState, error) {
+	var st domain.OIDCState
+	// the TTL monitor runs once a minute, an expired state may still be there
+	err := r.collection.FindOneAndDelete(ctx, bson.M{
+		"state_hash": hashToken(state),
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&st)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrOIDCStateNotFound
+		}
+		return nil, err
+	}
+	return &st, nil
+}
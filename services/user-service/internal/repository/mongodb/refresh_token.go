@@ -17,6 +17,7 @@ import (
 var (
 	ErrRefreshTokenNotFound = errors.New("refresh token not found")
 	ErrRefreshTokenExpired  = errors.New("refresh token expired")
+	ErrRefreshTokenReused   = errors.New("refresh token already used")
 )
 
 // RefreshTokenRepository handles refresh token persistence
@@ -58,21 +59,55 @@ func hashToken(token string) string {
 	return hex.EncodeToString(hash[:])
 }
 
-// Create stores a new refresh token
-func (r *RefreshTokenRepository) Create(ctx context.Context, token string, userID primitive.ObjectID, sessionID string, ttl time.Duration) error {
-	refreshToken := &domain.RefreshToken{
-		TokenHash: hashToken(token),
-		UserID:    userID,
-		SessionID: sessionID,
-		ExpiresAt: time.Now().Add(ttl),
-		CreatedAt: time.Now(),
+// Create stores a new refresh token of the session, the start of a new session is now
+func (r *RefreshTokenRepository) Create(ctx context.Context, token string, refreshToken *domain.RefreshToken, ttl time.Duration) error {
+	now := time.Now()
+	refreshToken.TokenHash = hashToken(token)
+	refreshToken.ExpiresAt = now.Add(ttl)
+	refreshToken.CreatedAt = now
+	refreshToken.LastUsedAt = now
+	if refreshToken.SessionStartedAt.IsZero() {
+		refreshToken.SessionStartedAt = now
 	}
 
 	_, err := r.collection.InsertOne(ctx, refreshToken)
 	return err
 }
 
-// Find finds a refresh token and validates it hasn't expired
+// Use marks a live refresh token as spent by the successor and returns it. A token spent
+// before is returned with ErrRefreshTokenReused: either it was stolen or the legitimate
+// client replays it. An expired token is never marked
+func (r *RefreshTokenRepository) Use(ctx context.Context, token string, successor []byte) (*domain.RefreshToken, error) {
+	hash := hashToken(token)
+	now := time.Now()
+
+	var refreshToken domain.RefreshToken
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"token_hash": hash, "used_at": nil, "expires_at": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"used_at": now, "successor": successor}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&refreshToken)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// unknown, expired or already spent, concurrent exchanges of the same token end up here too
+		if err := r.collection.FindOne(ctx, bson.M{"token_hash": hash}).Decode(&refreshToken); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, ErrRefreshTokenNotFound
+			}
+			return nil, err
+		}
+		if refreshToken.UsedAt == nil {
+			return nil, ErrRefreshTokenExpired
+		}
+		return &refreshToken, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &refreshToken, nil
+}
+
+// Find returns a refresh token, spent or not
 func (r *RefreshTokenRepository) Find(ctx context.Context, token string) (*domain.RefreshToken, error) {
 	var refreshToken domain.RefreshToken
 	err := r.collection.FindOne(ctx, bson.M{"token_hash": hashToken(token)}).Decode(&refreshToken)
@@ -83,10 +118,6 @@ func (r *RefreshTokenRepository) Find(ctx context.Context, token string) (*domai
 		return nil, err
 	}
 
-	if time.Now().After(refreshToken.ExpiresAt) {
-		return nil, ErrRefreshTokenExpired
-	}
-
 	return &refreshToken, nil
 }
 
@@ -107,3 +138,63 @@ func (r *RefreshTokenRepository) DeleteBySessionID(ctx context.Context, sessionI
 	_, err := r.collection.DeleteMany(ctx, bson.M{"session_id": sessionID})
 	return err
 }
+
+// FindBySessionID finds the refresh token of a session
+func (r *RefreshTokenRepository) FindBySessionID(ctx context.Context, sessionID string) (*domain.RefreshToken, error) {
+	var refreshToken domain.RefreshToken
+	err := r.collection.FindOne(ctx, bson.M{"session_id": sessionID}).Decode(&refreshToken)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrRefreshTokenNotFound
+		}
+		return nil, err
+	}
+
+	return &refreshToken, nil
+}
+
+// ListActive returns the live refresh tokens of a user, one per session, most recently used
+// first. Spent tokens kept as replay markers are left out
+func (r *RefreshTokenRepository) ListActive(ctx context.Context, userID primitive.ObjectID) ([]*domain.RefreshToken, error) {
+	cursor, err := r.collection.Find(ctx,
+		bson.M{"user_id": userID, "used_at": nil, "expires_at": bson.M{"$gt": time.Now()}},
+		options.Find().SetSort(bson.D{{Key: "last_used_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tokens []*domain.RefreshToken
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// HasSession reports whether the user has refresh tokens of the session
+func (r *RefreshTokenRepository) HasSession(ctx context.Context, userID primitive.ObjectID, sessionID string) (bool, error) {
+	n, err := r.collection.CountDocuments(ctx, bson.M{"user_id": userID, "session_id": sessionID}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// SessionIDsByUserID returns the sessions a user has refresh tokens for
+func (r *RefreshTokenRepository) SessionIDsByUserID(ctx context.Context, userID primitive.ObjectID) ([]string, error) {
+	values, err := r.collection.Distinct(ctx, "session_id", bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+
+	sessionIDs := make([]string, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(string); ok {
+			sessionIDs = append(sessionIDs, id)
+		}
+	}
+
+	return sessionIDs, nil
+}
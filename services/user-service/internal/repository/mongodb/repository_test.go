@@ -0,0 +1,252 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testDB returns a fresh database on the MongoDB of MONGODB_URI, dropped after the test.
+// The tests check the atomic updates the service relies on, which the in-memory stores
+// of the service tests only imitate
+func testDB(t *testing.T) *mongo.Database {
+	t.Helper()
+
+	uri := os.Getenv("MONGODB_URI")
+	if uri == "" {
+		t.Skip("MONGODB_URI is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatalf("MongoDB at MONGODB_URI: %v", err)
+	}
+
+	db := client.Database("user_service_test_" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() {
+		ctx := context.Background()
+		_ = db.Drop(ctx)
+		_ = client.Disconnect(ctx)
+	})
+
+	return db
+}
+
+// concurrently runs op n times at once and returns the number of calls without an error
+func concurrently(n int, op func() error) int {
+	var (
+		wg sync.WaitGroup
+		mx sync.Mutex
+		ok int
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if op() == nil {
+				mx.Lock()
+				ok++
+				mx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return ok
+}
+
+func TestRefreshTokenUse(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRefreshTokenRepository(testDB(t))
+	if err := repo.EnsureIndexes(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	userID := primitive.NewObjectID()
+	if err := repo.Create(ctx, "token", &domain.RefreshToken{UserID: userID, SessionID: "session"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	used, err := repo.Use(ctx, "token", []byte("successor"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used.UsedAt == nil || string(used.Successor) != "successor" || used.SessionID != "session" {
+		t.Errorf("Used token = %+v", used)
+	}
+
+	// a replay gets the spent token with its successor
+	replayed, err := repo.Use(ctx, "token", []byte("other"))
+	if !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Second Use: got %v, want ErrRefreshTokenReused", err)
+	}
+	if string(replayed.Successor) != "successor" {
+		t.Errorf("Successor after a replay = %q, want the first one", replayed.Successor)
+	}
+
+	if _, err := repo.Use(ctx, "unknown", nil); !errors.Is(err, ErrRefreshTokenNotFound) {
+		t.Errorf("Unknown token: got %v, want ErrRefreshTokenNotFound", err)
+	}
+
+	if err := repo.Create(ctx, "expired", &domain.RefreshToken{UserID: userID, SessionID: "session"}, -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Use(ctx, "expired", nil); !errors.Is(err, ErrRefreshTokenExpired) {
+		t.Errorf("Expired token: got %v, want ErrRefreshTokenExpired", err)
+	}
+	if expired, err := repo.Find(ctx, "expired"); err != nil || expired.UsedAt != nil {
+		t.Errorf("Expired token should not be marked used: %+v, %v", expired, err)
+	}
+}
+
+func TestRefreshTokenUseConcurrent(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRefreshTokenRepository(testDB(t))
+
+	if err := repo.Create(ctx, "token", &domain.RefreshToken{UserID: primitive.NewObjectID(), SessionID: "session"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	ok := concurrently(10, func() error {
+		_, err := repo.Use(ctx, "token", []byte("successor"))
+		return err
+	})
+	if ok != 1 {
+		t.Errorf("%d concurrent exchanges of a token succeeded, want 1", ok)
+	}
+}
+
+func TestLoginChallengeAttempt(t *testing.T) {
+	ctx := context.Background()
+	repo := NewLoginChallengeRepository(testDB(t))
+	if err := repo.EnsureIndexes(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	userID := primitive.NewObjectID()
+	if err := repo.Create(ctx, "challenge", userID, false, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	for want := 1; want <= 3; want++ {
+		ch, err := repo.Attempt(ctx, "challenge", 3)
+		if err != nil {
+			t.Fatalf("Attempt %d: %v", want, err)
+		}
+		if ch.Attempts != want || ch.UserID != userID {
+			t.Errorf("Attempt %d = %+v", want, ch)
+		}
+	}
+	if _, err := repo.Attempt(ctx, "challenge", 3); !errors.Is(err, ErrLoginChallengeNotFound) {
+		t.Errorf("Attempt past the limit: got %v, want ErrLoginChallengeNotFound", err)
+	}
+
+	if err := repo.Create(ctx, "expired", userID, false, -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Attempt(ctx, "expired", 3); !errors.Is(err, ErrLoginChallengeNotFound) {
+		t.Errorf("Expired challenge: got %v, want ErrLoginChallengeNotFound", err)
+	}
+}
+
+func TestLoginChallengeAttemptConcurrent(t *testing.T) {
+	ctx := context.Background()
+	repo := NewLoginChallengeRepository(testDB(t))
+
+	if err := repo.Create(ctx, "challenge", primitive.NewObjectID(), false, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	ok := concurrently(20, func() error {
+		_, err := repo.Attempt(ctx, "challenge", 5)
+		return err
+	})
+	if ok != 5 {
+		t.Errorf("%d concurrent attempts passed, want 5", ok)
+	}
+}
+
+func TestUseTOTPStep(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepository(testDB(t))
+
+	user := &domain.User{Email: "user@example.com"}
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetTOTPSecret(ctx, user.ID, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	// the enrollment code used step 10
+	if err := repo.EnableTOTP(ctx, user.ID, 10, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, step := range []int64{9, 10} {
+		if err := repo.UseTOTPStep(ctx, user.ID, step); !errors.Is(err, ErrTOTPCodeUsed) {
+			t.Errorf("Step %d: got %v, want ErrTOTPCodeUsed", step, err)
+		}
+	}
+	if err := repo.UseTOTPStep(ctx, user.ID, 11); err != nil {
+		t.Fatal(err)
+	}
+
+	ok := concurrently(10, func() error {
+		return repo.UseTOTPStep(ctx, user.ID, 12)
+	})
+	if ok != 1 {
+		t.Errorf("%d concurrent uses of a code succeeded, want 1", ok)
+	}
+}
+
+func TestRecordLoginFailure(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepository(testDB(t))
+
+	user := &domain.User{Email: "user@example.com"}
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	ok := concurrently(10, func() error {
+		_, err := repo.RecordLoginFailure(ctx, user.ID, time.Hour)
+		return err
+	})
+	if ok != 10 {
+		t.Fatalf("%d of 10 failures recorded", ok)
+	}
+	lockout, err := repo.RecordLoginFailure(ctx, user.ID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lockout.FailedAttempts != 11 {
+		t.Errorf("Failed attempts = %d, want 11", lockout.FailedAttempts)
+	}
+
+	// failures before the window start over
+	lockout, err = repo.RecordLoginFailure(ctx, user.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lockout.FailedAttempts != 1 {
+		t.Errorf("Failed attempts after the window = %d, want 1", lockout.FailedAttempts)
+	}
+
+	if _, err := repo.RecordLoginFailure(ctx, primitive.NewObjectID(), time.Hour); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Unknown user: got %v, want ErrUserNotFound", err)
+	}
+}
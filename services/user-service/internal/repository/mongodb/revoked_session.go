@@ -0,0 +1,68 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RevokedSessionRepository keeps revoked sessions until their access tokens expire
+type RevokedSessionRepository struct {
+	collection *mongo.Collection
+}
+
+// NewRevokedSessionRepository creates a new revoked session repository
+func NewRevokedSessionRepository(db *mongo.Database) *RevokedSessionRepository {
+	return &RevokedSessionRepository{
+		collection: db.Collection("revoked_sessions"),
+	}
+}
+
+// EnsureIndexes creates required indexes
+func (r *RevokedSessionRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "session_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0), // TTL index
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// Revoke marks the session as revoked for ttl
+func (r *RevokedSessionRepository) Revoke(ctx context.Context, sessionID string, ttl time.Duration) error {
+	now := time.Now()
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"session_id": sessionID},
+		bson.M{"$set": bson.M{"revoked_at": now, "expires_at": now.Add(ttl)}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// IsRevoked checks whether the session is revoked
+func (r *RevokedSessionRepository) IsRevoked(ctx context.Context, sessionID string) (bool, error) {
+	// the TTL monitor runs once a minute, an expired entry may still be there
+	err := r.collection.FindOne(ctx, bson.M{
+		"session_id": sessionID,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
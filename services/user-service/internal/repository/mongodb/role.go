@@ -0,0 +1,133 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrRoleAlreadyExists = errors.New("role already exists")
+)
+
+// RoleRepository handles role persistence
+type RoleRepository struct {
+	collection *mongo.Collection
+}
+
+// NewRoleRepository creates a new role repository
+func NewRoleRepository(db *mongo.Database) *RoleRepository {
+	return &RoleRepository{
+		collection: db.Collection("roles"),
+	}
+}
+
+// EnsureIndexes creates required indexes
+func (r *RoleRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// EnsureDefaults creates the roles that don't exist yet, existing roles are left as they are
+func (r *RoleRepository) EnsureDefaults(ctx context.Context, roles []*domain.Role) error {
+	for _, role := range roles {
+		now := time.Now()
+		_, err := r.collection.UpdateOne(ctx,
+			bson.M{"name": role.Name},
+			bson.M{"$setOnInsert": bson.M{
+				"permissions": role.Permissions,
+				"created_at":  now,
+				"updated_at":  now,
+			}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// List returns all roles ordered by name
+func (r *RoleRepository) List(ctx context.Context) ([]*domain.Role, error) {
+	return r.find(ctx, bson.M{})
+}
+
+// FindByNames returns the existing roles of the names
+func (r *RoleRepository) FindByNames(ctx context.Context, names []string) ([]*domain.Role, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	return r.find(ctx, bson.M{"name": bson.M{"$in": names}})
+}
+
+func (r *RoleRepository) find(ctx context.Context, filter bson.M) ([]*domain.Role, error) {
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []*domain.Role
+	if err := cursor.All(ctx, &roles); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// Create creates a new role
+func (r *RoleRepository) Create(ctx context.Context, role *domain.Role) error {
+	role.CreatedAt = time.Now()
+	role.UpdatedAt = role.CreatedAt
+
+	if _, err := r.collection.InsertOne(ctx, role); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrRoleAlreadyExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+// UpdatePermissions replaces the permissions of a role and returns the updated role
+func (r *RoleRepository) UpdatePermissions(ctx context.Context, name string, permissions []string) (*domain.Role, error) {
+	var role domain.Role
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"name": name},
+		bson.M{"$set": bson.M{"permissions": permissions, "updated_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&role)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+// Delete removes a role
+func (r *RoleRepository) Delete(ctx context.Context, name string) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"name": name})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrRoleNotFound
+	}
+
+	return nil
+}
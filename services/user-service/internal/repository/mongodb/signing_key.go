@@ -0,0 +1,82 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SigningKeyRepository handles access token signing key persistence
+type SigningKeyRepository struct {
+	collection *mongo.Collection
+}
+
+// NewSigningKeyRepository creates a new signing key repository
+func NewSigningKeyRepository(db *mongo.Database) *SigningKeyRepository {
+	return &SigningKeyRepository{
+		collection: db.Collection("signing_keys"),
+	}
+}
+
+// EnsureIndexes creates required indexes
+func (r *SigningKeyRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "kid", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			// concurrent rotations compute the same generation, only one of them is stored
+			Keys: bson.D{{Key: "generation", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"generation": bson.M{"$gt": 0}}),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0), // TTL index, keys being used have no expires_at
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// List returns the keys that have not expired yet
+func (r *SigningKeyRepository) List(ctx context.Context) ([]*domain.SigningKey, error) {
+	// the TTL monitor runs once a minute, expired keys may still be there
+	cursor, err := r.collection.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"expires_at": nil},
+		bson.M{"expires_at": bson.M{"$gt": time.Now()}},
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*domain.SigningKey
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Create stores a new key
+func (r *SigningKeyRepository) Create(ctx context.Context, key *domain.SigningKey) error {
+	key.CreatedAt = time.Now()
+
+	_, err := r.collection.InsertOne(ctx, key)
+	return err
+}
+
+// ExpireOthers sets the expiration of all keys but kid that don't expire yet
+func (r *SigningKeyRepository) ExpireOthers(ctx context.Context, kid string, expiresAt time.Time) error {
+	_, err := r.collection.UpdateMany(ctx,
+		bson.M{"kid": bson.M{"$ne": kid}, "expires_at": nil},
+		bson.M{"$set": bson.M{"expires_at": expiresAt}},
+	)
+	return err
+}
@@ -3,6 +3,8 @@ package mongodb
 import (
 	"context"
 	"errors"
+	"regexp"
+	"strings"
 	"time"
 
 	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
@@ -13,8 +15,11 @@ import (
 )
 
 var (
-	ErrUserNotFound      = errors.New("user not found")
-	ErrUserAlreadyExists = errors.New("user already exists")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrUserAlreadyExists     = errors.New("user already exists")
+	ErrIdentityAlreadyLinked = errors.New("identity is linked to another user")
+	ErrTOTPCodeUsed          = errors.New("TOTP code already used")
+	ErrRecoveryCodeInvalid   = errors.New("invalid recovery code")
 )
 
 // UserRepository handles user persistence
@@ -31,10 +36,20 @@ func NewUserRepository(db *mongo.Database) *UserRepository {
 
 // EnsureIndexes creates required indexes
 func (r *UserRepository) EnsureIndexes(ctx context.Context) error {
-	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
-		Keys:    bson.D{{Key: "email", Value: 1}},
-		Options: options.Index().SetUnique(true),
-	})
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			// an identity belongs to one user, users without identities are not indexed
+			Keys: bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.subject", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"identities.subject": bson.M{"$exists": true}}),
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
 	return err
 }
 
@@ -55,10 +70,10 @@ func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
 	return nil
 }
 
-// FindByEmail finds a user by email
+// FindByEmail finds a user by email, the Find methods skip deleted users
 func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
 	var user domain.User
-	err := r.collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	err := r.collection.FindOne(ctx, bson.M{"email": email, "deleted_at": nil}).Decode(&user)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, ErrUserNotFound
@@ -70,6 +85,269 @@ func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*domain
 
 // FindByID finds a user by ID
 func (r *UserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*domain.User, error) {
+	var user domain.User
+	err := r.collection.FindOne(ctx, bson.M{"_id": id, "deleted_at": nil}).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// FindByIdentity finds the user an OIDC identity is linked to
+func (r *UserRepository) FindByIdentity(ctx context.Context, provider, subject string) (*domain.User, error) {
+	var user domain.User
+	err := r.collection.FindOne(ctx, bson.M{
+		"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": subject}},
+		"deleted_at": nil,
+	}).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// AddIdentity links an OIDC identity to the user and returns the updated user
+func (r *UserRepository) AddIdentity(ctx context.Context, id primitive.ObjectID, identity domain.Identity) (*domain.User, error) {
+	var user domain.User
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id},
+		bson.M{
+			"$push": bson.M{"identities": identity},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrUserNotFound
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrIdentityAlreadyLinked
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetTOTPSecret stores the secret of a TOTP enrollment, replacing an unconfirmed one
+func (r *UserRepository) SetTOTPSecret(ctx context.Context, id primitive.ObjectID, secret string) error {
+	return r.updateOne(ctx, bson.M{"_id": id, "totp.enabled": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"totp": domain.TOTP{Secret: secret}, "updated_at": time.Now()}})
+}
+
+// EnableTOTP confirms the enrollment with the code of step and stores the recovery codes hashed
+func (r *UserRepository) EnableTOTP(ctx context.Context, id primitive.ObjectID, step int64, recoveryCodes []string) error {
+	hashes := make([]string, 0, len(recoveryCodes))
+	for _, code := range recoveryCodes {
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	now := time.Now()
+	return r.updateOne(ctx, bson.M{"_id": id, "totp.secret": bson.M{"$exists": true}},
+		bson.M{"$set": bson.M{
+			"totp.enabled":        true,
+			"totp.enabled_at":     now,
+			"totp.recovery_codes": hashes,
+			"totp.last_step":      step,
+			"updated_at":          now,
+		}})
+}
+
+// DisableTOTP removes the second factor of the user
+func (r *UserRepository) DisableTOTP(ctx context.Context, id primitive.ObjectID) error {
+	return r.updateOne(ctx, bson.M{"_id": id},
+		bson.M{"$unset": bson.M{"totp": ""}, "$set": bson.M{"updated_at": time.Now()}})
+}
+
+// UseTOTPStep records step as the last accepted one, fails for a step not after it
+func (r *UserRepository) UseTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) error {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "totp.last_step": bson.M{"$lt": step}},
+		bson.M{"$set": bson.M{"totp.last_step": step}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrTOTPCodeUsed
+	}
+	return nil
+}
+
+// UseRecoveryCode removes the recovery code from the user, fails for an unknown or used code
+func (r *UserRepository) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, code string) error {
+	hash := hashRecoveryCode(code)
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "totp.recovery_codes": hash},
+		bson.M{"$pull": bson.M{"totp.recovery_codes": hash}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return ErrRecoveryCodeInvalid
+	}
+	return nil
+}
+
+// RecordLoginFailure counts a failed password login and returns the updated lockout,
+// failures older than window are forgotten
+func (r *UserRepository) RecordLoginFailure(ctx context.Context, id primitive.ObjectID, window time.Duration) (*domain.Lockout, error) {
+	now := time.Now()
+
+	// a pipeline update keeps the reset and the increment atomic under concurrent attempts
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"lockout.failed_attempts": bson.M{"$cond": bson.A{
+			bson.M{"$gt": bson.A{"$lockout.last_failed_at", now.Add(-window)}},
+			bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$lockout.failed_attempts", 0}}, 1}},
+			1,
+		}},
+		"lockout.last_failed_at": now,
+	}}}}
+
+	var user domain.User
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return user.Lockout, nil
+}
+
+// LockUntil rejects the password logins of the user until the time
+func (r *UserRepository) LockUntil(ctx context.Context, id primitive.ObjectID, until time.Time) error {
+	return r.updateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"lockout.locked_until": until}})
+}
+
+// ClearLockout forgets the failed logins and lifts a lockout of the user
+func (r *UserRepository) ClearLockout(ctx context.Context, id primitive.ObjectID) error {
+	return r.updateOne(ctx, bson.M{"_id": id}, bson.M{"$unset": bson.M{"lockout": ""}})
+}
+
+// SetEmailVerified marks the email of the user verified while it is still email
+func (r *UserRepository) SetEmailVerified(ctx context.Context, id primitive.ObjectID, email string) error {
+	return r.updateOne(ctx, bson.M{"_id": id, "email": email},
+		bson.M{"$set": bson.M{"email_verified": true, "updated_at": time.Now()}})
+}
+
+// SetPassword replaces the password hash of the user
+func (r *UserRepository) SetPassword(ctx context.Context, id primitive.ObjectID, passwordHash string) error {
+	return r.updateOne(ctx, bson.M{"_id": id},
+		bson.M{"$set": bson.M{"password_hash": passwordHash, "updated_at": time.Now()}})
+}
+
+// UpdateProfile sets the username and returns the updated user
+func (r *UserRepository) UpdateProfile(ctx context.Context, id primitive.ObjectID, username string) (*domain.User, error) {
+	var user domain.User
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "deleted_at": nil},
+		bson.M{"$set": bson.M{"username": username, "updated_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetEmail replaces the email of the user, unverified until the new address is confirmed
+func (r *UserRepository) SetEmail(ctx context.Context, id primitive.ObjectID, email string) error {
+	err := r.updateOne(ctx, bson.M{"_id": id, "deleted_at": nil},
+		bson.M{"$set": bson.M{"email": email, "email_verified": false, "updated_at": time.Now()}})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrUserAlreadyExists
+	}
+	return err
+}
+
+// SoftDelete marks the user deleted and drops the personal data, the document stays for
+// references by ID. The email becomes a unique placeholder so the address can register again
+func (r *UserRepository) SoftDelete(ctx context.Context, id primitive.ObjectID) error {
+	now := time.Now()
+	return r.updateOne(ctx, bson.M{"_id": id, "deleted_at": nil}, bson.M{
+		"$set": bson.M{
+			"email":          "deleted-" + id.Hex() + "@deleted.invalid",
+			"email_verified": false,
+			"username":       "deleted-user",
+			"password_hash":  "",
+			"roles":          []string{},
+			"deleted_at":     now,
+			"updated_at":     now,
+		},
+		"$unset": bson.M{"permissions": "", "identities": "", "totp": "", "lockout": ""},
+	})
+}
+
+// User statuses of UserFilter
+const (
+	UserStatusActive   = "active"
+	UserStatusDisabled = "disabled"
+	UserStatusDeleted  = "deleted"
+)
+
+// UserFilter selects the users of List, empty fields match all. Deleted users are only
+// listed with UserStatusDeleted
+type UserFilter struct {
+	// Query matches the start of the email or username, ignoring case
+	Query  string
+	Role   string
+	Status string
+}
+
+// List returns users newest first matching the filter. Users before the cursor user are
+// returned when after isn't zero, for the next page
+func (r *UserRepository) List(ctx context.Context, f UserFilter, after primitive.ObjectID, limit int64) ([]*domain.User, error) {
+	filter := bson.M{"deleted_at": nil}
+	if f.Query != "" {
+		prefix := primitive.Regex{Pattern: "^" + regexp.QuoteMeta(f.Query), Options: "i"}
+		filter["$or"] = bson.A{bson.M{"email": prefix}, bson.M{"username": prefix}}
+	}
+	if f.Role != "" {
+		filter["roles"] = f.Role
+	}
+	switch f.Status {
+	case UserStatusActive:
+		filter["disabled_at"] = nil
+	case UserStatusDisabled:
+		filter["disabled_at"] = bson.M{"$ne": nil}
+	case UserStatusDeleted:
+		filter["deleted_at"] = bson.M{"$ne": nil}
+	}
+	if !after.IsZero() {
+		filter["_id"] = bson.M{"$lt": after}
+	}
+
+	cursor, err := r.collection.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []*domain.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// FindAnyByID finds a user by ID including deleted users, for admins
+func (r *UserRepository) FindAnyByID(ctx context.Context, id primitive.ObjectID) (*domain.User, error) {
 	var user domain.User
 	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
 	if err != nil {
@@ -80,3 +358,64 @@ func (r *UserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*
 	}
 	return &user, nil
 }
+
+// SetRoles replaces the roles of the user
+func (r *UserRepository) SetRoles(ctx context.Context, id primitive.ObjectID, roles []string) error {
+	return r.updateOne(ctx, bson.M{"_id": id, "deleted_at": nil},
+		bson.M{"$set": bson.M{"roles": roles, "updated_at": time.Now()}})
+}
+
+// SetDisabled disables or enables the user
+func (r *UserRepository) SetDisabled(ctx context.Context, id primitive.ObjectID, disabled bool) error {
+	now := time.Now()
+	update := bson.M{"$set": bson.M{"disabled_at": now, "updated_at": now}}
+	if !disabled {
+		update = bson.M{"$unset": bson.M{"disabled_at": ""}, "$set": bson.M{"updated_at": now}}
+	}
+	return r.updateOne(ctx, bson.M{"_id": id, "deleted_at": nil}, update)
+}
+
+func (r *UserRepository) updateOne(ctx context.Context, filter, update bson.M) error {
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// hashRecoveryCode hashes the code as typed, ignoring case, spaces and dashes
+func hashRecoveryCode(code string) string {
+	code = strings.NewReplacer(" ", "", "-", "").Replace(strings.ToLower(code))
+	return hashToken(code)
+}
+
+// AddPermission grants a permission to the user and returns the updated user
+func (r *UserRepository) AddPermission(ctx context.Context, id primitive.ObjectID, permission string) (*domain.User, error) {
+	return r.updatePermissions(ctx, id, bson.M{"$addToSet": bson.M{"permissions": permission}})
+}
+
+// RemovePermission takes back a permission granted to the user and returns the updated user
+func (r *UserRepository) RemovePermission(ctx context.Context, id primitive.ObjectID, permission string) (*domain.User, error) {
+	return r.updatePermissions(ctx, id, bson.M{"$pull": bson.M{"permissions": permission}})
+}
+
+func (r *UserRepository) updatePermissions(ctx context.Context, id primitive.ObjectID, update bson.M) (*domain.User, error) {
+	update["$set"] = bson.M{"updated_at": time.Now()}
+
+	var user domain.User
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
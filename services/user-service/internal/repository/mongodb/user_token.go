@@ -0,0 +1,91 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrUserTokenNotFound = errors.New("user token not found")
+
+// UserTokenRepository keeps the mailed email verification and password reset tokens
+type UserTokenRepository struct {
+	collection *mongo.Collection
+}
+
+// NewUserTokenRepository creates a new user token repository
+func NewUserTokenRepository(db *mongo.Database) *UserTokenRepository {
+	return &UserTokenRepository{
+		collection: db.Collection("user_tokens"),
+	}
+}
+
+// EnsureIndexes creates required indexes
+func (r *UserTokenRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "purpose", Value: 1}},
+			Options: options.Index(),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0), // TTL index
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// Create stores a token of the purpose under its hash, replacing the user's earlier ones
+// so only the latest mail works
+func (r *UserTokenRepository) Create(ctx context.Context, token, purpose string, userID primitive.ObjectID, email string, ttl time.Duration) error {
+	if err := r.DeleteByUser(ctx, userID, purpose); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err := r.collection.InsertOne(ctx, &domain.UserToken{
+		TokenHash: hashToken(token),
+		Purpose:   purpose,
+		UserID:    userID,
+		Email:     email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	return err
+}
+
+// Take returns the token of the purpose and deletes it, a token is used once
+func (r *UserTokenRepository) Take(ctx context.Context, token, purpose string) (*domain.UserToken, error) {
+	var t domain.UserToken
+	// the TTL monitor runs once a minute, an expired token may still be there
+	err := r.collection.FindOneAndDelete(ctx, bson.M{
+		"token_hash": hashToken(token),
+		"purpose":    purpose,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&t)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrUserTokenNotFound
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+// DeleteByUser removes the tokens of the purpose of a user
+func (r *UserTokenRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID, purpose string) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID, "purpose": purpose})
+	return err
+}
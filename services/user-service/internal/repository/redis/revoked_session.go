@@ -0,0 +1,36 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const revokedSessionPrefix = "revoked_session:"
+
+// RevokedSessionRepository keeps revoked sessions in Redis, an alternative
+// to the MongoDB collection for lower latency of the per-request check
+type RevokedSessionRepository struct {
+	client redis.UniversalClient
+}
+
+// NewRevokedSessionRepository creates a new revoked session repository
+func NewRevokedSessionRepository(client redis.UniversalClient) *RevokedSessionRepository {
+	return &RevokedSessionRepository{client: client}
+}
+
+// Revoke marks the session as revoked for ttl
+func (r *RevokedSessionRepository) Revoke(ctx context.Context, sessionID string, ttl time.Duration) error {
+	return r.client.Set(ctx, revokedSessionPrefix+sessionID, time.Now().Unix(), ttl).Err()
+}
+
+// IsRevoked checks whether the session is revoked
+func (r *RevokedSessionRepository) IsRevoked(ctx context.Context, sessionID string) (bool, error) {
+	n, err := r.client.Exists(ctx, revokedSessionPrefix+sessionID).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
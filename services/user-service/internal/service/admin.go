@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/repository/mongodb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrAccountDisabled  = errors.New("account is disabled")
+	ErrUnknownRole      = errors.New("unknown role")
+	ErrSelfChange       = errors.New("admins can't change their own roles or disable themselves")
+	ErrInvalidPageToken = errors.New("invalid page token")
+)
+
+// Page sizes of the admin lists
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// AdminService manages users for admins, every change is recorded in the audit log
+type AdminService struct {
+	users        *UserService
+	userRepo     UserStore
+	roleRepo     RoleStore
+	auditLogRepo AuditLogStore
+}
+
+// NewAdminService creates a new admin service, users checks the admin permission and ends sessions
+func NewAdminService(
+	users *UserService,
+	userRepo UserStore,
+	roleRepo RoleStore,
+	auditLogRepo AuditLogStore,
+) *AdminService {
+	return &AdminService{
+		users:        users,
+		userRepo:     userRepo,
+		roleRepo:     roleRepo,
+		auditLogRepo: auditLogRepo,
+	}
+}
+
+// ListUsers returns a page of the users matching the filter, newest first, and the token of
+// the next page, empty on the last page
+func (s *AdminService) ListUsers(ctx context.Context, adminID string, filter mongodb.UserFilter, pageSize int, pageToken string) ([]*domain.User, string, error) {
+	if err := s.users.requirePermission(ctx, adminID, domain.PermissionAdmin); err != nil {
+		return nil, "", err
+	}
+
+	after, limit, err := page(pageSize, pageToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// one more tells whether there is a next page
+	users, err := s.userRepo.List(ctx, filter, after, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if int64(len(users)) > limit {
+		users = users[:limit]
+		next = users[limit-1].ID.Hex()
+	}
+
+	return users, next, nil
+}
+
+// GetUser returns a user, deleted users included
+func (s *AdminService) GetUser(ctx context.Context, adminID, userID string) (*domain.User, error) {
+	if err := s.users.requirePermission(ctx, adminID, domain.PermissionAdmin); err != nil {
+		return nil, err
+	}
+
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	return s.userRepo.FindAnyByID(ctx, id)
+}
+
+// SetRoles replaces the roles of a user with existing roles and returns the updated user
+func (s *AdminService) SetRoles(ctx context.Context, adminID, userID string, roles []string) (*domain.User, error) {
+	user, err := s.target(ctx, adminID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the dedupe of permission names fits role names too
+	roles = uniquePermissions(roles)
+	stored, err := s.roleRepo.FindByNames(ctx, roles)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range roles {
+		if !slices.ContainsFunc(stored, func(r *domain.Role) bool { return r.Name == name }) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownRole, name)
+		}
+	}
+
+	if err := s.userRepo.SetRoles(ctx, user.ID, roles); err != nil {
+		return nil, err
+	}
+
+	if err := s.users.audit(ctx, adminID, domain.AuditSetRoles, user.ID, map[string]interface{}{
+		"from": user.Roles,
+		"to":   roles,
+	}); err != nil {
+		return nil, err
+	}
+
+	user.Roles = roles
+	return user, nil
+}
+
+// DisableUser blocks the logins of a user and ends the user's sessions
+func (s *AdminService) DisableUser(ctx context.Context, adminID, userID, reason string) error {
+	user, err := s.target(ctx, adminID, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.SetDisabled(ctx, user.ID, true); err != nil {
+		return err
+	}
+	if _, err := s.users.LogoutAll(ctx, userID); err != nil {
+		return err
+	}
+
+	return s.users.audit(ctx, adminID, domain.AuditDisableUser, user.ID, map[string]interface{}{"reason": reason})
+}
+
+// EnableUser allows the logins of a disabled user again
+func (s *AdminService) EnableUser(ctx context.Context, adminID, userID string) error {
+	user, err := s.target(ctx, adminID, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.SetDisabled(ctx, user.ID, false); err != nil {
+		return err
+	}
+
+	return s.users.audit(ctx, adminID, domain.AuditEnableUser, user.ID, nil)
+}
+
+// ListAuditLog returns a page of the audit entries, of one user when userID isn't empty,
+// newest first, and the token of the next page
+func (s *AdminService) ListAuditLog(ctx context.Context, adminID, userID string, pageSize int, pageToken string) ([]*domain.AuditEntry, string, error) {
+	if err := s.users.requirePermission(ctx, adminID, domain.PermissionAdmin); err != nil {
+		return nil, "", err
+	}
+
+	var target primitive.ObjectID
+	if userID != "" {
+		id, err := primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			return nil, "", ErrUserNotFound
+		}
+		target = id
+	}
+
+	after, limit, err := page(pageSize, pageToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	entries, err := s.auditLogRepo.List(ctx, target, after, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if int64(len(entries)) > limit {
+		entries = entries[:limit]
+		next = entries[limit-1].ID.Hex()
+	}
+
+	return entries, next, nil
+}
+
+// target checks the admin permission and returns the user a change applies to
+func (s *AdminService) target(ctx context.Context, adminID, userID string) (*domain.User, error) {
+	if err := s.users.requirePermission(ctx, adminID, domain.PermissionAdmin); err != nil {
+		return nil, err
+	}
+	if adminID == userID {
+		return nil, ErrSelfChange
+	}
+
+	return s.users.GetProfile(ctx, userID)
+}
+
+// audit records a change of an admin in the audit log, target is the user the change
+// applies to, zero for a change of a role
+func (s *UserService) audit(ctx context.Context, adminID, action string, target primitive.ObjectID, details map[string]interface{}) error {
+	admin, err := primitive.ObjectIDFromHex(adminID)
+	if err != nil {
+		return ErrPermissionDenied
+	}
+
+	return s.auditLogRepo.Create(ctx, &domain.AuditEntry{
+		ActorID:  admin,
+		Action:   action,
+		TargetID: target,
+		Details:  details,
+	})
+}
+
+// page returns the cursor and size of a page request
+func page(pageSize int, pageToken string) (primitive.ObjectID, int64, error) {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	pageSize = min(pageSize, maxPageSize)
+
+	if pageToken == "" {
+		return primitive.NilObjectID, int64(pageSize), nil
+	}
+
+	after, err := primitive.ObjectIDFromHex(pageToken)
+	if err != nil {
+		return primitive.NilObjectID, 0, ErrInvalidPageToken
+	}
+
+	return after, int64(pageSize), nil
+}
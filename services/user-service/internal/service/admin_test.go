@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+)
+
+func TestAdminSelfChange(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	admin := env.createUser(t, "admin@example.com", "password1", domain.RoleAdmin)
+	// admins log in with TOTP, the session is what matters here
+	tokens, err := env.svc.loginTokens(ctx, admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := env.admin.SetRoles(ctx, admin.ID.Hex(), admin.ID.Hex(), []string{domain.RoleClient}); !errors.Is(err, ErrSelfChange) {
+		t.Errorf("SetRoles of oneself: got %v, want ErrSelfChange", err)
+	}
+	if err := env.admin.DisableUser(ctx, admin.ID.Hex(), admin.ID.Hex(), "test"); !errors.Is(err, ErrSelfChange) {
+		t.Errorf("DisableUser of oneself: got %v, want ErrSelfChange", err)
+	}
+	if err := env.admin.EnableUser(ctx, admin.ID.Hex(), admin.ID.Hex()); !errors.Is(err, ErrSelfChange) {
+		t.Errorf("EnableUser of oneself: got %v, want ErrSelfChange", err)
+	}
+
+	stored, err := env.users.FindByID(ctx, admin.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(stored.Roles, []string{domain.RoleAdmin}) || stored.DisabledAt != nil {
+		t.Errorf("Admin changed by a rejected self change: %+v", stored)
+	}
+	if _, err := env.auth.ValidateSession(ctx, tokens.AccessToken); err != nil {
+		t.Errorf("Session of the admin should stay valid: %v", err)
+	}
+	if len(env.auditLog.entries) != 0 {
+		t.Errorf("Rejected changes should not be audited: %+v", env.auditLog.entries)
+	}
+}
+
+func TestAdminRequiresAdmin(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := env.createUser(t, "user@example.com", "password1")
+	other := env.createUser(t, "other@example.com", "password1")
+
+	if _, err := env.admin.SetRoles(ctx, user.ID.Hex(), other.ID.Hex(), []string{domain.RoleAdmin}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("SetRoles: got %v, want ErrPermissionDenied", err)
+	}
+	if err := env.admin.DisableUser(ctx, user.ID.Hex(), other.ID.Hex(), ""); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("DisableUser: got %v, want ErrPermissionDenied", err)
+	}
+	if _, _, err := env.admin.ListAuditLog(ctx, user.ID.Hex(), "", 0, ""); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("ListAuditLog: got %v, want ErrPermissionDenied", err)
+	}
+}
+
+func TestAdminAuditLog(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	admin := env.createUser(t, "admin@example.com", "password1", domain.RoleAdmin)
+	user := env.createUser(t, "user@example.com", "password1", domain.RoleClient)
+	other := env.createUser(t, "other@example.com", "password1")
+	tokens := env.login(t, "user@example.com", "password1")
+
+	if _, err := env.admin.SetRoles(ctx, admin.ID.Hex(), user.ID.Hex(), []string{"NO_SUCH_ROLE"}); !errors.Is(err, ErrUnknownRole) {
+		t.Errorf("Unknown role: got %v, want ErrUnknownRole", err)
+	}
+
+	updated, err := env.admin.SetRoles(ctx, admin.ID.Hex(), user.ID.Hex(), []string{domain.RoleAdmin, domain.RoleAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(updated.Roles, []string{domain.RoleAdmin}) {
+		t.Errorf("Roles = %v, want [%s]", updated.Roles, domain.RoleAdmin)
+	}
+
+	if err := env.admin.DisableUser(ctx, admin.ID.Hex(), user.ID.Hex(), "spam"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.auth.ValidateSession(ctx, tokens.AccessToken); err == nil {
+		t.Error("Sessions of a disabled user should end")
+	}
+	if err := env.admin.EnableUser(ctx, admin.ID.Hex(), user.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.admin.DisableUser(ctx, admin.ID.Hex(), other.ID.Hex(), "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, next, err := env.admin.ListAuditLog(ctx, admin.ID.Hex(), user.ID.Hex(), 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != "" {
+		t.Errorf("Next page token = %q on the last page", next)
+	}
+
+	// newest first, and only the entries of the user
+	want := []string{domain.AuditEnableUser, domain.AuditDisableUser, domain.AuditSetRoles}
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+		if e.ActorID != admin.ID || e.TargetID != user.ID {
+			t.Errorf("Entry %s by %s of %s, want by the admin of the user", e.Action, e.ActorID.Hex(), e.TargetID.Hex())
+		}
+	}
+	if !slices.Equal(actions, want) {
+		t.Fatalf("Audited actions = %v, want %v", actions, want)
+	}
+	if from, to := entries[2].Details["from"], entries[2].Details["to"]; !slices.Equal(from.([]string), []string{domain.RoleClient}) || !slices.Equal(to.([]string), []string{domain.RoleAdmin}) {
+		t.Errorf("SetRoles details = %v", entries[2].Details)
+	}
+	if reason := entries[1].Details["reason"]; reason != "spam" {
+		t.Errorf("DisableUser reason = %v, want spam", reason)
+	}
+
+	// pages of all entries
+	first, next, err := env.admin.ListAuditLog(ctx, admin.ID.Hex(), "", 3, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 3 || next == "" || first[0].TargetID != other.ID {
+		t.Fatalf("First page = %d entries, next %q", len(first), next)
+	}
+	rest, next, err := env.admin.ListAuditLog(ctx, admin.ID.Hex(), "", 3, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 1 || next != "" || rest[0].Action != domain.AuditSetRoles {
+		t.Errorf("Last page = %+v, next %q", rest, next)
+	}
+
+	if _, _, err := env.admin.ListAuditLog(ctx, admin.ID.Hex(), "", 3, "not-a-token"); !errors.Is(err, ErrInvalidPageToken) {
+		t.Errorf("Invalid page token: got %v, want ErrInvalidPageToken", err)
+	}
+}
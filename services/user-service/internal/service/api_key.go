@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/jwt"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/repository/mongodb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// apiKeyPrefix tells API keys apart from other secrets, e.g. for secret scanners
+	apiKeyPrefix = "ak_"
+	// apiKeyLength is the number of hex characters after the prefix
+	apiKeyLength = 64
+	// apiKeyShownLength is how much of a key is stored in clear to recognize it
+	apiKeyShownLength = len(apiKeyPrefix) + 8
+)
+
+// APIKeyInfo contains validated API key information
+type APIKeyInfo struct {
+	KeyID    string
+	ClientID string
+	Scopes   []string
+}
+
+// ValidateAPIKey checks an API key and returns its client and scopes
+func (s *AuthService) ValidateAPIKey(ctx context.Context, key string) (*APIKeyInfo, error) {
+	apiKey, err := s.apiKeyRepo.FindByKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &APIKeyInfo{
+		KeyID:    apiKey.ID.Hex(),
+		ClientID: apiKey.ClientID,
+		Scopes:   apiKey.Scopes,
+	}, nil
+}
+
+// CreateAPIKey issues an API key to a machine client, the key is returned only here.
+// A zero ttl makes a key that doesn't expire, adminID must have the admin permission
+func (s *UserService) CreateAPIKey(ctx context.Context, adminID, clientID string, scopes []string, ttl time.Duration) (*domain.APIKey, string, error) {
+	if err := s.requirePermission(ctx, adminID, domain.PermissionAdmin); err != nil {
+		return nil, "", err
+	}
+
+	secret, err := jwt.GenerateRefreshToken(apiKeyLength)
+	if err != nil {
+		return nil, "", err
+	}
+	key := apiKeyPrefix + secret
+
+	createdBy, _ := primitive.ObjectIDFromHex(adminID)
+	apiKey := &domain.APIKey{
+		ClientID:  clientID,
+		Prefix:    key[:apiKeyShownLength],
+		Scopes:    uniquePermissions(scopes),
+		CreatedBy: createdBy,
+	}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		apiKey.ExpiresAt = &expiresAt
+	}
+
+	if err := s.apiKeyRepo.Create(ctx, apiKey, key); err != nil {
+		return nil, "", err
+	}
+
+	return apiKey, key, nil
+}
+
+// ListAPIKeys returns the API keys of a client, of all clients if clientID is empty,
+// adminID must have the admin permission
+func (s *UserService) ListAPIKeys(ctx context.Context, adminID, clientID string) ([]*domain.APIKey, error) {
+	if err := s.requirePermission(ctx, adminID, domain.PermissionAdmin); err != nil {
+		return nil, err
+	}
+
+	return s.apiKeyRepo.List(ctx, clientID)
+}
+
+// RevokeAPIKey invalidates an API key, adminID must have the admin permission
+func (s *UserService) RevokeAPIKey(ctx context.Context, adminID, keyID string) error {
+	if err := s.requirePermission(ctx, adminID, domain.PermissionAdmin); err != nil {
+		return err
+	}
+
+	id, err := primitive.ObjectIDFromHex(keyID)
+	if err != nil {
+		return mongodb.ErrAPIKeyNotFound
+	}
+
+	return s.apiKeyRepo.Revoke(ctx, id)
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/repository/mongodb"
+)
+
+func TestValidateAPIKey(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	admin := env.createUser(t, "admin@example.com", "", domain.RoleAdmin).ID.Hex()
+
+	apiKey, key, err := env.svc.CreateAPIKey(ctx, admin, "billing", []string{"payments", "payments"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, apiKeyPrefix) || apiKey.Prefix != key[:apiKeyShownLength] {
+		t.Errorf("Key %q shown as %q", key, apiKey.Prefix)
+	}
+
+	info, err := env.auth.ValidateAPIKey(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.KeyID != apiKey.ID.Hex() || info.ClientID != "billing" || !slices.Equal(info.Scopes, []string{"payments"}) {
+		t.Errorf("ValidateAPIKey = %+v", info)
+	}
+
+	if _, err := env.auth.ValidateAPIKey(ctx, key+"0"); !errors.Is(err, mongodb.ErrAPIKeyNotFound) {
+		t.Errorf("Unknown key: got %v, want ErrAPIKeyNotFound", err)
+	}
+
+	env.apiKeys.expire(apiKey.ID)
+	if _, err := env.auth.ValidateAPIKey(ctx, key); !errors.Is(err, mongodb.ErrAPIKeyExpired) {
+		t.Errorf("Expired key: got %v, want ErrAPIKeyExpired", err)
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	admin := env.createUser(t, "admin@example.com", "", domain.RoleAdmin).ID.Hex()
+	client := env.createUser(t, "user@example.com", "password1").ID.Hex()
+
+	// without a ttl the key doesn't expire
+	apiKey, key, err := env.svc.CreateAPIKey(ctx, admin, "billing", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if apiKey.ExpiresAt != nil {
+		t.Errorf("Key without a ttl expires at %s", apiKey.ExpiresAt)
+	}
+	_, other, err := env.svc.CreateAPIKey(ctx, admin, "billing", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.svc.RevokeAPIKey(ctx, client, apiKey.ID.Hex()); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("RevokeAPIKey by a client: got %v, want ErrPermissionDenied", err)
+	}
+	if err := env.svc.RevokeAPIKey(ctx, admin, "not-an-id"); !errors.Is(err, mongodb.ErrAPIKeyNotFound) {
+		t.Errorf("RevokeAPIKey of a bad id: got %v, want ErrAPIKeyNotFound", err)
+	}
+
+	if err := env.svc.RevokeAPIKey(ctx, admin, apiKey.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.auth.ValidateAPIKey(ctx, key); !errors.Is(err, mongodb.ErrAPIKeyRevoked) {
+		t.Errorf("Revoked key: got %v, want ErrAPIKeyRevoked", err)
+	}
+	if _, err := env.auth.ValidateAPIKey(ctx, other); err != nil {
+		t.Errorf("Other key of the client should stay valid: %v", err)
+	}
+
+	// revoked keys stay listed
+	keys, err := env.svc.ListAPIKeys(ctx, admin, "billing")
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("ListAPIKeys = %v, %v", keys, err)
+	}
+}
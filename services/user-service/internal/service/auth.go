@@ -2,28 +2,54 @@ package service
 
 import (
 	"context"
+	"errors"
+	"time"
 
-	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
 	"gitlab.com/gitops-poc-dzha/user-service/internal/jwt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// ErrSessionRevoked is returned for tokens of a session that was logged out or revoked
+var ErrSessionRevoked = errors.New("session revoked")
+
+// RevokedSessionStore keeps revoked sessions until their access tokens expire
+type RevokedSessionStore interface {
+	Revoke(ctx context.Context, sessionID string, ttl time.Duration) error
+	IsRevoked(ctx context.Context, sessionID string) (bool, error)
+}
+
 // AuthService handles authentication operations for auth-adapter
 type AuthService struct {
-	jwtManager *jwt.Manager
+	jwtManager      *jwt.Manager
+	revokedSessions RevokedSessionStore
+	userRepo        UserStore
+	roleRepo        RoleStore
+	apiKeyRepo      APIKeyStore
 }
 
 // NewAuthService creates a new auth service
-func NewAuthService(jwtManager *jwt.Manager) *AuthService {
+func NewAuthService(
+	jwtManager *jwt.Manager,
+	revokedSessions RevokedSessionStore,
+	userRepo UserStore,
+	roleRepo RoleStore,
+	apiKeyRepo APIKeyStore,
+) *AuthService {
 	return &AuthService{
-		jwtManager: jwtManager,
+		jwtManager:      jwtManager,
+		revokedSessions: revokedSessions,
+		userRepo:        userRepo,
+		roleRepo:        roleRepo,
+		apiKeyRepo:      apiKeyRepo,
 	}
 }
 
 // SessionInfo contains validated session information
 type SessionInfo struct {
-	UserID    string
-	SessionID string
-	Roles     []RoleInfo
+	UserID      string
+	SessionID   string
+	Roles       []RoleInfo
+	Permissions []string // of all roles plus the ones granted to the user
 }
 
 // RoleInfo contains role and permissions
@@ -39,18 +65,36 @@ func (s *AuthService) ValidateSession(ctx context.Context, token string) (*Sessi
 		return nil, err
 	}
 
-	// Build role info with permissions
-	roles := make([]RoleInfo, 0, len(claims.Roles))
-	for _, roleName := range claims.Roles {
-		roles = append(roles, RoleInfo{
-			Name:        roleName,
-			Permissions: domain.DefaultPermissions(roleName),
-		})
+	revoked, err := s.revokedSessions.IsRevoked(ctx, claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrSessionRevoked
+	}
+
+	// Roles and grants are read from the user, not the token, so changes apply right away
+	id, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return nil, jwt.ErrInvalidToken
+	}
+	user, err := s.userRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+
+	roles, permissions, err := resolvePermissions(ctx, s.roleRepo, user)
+	if err != nil {
+		return nil, err
 	}
 
 	return &SessionInfo{
-		UserID:    claims.UserID,
-		SessionID: claims.SessionID,
-		Roles:     roles,
+		UserID:      claims.UserID,
+		SessionID:   claims.SessionID,
+		Roles:       roles,
+		Permissions: permissions,
 	}, nil
 }
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/repository/mongodb"
+)
+
+func TestValidateSessionRevoked(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		revoke func(env *testEnv, user *domain.User, sessionID string) error
+	}{
+		{
+			name: "logout",
+			revoke: func(env *testEnv, user *domain.User, sessionID string) error {
+				return env.svc.Logout(ctx, user.ID.Hex(), sessionID)
+			},
+		},
+		{
+			name: "logout all",
+			revoke: func(env *testEnv, user *domain.User, sessionID string) error {
+				_, err := env.svc.LogoutAll(ctx, user.ID.Hex())
+				return err
+			},
+		},
+		{
+			name: "revoked by the user",
+			revoke: func(env *testEnv, user *domain.User, sessionID string) error {
+				return env.svc.RevokeSession(ctx, user.ID.Hex(), sessionID)
+			},
+		},
+		{
+			name: "revoked by an admin",
+			revoke: func(env *testEnv, user *domain.User, sessionID string) error {
+				admin := env.createUser(t, "admin@example.com", "", domain.RoleAdmin)
+				return env.svc.AdminRevokeSession(ctx, admin.ID.Hex(), sessionID)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			user := env.createUser(t, "user@example.com", "password1")
+			tokens := env.login(t, "user@example.com", "password1")
+			other := env.login(t, "user@example.com", "password1")
+
+			if _, err := env.auth.ValidateSession(ctx, tokens.AccessToken); err != nil {
+				t.Fatalf("Session should be valid before the revocation: %v", err)
+			}
+
+			if err := tt.revoke(env, user, env.sessionOf(t, tokens)); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := env.auth.ValidateSession(ctx, tokens.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+				t.Errorf("Access token of a revoked session: got %v, want ErrSessionRevoked", err)
+			}
+			if _, err := env.svc.RefreshToken(ctx, tokens.RefreshToken); !errors.Is(err, mongodb.ErrRefreshTokenNotFound) {
+				t.Errorf("Refresh token of a revoked session: got %v, want ErrRefreshTokenNotFound", err)
+			}
+
+			// only LogoutAll ends the other sessions of the user
+			_, err := env.auth.ValidateSession(ctx, other.AccessToken)
+			if tt.name == "logout all" {
+				if !errors.Is(err, ErrSessionRevoked) {
+					t.Errorf("Other session after LogoutAll: got %v, want ErrSessionRevoked", err)
+				}
+			} else if err != nil {
+				t.Errorf("Other session should stay valid: %v", err)
+			}
+		})
+	}
+}
+
+func TestAdminRevokeSessionRequiresAdmin(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	env.createUser(t, "user@example.com", "password1")
+	tokens := env.login(t, "user@example.com", "password1")
+	other := env.createUser(t, "other@example.com", "password1")
+
+	if err := env.svc.AdminRevokeSession(ctx, other.ID.Hex(), env.sessionOf(t, tokens)); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("AdminRevokeSession by a client: got %v, want ErrPermissionDenied", err)
+	}
+	if _, err := env.auth.ValidateSession(ctx, tokens.AccessToken); err != nil {
+		t.Errorf("Session should stay valid: %v", err)
+	}
+}
+
+func TestValidateSessionDisabledUser(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := env.createUser(t, "user@example.com", "password1")
+	tokens := env.login(t, "user@example.com", "password1")
+
+	if err := env.users.SetDisabled(ctx, user.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := env.auth.ValidateSession(ctx, tokens.AccessToken); !errors.Is(err, ErrAccountDisabled) {
+		t.Errorf("Session of a disabled user: got %v, want ErrAccountDisabled", err)
+	}
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"unicode/utf8"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/jwt"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/mailer"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/repository/mongodb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidToken         = errors.New("invalid or expired token")
+	ErrEmailAlreadyVerified = errors.New("email is already verified")
+	ErrWeakPassword         = errors.New("password is too short")
+	ErrInvalidEmail         = errors.New("invalid email address")
+)
+
+// Password change reasons of the user.password_changed event
+const (
+	passwordReset  = "reset"
+	passwordChange = "change"
+)
+
+// RequestEmailVerification mails a new verification link to the user, earlier links stop working
+func (s *UserService) RequestEmailVerification(ctx context.Context, userID string) error {
+	user, err := s.GetProfile(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+
+	return s.sendEmailVerification(ctx, user)
+}
+
+// VerifyEmail marks the email the token was sent to verified, when it is still the user's email
+func (s *UserService) VerifyEmail(ctx context.Context, token string) (string, error) {
+	t, err := s.userTokenRepo.Take(ctx, token, domain.TokenEmailVerification)
+	if errors.Is(err, mongodb.ErrUserTokenNotFound) {
+		return "", ErrInvalidToken
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// no match when the user is gone or changed the email since
+	if err := s.userRepo.SetEmailVerified(ctx, t.UserID, t.Email); err != nil {
+		if errors.Is(err, mongodb.ErrUserNotFound) {
+			return "", ErrInvalidToken
+		}
+		return "", err
+	}
+
+	if s.eventPublisher != nil {
+		_ = s.eventPublisher.PublishEmailVerified(ctx, t.UserID.Hex(), t.Email)
+	}
+
+	return t.UserID.Hex(), nil
+}
+
+// RequestPasswordReset mails a reset link to the user of the email. Unknown emails succeed
+// too, the response doesn't tell which emails have accounts
+func (s *UserService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.FindByEmail(ctx, email)
+	if errors.Is(err, mongodb.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := jwt.GenerateRefreshToken(s.cfg.RefreshTokenLength)
+	if err != nil {
+		return err
+	}
+	if err := s.userTokenRepo.Create(ctx, token, domain.TokenPasswordReset, user.ID, user.Email, s.cfg.PasswordResetTTL); err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nuse this link to choose a new password, it works once within %s:\n\n%s\n\n"+
+			"If you didn't ask for it, ignore this email, your password stays the same.\n",
+			user.Username, s.cfg.PasswordResetTTL, s.link("/reset-password", token)),
+	})
+}
+
+// ResetPassword sets the password of the token's user and ends all sessions of the user
+func (s *UserService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if err := s.checkPassword(newPassword); err != nil {
+		return err
+	}
+
+	t, err := s.userTokenRepo.Take(ctx, token, domain.TokenPasswordReset)
+	if errors.Is(err, mongodb.ErrUserTokenNotFound) {
+		return ErrInvalidToken
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.setPassword(ctx, t.UserID, newPassword, passwordReset); err != nil {
+		return err
+	}
+
+	// the mailbox owner chose the password, failed attempts of others don't matter anymore
+	return s.userRepo.ClearLockout(ctx, t.UserID)
+}
+
+// setPassword stores the new password and invalidates all refresh tokens of the user,
+// sessions with the old password must log in again
+func (s *UserService) setPassword(ctx context.Context, id primitive.ObjectID, password, reason string) error {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.SetPassword(ctx, id, string(passwordHash)); err != nil {
+		return err
+	}
+
+	if _, err := s.LogoutAll(ctx, id.Hex()); err != nil {
+		return err
+	}
+
+	if s.eventPublisher != nil {
+		_ = s.eventPublisher.PublishPasswordChanged(ctx, id.Hex(), reason)
+	}
+
+	return nil
+}
+
+func (s *UserService) checkPassword(password string) error {
+	if utf8.RuneCountInString(password) < s.cfg.MinPasswordLength {
+		return fmt.Errorf("%w: at least %d characters", ErrWeakPassword, s.cfg.MinPasswordLength)
+	}
+	return nil
+}
+
+// checkEmail accepts a bare address like user@example.com, without a display name or brackets
+func checkEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+// sendEmailVerification mails a verification link for the current email of the user
+func (s *UserService) sendEmailVerification(ctx context.Context, user *domain.User) error {
+	token, err := jwt.GenerateRefreshToken(s.cfg.RefreshTokenLength)
+	if err != nil {
+		return err
+	}
+	if err := s.userTokenRepo.Create(ctx, token, domain.TokenEmailVerification, user.ID, user.Email, s.cfg.EmailVerificationTTL); err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hi %s,\n\nconfirm your email with this link, it works within %s:\n\n%s\n",
+			user.Username, s.cfg.EmailVerificationTTL, s.link("/verify-email", token)),
+	})
+}
+
+// link is the frontend page of path with the token
+func (s *UserService) link(path, token string) string {
+	return s.cfg.AppURL + path + "?" + url.Values{"token": {token}}.Encode()
+}
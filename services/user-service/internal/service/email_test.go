@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestVerifyEmailSingleUse(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := env.createUser(t, "user@example.com", "password1")
+
+	if err := env.svc.RequestEmailVerification(ctx, user.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	first := env.mailer.token(t, user.Email)
+
+	// a new link replaces the previous one
+	if err := env.svc.RequestEmailVerification(ctx, user.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	second := env.mailer.token(t, user.Email)
+	if first == second {
+		t.Fatal("Each request should mail a new token")
+	}
+	if _, err := env.svc.VerifyEmail(ctx, first); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Replaced token: got %v, want ErrInvalidToken", err)
+	}
+
+	userID, err := env.svc.VerifyEmail(ctx, second)
+	if err != nil || userID != user.ID.Hex() {
+		t.Fatalf("VerifyEmail = %s, %v", userID, err)
+	}
+	if _, err := env.svc.VerifyEmail(ctx, second); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Used token: got %v, want ErrInvalidToken", err)
+	}
+
+	if err := env.svc.RequestEmailVerification(ctx, user.ID.Hex()); !errors.Is(err, ErrEmailAlreadyVerified) {
+		t.Errorf("Verified email: got %v, want ErrEmailAlreadyVerified", err)
+	}
+}
+
+func TestVerifyEmailStaleToken(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := env.createUser(t, "user@example.com", "password1")
+
+	if err := env.svc.RequestEmailVerification(ctx, user.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	env.userTokens.expire()
+	if _, err := env.svc.VerifyEmail(ctx, env.mailer.token(t, user.Email)); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expired token: got %v, want ErrInvalidToken", err)
+	}
+
+	// the link of the old address doesn't verify the new one
+	if err := env.svc.RequestEmailVerification(ctx, user.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.users.SetEmail(ctx, user.ID, "new@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.svc.VerifyEmail(ctx, env.mailer.token(t, user.Email)); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Token of the old email: got %v, want ErrInvalidToken", err)
+	}
+	if stored, _ := env.users.FindByID(ctx, user.ID); stored.EmailVerified {
+		t.Error("New email should not be verified")
+	}
+}
+
+func TestResetPasswordSingleUse(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	env.createUser(t, "user@example.com", "password1")
+	tokens := env.login(t, "user@example.com", "password1")
+
+	if err := env.svc.RequestPasswordReset(ctx, "user@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	first := env.mailer.token(t, "user@example.com")
+	if err := env.svc.RequestPasswordReset(ctx, "user@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	second := env.mailer.token(t, "user@example.com")
+
+	if err := env.svc.ResetPassword(ctx, first, "new-password"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Replaced token: got %v, want ErrInvalidToken", err)
+	}
+
+	// a rejected password doesn't spend the token
+	if err := env.svc.ResetPassword(ctx, second, "short"); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("Short password: got %v, want ErrWeakPassword", err)
+	}
+	if err := env.svc.ResetPassword(ctx, second, "new-password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.svc.ResetPassword(ctx, second, "other-password"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Used token: got %v, want ErrInvalidToken", err)
+	}
+
+	if _, err := env.auth.ValidateSession(ctx, tokens.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("Session after a reset: got %v, want ErrSessionRevoked", err)
+	}
+	if _, err := env.svc.Login(ctx, "user@example.com", "password1"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Old password: got %v, want ErrInvalidCredentials", err)
+	}
+	env.login(t, "user@example.com", "new-password")
+}
+
+func TestResetPasswordClearsLockout(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := env.createUser(t, "user@example.com", "password1")
+	env.failLogins(t, "user@example.com", env.cfg.LoginBackoffAfter)
+
+	if err := env.svc.RequestPasswordReset(ctx, "user@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.svc.ResetPassword(ctx, env.mailer.token(t, "user@example.com"), "new-password"); err != nil {
+		t.Fatal(err)
+	}
+	if lockout := env.lockout(t, user.ID); lockout != nil {
+		t.Errorf("Lockout after a reset = %+v, want none", lockout)
+	}
+	env.login(t, "user@example.com", "new-password")
+}
+
+func TestRequestPasswordResetUnknownEmail(t *testing.T) {
+	env := newTestEnv(t)
+
+	if err := env.svc.RequestPasswordReset(context.Background(), "nobody@example.com"); err != nil {
+		t.Errorf("Unknown email: got %v, want no error", err)
+	}
+	if _, ok := env.mailer.last("nobody@example.com"); ok {
+		t.Error("Unknown email should get no mail")
+	}
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrAccountLocked = errors.New("account is locked")
+
+// LockedError is returned by Login while failed attempts lock the account
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("account is locked until %s", e.Until.Format(time.RFC3339))
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrAccountLocked
+}
+
+// loginFailed counts a wrong password or second factor of the user and locks the account
+// for the backoff of the failure count, at the threshold for the full lockout duration
+func (s *UserService) loginFailed(ctx context.Context, user *domain.User) error {
+	lockout, err := s.userRepo.RecordLoginFailure(ctx, user.ID, s.cfg.LoginFailureWindow)
+	if err != nil {
+		return err
+	}
+
+	if s.eventPublisher != nil {
+		_ = s.eventPublisher.PublishLoginFailed(ctx, user.ID.Hex(), lockout.FailedAttempts)
+	}
+
+	delay := s.loginBackoff(lockout.FailedAttempts)
+	if delay == 0 {
+		return nil
+	}
+
+	until := time.Now().Add(delay)
+	if err := s.userRepo.LockUntil(ctx, user.ID, until); err != nil {
+		return err
+	}
+
+	if lockout.FailedAttempts == s.cfg.LoginLockoutThreshold && s.eventPublisher != nil {
+		_ = s.eventPublisher.PublishUserLocked(ctx, user.ID.Hex(), lockout.FailedAttempts, until)
+	}
+
+	return nil
+}
+
+// loginSucceeded clears the failed attempts once the user passed every factor of a login
+func (s *UserService) loginSucceeded(ctx context.Context, user *domain.User) error {
+	if user.Lockout == nil {
+		return nil
+	}
+
+	return s.userRepo.ClearLockout(ctx, user.ID)
+}
+
+// loginBackoff is the wait after the failed attempts: none before LoginBackoffAfter,
+// then LoginBackoffBase doubling per failure up to LoginLockoutDuration
+func (s *UserService) loginBackoff(failedAttempts int) time.Duration {
+	switch {
+	case failedAttempts >= s.cfg.LoginLockoutThreshold:
+		return s.cfg.LoginLockoutDuration
+	case failedAttempts < s.cfg.LoginBackoffAfter:
+		return 0
+	}
+
+	delay := s.cfg.LoginBackoffBase
+	for i := s.cfg.LoginBackoffAfter; i < failedAttempts && delay < s.cfg.LoginLockoutDuration; i++ {
+		delay *= 2
+	}
+
+	return min(delay, s.cfg.LoginLockoutDuration)
+}
+
+// UnlockUser lifts the lockout of a user and clears the failed attempts, admins only
+func (s *UserService) UnlockUser(ctx context.Context, adminID, userID string) error {
+	if err := s.requirePermission(ctx, adminID, domain.PermissionAdmin); err != nil {
+		return err
+	}
+
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+
+	if err := s.userRepo.ClearLockout(ctx, id); err != nil {
+		return err
+	}
+
+	return s.audit(ctx, adminID, domain.AuditUnlockUser, id, nil)
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/config"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLoginBackoff(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    config.Config
+		delays map[int]time.Duration
+	}{
+		{
+			name: "growth",
+			cfg: config.Config{
+				LoginBackoffAfter:     3,
+				LoginBackoffBase:      time.Second,
+				LoginLockoutThreshold: 10,
+				LoginLockoutDuration:  15 * time.Minute,
+			},
+			delays: map[int]time.Duration{
+				0:  0,
+				2:  0,
+				3:  time.Second,
+				4:  2 * time.Second,
+				5:  4 * time.Second,
+				9:  64 * time.Second,
+				10: 15 * time.Minute,
+				11: 15 * time.Minute,
+			},
+		},
+		{
+			name: "capped by the lockout duration",
+			cfg: config.Config{
+				LoginBackoffAfter:     1,
+				LoginBackoffBase:      time.Minute,
+				LoginLockoutThreshold: 100,
+				LoginLockoutDuration:  5 * time.Minute,
+			},
+			delays: map[int]time.Duration{
+				1:  time.Minute,
+				3:  4 * time.Minute,
+				4:  5 * time.Minute,
+				99: 5 * time.Minute,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &UserService{cfg: &tt.cfg}
+			for failed, want := range tt.delays {
+				if got := s.loginBackoff(failed); got != want {
+					t.Errorf("loginBackoff(%d) = %s, want %s", failed, got, want)
+				}
+			}
+		})
+	}
+}
+
+// failLogins logs in with a wrong password n times
+func (env *testEnv) failLogins(t *testing.T, email string, n int) {
+	t.Helper()
+
+	for range n {
+		if _, err := env.svc.Login(context.Background(), email, "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Wrong password: got %v, want ErrInvalidCredentials", err)
+		}
+	}
+}
+
+// lockout returns the lockout state of the user
+func (env *testEnv) lockout(t *testing.T, id primitive.ObjectID) *domain.Lockout {
+	t.Helper()
+
+	user, err := env.users.FindByID(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user.Lockout
+}
+
+func TestLoginLockout(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := env.createUser(t, "user@example.com", "password1")
+
+	env.failLogins(t, "user@example.com", env.cfg.LoginBackoffAfter)
+
+	// while locked even the right password is refused, and the attempt isn't counted
+	_, err := env.svc.Login(ctx, "user@example.com", "password1")
+	var locked *LockedError
+	if !errors.As(err, &locked) || !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("Locked account: got %v, want LockedError", err)
+	}
+	if lockout := env.lockout(t, user.ID); lockout.FailedAttempts != env.cfg.LoginBackoffAfter {
+		t.Errorf("Failed attempts = %d while locked, want %d", lockout.FailedAttempts, env.cfg.LoginBackoffAfter)
+	}
+
+	// the backoff runs out, a successful login resets the count
+	if err := env.users.LockUntil(ctx, user.ID, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	env.login(t, "user@example.com", "password1")
+	if lockout := env.lockout(t, user.ID); lockout != nil {
+		t.Errorf("Lockout after a successful login = %+v, want none", lockout)
+	}
+
+	env.failLogins(t, "user@example.com", 1)
+	if lockout := env.lockout(t, user.ID); lockout.FailedAttempts != 1 || lockout.LockedUntil != nil {
+		t.Errorf("Lockout after a failure following a reset = %+v", lockout)
+	}
+}
+
+func TestUnlockUser(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	admin := env.createUser(t, "admin@example.com", "", domain.RoleAdmin)
+	user := env.createUser(t, "user@example.com", "password1")
+
+	env.failLogins(t, "user@example.com", env.cfg.LoginBackoffAfter)
+	if _, err := env.svc.Login(ctx, "user@example.com", "password1"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("Locked account: got %v, want ErrAccountLocked", err)
+	}
+
+	if err := env.svc.UnlockUser(ctx, user.ID.Hex(), user.ID.Hex()); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("UnlockUser by the user: got %v, want ErrPermissionDenied", err)
+	}
+	if err := env.svc.UnlockUser(ctx, admin.ID.Hex(), user.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the count starts over, one more failure doesn't lock again
+	if lockout := env.lockout(t, user.ID); lockout != nil {
+		t.Errorf("Lockout after UnlockUser = %+v, want none", lockout)
+	}
+	if entries := env.auditLog.entries; len(entries) != 1 || entries[0].Action != domain.AuditUnlockUser || entries[0].ActorID != admin.ID || entries[0].TargetID != user.ID {
+		t.Errorf("Audit log after UnlockUser = %+v", entries)
+	}
+	env.failLogins(t, "user@example.com", 1)
+	env.login(t, "user@example.com", "password1")
+}
+
+func TestSecondFactorLockout(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := env.createUser(t, "user@example.com", "password1")
+	secret, _ := env.enableTOTP(t, user)
+
+	// the password alone keeps the failures, and new challenges don't give new guesses
+	env.failLogins(t, "user@example.com", 1)
+	pending := env.challenge(t, "user@example.com", "password1")
+	for range env.cfg.LoginBackoffAfter - 1 {
+		if _, err := env.svc.VerifyLoginTOTP(ctx, env.challenge(t, "user@example.com", "password1"), "000000"); !errors.Is(err, ErrInvalidTOTPCode) {
+			t.Fatalf("Wrong code: got %v, want ErrInvalidTOTPCode", err)
+		}
+	}
+	if lockout := env.lockout(t, user.ID); lockout == nil || lockout.FailedAttempts != env.cfg.LoginBackoffAfter || lockout.LockedUntil == nil {
+		t.Fatalf("Lockout after wrong codes = %+v", lockout)
+	}
+
+	// while locked the code of a pending challenge isn't checked, nor the password
+	if _, err := env.svc.VerifyLoginTOTP(ctx, pending, totpCode(t, secret, 1)); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("Challenge of a locked account: got %v, want ErrAccountLocked", err)
+	}
+	if _, err := env.svc.Login(ctx, "user@example.com", "password1"); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("Login of a locked account: got %v, want ErrAccountLocked", err)
+	}
+
+	// the backoff runs out, passing the second factor resets the count
+	if err := env.users.LockUntil(ctx, user.ID, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	challenge := env.challenge(t, "user@example.com", "password1")
+	if lockout := env.lockout(t, user.ID); lockout == nil {
+		t.Error("The password alone should not reset the failed attempts")
+	}
+	if _, err := env.svc.VerifyLoginTOTP(ctx, challenge, totpCode(t, secret, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if lockout := env.lockout(t, user.ID); lockout != nil {
+		t.Errorf("Lockout after a successful login = %+v, want none", lockout)
+	}
+}
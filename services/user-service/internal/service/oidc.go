@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/oidc"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/repository/mongodb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrUnknownProvider  = errors.New("unknown OIDC provider")
+	ErrInvalidOIDCState = errors.New("invalid or expired OIDC state")
+	ErrOIDCAuthFailed   = errors.New("OIDC authentication failed")
+	// ErrAccountExists is returned for an identity whose email belongs to a user it can't be
+	// linked to automatically, the user logs in with the password and links it
+	ErrAccountExists = errors.New("an account with this email already exists")
+)
+
+// OIDCLogin is the result of a completed OIDC login
+type OIDCLogin struct {
+	*LoginResult
+	NewUser bool
+}
+
+// OIDCStart is an OIDC login in progress
+type OIDCStart struct {
+	// AuthURL is the provider URL to send the browser to
+	AuthURL string
+	// State identifies the login, the provider returns it with the code
+	State string
+	// Binding stays with the browser that started the login, CompleteOIDCLogin requires it so
+	// that a victim can't be logged in with the redirect of an attacker (login CSRF)
+	Binding string
+}
+
+// StartOIDCLogin returns the provider URL to send the browser to, the state identifying
+// the login and its binding. With userID the identity is linked to that user instead
+func (s *UserService) StartOIDCLogin(ctx context.Context, providerName, userID string) (*OIDCStart, error) {
+	provider, ok := s.oidcProviders[providerName]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	st := &domain.OIDCState{
+		Provider:  providerName,
+		ExpiresAt: time.Now().Add(s.cfg.OIDCStateTTL),
+	}
+	if userID != "" {
+		id, err := primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			return nil, ErrUserNotFound
+		}
+		st.UserID = &id
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+	binding, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+	st.BindingHash = bindingHash(binding)
+	if st.Nonce, err = oidc.RandomString(); err != nil {
+		return nil, err
+	}
+	if st.CodeVerifier, err = oidc.RandomString(); err != nil {
+		return nil, err
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, st.Nonce, st.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.oidcStateRepo.Create(ctx, state, st); err != nil {
+		return nil, err
+	}
+
+	return &OIDCStart{AuthURL: authURL, State: state, Binding: binding}, nil
+}
+
+// bindingHash is the stored form of a login binding
+func bindingHash(binding string) string {
+	sum := sha256.Sum256([]byte(binding))
+	return hex.EncodeToString(sum[:])
+}
+
+// CompleteOIDCLogin exchanges the code of the provider redirect and logs in the user the
+// identity is linked to, like Login the result may be a TOTP challenge. binding must be the
+// one of StartOIDCLogin. An unknown identity is linked to the user of the same email when
+// both the provider and the user verified it, or gets a new user without a password
+func (s *UserService) CompleteOIDCLogin(ctx context.Context, state, binding, code string) (*OIDCLogin, error) {
+	st, err := s.oidcStateRepo.Take(ctx, state)
+	if errors.Is(err, mongodb.ErrOIDCStateNotFound) {
+		return nil, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the state is spent either way, a login started by another browser can't be retried
+	if subtle.ConstantTimeCompare([]byte(st.BindingHash), []byte(bindingHash(binding))) != 1 {
+		return nil, ErrInvalidOIDCState
+	}
+
+	provider, ok := s.oidcProviders[st.Provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	claims, err := provider.Authenticate(ctx, code, st.CodeVerifier, st.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCAuthFailed, err)
+	}
+
+	identity := domain.Identity{
+		Provider: st.Provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+		LinkedAt: time.Now(),
+	}
+
+	user, newUser, err := s.oidcUser(ctx, st, identity, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if newUser && s.eventPublisher != nil {
+		_ = s.eventPublisher.PublishUserRegistered(ctx, user.ID.Hex(), user.Email)
+	}
+
+	// the provider is the first factor, TOTP still applies
+	login, err := s.completeLogin(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCLogin{LoginResult: login, NewUser: newUser}, nil
+}
+
+// oidcUser finds or creates the user of the identity, reports whether the user is new
+func (s *UserService) oidcUser(ctx context.Context, st *domain.OIDCState, identity domain.Identity, claims *oidc.Claims) (*domain.User, bool, error) {
+	user, err := s.userRepo.FindByIdentity(ctx, identity.Provider, identity.Subject)
+	switch {
+	case err == nil:
+		if st.UserID != nil && *st.UserID != user.ID {
+			return nil, false, mongodb.ErrIdentityAlreadyLinked
+		}
+		return user, false, nil
+	case !errors.Is(err, mongodb.ErrUserNotFound):
+		return nil, false, err
+	}
+
+	// linking requested by a logged in user
+	if st.UserID != nil {
+		user, err := s.userRepo.AddIdentity(ctx, *st.UserID, identity)
+		return user, false, err
+	}
+
+	if claims.Email == "" {
+		return nil, false, fmt.Errorf("%w: no email claim", ErrOIDCAuthFailed)
+	}
+
+	// the provider vouches for the address and the user proved owning it, so it is the same
+	// person. An unverified account may have been registered by anyone with that address,
+	// its owner logs in with the password and links the identity
+	if claims.EmailVerified {
+		existing, err := s.userRepo.FindByEmail(ctx, claims.Email)
+		if err == nil {
+			if !existing.EmailVerified {
+				return nil, false, ErrAccountExists
+			}
+			user, err := s.userRepo.AddIdentity(ctx, existing.ID, identity)
+			return user, false, err
+		}
+		if !errors.Is(err, mongodb.ErrUserNotFound) {
+			return nil, false, err
+		}
+	}
+
+	user = &domain.User{
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Username:      oidcUsername(claims),
+		Roles:         []string{domain.RoleClient},
+		Identities:    []domain.Identity{identity},
+	}
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		if errors.Is(err, mongodb.ErrUserAlreadyExists) {
+			return nil, false, ErrAccountExists
+		}
+		return nil, false, err
+	}
+
+	return user, true, nil
+}
+
+func oidcUsername(claims *oidc.Claims) string {
+	if claims.PreferredUsername != "" {
+		return claims.PreferredUsername
+	}
+	if claims.Name != "" {
+		return claims.Name
+	}
+
+	name, _, _ := strings.Cut(claims.Email, "@")
+	return name
+}
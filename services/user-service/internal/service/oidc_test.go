@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/oidc"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/repository/mongodb"
+)
+
+// newRejectingProvider returns a provider that is discovered but rejects every code,
+// a login reaching the code exchange fails with ErrOIDCAuthFailed
+func newRejectingProvider(t *testing.T) *oidc.Provider {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 srv.URL,
+			"authorization_endpoint": srv.URL + "/authorize",
+			"token_endpoint":         srv.URL + "/token",
+			"jwks_uri":               srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+	})
+
+	return oidc.NewProvider(oidc.Config{
+		Name:        "test",
+		Issuer:      srv.URL,
+		ClientID:    "client",
+		RedirectURL: "https://app.test/callback",
+	}, srv.Client())
+}
+
+func TestCompleteOIDCLoginBinding(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	env.svc.oidcProviders["test"] = newRejectingProvider(t)
+
+	start, err := env.svc.StartOIDCLogin(ctx, "test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start.Binding == "" || start.Binding == start.State {
+		t.Fatalf("StartOIDCLogin binding = %q, state %q", start.Binding, start.State)
+	}
+
+	// the redirect of an attacker's login completed in the victim's browser
+	if _, err := env.svc.CompleteOIDCLogin(ctx, start.State, "other-binding", "code"); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("Foreign binding: got %v, want ErrInvalidOIDCState", err)
+	}
+	if _, err := env.svc.CompleteOIDCLogin(ctx, start.State, start.Binding, "code"); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("State after a foreign binding should be spent, got %v", err)
+	}
+
+	// with its binding the login gets to the code exchange
+	start, err = env.svc.StartOIDCLogin(ctx, "test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.svc.CompleteOIDCLogin(ctx, start.State, start.Binding, "code"); !errors.Is(err, ErrOIDCAuthFailed) {
+		t.Errorf("Own binding: got %v, want ErrOIDCAuthFailed of the rejected code", err)
+	}
+}
+
+func TestOIDCUserEmailLinking(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name          string
+		localVerified bool
+		// providerVerified is the email_verified claim
+		providerVerified bool
+		wantErr          error
+		wantLinked       bool
+	}{
+		{name: "both verified", localVerified: true, providerVerified: true, wantLinked: true},
+		{name: "local account unverified", providerVerified: true, wantErr: ErrAccountExists},
+		{name: "provider email unverified", localVerified: true, wantErr: ErrAccountExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			local := env.createUser(t, "user@example.com", "password1")
+			if tt.localVerified {
+				if err := env.users.SetEmailVerified(ctx, local.ID, local.Email); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			identity := domain.Identity{Provider: "test", Subject: "sub-1", Email: local.Email}
+			claims := &oidc.Claims{Email: local.Email, EmailVerified: tt.providerVerified}
+			user, newUser, err := env.svc.oidcUser(ctx, &domain.OIDCState{Provider: "test"}, identity, claims)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("oidcUser: got %v, want %v", err, tt.wantErr)
+			}
+
+			linked, err := env.users.FindByIdentity(ctx, "test", "sub-1")
+			if !tt.wantLinked {
+				if !errors.Is(err, mongodb.ErrUserNotFound) {
+					t.Errorf("Identity should not be linked, found %v, %v", linked, err)
+				}
+				return
+			}
+			if newUser || user.ID != local.ID || err != nil || linked.ID != local.ID {
+				t.Errorf("Identity should be linked to the local user: %v, %v, %v", user, newUser, err)
+			}
+		})
+	}
+}
+
+func TestOIDCUserExplicitLink(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	local := env.createUser(t, "user@example.com", "password1")
+	other := env.createUser(t, "other@example.com", "password1")
+
+	// the logged in user links an identity whatever its email
+	identity := domain.Identity{Provider: "test", Subject: "sub-1", Email: "personal@example.org"}
+	claims := &oidc.Claims{Email: identity.Email}
+	user, newUser, err := env.svc.oidcUser(ctx, &domain.OIDCState{Provider: "test", UserID: &local.ID}, identity, claims)
+	if err != nil || newUser || user.ID != local.ID {
+		t.Fatalf("Explicit link: %v, %v, %v", user, newUser, err)
+	}
+
+	// the identity then logs in as that user, and can't be linked to another one
+	user, _, err = env.svc.oidcUser(ctx, &domain.OIDCState{Provider: "test"}, identity, claims)
+	if err != nil || user.ID != local.ID {
+		t.Errorf("Login with the linked identity: %v, %v", user, err)
+	}
+	if _, _, err := env.svc.oidcUser(ctx, &domain.OIDCState{Provider: "test", UserID: &other.ID}, identity, claims); !errors.Is(err, mongodb.ErrIdentityAlreadyLinked) {
+		t.Errorf("Linking to another user: got %v, want ErrIdentityAlreadyLinked", err)
+	}
+}
+
+func TestOIDCUserNew(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	identity := domain.Identity{Provider: "test", Subject: "sub-1", Email: "new@example.com"}
+	claims := &oidc.Claims{Email: identity.Email, EmailVerified: true, PreferredUsername: "newbie"}
+	user, newUser, err := env.svc.oidcUser(ctx, &domain.OIDCState{Provider: "test"}, identity, claims)
+	if err != nil || !newUser {
+		t.Fatalf("New identity: %v, %v, %v", user, newUser, err)
+	}
+	if !user.EmailVerified || user.PasswordHash != "" || user.Username != "newbie" {
+		t.Errorf("Unexpected new user %+v", user)
+	}
+}
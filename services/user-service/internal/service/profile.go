@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/mailer"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/repository/mongodb"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrReauthRequired is returned for a change of a user without a password whose session
+// didn't start recently, the user logs in with the provider again and retries
+var ErrReauthRequired = errors.New("log in again to confirm this change")
+
+// UpdateProfile sets the username of the user and returns the updated user
+func (s *UserService) UpdateProfile(ctx context.Context, userID, username string) (*domain.User, error) {
+	user, err := s.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err = s.userRepo.UpdateProfile(ctx, user.ID, strings.TrimSpace(username))
+	if err != nil {
+		return nil, err
+	}
+
+	if s.eventPublisher != nil {
+		_ = s.eventPublisher.PublishProfileUpdated(ctx, userID, user.Username)
+	}
+
+	return user, nil
+}
+
+// ChangePassword replaces the password after checking the current one, all sessions of
+// the user end and log in again with the new password
+func (s *UserService) ChangePassword(ctx context.Context, userID, sessionID, currentPassword, newPassword string) error {
+	user, err := s.GetProfile(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.confirmUser(ctx, user, sessionID, currentPassword); err != nil {
+		return err
+	}
+	if err := s.checkPassword(newPassword); err != nil {
+		return err
+	}
+
+	return s.setPassword(ctx, user.ID, newPassword, passwordChange)
+}
+
+// ChangeEmail replaces the email after checking the password, the new address is unverified
+// until the user follows the mailed link. The old address is told about the change
+func (s *UserService) ChangeEmail(ctx context.Context, userID, sessionID, password, newEmail string) error {
+	if err := checkEmail(newEmail); err != nil {
+		return err
+	}
+
+	user, err := s.GetProfile(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.confirmUser(ctx, user, sessionID, password); err != nil {
+		return err
+	}
+
+	oldEmail := user.Email
+	if err := s.userRepo.SetEmail(ctx, user.ID, newEmail); err != nil {
+		return err
+	}
+	user.Email, user.EmailVerified = newEmail, false
+
+	if s.eventPublisher != nil {
+		_ = s.eventPublisher.PublishEmailChanged(ctx, userID, oldEmail, newEmail)
+	}
+
+	// like Register a failed mail is resent by RequestEmailVerification
+	_ = s.sendEmailVerification(ctx, user)
+
+	// the notice is best effort, the change is done
+	_ = s.mailer.Send(ctx, mailer.Message{
+		To:      oldEmail,
+		Subject: "Your email was changed",
+		Body: fmt.Sprintf("Hi %s,\n\nthe email of your account was changed to %s.\n\n"+
+			"If you didn't do this, contact support right away, this address can't be used to log in anymore.\n",
+			user.Username, newEmail),
+	})
+
+	return nil
+}
+
+// DeleteAccount soft deletes the user after checking the password: the personal data is
+// anonymized, sessions end and the email can register a new account
+func (s *UserService) DeleteAccount(ctx context.Context, userID, sessionID, password string) error {
+	user, err := s.GetProfile(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.confirmUser(ctx, user, sessionID, password); err != nil {
+		return err
+	}
+
+	if err := s.userRepo.SoftDelete(ctx, user.ID); err != nil {
+		return err
+	}
+
+	if _, err := s.LogoutAll(ctx, userID); err != nil {
+		return err
+	}
+	for _, purpose := range []string{domain.TokenEmailVerification, domain.TokenPasswordReset} {
+		if err := s.userTokenRepo.DeleteByUser(ctx, user.ID, purpose); err != nil {
+			return err
+		}
+	}
+
+	if s.eventPublisher != nil {
+		_ = s.eventPublisher.PublishUserDeleted(ctx, userID)
+	}
+
+	return nil
+}
+
+// confirmUser checks the user is at the keyboard for a sensitive change: the password, or
+// for users created by an OIDC login without one a login within ReauthMaxAge, as a stolen
+// session alone must not take over the account
+func (s *UserService) confirmUser(ctx context.Context, user *domain.User, sessionID, password string) error {
+	if user.PasswordHash != "" {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+			return ErrInvalidCredentials
+		}
+		return nil
+	}
+
+	// refreshing keeps the start of the session, only a new login renews it
+	token, err := s.refreshTokenRepo.FindBySessionID(ctx, sessionID)
+	if errors.Is(err, mongodb.ErrRefreshTokenNotFound) {
+		return ErrReauthRequired
+	}
+	if err != nil {
+		return err
+	}
+	if token.UserID != user.ID || time.Since(token.SessionStartedAt) > s.cfg.ReauthMaxAge {
+		return ErrReauthRequired
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/repository/mongodb"
+)
+
+func TestChangePassword(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := env.createUser(t, "user@example.com", "password1")
+	tokens := env.login(t, "user@example.com", "password1")
+	other := env.login(t, "user@example.com", "password1")
+	sessionID := env.sessionOf(t, tokens)
+
+	if err := env.svc.ChangePassword(ctx, user.ID.Hex(), sessionID, "wrong-password", "new-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Wrong current password: got %v, want ErrInvalidCredentials", err)
+	}
+	if err := env.svc.ChangePassword(ctx, user.ID.Hex(), sessionID, "password1", "short"); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("Short password: got %v, want ErrWeakPassword", err)
+	}
+	if _, err := env.auth.ValidateSession(ctx, tokens.AccessToken); err != nil {
+		t.Fatalf("Rejected changes should keep the sessions: %v", err)
+	}
+
+	if err := env.svc.ChangePassword(ctx, user.ID.Hex(), sessionID, "password1", "new-password"); err != nil {
+		t.Fatal(err)
+	}
+	for _, pair := range []*TokenPair{tokens, other} {
+		if _, err := env.auth.ValidateSession(ctx, pair.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+			t.Errorf("Session after ChangePassword: got %v, want ErrSessionRevoked", err)
+		}
+	}
+	env.login(t, "user@example.com", "new-password")
+}
+
+func TestChangeEmail(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := env.createUser(t, "user@example.com", "password1")
+	env.createUser(t, "taken@example.com", "password1")
+	tokens := env.login(t, "user@example.com", "password1")
+	sessionID := env.sessionOf(t, tokens)
+
+	for _, email := range []string{"not-an-email", "User <new@example.com>", "new@example.com, other@example.com"} {
+		if err := env.svc.ChangeEmail(ctx, user.ID.Hex(), sessionID, "password1", email); !errors.Is(err, ErrInvalidEmail) {
+			t.Errorf("ChangeEmail to %q: got %v, want ErrInvalidEmail", email, err)
+		}
+	}
+	if err := env.svc.ChangeEmail(ctx, user.ID.Hex(), sessionID, "wrong-password", "new@example.com"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Wrong password: got %v, want ErrInvalidCredentials", err)
+	}
+	if err := env.svc.ChangeEmail(ctx, user.ID.Hex(), sessionID, "password1", "taken@example.com"); !errors.Is(err, mongodb.ErrUserAlreadyExists) {
+		t.Errorf("Email of another user: got %v, want ErrUserAlreadyExists", err)
+	}
+	if _, ok := env.mailer.last("user@example.com"); ok {
+		t.Error("Rejected changes should mail nothing")
+	}
+
+	if err := env.svc.ChangeEmail(ctx, user.ID.Hex(), sessionID, "password1", "new@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	notice, ok := env.mailer.last("user@example.com")
+	if !ok || !strings.Contains(notice.Body, "new@example.com") {
+		t.Errorf("Old address should be told about the change, got %+v", notice)
+	}
+	if _, err := env.svc.VerifyEmail(ctx, env.mailer.token(t, "new@example.com")); err != nil {
+		t.Errorf("New address should get a verification link: %v", err)
+	}
+	env.login(t, "new@example.com", "password1")
+}
+
+func TestRegisterInvalidEmail(t *testing.T) {
+	env := newTestEnv(t)
+
+	if _, _, err := env.svc.Register(context.Background(), "not-an-email", "password1", "user"); !errors.Is(err, ErrInvalidEmail) {
+		t.Errorf("Register: got %v, want ErrInvalidEmail", err)
+	}
+}
+
+func TestRegisterWeakPassword(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	if _, _, err := env.svc.Register(ctx, "user@example.com", "short", "user"); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("Register: got %v, want ErrWeakPassword", err)
+	}
+	if _, err := env.users.FindByEmail(ctx, "user@example.com"); err == nil {
+		t.Error("A rejected registration should create no user")
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := env.createUser(t, "user@example.com", "password1")
+	tokens := env.login(t, "user@example.com", "password1")
+	other := env.login(t, "user@example.com", "password1")
+	sessionID := env.sessionOf(t, tokens)
+
+	if err := env.svc.DeleteAccount(ctx, user.ID.Hex(), sessionID, "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Wrong password: got %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := env.auth.ValidateSession(ctx, tokens.AccessToken); err != nil {
+		t.Fatalf("Rejected delete should keep the sessions: %v", err)
+	}
+
+	if err := env.svc.DeleteAccount(ctx, user.ID.Hex(), sessionID, "password1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, pair := range []*TokenPair{tokens, other} {
+		if _, err := env.auth.ValidateSession(ctx, pair.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+			t.Errorf("Session after DeleteAccount: got %v, want ErrSessionRevoked", err)
+		}
+	}
+	if _, err := env.svc.Login(ctx, "user@example.com", "password1"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login of a deleted account: got %v, want ErrInvalidCredentials", err)
+	}
+
+	// the email is free for a new account
+	env.createUser(t, "user@example.com", "password1")
+}
+
+func TestConfirmUserWithoutPassword(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		op   func(env *testEnv, userID, sessionID string) error
+	}{
+		{
+			name: "ChangePassword",
+			op: func(env *testEnv, userID, sessionID string) error {
+				return env.svc.ChangePassword(ctx, userID, sessionID, "", "new-password")
+			},
+		},
+		{
+			name: "ChangeEmail",
+			op: func(env *testEnv, userID, sessionID string) error {
+				return env.svc.ChangeEmail(ctx, userID, sessionID, "", "new@example.com")
+			},
+		},
+		{
+			name: "DeleteAccount",
+			op: func(env *testEnv, userID, sessionID string) error {
+				return env.svc.DeleteAccount(ctx, userID, sessionID, "")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			// created by an OIDC login, which signs in like this
+			user := env.createUser(t, "user@example.com", "")
+			env.createUser(t, "other@example.com", "password1")
+			tokens, err := env.svc.loginTokens(ctx, user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sessionID := env.sessionOf(t, tokens)
+			otherSession := env.sessionOf(t, env.login(t, "other@example.com", "password1"))
+
+			// a session of somebody else, or none, proves nothing
+			for _, id := range []string{"", otherSession} {
+				if err := tt.op(env, user.ID.Hex(), id); !errors.Is(err, ErrReauthRequired) {
+					t.Errorf("Session %q: got %v, want ErrReauthRequired", id, err)
+				}
+			}
+
+			// a refreshed session keeps its start, only a new login is fresh
+			env.tokens.ageSession(sessionID, env.cfg.ReauthMaxAge+1)
+			refreshed, err := env.svc.RefreshToken(ctx, tokens.RefreshToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.op(env, user.ID.Hex(), env.sessionOf(t, refreshed)); !errors.Is(err, ErrReauthRequired) {
+				t.Errorf("Stale session: got %v, want ErrReauthRequired", err)
+			}
+
+			fresh, err := env.svc.loginTokens(ctx, user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.op(env, user.ID.Hex(), env.sessionOf(t, fresh)); err != nil {
+				t.Errorf("Fresh session: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/repository/mongodb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrRoleProtected is returned on deleting a role the service relies on
+	ErrRoleProtected = errors.New("built-in role can't be deleted")
+	// ErrLastAdminRole is returned on taking the admin permission from the last role granting it,
+	// nobody could manage roles afterwards
+	ErrLastAdminRole = errors.New("the last role granting the admin permission must keep it")
+)
+
+// ListRoles returns all roles, adminID must have the admin permission
+func (s *UserService) ListRoles(ctx context.Context, adminID string) ([]*domain.Role, error) {
+	if err := s.requirePermission(ctx, adminID, domain.PermissionAdmin); err != nil {
+		return nil, err
+	}
+
+	return s.roleRepo.List(ctx)
+}
+
+// CreateRole adds a role, adminID must have the admin permission
+func (s *UserService) CreateRole(ctx context.Context, adminID, name string, permissions []string) (*domain.Role, error) {
+	if err := s.requirePermission(ctx, adminID, domain.PermissionAdmin); err != nil {
+		return nil, err
+	}
+
+	role := &domain.Role{
+		Name:        name,
+		Permissions: uniquePermissions(permissions),
+	}
+	if err := s.roleRepo.Create(ctx, role); err != nil {
+		return nil, err
+	}
+
+	if err := s.audit(ctx, adminID, domain.AuditCreateRole, primitive.NilObjectID, map[string]interface{}{
+		"role":        role.Name,
+		"permissions": role.Permissions,
+	}); err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+// UpdateRole replaces the permissions of a role, adminID must have the admin permission
+func (s *UserService) UpdateRole(ctx context.Context, adminID, name string, permissions []string) (*domain.Role, error) {
+	if err := s.requirePermission(ctx, adminID, domain.PermissionAdmin); err != nil {
+		return nil, err
+	}
+
+	permissions = uniquePermissions(permissions)
+	if !slices.Contains(permissions, domain.PermissionAdmin) {
+		if err := s.requireOtherAdminRole(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+
+	role, err := s.roleRepo.UpdatePermissions(ctx, name, permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.audit(ctx, adminID, domain.AuditUpdateRole, primitive.NilObjectID, map[string]interface{}{
+		"role":        role.Name,
+		"permissions": role.Permissions,
+	}); err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+// DeleteRole removes a role, adminID must have the admin permission.
+// Users keep the role name but get no permissions from it
+func (s *UserService) DeleteRole(ctx context.Context, adminID, name string) error {
+	if err := s.requirePermission(ctx, adminID, domain.PermissionAdmin); err != nil {
+		return err
+	}
+
+	if domain.IsBuiltinRole(name) {
+		return ErrRoleProtected
+	}
+	// a rename is a new role plus the delete of the old one, the delete is checked
+	if err := s.requireOtherAdminRole(ctx, name); err != nil {
+		return err
+	}
+
+	if err := s.roleRepo.Delete(ctx, name); err != nil {
+		return err
+	}
+
+	return s.audit(ctx, adminID, domain.AuditDeleteRole, primitive.NilObjectID, map[string]interface{}{"role": name})
+}
+
+// requireOtherAdminRole returns ErrLastAdminRole unless a role other than name grants the
+// admin permission
+func (s *UserService) requireOtherAdminRole(ctx context.Context, name string) error {
+	roles, err := s.roleRepo.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, role := range roles {
+		if role.Name != name && slices.Contains(role.Permissions, domain.PermissionAdmin) {
+			return nil
+		}
+	}
+
+	return ErrLastAdminRole
+}
+
+// GrantPermission grants a permission to a user directly and returns the user's grants,
+// adminID must have the admin permission
+func (s *UserService) GrantPermission(ctx context.Context, adminID, userID, permission string) ([]string, error) {
+	if err := s.requirePermission(ctx, adminID, domain.PermissionAdmin); err != nil {
+		return nil, err
+	}
+
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	user, err := s.userRepo.AddPermission(ctx, id, permission)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.audit(ctx, adminID, domain.AuditGrantPermission, id, map[string]interface{}{"permission": permission}); err != nil {
+		return nil, err
+	}
+
+	return user.Permissions, nil
+}
+
+// RevokePermission takes back a permission granted to a user and returns the user's grants,
+// adminID must have the admin permission
+func (s *UserService) RevokePermission(ctx context.Context, adminID, userID, permission string) ([]string, error) {
+	if err := s.requirePermission(ctx, adminID, domain.PermissionAdmin); err != nil {
+		return nil, err
+	}
+
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	user, err := s.userRepo.RemovePermission(ctx, id, permission)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.audit(ctx, adminID, domain.AuditRevokePermission, id, map[string]interface{}{"permission": permission}); err != nil {
+		return nil, err
+	}
+
+	return user.Permissions, nil
+}
+
+// requirePermission checks the user has the permission through a role or a grant
+func (s *UserService) requirePermission(ctx context.Context, userID, permission string) error {
+	user, err := s.GetProfile(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) || errors.Is(err, mongodb.ErrUserNotFound) {
+			return ErrPermissionDenied
+		}
+		return err
+	}
+
+	_, permissions, err := resolvePermissions(ctx, s.roleRepo, user)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range permissions {
+		if p == permission {
+			return nil
+		}
+	}
+
+	return ErrPermissionDenied
+}
+
+// resolvePermissions returns the roles of the user with their permissions and all permissions
+// the user has through them or a grant. Roles that were deleted are left out
+func resolvePermissions(ctx context.Context, roleRepo RoleStore, user *domain.User) ([]RoleInfo, []string, error) {
+	stored, err := roleRepo.FindByNames(ctx, user.Roles)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roles := make([]RoleInfo, 0, len(stored))
+	var permissions []string
+	for _, role := range stored {
+		roles = append(roles, RoleInfo{
+			Name:        role.Name,
+			Permissions: role.Permissions,
+		})
+		permissions = append(permissions, role.Permissions...)
+	}
+	permissions = append(permissions, user.Permissions...)
+
+	return roles, uniquePermissions(permissions), nil
+}
+
+// uniquePermissions drops empty and repeated permissions, keeping the order
+func uniquePermissions(permissions []string) []string {
+	seen := make(map[string]bool, len(permissions))
+	unique := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		if p == "" || seen[p] {
+			continue
+		}
+		seen[p] = true
+		unique = append(unique, p)
+	}
+
+	return unique
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRolePermissions(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	admin := env.createUser(t, "admin@example.com", "", domain.RoleAdmin)
+	user := env.createUser(t, "user@example.com", "password1", domain.RoleClient, "SUPPORT")
+	tokens := env.login(t, "user@example.com", "password1")
+
+	permissions := func() []string {
+		t.Helper()
+		info, err := env.auth.ValidateSession(ctx, tokens.AccessToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(info.Permissions)
+		return info.Permissions
+	}
+
+	// a role the user has before it exists grants nothing
+	if got := permissions(); !slices.Equal(got, []string{domain.PermissionRead, domain.PermissionWrite}) {
+		t.Errorf("Permissions = %v, want the CLIENT ones", got)
+	}
+
+	if _, err := env.svc.CreateRole(ctx, admin.ID.Hex(), "SUPPORT", []string{"tickets", "tickets", ""}); err != nil {
+		t.Fatal(err)
+	}
+	if got := permissions(); !slices.Equal(got, []string{domain.PermissionRead, "tickets", domain.PermissionWrite}) {
+		t.Errorf("Permissions after CreateRole = %v", got)
+	}
+
+	// changes apply to live sessions right away
+	if _, err := env.svc.UpdateRole(ctx, admin.ID.Hex(), "SUPPORT", []string{"refunds"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := permissions(); !slices.Equal(got, []string{domain.PermissionRead, "refunds", domain.PermissionWrite}) {
+		t.Errorf("Permissions after UpdateRole = %v", got)
+	}
+
+	grants, err := env.svc.GrantPermission(ctx, admin.ID.Hex(), user.ID.Hex(), "reports")
+	if err != nil || !slices.Equal(grants, []string{"reports"}) {
+		t.Fatalf("GrantPermission = %v, %v", grants, err)
+	}
+	if got := permissions(); !slices.Contains(got, "reports") {
+		t.Errorf("Permissions after GrantPermission = %v", got)
+	}
+
+	if err := env.svc.DeleteRole(ctx, admin.ID.Hex(), "SUPPORT"); err != nil {
+		t.Fatal(err)
+	}
+	if grants, err := env.svc.RevokePermission(ctx, admin.ID.Hex(), user.ID.Hex(), "reports"); err != nil || len(grants) != 0 {
+		t.Fatalf("RevokePermission = %v, %v", grants, err)
+	}
+	if got := permissions(); !slices.Equal(got, []string{domain.PermissionRead, domain.PermissionWrite}) {
+		t.Errorf("Permissions after DeleteRole and RevokePermission = %v", got)
+	}
+
+	// every change is audited, the role changes without a target user
+	want := []struct {
+		action string
+		target primitive.ObjectID
+	}{
+		{domain.AuditCreateRole, primitive.NilObjectID},
+		{domain.AuditUpdateRole, primitive.NilObjectID},
+		{domain.AuditGrantPermission, user.ID},
+		{domain.AuditDeleteRole, primitive.NilObjectID},
+		{domain.AuditRevokePermission, user.ID},
+	}
+	if len(env.auditLog.entries) != len(want) {
+		t.Fatalf("Audit log = %+v, want %d entries", env.auditLog.entries, len(want))
+	}
+	for i, e := range env.auditLog.entries {
+		if e.Action != want[i].action || e.ActorID != admin.ID || e.TargetID != want[i].target {
+			t.Errorf("Entry %d = %s by %s of %s, want %s of %s", i, e.Action, e.ActorID.Hex(), e.TargetID.Hex(), want[i].action, want[i].target.Hex())
+		}
+	}
+	if role, permissions := env.auditLog.entries[1].Details["role"], env.auditLog.entries[1].Details["permissions"]; role != "SUPPORT" || !slices.Equal(permissions.([]string), []string{"refunds"}) {
+		t.Errorf("UpdateRole details = %v", env.auditLog.entries[1].Details)
+	}
+}
+
+func TestRoleOperationsRequireAdmin(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	client := env.createUser(t, "user@example.com", "password1").ID.Hex()
+
+	// a grant of the admin permission is as good as the ADMIN role
+	granted := env.createUser(t, "granted@example.com", "password1").ID.Hex()
+	if _, err := env.users.AddPermission(ctx, mustObjectID(t, granted), domain.PermissionAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	ops := map[string]func(adminID string) error{
+		"ListRoles": func(adminID string) error {
+			_, err := env.svc.ListRoles(ctx, adminID)
+			return err
+		},
+		"CreateRole": func(adminID string) error {
+			_, err := env.svc.CreateRole(ctx, adminID, "ROLE-"+adminID, nil)
+			return err
+		},
+		"UpdateRole": func(adminID string) error {
+			_, err := env.svc.UpdateRole(ctx, adminID, domain.RoleClient, []string{domain.PermissionRead, domain.PermissionWrite})
+			return err
+		},
+		"GrantPermission": func(adminID string) error {
+			_, err := env.svc.GrantPermission(ctx, adminID, client, "reports")
+			return err
+		},
+		"RevokePermission": func(adminID string) error {
+			_, err := env.svc.RevokePermission(ctx, adminID, client, "reports")
+			return err
+		},
+	}
+
+	for name, op := range ops {
+		if err := op(client); !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("%s by a client: got %v, want ErrPermissionDenied", name, err)
+		}
+		if err := op("not-an-id"); !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("%s by an unknown user: got %v, want ErrPermissionDenied", name, err)
+		}
+		if err := op(granted); err != nil {
+			t.Errorf("%s by a user granted admin: %v", name, err)
+		}
+	}
+}
+
+func TestLastAdminRole(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	admin := env.createUser(t, "admin@example.com", "", domain.RoleAdmin).ID.Hex()
+
+	if err := env.svc.DeleteRole(ctx, admin, domain.RoleAdmin); !errors.Is(err, ErrRoleProtected) {
+		t.Errorf("Deleting ADMIN: got %v, want ErrRoleProtected", err)
+	}
+	if _, err := env.svc.UpdateRole(ctx, admin, domain.RoleAdmin, []string{domain.PermissionRead}); !errors.Is(err, ErrLastAdminRole) {
+		t.Errorf("Taking admin from the only admin role: got %v, want ErrLastAdminRole", err)
+	}
+
+	// with another admin role ADMIN may drop the permission, which the new role then keeps
+	if _, err := env.svc.CreateRole(ctx, admin, "OWNER", []string{domain.PermissionAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.users.SetRoles(ctx, mustObjectID(t, admin), []string{domain.RoleAdmin, "OWNER"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.svc.UpdateRole(ctx, admin, domain.RoleAdmin, []string{domain.PermissionRead}); err != nil {
+		t.Fatalf("Taking admin from ADMIN with OWNER left: %v", err)
+	}
+	if _, err := env.svc.UpdateRole(ctx, admin, "OWNER", nil); !errors.Is(err, ErrLastAdminRole) {
+		t.Errorf("Taking admin from OWNER: got %v, want ErrLastAdminRole", err)
+	}
+
+	// renaming OWNER is a new role and the delete of the old one, which must come last
+	if err := env.svc.DeleteRole(ctx, admin, "OWNER"); !errors.Is(err, ErrLastAdminRole) {
+		t.Errorf("Deleting OWNER before the rename: got %v, want ErrLastAdminRole", err)
+	}
+	if err := env.users.SetRoles(ctx, mustObjectID(t, admin), []string{"OWNER", "SUPERUSER"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.svc.CreateRole(ctx, admin, "SUPERUSER", []string{domain.PermissionAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.svc.DeleteRole(ctx, admin, "OWNER"); err != nil {
+		t.Errorf("Deleting OWNER after the rename: %v", err)
+	}
+
+	roles, _ := env.svc.ListRoles(ctx, admin)
+	var adminRoles []string
+	for _, role := range roles {
+		if slices.Contains(role.Permissions, domain.PermissionAdmin) {
+			adminRoles = append(adminRoles, role.Name)
+		}
+	}
+	if !slices.Equal(adminRoles, []string{"SUPERUSER"}) {
+		t.Errorf("Roles granting admin = %v, want SUPERUSER", adminRoles)
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+type deviceKey struct{}
+
+// WithDevice returns a context carrying the client of the request, sessions started or
+// refreshed with it record the device
+func WithDevice(ctx context.Context, device domain.Device) context.Context {
+	return context.WithValue(ctx, deviceKey{}, device)
+}
+
+func deviceFromContext(ctx context.Context) domain.Device {
+	device, _ := ctx.Value(deviceKey{}).(domain.Device)
+	return device
+}
+
+// Session is a logged in device of a user
+type Session struct {
+	SessionID  string
+	Device     domain.Device
+	StartedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+}
+
+// ListSessions returns the active sessions of the user, most recently used first
+func (s *UserService) ListSessions(ctx context.Context, userID string) ([]Session, error) {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	tokens, err := s.refreshTokenRepo.ListActive(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(tokens))
+	for _, t := range tokens {
+		sessions = append(sessions, Session{
+			SessionID:  t.SessionID,
+			Device:     t.Device,
+			StartedAt:  t.SessionStartedAt,
+			LastUsedAt: t.LastUsedAt,
+			ExpiresAt:  t.ExpiresAt,
+		})
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession logs out one session of the user, e.g. a lost device
+func (s *UserService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+
+	// sessions of other users are not found rather than denied
+	ok, err := s.refreshTokenRepo.HasSession(ctx, id, sessionID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrSessionNotFound
+	}
+
+	if err := s.revokeSession(ctx, sessionID); err != nil {
+		return err
+	}
+
+	if s.eventPublisher != nil {
+		_ = s.eventPublisher.PublishUserLogout(ctx, userID, sessionID)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+)
+
+func TestListSessions(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := env.createUser(t, "user@example.com", "password1")
+	env.createUser(t, "other@example.com", "password1")
+	env.login(t, "other@example.com", "password1")
+
+	phone := domain.Device{UserAgent: "phone", IP: "10.0.0.1"}
+	res, err := env.svc.Login(WithDevice(ctx, phone), "user@example.com", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := env.sessionOf(t, res.Tokens)
+
+	// a refresh keeps the session and only its newest token is listed
+	desktop := env.login(t, "user@example.com", "password1")
+	if _, err := env.svc.RefreshToken(ctx, desktop.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := env.svc.ListSessions(ctx, user.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("ListSessions returned %d sessions, want 2: %+v", len(sessions), sessions)
+	}
+	if sessions[0].SessionID != env.sessionOf(t, desktop) || sessions[1].SessionID != first {
+		t.Errorf("Sessions should be listed most recently used first: %+v", sessions)
+	}
+	if sessions[1].Device != phone {
+		t.Errorf("Device = %+v, want %+v", sessions[1].Device, phone)
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := env.createUser(t, "user@example.com", "password1")
+	env.createUser(t, "other@example.com", "password1")
+	tokens := env.login(t, "user@example.com", "password1")
+	kept := env.login(t, "user@example.com", "password1")
+	other := env.login(t, "other@example.com", "password1")
+
+	// a session of another user is not found, and stays logged in
+	if err := env.svc.RevokeSession(ctx, user.ID.Hex(), env.sessionOf(t, other)); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Session of another user: got %v, want ErrSessionNotFound", err)
+	}
+	if _, err := env.auth.ValidateSession(ctx, other.AccessToken); err != nil {
+		t.Errorf("Session of another user should stay valid: %v", err)
+	}
+	if err := env.svc.RevokeSession(ctx, user.ID.Hex(), "unknown"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Unknown session: got %v, want ErrSessionNotFound", err)
+	}
+
+	if err := env.svc.RevokeSession(ctx, user.ID.Hex(), env.sessionOf(t, tokens)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.auth.ValidateSession(ctx, tokens.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("Revoked session: got %v, want ErrSessionRevoked", err)
+	}
+	if _, err := env.svc.RefreshToken(ctx, tokens.RefreshToken); err == nil {
+		t.Error("Refresh token of a revoked session should be rejected")
+	}
+	if _, err := env.auth.ValidateSession(ctx, kept.AccessToken); err != nil {
+		t.Errorf("Other sessions should stay valid: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/repository/mongodb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The stores below are implemented by the MongoDB repositories and return their errors,
+// e.g. mongodb.ErrUserNotFound
+
+// UserStore persists users
+type UserStore interface {
+	Create(ctx context.Context, user *domain.User) error
+	FindByEmail(ctx context.Context, email string) (*domain.User, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*domain.User, error)
+	FindAnyByID(ctx context.Context, id primitive.ObjectID) (*domain.User, error)
+	FindByIdentity(ctx context.Context, provider, subject string) (*domain.User, error)
+	List(ctx context.Context, f mongodb.UserFilter, after primitive.ObjectID, limit int64) ([]*domain.User, error)
+	AddIdentity(ctx context.Context, id primitive.ObjectID, identity domain.Identity) (*domain.User, error)
+	AddPermission(ctx context.Context, id primitive.ObjectID, permission string) (*domain.User, error)
+	RemovePermission(ctx context.Context, id primitive.ObjectID, permission string) (*domain.User, error)
+	SetTOTPSecret(ctx context.Context, id primitive.ObjectID, secret string) error
+	EnableTOTP(ctx context.Context, id primitive.ObjectID, step int64, recoveryCodes []string) error
+	DisableTOTP(ctx context.Context, id primitive.ObjectID) error
+	UseTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) error
+	UseRecoveryCode(ctx context.Context, id primitive.ObjectID, code string) error
+	RecordLoginFailure(ctx context.Context, id primitive.ObjectID, window time.Duration) (*domain.Lockout, error)
+	LockUntil(ctx context.Context, id primitive.ObjectID, until time.Time) error
+	ClearLockout(ctx context.Context, id primitive.ObjectID) error
+	SetEmailVerified(ctx context.Context, id primitive.ObjectID, email string) error
+	SetPassword(ctx context.Context, id primitive.ObjectID, passwordHash string) error
+	UpdateProfile(ctx context.Context, id primitive.ObjectID, username string) (*domain.User, error)
+	SetEmail(ctx context.Context, id primitive.ObjectID, email string) error
+	SoftDelete(ctx context.Context, id primitive.ObjectID) error
+	SetRoles(ctx context.Context, id primitive.ObjectID, roles []string) error
+	SetDisabled(ctx context.Context, id primitive.ObjectID, disabled bool) error
+}
+
+// RefreshTokenStore persists refresh tokens, one live token per session
+type RefreshTokenStore interface {
+	Create(ctx context.Context, token string, refreshToken *domain.RefreshToken, ttl time.Duration) error
+	Use(ctx context.Context, token string, successor []byte) (*domain.RefreshToken, error)
+	Find(ctx context.Context, token string) (*domain.RefreshToken, error)
+	FindBySessionID(ctx context.Context, sessionID string) (*domain.RefreshToken, error)
+	ListActive(ctx context.Context, userID primitive.ObjectID) ([]*domain.RefreshToken, error)
+	HasSession(ctx context.Context, userID primitive.ObjectID, sessionID string) (bool, error)
+	SessionIDsByUserID(ctx context.Context, userID primitive.ObjectID) ([]string, error)
+	DeleteBySessionID(ctx context.Context, sessionID string) error
+	DeleteByUserID(ctx context.Context, userID primitive.ObjectID) error
+}
+
+// RoleStore persists roles and their permissions
+type RoleStore interface {
+	List(ctx context.Context) ([]*domain.Role, error)
+	FindByNames(ctx context.Context, names []string) ([]*domain.Role, error)
+	Create(ctx context.Context, role *domain.Role) error
+	UpdatePermissions(ctx context.Context, name string, permissions []string) (*domain.Role, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// APIKeyStore persists API keys by the hash of the key
+type APIKeyStore interface {
+	Create(ctx context.Context, apiKey *domain.APIKey, key string) error
+	FindByKey(ctx context.Context, key string) (*domain.APIKey, error)
+	List(ctx context.Context, clientID string) ([]*domain.APIKey, error)
+	Revoke(ctx context.Context, id primitive.ObjectID) error
+}
+
+// OIDCStateStore keeps the state of OIDC logins in progress
+type OIDCStateStore interface {
+	Create(ctx context.Context, state string, st *domain.OIDCState) error
+	Take(ctx context.Context, state string) (*domain.OIDCState, error)
+}
+
+// LoginChallengeStore keeps the second factor challenges of logins in progress
+type LoginChallengeStore interface {
+	Create(ctx context.Context, token string, userID primitive.ObjectID, enrollment bool, ttl time.Duration) error
+	Find(ctx context.Context, token string) (*domain.LoginChallenge, error)
+	Attempt(ctx context.Context, token string, maxAttempts int) (*domain.LoginChallenge, error)
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// UserTokenStore keeps the single use tokens mailed to users
+type UserTokenStore interface {
+	Create(ctx context.Context, token, purpose string, userID primitive.ObjectID, email string, ttl time.Duration) error
+	Take(ctx context.Context, token, purpose string) (*domain.UserToken, error)
+	DeleteByUser(ctx context.Context, userID primitive.ObjectID, purpose string) error
+}
+
+// AuditLogStore records admin actions
+type AuditLogStore interface {
+	Create(ctx context.Context, entry *domain.AuditEntry) error
+	List(ctx context.Context, targetID, after primitive.ObjectID, limit int64) ([]*domain.AuditEntry, error)
+}
@@ -0,0 +1,1018 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/config"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/jwt"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/mailer"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/repository/mongodb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// In-memory stores with the semantics of the MongoDB repositories, including their errors.
+// Returned documents are copies, like decoded ones
+
+type testEnv struct {
+	users      *memUserStore
+	tokens     *memRefreshTokenStore
+	roles      *memRoleStore
+	apiKeys    *memAPIKeyStore
+	oidcStates *memOIDCStateStore
+	challenges *memLoginChallengeStore
+	userTokens *memUserTokenStore
+	auditLog   *memAuditLogStore
+	revoked    *memRevokedSessionStore
+	mailer     *memMailer
+	cfg        *config.Config
+
+	svc   *UserService
+	auth  *AuthService
+	admin *AdminService
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	env := &testEnv{
+		users:      &memUserStore{},
+		tokens:     &memRefreshTokenStore{},
+		roles:      &memRoleStore{roles: domain.DefaultRoles()},
+		apiKeys:    &memAPIKeyStore{},
+		oidcStates: &memOIDCStateStore{},
+		challenges: &memLoginChallengeStore{},
+		userTokens: &memUserTokenStore{},
+		auditLog:   &memAuditLogStore{},
+		revoked:    &memRevokedSessionStore{},
+		mailer:     &memMailer{},
+		cfg: &config.Config{
+			AccessTokenTTL:         15 * time.Minute,
+			RefreshTokenTTL:        time.Hour,
+			RefreshTokenLength:     64,
+			RefreshTokenReuseGrace: 10 * time.Second,
+			OIDCStateTTL:           10 * time.Minute,
+			TOTPIssuer:             "user-service",
+			LoginChallengeTTL:      5 * time.Minute,
+			LoginChallengeAttempts: 5,
+			LoginBackoffAfter:      3,
+			LoginBackoffBase:       time.Second,
+			LoginLockoutThreshold:  10,
+			LoginLockoutDuration:   15 * time.Minute,
+			LoginFailureWindow:     time.Hour,
+			AppURL:                 "https://app.test",
+			EmailVerificationTTL:   time.Hour,
+			PasswordResetTTL:       time.Hour,
+			MinPasswordLength:      8,
+			ReauthMaxAge:           5 * time.Minute,
+		},
+	}
+
+	jwtManager := jwt.NewManager("test-secret", env.cfg.AccessTokenTTL)
+	env.svc = NewUserService(env.users, env.tokens, env.roles, env.apiKeys, env.oidcStates, env.challenges,
+		env.userTokens, env.auditLog, nil, env.revoked, jwtManager, nil, env.mailer, env.cfg)
+	env.auth = NewAuthService(jwtManager, env.revoked, env.users, env.roles, env.apiKeys)
+	env.admin = NewAdminService(env.svc, env.users, env.roles, env.auditLog)
+
+	return env
+}
+
+// createUser stores a user with the password and roles, bcrypt at the minimum cost keeps tests fast
+func (env *testEnv) createUser(t *testing.T, email, password string, roles ...string) *domain.User {
+	t.Helper()
+
+	user := &domain.User{Email: email, Username: strings.Split(email, "@")[0], Roles: roles}
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		user.PasswordHash = string(hash)
+	}
+	if len(user.Roles) == 0 {
+		user.Roles = []string{domain.RoleClient}
+	}
+	if err := env.users.Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+// login logs the user in with a password, failing the test for a second factor challenge
+func (env *testEnv) login(t *testing.T, email, password string) *TokenPair {
+	t.Helper()
+
+	res, err := env.svc.Login(context.Background(), email, password)
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if res.Tokens == nil {
+		t.Fatalf("Login returned a challenge: %+v", res)
+	}
+
+	return res.Tokens
+}
+
+// sessionOf returns the session of an access token
+func (env *testEnv) sessionOf(t *testing.T, tokens *TokenPair) string {
+	t.Helper()
+
+	claims, err := env.svc.jwtManager.ValidateToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return claims.SessionID
+}
+
+func mustObjectID(t *testing.T, hex string) primitive.ObjectID {
+	t.Helper()
+
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+func cloneUser(u *domain.User) *domain.User {
+	c := *u
+	c.Roles = slices.Clone(u.Roles)
+	c.Permissions = slices.Clone(u.Permissions)
+	c.Identities = slices.Clone(u.Identities)
+	if u.TOTP != nil {
+		totp := *u.TOTP
+		totp.RecoveryCodes = slices.Clone(u.TOTP.RecoveryCodes)
+		c.TOTP = &totp
+	}
+	if u.Lockout != nil {
+		lockout := *u.Lockout
+		c.Lockout = &lockout
+	}
+	return &c
+}
+
+type memUserStore struct {
+	mx    sync.Mutex
+	users []*domain.User
+}
+
+func (s *memUserStore) find(match func(*domain.User) bool) (*domain.User, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for _, u := range s.users {
+		if match(u) {
+			return cloneUser(u), nil
+		}
+	}
+	return nil, mongodb.ErrUserNotFound
+}
+
+// update applies fn to the user matching the filter, ErrUserNotFound like updateOne without a match
+func (s *memUserStore) update(id primitive.ObjectID, filter func(*domain.User) bool, fn func(*domain.User) error) (*domain.User, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for _, u := range s.users {
+		if u.ID == id && (filter == nil || filter(u)) {
+			if err := fn(u); err != nil {
+				return nil, err
+			}
+			u.UpdatedAt = time.Now()
+			return cloneUser(u), nil
+		}
+	}
+	return nil, mongodb.ErrUserNotFound
+}
+
+func notDeleted(u *domain.User) bool {
+	return u.DeletedAt == nil
+}
+
+func (s *memUserStore) Create(ctx context.Context, user *domain.User) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for _, u := range s.users {
+		if u.Email == user.Email {
+			return mongodb.ErrUserAlreadyExists
+		}
+	}
+
+	user.ID = primitive.NewObjectID()
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	s.users = append(s.users, cloneUser(user))
+	return nil
+}
+
+func (s *memUserStore) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return s.find(func(u *domain.User) bool { return u.Email == email && notDeleted(u) })
+}
+
+func (s *memUserStore) FindByID(ctx context.Context, id primitive.ObjectID) (*domain.User, error) {
+	return s.find(func(u *domain.User) bool { return u.ID == id && notDeleted(u) })
+}
+
+func (s *memUserStore) FindAnyByID(ctx context.Context, id primitive.ObjectID) (*domain.User, error) {
+	return s.find(func(u *domain.User) bool { return u.ID == id })
+}
+
+func (s *memUserStore) FindByIdentity(ctx context.Context, provider, subject string) (*domain.User, error) {
+	return s.find(func(u *domain.User) bool {
+		return notDeleted(u) && slices.ContainsFunc(u.Identities, func(i domain.Identity) bool {
+			return i.Provider == provider && i.Subject == subject
+		})
+	})
+}
+
+func (s *memUserStore) List(ctx context.Context, f mongodb.UserFilter, after primitive.ObjectID, limit int64) ([]*domain.User, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	var users []*domain.User
+	for i := len(s.users) - 1; i >= 0 && int64(len(users)) < limit; i-- {
+		u := s.users[i]
+		switch {
+		case (u.DeletedAt != nil) != (f.Status == mongodb.UserStatusDeleted):
+		case f.Status == mongodb.UserStatusActive && u.DisabledAt != nil:
+		case f.Status == mongodb.UserStatusDisabled && u.DisabledAt == nil:
+		case f.Role != "" && !slices.Contains(u.Roles, f.Role):
+		case f.Query != "" && !strings.HasPrefix(strings.ToLower(u.Email), strings.ToLower(f.Query)) &&
+			!strings.HasPrefix(strings.ToLower(u.Username), strings.ToLower(f.Query)):
+		case !after.IsZero() && u.ID.Hex() >= after.Hex():
+		default:
+			users = append(users, cloneUser(u))
+		}
+	}
+	return users, nil
+}
+
+func (s *memUserStore) AddIdentity(ctx context.Context, id primitive.ObjectID, identity domain.Identity) (*domain.User, error) {
+	if u, err := s.FindByIdentity(ctx, identity.Provider, identity.Subject); err == nil && u.ID != id {
+		return nil, mongodb.ErrIdentityAlreadyLinked
+	}
+	return s.update(id, nil, func(u *domain.User) error {
+		u.Identities = append(u.Identities, identity)
+		return nil
+	})
+}
+
+func (s *memUserStore) AddPermission(ctx context.Context, id primitive.ObjectID, permission string) (*domain.User, error) {
+	return s.update(id, nil, func(u *domain.User) error {
+		if !slices.Contains(u.Permissions, permission) {
+			u.Permissions = append(u.Permissions, permission)
+		}
+		return nil
+	})
+}
+
+func (s *memUserStore) RemovePermission(ctx context.Context, id primitive.ObjectID, permission string) (*domain.User, error) {
+	return s.update(id, nil, func(u *domain.User) error {
+		u.Permissions = slices.DeleteFunc(u.Permissions, func(p string) bool { return p == permission })
+		return nil
+	})
+}
+
+func (s *memUserStore) SetTOTPSecret(ctx context.Context, id primitive.ObjectID, secret string) error {
+	_, err := s.update(id, func(u *domain.User) bool { return !u.TOTPEnabled() }, func(u *domain.User) error {
+		u.TOTP = &domain.TOTP{Secret: secret}
+		return nil
+	})
+	return err
+}
+
+func (s *memUserStore) EnableTOTP(ctx context.Context, id primitive.ObjectID, step int64, recoveryCodes []string) error {
+	_, err := s.update(id, func(u *domain.User) bool { return u.TOTP != nil }, func(u *domain.User) error {
+		now := time.Now()
+		u.TOTP.Enabled, u.TOTP.EnabledAt, u.TOTP.LastStep = true, &now, step
+		u.TOTP.RecoveryCodes = nil
+		for _, code := range recoveryCodes {
+			u.TOTP.RecoveryCodes = append(u.TOTP.RecoveryCodes, normalizeRecoveryCode(code))
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *memUserStore) DisableTOTP(ctx context.Context, id primitive.ObjectID) error {
+	_, err := s.update(id, nil, func(u *domain.User) error {
+		u.TOTP = nil
+		return nil
+	})
+	return err
+}
+
+func (s *memUserStore) UseTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) error {
+	_, err := s.update(id, func(u *domain.User) bool { return u.TOTP != nil && u.TOTP.LastStep < step }, func(u *domain.User) error {
+		u.TOTP.LastStep = step
+		return nil
+	})
+	if err != nil {
+		return mongodb.ErrTOTPCodeUsed
+	}
+	return nil
+}
+
+func (s *memUserStore) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, code string) error {
+	code = normalizeRecoveryCode(code)
+	_, err := s.update(id, func(u *domain.User) bool { return u.TOTP != nil && slices.Contains(u.TOTP.RecoveryCodes, code) }, func(u *domain.User) error {
+		u.TOTP.RecoveryCodes = slices.DeleteFunc(u.TOTP.RecoveryCodes, func(c string) bool { return c == code })
+		return nil
+	})
+	if err != nil {
+		return mongodb.ErrRecoveryCodeInvalid
+	}
+	return nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.ToLower(code))
+}
+
+func (s *memUserStore) RecordLoginFailure(ctx context.Context, id primitive.ObjectID, window time.Duration) (*domain.Lockout, error) {
+	u, err := s.update(id, nil, func(u *domain.User) error {
+		now := time.Now()
+		if u.Lockout == nil {
+			u.Lockout = &domain.Lockout{}
+		}
+		if u.Lockout.LastFailedAt.After(now.Add(-window)) {
+			u.Lockout.FailedAttempts++
+		} else {
+			u.Lockout.FailedAttempts = 1
+		}
+		u.Lockout.LastFailedAt = now
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u.Lockout, nil
+}
+
+func (s *memUserStore) LockUntil(ctx context.Context, id primitive.ObjectID, until time.Time) error {
+	_, err := s.update(id, nil, func(u *domain.User) error {
+		if u.Lockout == nil {
+			u.Lockout = &domain.Lockout{}
+		}
+		u.Lockout.LockedUntil = &until
+		return nil
+	})
+	return err
+}
+
+func (s *memUserStore) ClearLockout(ctx context.Context, id primitive.ObjectID) error {
+	_, err := s.update(id, nil, func(u *domain.User) error {
+		u.Lockout = nil
+		return nil
+	})
+	return err
+}
+
+func (s *memUserStore) SetEmailVerified(ctx context.Context, id primitive.ObjectID, email string) error {
+	_, err := s.update(id, func(u *domain.User) bool { return u.Email == email }, func(u *domain.User) error {
+		u.EmailVerified = true
+		return nil
+	})
+	return err
+}
+
+func (s *memUserStore) SetPassword(ctx context.Context, id primitive.ObjectID, passwordHash string) error {
+	_, err := s.update(id, nil, func(u *domain.User) error {
+		u.PasswordHash = passwordHash
+		return nil
+	})
+	return err
+}
+
+func (s *memUserStore) UpdateProfile(ctx context.Context, id primitive.ObjectID, username string) (*domain.User, error) {
+	return s.update(id, notDeleted, func(u *domain.User) error {
+		u.Username = username
+		return nil
+	})
+}
+
+func (s *memUserStore) SetEmail(ctx context.Context, id primitive.ObjectID, email string) error {
+	if _, err := s.FindAnyByID(ctx, id); err != nil {
+		return err
+	}
+	if u, err := s.find(func(u *domain.User) bool { return u.Email == email }); err == nil && u.ID != id {
+		return mongodb.ErrUserAlreadyExists
+	}
+	_, err := s.update(id, notDeleted, func(u *domain.User) error {
+		u.Email, u.EmailVerified = email, false
+		return nil
+	})
+	return err
+}
+
+func (s *memUserStore) SoftDelete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := s.update(id, notDeleted, func(u *domain.User) error {
+		now := time.Now()
+		u.Email, u.EmailVerified = "deleted-"+id.Hex()+"@deleted.invalid", false
+		u.Username, u.PasswordHash, u.Roles = "deleted-user", "", []string{}
+		u.Permissions, u.Identities, u.TOTP, u.Lockout = nil, nil, nil, nil
+		u.DeletedAt = &now
+		return nil
+	})
+	return err
+}
+
+func (s *memUserStore) SetRoles(ctx context.Context, id primitive.ObjectID, roles []string) error {
+	_, err := s.update(id, notDeleted, func(u *domain.User) error {
+		u.Roles = slices.Clone(roles)
+		return nil
+	})
+	return err
+}
+
+func (s *memUserStore) SetDisabled(ctx context.Context, id primitive.ObjectID, disabled bool) error {
+	_, err := s.update(id, notDeleted, func(u *domain.User) error {
+		u.DisabledAt = nil
+		if disabled {
+			now := time.Now()
+			u.DisabledAt = &now
+		}
+		return nil
+	})
+	return err
+}
+
+// memRefreshTokenStore keys the tokens by their value instead of the hash
+type memRefreshTokenStore struct {
+	mx     sync.Mutex
+	tokens map[string]*domain.RefreshToken
+}
+
+func (s *memRefreshTokenStore) Create(ctx context.Context, token string, refreshToken *domain.RefreshToken, ttl time.Duration) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	now := time.Now()
+	refreshToken.ID = primitive.NewObjectID()
+	refreshToken.TokenHash = token
+	refreshToken.ExpiresAt = now.Add(ttl)
+	refreshToken.CreatedAt = now
+	refreshToken.LastUsedAt = now
+	if refreshToken.SessionStartedAt.IsZero() {
+		refreshToken.SessionStartedAt = now
+	}
+
+	if s.tokens == nil {
+		s.tokens = make(map[string]*domain.RefreshToken)
+	}
+	stored := *refreshToken
+	s.tokens[token] = &stored
+	return nil
+}
+
+func (s *memRefreshTokenStore) Use(ctx context.Context, token string, successor []byte) (*domain.RefreshToken, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	t, ok := s.tokens[token]
+	switch {
+	case !ok:
+		return nil, mongodb.ErrRefreshTokenNotFound
+	case t.UsedAt != nil:
+		used := *t
+		return &used, mongodb.ErrRefreshTokenReused
+	case !t.ExpiresAt.After(time.Now()):
+		return nil, mongodb.ErrRefreshTokenExpired
+	}
+
+	now := time.Now()
+	t.UsedAt, t.Successor = &now, successor
+	used := *t
+	return &used, nil
+}
+
+func (s *memRefreshTokenStore) Find(ctx context.Context, token string) (*domain.RefreshToken, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	t, ok := s.tokens[token]
+	if !ok {
+		return nil, mongodb.ErrRefreshTokenNotFound
+	}
+	c := *t
+	return &c, nil
+}
+
+// age moves the use and expiration of the token back by d
+func (s *memRefreshTokenStore) age(token string, d time.Duration) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	t := s.tokens[token]
+	t.ExpiresAt = t.ExpiresAt.Add(-d)
+	if t.UsedAt != nil {
+		usedAt := t.UsedAt.Add(-d)
+		t.UsedAt = &usedAt
+	}
+}
+
+// ageSession moves the start of the session back by d
+func (s *memRefreshTokenStore) ageSession(sessionID string, d time.Duration) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for _, t := range s.tokens {
+		if t.SessionID == sessionID {
+			t.SessionStartedAt = t.SessionStartedAt.Add(-d)
+		}
+	}
+}
+
+func (s *memRefreshTokenStore) each(fn func(token string, t *domain.RefreshToken)) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for token, t := range s.tokens {
+		fn(token, t)
+	}
+}
+
+func (s *memRefreshTokenStore) FindBySessionID(ctx context.Context, sessionID string) (*domain.RefreshToken, error) {
+	var found *domain.RefreshToken
+	s.each(func(_ string, t *domain.RefreshToken) {
+		if t.SessionID == sessionID {
+			c := *t
+			found = &c
+		}
+	})
+	if found == nil {
+		return nil, mongodb.ErrRefreshTokenNotFound
+	}
+	return found, nil
+}
+
+func (s *memRefreshTokenStore) ListActive(ctx context.Context, userID primitive.ObjectID) ([]*domain.RefreshToken, error) {
+	var tokens []*domain.RefreshToken
+	s.each(func(_ string, t *domain.RefreshToken) {
+		if t.UserID == userID && t.UsedAt == nil && t.ExpiresAt.After(time.Now()) {
+			c := *t
+			tokens = append(tokens, &c)
+		}
+	})
+	slices.SortFunc(tokens, func(a, b *domain.RefreshToken) int { return b.LastUsedAt.Compare(a.LastUsedAt) })
+	return tokens, nil
+}
+
+func (s *memRefreshTokenStore) HasSession(ctx context.Context, userID primitive.ObjectID, sessionID string) (bool, error) {
+	found := false
+	s.each(func(_ string, t *domain.RefreshToken) {
+		found = found || (t.UserID == userID && t.SessionID == sessionID)
+	})
+	return found, nil
+}
+
+func (s *memRefreshTokenStore) SessionIDsByUserID(ctx context.Context, userID primitive.ObjectID) ([]string, error) {
+	var sessionIDs []string
+	s.each(func(_ string, t *domain.RefreshToken) {
+		if t.UserID == userID && !slices.Contains(sessionIDs, t.SessionID) {
+			sessionIDs = append(sessionIDs, t.SessionID)
+		}
+	})
+	return sessionIDs, nil
+}
+
+func (s *memRefreshTokenStore) deleteWhere(match func(*domain.RefreshToken) bool) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for token, t := range s.tokens {
+		if match(t) {
+			delete(s.tokens, token)
+		}
+	}
+}
+
+func (s *memRefreshTokenStore) DeleteBySessionID(ctx context.Context, sessionID string) error {
+	s.deleteWhere(func(t *domain.RefreshToken) bool { return t.SessionID == sessionID })
+	return nil
+}
+
+func (s *memRefreshTokenStore) DeleteByUserID(ctx context.Context, userID primitive.ObjectID) error {
+	s.deleteWhere(func(t *domain.RefreshToken) bool { return t.UserID == userID })
+	return nil
+}
+
+type memRoleStore struct {
+	mx    sync.Mutex
+	roles []*domain.Role
+}
+
+func (s *memRoleStore) List(ctx context.Context) ([]*domain.Role, error) {
+	return s.FindByNames(ctx, nil)
+}
+
+// FindByNames returns all roles for nil names, unlike the repository, to serve List
+func (s *memRoleStore) FindByNames(ctx context.Context, names []string) ([]*domain.Role, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	var roles []*domain.Role
+	for _, r := range s.roles {
+		if names == nil || slices.Contains(names, r.Name) {
+			c := *r
+			c.Permissions = slices.Clone(r.Permissions)
+			roles = append(roles, &c)
+		}
+	}
+	slices.SortFunc(roles, func(a, b *domain.Role) int { return strings.Compare(a.Name, b.Name) })
+	return roles, nil
+}
+
+func (s *memRoleStore) Create(ctx context.Context, role *domain.Role) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if slices.ContainsFunc(s.roles, func(r *domain.Role) bool { return r.Name == role.Name }) {
+		return mongodb.ErrRoleAlreadyExists
+	}
+	c := *role
+	s.roles = append(s.roles, &c)
+	return nil
+}
+
+func (s *memRoleStore) UpdatePermissions(ctx context.Context, name string, permissions []string) (*domain.Role, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for _, r := range s.roles {
+		if r.Name == name {
+			r.Permissions = slices.Clone(permissions)
+			c := *r
+			return &c, nil
+		}
+	}
+	return nil, mongodb.ErrRoleNotFound
+}
+
+func (s *memRoleStore) Delete(ctx context.Context, name string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	n := len(s.roles)
+	s.roles = slices.DeleteFunc(s.roles, func(r *domain.Role) bool { return r.Name == name })
+	if len(s.roles) == n {
+		return mongodb.ErrRoleNotFound
+	}
+	return nil
+}
+
+// memAPIKeyStore keys the API keys by their value instead of the hash
+type memAPIKeyStore struct {
+	mx   sync.Mutex
+	keys map[string]*domain.APIKey
+}
+
+func (s *memAPIKeyStore) Create(ctx context.Context, apiKey *domain.APIKey, key string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	apiKey.ID = primitive.NewObjectID()
+	apiKey.KeyHash = key
+	apiKey.CreatedAt = time.Now()
+	if s.keys == nil {
+		s.keys = make(map[string]*domain.APIKey)
+	}
+	c := *apiKey
+	s.keys[key] = &c
+	return nil
+}
+
+func (s *memAPIKeyStore) FindByKey(ctx context.Context, key string) (*domain.APIKey, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	k, ok := s.keys[key]
+	switch {
+	case !ok:
+		return nil, mongodb.ErrAPIKeyNotFound
+	case k.RevokedAt != nil:
+		return nil, mongodb.ErrAPIKeyRevoked
+	case k.ExpiresAt != nil && time.Now().After(*k.ExpiresAt):
+		return nil, mongodb.ErrAPIKeyExpired
+	}
+	c := *k
+	return &c, nil
+}
+
+func (s *memAPIKeyStore) List(ctx context.Context, clientID string) ([]*domain.APIKey, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	var keys []*domain.APIKey
+	for _, k := range s.keys {
+		if clientID == "" || k.ClientID == clientID {
+			c := *k
+			keys = append(keys, &c)
+		}
+	}
+	return keys, nil
+}
+
+func (s *memAPIKeyStore) Revoke(ctx context.Context, id primitive.ObjectID) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for _, k := range s.keys {
+		if k.ID == id {
+			if k.RevokedAt == nil {
+				now := time.Now()
+				k.RevokedAt = &now
+			}
+			return nil
+		}
+	}
+	return mongodb.ErrAPIKeyNotFound
+}
+
+// expire moves the expiration of the key to the past
+func (s *memAPIKeyStore) expire(id primitive.ObjectID) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for _, k := range s.keys {
+		if k.ID == id {
+			expiresAt := time.Now().Add(-time.Second)
+			k.ExpiresAt = &expiresAt
+		}
+	}
+}
+
+type memOIDCStateStore struct {
+	mx     sync.Mutex
+	states map[string]*domain.OIDCState
+}
+
+func (s *memOIDCStateStore) Create(ctx context.Context, state string, st *domain.OIDCState) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	st.ID = primitive.NewObjectID()
+	st.StateHash = state
+	st.CreatedAt = time.Now()
+	if s.states == nil {
+		s.states = make(map[string]*domain.OIDCState)
+	}
+	c := *st
+	s.states[state] = &c
+	return nil
+}
+
+func (s *memOIDCStateStore) Take(ctx context.Context, state string) (*domain.OIDCState, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	st, ok := s.states[state]
+	if !ok || !st.ExpiresAt.After(time.Now()) {
+		return nil, mongodb.ErrOIDCStateNotFound
+	}
+	delete(s.states, state)
+	return st, nil
+}
+
+type memLoginChallengeStore struct {
+	mx         sync.Mutex
+	challenges map[string]*domain.LoginChallenge
+}
+
+func (s *memLoginChallengeStore) Create(ctx context.Context, token string, userID primitive.ObjectID, enrollment bool, ttl time.Duration) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	now := time.Now()
+	if s.challenges == nil {
+		s.challenges = make(map[string]*domain.LoginChallenge)
+	}
+	s.challenges[token] = &domain.LoginChallenge{
+		ID:         primitive.NewObjectID(),
+		TokenHash:  token,
+		UserID:     userID,
+		Enrollment: enrollment,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	return nil
+}
+
+func (s *memLoginChallengeStore) Find(ctx context.Context, token string) (*domain.LoginChallenge, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	ch, ok := s.challenges[token]
+	if !ok || !ch.ExpiresAt.After(time.Now()) {
+		return nil, mongodb.ErrLoginChallengeNotFound
+	}
+	c := *ch
+	return &c, nil
+}
+
+func (s *memLoginChallengeStore) Attempt(ctx context.Context, token string, maxAttempts int) (*domain.LoginChallenge, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	ch, ok := s.challenges[token]
+	if !ok || !ch.ExpiresAt.After(time.Now()) || ch.Attempts >= maxAttempts {
+		return nil, mongodb.ErrLoginChallengeNotFound
+	}
+	ch.Attempts++
+	c := *ch
+	return &c, nil
+}
+
+func (s *memLoginChallengeStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for token, ch := range s.challenges {
+		if ch.ID == id {
+			delete(s.challenges, token)
+		}
+	}
+	return nil
+}
+
+// expire moves the expiration of all challenges to the past
+func (s *memLoginChallengeStore) expire() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for _, ch := range s.challenges {
+		ch.ExpiresAt = time.Now().Add(-time.Second)
+	}
+}
+
+type memUserTokenStore struct {
+	mx     sync.Mutex
+	tokens map[string]*domain.UserToken
+}
+
+func (s *memUserTokenStore) Create(ctx context.Context, token, purpose string, userID primitive.ObjectID, email string, ttl time.Duration) error {
+	if err := s.DeleteByUser(ctx, userID, purpose); err != nil {
+		return err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	now := time.Now()
+	if s.tokens == nil {
+		s.tokens = make(map[string]*domain.UserToken)
+	}
+	s.tokens[token] = &domain.UserToken{
+		ID:        primitive.NewObjectID(),
+		TokenHash: token,
+		Purpose:   purpose,
+		UserID:    userID,
+		Email:     email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	return nil
+}
+
+func (s *memUserTokenStore) Take(ctx context.Context, token, purpose string) (*domain.UserToken, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	t, ok := s.tokens[token]
+	if !ok || t.Purpose != purpose || !t.ExpiresAt.After(time.Now()) {
+		return nil, mongodb.ErrUserTokenNotFound
+	}
+	delete(s.tokens, token)
+	return t, nil
+}
+
+func (s *memUserTokenStore) DeleteByUser(ctx context.Context, userID primitive.ObjectID, purpose string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for token, t := range s.tokens {
+		if t.UserID == userID && t.Purpose == purpose {
+			delete(s.tokens, token)
+		}
+	}
+	return nil
+}
+
+// expire moves the expiration of all tokens to the past
+func (s *memUserTokenStore) expire() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for _, t := range s.tokens {
+		t.ExpiresAt = time.Now().Add(-time.Second)
+	}
+}
+
+type memAuditLogStore struct {
+	mx      sync.Mutex
+	entries []*domain.AuditEntry
+}
+
+func (s *memAuditLogStore) Create(ctx context.Context, entry *domain.AuditEntry) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	entry.ID = primitive.NewObjectID()
+	entry.CreatedAt = time.Now()
+	c := *entry
+	s.entries = append(s.entries, &c)
+	return nil
+}
+
+func (s *memAuditLogStore) List(ctx context.Context, targetID, after primitive.ObjectID, limit int64) ([]*domain.AuditEntry, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	var entries []*domain.AuditEntry
+	for i := len(s.entries) - 1; i >= 0 && int64(len(entries)) < limit; i-- {
+		e := s.entries[i]
+		if (targetID.IsZero() || e.TargetID == targetID) && (after.IsZero() || e.ID.Hex() < after.Hex()) {
+			c := *e
+			entries = append(entries, &c)
+		}
+	}
+	return entries, nil
+}
+
+type memRevokedSessionStore struct {
+	mx       sync.Mutex
+	sessions map[string]time.Time
+}
+
+func (s *memRevokedSessionStore) Revoke(ctx context.Context, sessionID string, ttl time.Duration) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.sessions == nil {
+		s.sessions = make(map[string]time.Time)
+	}
+	s.sessions[sessionID] = time.Now().Add(ttl)
+	return nil
+}
+
+func (s *memRevokedSessionStore) IsRevoked(ctx context.Context, sessionID string) (bool, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	until, ok := s.sessions[sessionID]
+	return ok && until.After(time.Now()), nil
+}
+
+// memMailer keeps the sent messages
+type memMailer struct {
+	mx       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *memMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// token returns the token of the link in the last message sent to the address
+func (m *memMailer) token(t *testing.T, to string) string {
+	t.Helper()
+
+	msg, ok := m.last(to)
+	if !ok {
+		t.Fatalf("No mail sent to %s", to)
+	}
+	_, rest, ok := strings.Cut(msg.Body, "?token=")
+	if !ok {
+		t.Fatalf("No link in the mail to %s: %s", to, msg.Body)
+	}
+	token, _, _ := strings.Cut(rest, "\n")
+
+	return token
+}
+
+// last returns the last message sent to the address
+func (m *memMailer) last(to string) (mailer.Message, bool) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To == to {
+			return m.messages[i], true
+		}
+	}
+	return mailer.Message{}, false
+}
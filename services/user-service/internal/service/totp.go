@@ -0,0 +1,318 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/jwt"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/repository/mongodb"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/totp"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidChallenge       = errors.New("invalid or expired login challenge")
+	ErrInvalidTOTPCode        = errors.New("invalid TOTP or recovery code")
+	ErrTOTPAlreadyEnabled     = errors.New("TOTP is already enabled")
+	ErrTOTPNotEnrolled        = errors.New("TOTP is not enrolled")
+	ErrTOTPRequired           = errors.New("TOTP is required for the user")
+	ErrTOTPEnrollmentRequired = errors.New("TOTP enrollment is required before login")
+)
+
+const recoveryCodeCount = 10
+
+// LoginResult is a login that passed the password or OIDC provider: tokens, or a
+// challenge while the second factor is needed
+type LoginResult struct {
+	UserID string
+	Tokens *TokenPair
+	// Challenge stands in for the tokens until VerifyLoginTOTP, or ConfirmTOTP
+	// when EnrollmentRequired
+	Challenge          string
+	EnrollmentRequired bool
+}
+
+// TOTPEnrollment is a confirmed TOTP enrollment, Login is set when it completed a login challenge
+type TOTPEnrollment struct {
+	RecoveryCodes []string
+	Login         *LoginResult
+}
+
+// completeLogin issues tokens to a user that passed the first factor, or a challenge
+// when TOTP is enabled or required for the user, see totpRequired
+func (s *UserService) completeLogin(ctx context.Context, user *domain.User) (*LoginResult, error) {
+	if user.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+
+	if !user.TOTPEnabled() {
+		required, err := s.totpRequired(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		if !required {
+			tokens, err := s.loginTokens(ctx, user)
+			if err != nil {
+				return nil, err
+			}
+			return &LoginResult{UserID: user.ID.Hex(), Tokens: tokens}, nil
+		}
+	}
+
+	enrollment := !user.TOTPEnabled()
+	challenge, err := jwt.GenerateRefreshToken(s.cfg.RefreshTokenLength)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loginChallengeRepo.Create(ctx, challenge, user.ID, enrollment, s.cfg.LoginChallengeTTL); err != nil {
+		return nil, err
+	}
+
+	return &LoginResult{UserID: user.ID.Hex(), Challenge: challenge, EnrollmentRequired: enrollment}, nil
+}
+
+// VerifyLoginTOTP completes a login challenge with a TOTP or recovery code
+func (s *UserService) VerifyLoginTOTP(ctx context.Context, challenge, code string) (*LoginResult, error) {
+	ch, err := s.loginChallengeRepo.Attempt(ctx, challenge, s.cfg.LoginChallengeAttempts)
+	if errors.Is(err, mongodb.ErrLoginChallengeNotFound) {
+		return nil, ErrInvalidChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ch.Enrollment {
+		return nil, ErrTOTPEnrollmentRequired
+	}
+
+	user, err := s.userRepo.FindByID(ctx, ch.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled() {
+		return nil, ErrTOTPNotEnrolled
+	}
+
+	// like Login, a locked account isn't checked and the attempt doesn't count
+	if until, locked := user.LockedUntil(time.Now()); locked {
+		return nil, &LockedError{Until: until}
+	}
+
+	// wrong codes count toward the lockout like wrong passwords, so that the fresh
+	// challenges of a known password don't give fresh guesses
+	if err := s.verifySecondFactor(ctx, user, code); err != nil {
+		if errors.Is(err, ErrInvalidTOTPCode) {
+			if err := s.loginFailed(ctx, user); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+
+	if err := s.loginChallengeRepo.Delete(ctx, ch.ID); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.loginTokens(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loginSucceeded(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return &LoginResult{UserID: user.ID.Hex(), Tokens: tokens}, nil
+}
+
+// EnrollTOTP starts the enrollment of the session user, or of the user of an enrollment
+// challenge, and returns the secret with its otpauth:// URL
+func (s *UserService) EnrollTOTP(ctx context.Context, userID, challenge string) (string, string, error) {
+	user, _, err := s.secondFactorUser(ctx, userID, challenge, false)
+	if err != nil {
+		return "", "", err
+	}
+	if user.TOTPEnabled() {
+		return "", "", ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.userRepo.SetTOTPSecret(ctx, user.ID, secret); err != nil {
+		return "", "", err
+	}
+
+	return secret, totp.URL(s.cfg.TOTPIssuer, user.Email, secret), nil
+}
+
+// ConfirmTOTP enables TOTP with the first code of the authenticator app and returns the
+// recovery codes, shown once. With a challenge the login completes too
+func (s *UserService) ConfirmTOTP(ctx context.Context, userID, challenge, code string) (*TOTPEnrollment, error) {
+	user, ch, err := s.secondFactorUser(ctx, userID, challenge, true)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled() {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if user.TOTP == nil || user.TOTP.Secret == "" {
+		return nil, ErrTOTPNotEnrolled
+	}
+
+	step, ok := totp.Validate(user.TOTP.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTOTPCode
+	}
+
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.EnableTOTP(ctx, user.ID, step, codes); err != nil {
+		return nil, err
+	}
+
+	enrollment := &TOTPEnrollment{RecoveryCodes: codes}
+	if ch != nil {
+		if err := s.loginChallengeRepo.Delete(ctx, ch.ID); err != nil {
+			return nil, err
+		}
+		tokens, err := s.loginTokens(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.loginSucceeded(ctx, user); err != nil {
+			return nil, err
+		}
+		enrollment.Login = &LoginResult{UserID: user.ID.Hex(), Tokens: tokens}
+	}
+
+	return enrollment, nil
+}
+
+// DisableTOTP removes the second factor after checking a TOTP or recovery code,
+// users requiring TOTP can't disable it
+func (s *UserService) DisableTOTP(ctx context.Context, userID, code string) error {
+	user, _, err := s.secondFactorUser(ctx, userID, "", false)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled() {
+		return ErrTOTPNotEnrolled
+	}
+	required, err := s.totpRequired(ctx, user)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrTOTPRequired
+	}
+
+	if err := s.verifySecondFactor(ctx, user, code); err != nil {
+		return err
+	}
+
+	return s.userRepo.DisableTOTP(ctx, user.ID)
+}
+
+// secondFactorUser resolves the user of a TOTP RPC: the session user, or the user of a
+// login challenge. attempt counts the call against the challenge attempts
+func (s *UserService) secondFactorUser(ctx context.Context, userID, challenge string, attempt bool) (*domain.User, *domain.LoginChallenge, error) {
+	if userID != "" {
+		id, err := primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			return nil, nil, ErrUserNotFound
+		}
+		user, err := s.userRepo.FindByID(ctx, id)
+		return user, nil, err
+	}
+
+	if challenge == "" {
+		return nil, nil, ErrInvalidChallenge
+	}
+
+	var (
+		ch  *domain.LoginChallenge
+		err error
+	)
+	if attempt {
+		ch, err = s.loginChallengeRepo.Attempt(ctx, challenge, s.cfg.LoginChallengeAttempts)
+	} else {
+		ch, err = s.loginChallengeRepo.Find(ctx, challenge)
+	}
+	if errors.Is(err, mongodb.ErrLoginChallengeNotFound) {
+		return nil, nil, ErrInvalidChallenge
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.userRepo.FindByID(ctx, ch.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, ch, nil
+}
+
+// verifySecondFactor accepts an unused TOTP code or a recovery code, which is used up
+func (s *UserService) verifySecondFactor(ctx context.Context, user *domain.User, code string) error {
+	if !totp.IsCode(code) {
+		err := s.userRepo.UseRecoveryCode(ctx, user.ID, code)
+		if errors.Is(err, mongodb.ErrRecoveryCodeInvalid) {
+			return ErrInvalidTOTPCode
+		}
+		return err
+	}
+
+	step, ok := totp.Validate(user.TOTP.Secret, code, time.Now())
+	if !ok {
+		return ErrInvalidTOTPCode
+	}
+
+	err := s.userRepo.UseTOTPStep(ctx, user.ID, step)
+	if errors.Is(err, mongodb.ErrTOTPCodeUsed) {
+		return ErrInvalidTOTPCode
+	}
+	return err
+}
+
+// totpRequired reports whether the user must use TOTP: users with the admin permission,
+// through a role or a grant, and users of the TOTPRequiredRoles
+func (s *UserService) totpRequired(ctx context.Context, user *domain.User) (bool, error) {
+	for _, role := range user.Roles {
+		if slices.Contains(s.cfg.TOTPRequiredRoles, role) {
+			return true, nil
+		}
+	}
+
+	_, permissions, err := resolvePermissions(ctx, s.roleRepo, user)
+	if err != nil {
+		return false, err
+	}
+
+	return slices.Contains(permissions, domain.PermissionAdmin), nil
+}
+
+// generateRecoveryCodes returns codes like "k3f9a-p2x7q", 50 random bits each
+func generateRecoveryCodes() ([]string, error) {
+	enc := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(enc.EncodeToString(b))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+
+	return codes, nil
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/totp"
+)
+
+// totpCode returns the code of the secret offset steps from now
+func totpCode(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+
+	code, err := totp.Code(secret, totp.Step(time.Now())+offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code
+}
+
+// enableTOTP enrolls the user with the code of the current step and returns the secret
+// and the recovery codes
+func (env *testEnv) enableTOTP(t *testing.T, user *domain.User) (string, []string) {
+	t.Helper()
+
+	ctx := context.Background()
+	secret, _, err := env.svc.EnrollTOTP(ctx, user.ID.Hex(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enrollment, err := env.svc.ConfirmTOTP(ctx, user.ID.Hex(), "", totpCode(t, secret, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return secret, enrollment.RecoveryCodes
+}
+
+// challenge starts a password login that must return a TOTP challenge
+func (env *testEnv) challenge(t *testing.T, email, password string) string {
+	t.Helper()
+
+	res, err := env.svc.Login(context.Background(), email, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Challenge == "" || res.Tokens != nil {
+		t.Fatalf("Login should return a challenge, got %+v", res)
+	}
+
+	return res.Challenge
+}
+
+func TestVerifyLoginTOTPReplay(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := env.createUser(t, "user@example.com", "password1")
+	secret, _ := env.enableTOTP(t, user)
+
+	// the code that confirmed the enrollment is spent
+	if _, err := env.svc.VerifyLoginTOTP(ctx, env.challenge(t, "user@example.com", "password1"), totpCode(t, secret, 0)); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Errorf("Code of the enrollment: got %v, want ErrInvalidTOTPCode", err)
+	}
+
+	// the next step is within the window
+	next := totpCode(t, secret, 1)
+	res, err := env.svc.VerifyLoginTOTP(ctx, env.challenge(t, "user@example.com", "password1"), next)
+	if err != nil || res.Tokens == nil {
+		t.Fatalf("Code of the next step: %+v, %v", res, err)
+	}
+
+	// a code seen once, e.g. over the shoulder, doesn't log in again, nor does an older one
+	for _, code := range []string{next, totpCode(t, secret, 0)} {
+		if _, err := env.svc.VerifyLoginTOTP(ctx, env.challenge(t, "user@example.com", "password1"), code); !errors.Is(err, ErrInvalidTOTPCode) {
+			t.Errorf("Replayed code %s: got %v, want ErrInvalidTOTPCode", code, err)
+		}
+	}
+}
+
+func TestVerifyLoginTOTPChallenge(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := env.createUser(t, "user@example.com", "password1")
+	secret, _ := env.enableTOTP(t, user)
+	// the lockout by wrong codes is tested by TestSecondFactorLockout
+	env.cfg.LoginBackoffAfter = env.cfg.LoginLockoutThreshold
+
+	// wrong codes count against the challenge
+	challenge := env.challenge(t, "user@example.com", "password1")
+	for range env.cfg.LoginChallengeAttempts {
+		if _, err := env.svc.VerifyLoginTOTP(ctx, challenge, "000000"); !errors.Is(err, ErrInvalidTOTPCode) && !errors.Is(err, ErrInvalidChallenge) {
+			t.Fatalf("Wrong code: got %v", err)
+		}
+	}
+	if _, err := env.svc.VerifyLoginTOTP(ctx, challenge, totpCode(t, secret, 1)); !errors.Is(err, ErrInvalidChallenge) {
+		t.Errorf("Challenge out of attempts: got %v, want ErrInvalidChallenge", err)
+	}
+
+	challenge = env.challenge(t, "user@example.com", "password1")
+	env.challenges.expire()
+	if _, err := env.svc.VerifyLoginTOTP(ctx, challenge, totpCode(t, secret, 1)); !errors.Is(err, ErrInvalidChallenge) {
+		t.Errorf("Expired challenge: got %v, want ErrInvalidChallenge", err)
+	}
+
+	// a completed challenge can't be used twice
+	challenge = env.challenge(t, "user@example.com", "password1")
+	if _, err := env.svc.VerifyLoginTOTP(ctx, challenge, totpCode(t, secret, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.svc.VerifyLoginTOTP(ctx, challenge, totpCode(t, secret, -1)); !errors.Is(err, ErrInvalidChallenge) {
+		t.Errorf("Completed challenge: got %v, want ErrInvalidChallenge", err)
+	}
+}
+
+func TestRecoveryCodesSingleUse(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := env.createUser(t, "user@example.com", "password1")
+	_, codes := env.enableTOTP(t, user)
+	if len(codes) == 0 {
+		t.Fatal("Enrollment should return recovery codes")
+	}
+
+	// codes are typed loosely, in upper case and without the dash
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))
+	res, err := env.svc.VerifyLoginTOTP(ctx, env.challenge(t, "user@example.com", "password1"), typed)
+	if err != nil || res.Tokens == nil {
+		t.Fatalf("Recovery code: %+v, %v", res, err)
+	}
+
+	if _, err := env.svc.VerifyLoginTOTP(ctx, env.challenge(t, "user@example.com", "password1"), codes[0]); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Errorf("Used recovery code: got %v, want ErrInvalidTOTPCode", err)
+	}
+	if _, err := env.svc.VerifyLoginTOTP(ctx, env.challenge(t, "user@example.com", "password1"), codes[1]); err != nil {
+		t.Errorf("Other recovery codes should stay valid: %v", err)
+	}
+}
+
+func TestConfirmTOTP(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := env.createUser(t, "user@example.com", "password1")
+
+	if _, err := env.svc.ConfirmTOTP(ctx, user.ID.Hex(), "", "123456"); !errors.Is(err, ErrTOTPNotEnrolled) {
+		t.Errorf("Confirm before the enrollment: got %v, want ErrTOTPNotEnrolled", err)
+	}
+
+	secret, _, err := env.svc.EnrollTOTP(ctx, user.ID.Hex(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrong := []string{"", "abcdef", totpCode(t, secret, -3), totpCode(t, secret, 3)}
+	if other, err := totp.GenerateSecret(); err == nil {
+		wrong = append(wrong, totpCode(t, other, 0))
+	}
+	for _, code := range wrong {
+		if _, err := env.svc.ConfirmTOTP(ctx, user.ID.Hex(), "", code); !errors.Is(err, ErrInvalidTOTPCode) {
+			t.Errorf("Confirm with %q: got %v, want ErrInvalidTOTPCode", code, err)
+		}
+	}
+	if stored, _ := env.users.FindByID(ctx, user.ID); stored.TOTPEnabled() {
+		t.Fatal("TOTP should not be enabled by a wrong code")
+	}
+
+	if _, err := env.svc.ConfirmTOTP(ctx, user.ID.Hex(), "", totpCode(t, secret, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.svc.ConfirmTOTP(ctx, user.ID.Hex(), "", totpCode(t, secret, 1)); !errors.Is(err, ErrTOTPAlreadyEnabled) {
+		t.Errorf("Second confirm: got %v, want ErrTOTPAlreadyEnabled", err)
+	}
+}
+
+func TestConfirmTOTPEnrollmentChallenge(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	env.cfg.TOTPRequiredRoles = []string{domain.RoleAdmin}
+	env.createUser(t, "admin@example.com", "password1", domain.RoleAdmin)
+
+	res, err := env.svc.Login(ctx, "admin@example.com", "password1")
+	if err != nil || !res.EnrollmentRequired || res.Tokens != nil {
+		t.Fatalf("Login of a role requiring TOTP: %+v, %v", res, err)
+	}
+
+	// the enrollment challenge isn't a second factor
+	if _, err := env.svc.VerifyLoginTOTP(ctx, res.Challenge, "123456"); !errors.Is(err, ErrTOTPEnrollmentRequired) {
+		t.Errorf("VerifyLoginTOTP with an enrollment challenge: got %v, want ErrTOTPEnrollmentRequired", err)
+	}
+
+	secret, _, err := env.svc.EnrollTOTP(ctx, "", res.Challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.svc.ConfirmTOTP(ctx, "", res.Challenge, totpCode(t, secret, 3)); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Errorf("Confirm with a stale code: got %v, want ErrInvalidTOTPCode", err)
+	}
+
+	env.challenges.expire()
+	if _, err := env.svc.ConfirmTOTP(ctx, "", res.Challenge, totpCode(t, secret, 0)); !errors.Is(err, ErrInvalidChallenge) {
+		t.Errorf("Confirm with an expired challenge: got %v, want ErrInvalidChallenge", err)
+	}
+
+	// a new login completes with the enrollment
+	res, err = env.svc.Login(ctx, "admin@example.com", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, _, err = env.svc.EnrollTOTP(ctx, "", res.Challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enrollment, err := env.svc.ConfirmTOTP(ctx, "", res.Challenge, totpCode(t, secret, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enrollment.Login == nil || enrollment.Login.Tokens == nil {
+		t.Errorf("Confirm with a challenge should complete the login: %+v", enrollment.Login)
+	}
+}
+
+func TestTOTPRequiredForAdminPermission(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	if err := env.roles.Create(ctx, &domain.Role{Name: "OWNER", Permissions: []string{domain.PermissionAdmin}}); err != nil {
+		t.Fatal(err)
+	}
+
+	env.createUser(t, "admin@example.com", "password1", domain.RoleAdmin)
+	owner := env.createUser(t, "owner@example.com", "password1", "OWNER")
+	granted := env.createUser(t, "granted@example.com", "password1", domain.RoleClient)
+	if _, err := env.users.AddPermission(ctx, granted.ID, domain.PermissionAdmin); err != nil {
+		t.Fatal(err)
+	}
+	env.createUser(t, "client@example.com", "password1", domain.RoleClient)
+
+	// whatever the role is named, the admin permission requires TOTP
+	for _, email := range []string{"admin@example.com", "owner@example.com", "granted@example.com"} {
+		res, err := env.svc.Login(ctx, email, "password1")
+		if err != nil || !res.EnrollmentRequired || res.Tokens != nil {
+			t.Errorf("Login of %s: %+v, %v, want an enrollment challenge", email, res, err)
+		}
+	}
+	env.login(t, "client@example.com", "password1")
+
+	env.enableTOTP(t, owner)
+	if err := env.svc.DisableTOTP(ctx, owner.ID.Hex(), "000000"); !errors.Is(err, ErrTOTPRequired) {
+		t.Errorf("DisableTOTP with the admin permission: got %v, want ErrTOTPRequired", err)
+	}
+}
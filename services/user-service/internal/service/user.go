@@ -1,13 +1,21 @@
 package service
 
 import (
+	"cmp"
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
 	"errors"
+	"time"
 
 	"gitlab.com/gitops-poc-dzha/user-service/internal/config"
 	"gitlab.com/gitops-poc-dzha/user-service/internal/domain"
 	"gitlab.com/gitops-poc-dzha/user-service/internal/events"
 	"gitlab.com/gitops-poc-dzha/user-service/internal/jwt"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/mailer"
+	"gitlab.com/gitops-poc-dzha/user-service/internal/oidc"
 	"gitlab.com/gitops-poc-dzha/user-service/internal/repository/mongodb"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
@@ -16,31 +24,67 @@ import (
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrUserNotFound       = errors.New("user not found")
+	ErrPermissionDenied   = errors.New("permission denied")
 )
 
+// revocationSkew keeps a session revoked a bit longer than its last access token lives
+const revocationSkew = time.Minute
+
 // UserService handles user operations
 type UserService struct {
-	userRepo         *mongodb.UserRepository
-	refreshTokenRepo *mongodb.RefreshTokenRepository
-	jwtManager       *jwt.Manager
-	eventPublisher   *events.Publisher
-	cfg              *config.Config
+	userRepo           UserStore
+	refreshTokenRepo   RefreshTokenStore
+	roleRepo           RoleStore
+	apiKeyRepo         APIKeyStore
+	oidcStateRepo      OIDCStateStore
+	loginChallengeRepo LoginChallengeStore
+	userTokenRepo      UserTokenStore
+	auditLogRepo       AuditLogStore
+	oidcProviders      map[string]*oidc.Provider
+	revokedSessions    RevokedSessionStore
+	jwtManager         *jwt.Manager
+	eventPublisher     *events.Publisher
+	mailer             mailer.Mailer
+	cfg                *config.Config
 }
 
 // NewUserService creates a new user service
 func NewUserService(
-	userRepo *mongodb.UserRepository,
-	refreshTokenRepo *mongodb.RefreshTokenRepository,
+	userRepo UserStore,
+	refreshTokenRepo RefreshTokenStore,
+	roleRepo RoleStore,
+	apiKeyRepo APIKeyStore,
+	oidcStateRepo OIDCStateStore,
+	loginChallengeRepo LoginChallengeStore,
+	userTokenRepo UserTokenStore,
+	auditLogRepo AuditLogStore,
+	oidcProviders []*oidc.Provider,
+	revokedSessions RevokedSessionStore,
 	jwtManager *jwt.Manager,
 	eventPublisher *events.Publisher,
+	mailer mailer.Mailer,
 	cfg *config.Config,
 ) *UserService {
+	providers := make(map[string]*oidc.Provider, len(oidcProviders))
+	for _, p := range oidcProviders {
+		providers[p.Name()] = p
+	}
+
 	return &UserService{
-		userRepo:         userRepo,
-		refreshTokenRepo: refreshTokenRepo,
-		jwtManager:       jwtManager,
-		eventPublisher:   eventPublisher,
-		cfg:              cfg,
+		userRepo:           userRepo,
+		refreshTokenRepo:   refreshTokenRepo,
+		roleRepo:           roleRepo,
+		apiKeyRepo:         apiKeyRepo,
+		oidcStateRepo:      oidcStateRepo,
+		loginChallengeRepo: loginChallengeRepo,
+		userTokenRepo:      userTokenRepo,
+		auditLogRepo:       auditLogRepo,
+		oidcProviders:      providers,
+		revokedSessions:    revokedSessions,
+		jwtManager:         jwtManager,
+		eventPublisher:     eventPublisher,
+		mailer:             mailer,
+		cfg:                cfg,
 	}
 }
 
@@ -52,6 +96,13 @@ type TokenPair struct {
 
 // Register creates a new user account
 func (s *UserService) Register(ctx context.Context, email, password, username string) (string, *TokenPair, error) {
+	if err := checkEmail(email); err != nil {
+		return "", nil, err
+	}
+	if err := s.checkPassword(password); err != nil {
+		return "", nil, err
+	}
+
 	// Hash password
 	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -81,29 +132,57 @@ func (s *UserService) Register(ctx context.Context, email, password, username st
 		_ = s.eventPublisher.PublishUserRegistered(ctx, user.ID.Hex(), email)
 	}
 
+	// the account works unverified, a failed mail is resent by RequestEmailVerification
+	_ = s.sendEmailVerification(ctx, user)
+
 	return user.ID.Hex(), tokens, nil
 }
 
-// Login authenticates a user
-func (s *UserService) Login(ctx context.Context, email, password string) (string, *TokenPair, error) {
+// Login authenticates a user, with TOTP enabled the result is a challenge instead of tokens.
+// Failed attempts lock the account for a growing time, see loginFailed
+func (s *UserService) Login(ctx context.Context, email, password string) (*LoginResult, error) {
 	// Find user
 	user, err := s.userRepo.FindByEmail(ctx, email)
 	if err != nil {
 		if errors.Is(err, mongodb.ErrUserNotFound) {
-			return "", nil, ErrInvalidCredentials
+			return nil, ErrInvalidCredentials
 		}
-		return "", nil, err
+		return nil, err
+	}
+
+	// A locked account isn't checked, the attempts don't count either
+	if until, locked := user.LockedUntil(time.Now()); locked {
+		return nil, &LockedError{Until: until}
 	}
 
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return "", nil, ErrInvalidCredentials
+		if err := s.loginFailed(ctx, user); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
 	}
 
-	// Generate tokens
+	login, err := s.completeLogin(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	// with a second factor the failed attempts count until it is passed too
+	if login.Tokens != nil {
+		if err := s.loginSucceeded(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+
+	return login, nil
+}
+
+// loginTokens starts a session of the user and publishes the login
+func (s *UserService) loginTokens(ctx context.Context, user *domain.User) (*TokenPair, error) {
 	tokens, err := s.generateTokens(ctx, user)
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
 
 	// Publish event (session_id is in the JWT)
@@ -114,13 +193,12 @@ func (s *UserService) Login(ctx context.Context, email, password string) (string
 		}
 	}
 
-	return user.ID.Hex(), tokens, nil
+	return tokens, nil
 }
 
 // Logout invalidates the current session
 func (s *UserService) Logout(ctx context.Context, userID, sessionID string) error {
-	// Delete refresh token for this session
-	if err := s.refreshTokenRepo.DeleteBySessionID(ctx, sessionID); err != nil {
+	if err := s.revokeSession(ctx, sessionID); err != nil {
 		return err
 	}
 
@@ -132,16 +210,104 @@ func (s *UserService) Logout(ctx context.Context, userID, sessionID string) erro
 	return nil
 }
 
+// LogoutAll invalidates all sessions of the user, returns how many were revoked
+func (s *UserService) LogoutAll(ctx context.Context, userID string) (int, error) {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, ErrUserNotFound
+	}
+
+	// every session with a live access token still has its refresh token
+	sessionIDs, err := s.refreshTokenRepo.SessionIDsByUserID(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, sessionID := range sessionIDs {
+		if err := s.revokedSessions.Revoke(ctx, sessionID, s.cfg.AccessTokenTTL+revocationSkew); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := s.refreshTokenRepo.DeleteByUserID(ctx, id); err != nil {
+		return 0, err
+	}
+
+	if s.eventPublisher != nil {
+		for _, sessionID := range sessionIDs {
+			_ = s.eventPublisher.PublishUserLogout(ctx, userID, sessionID)
+		}
+	}
+
+	return len(sessionIDs), nil
+}
+
+// AdminRevokeSession invalidates a session of any user, adminID must have the admin permission
+func (s *UserService) AdminRevokeSession(ctx context.Context, adminID, sessionID string) error {
+	if err := s.requirePermission(ctx, adminID, domain.PermissionAdmin); err != nil {
+		return err
+	}
+
+	// owner of the session for the event, unknown once its refresh token is gone
+	token, err := s.refreshTokenRepo.FindBySessionID(ctx, sessionID)
+	if err != nil && !errors.Is(err, mongodb.ErrRefreshTokenNotFound) {
+		return err
+	}
+
+	if err := s.revokeSession(ctx, sessionID); err != nil {
+		return err
+	}
+
+	if s.eventPublisher != nil && token != nil {
+		_ = s.eventPublisher.PublishUserLogout(ctx, token.UserID.Hex(), sessionID)
+	}
+
+	return nil
+}
+
+// revokeSession rejects the access tokens of the session and deletes its refresh token
+func (s *UserService) revokeSession(ctx context.Context, sessionID string) error {
+	if err := s.revokedSessions.Revoke(ctx, sessionID, s.cfg.AccessTokenTTL+revocationSkew); err != nil {
+		return err
+	}
+
+	return s.refreshTokenRepo.DeleteBySessionID(ctx, sessionID)
+}
+
 // RefreshToken exchanges a refresh token for new tokens
 func (s *UserService) RefreshToken(ctx context.Context, refreshToken string) (*TokenPair, error) {
-	// Find and validate refresh token
-	token, err := s.refreshTokenRepo.Find(ctx, refreshToken)
+	newRefreshToken, err := jwt.GenerateRefreshToken(s.cfg.RefreshTokenLength)
+	if err != nil {
+		return nil, err
+	}
+	successor, err := sealSuccessor(refreshToken, newRefreshToken)
 	if err != nil {
 		return nil, err
 	}
 
-	// Delete old refresh token (rotation)
-	if err := s.refreshTokenRepo.Delete(ctx, refreshToken); err != nil {
+	// Spend the refresh token (rotation), it stays as a marker of the session family
+	token, err := s.refreshTokenRepo.Use(ctx, refreshToken, successor)
+	retried := false
+	if errors.Is(err, mongodb.ErrRefreshTokenReused) {
+		// a client that lost the response of its exchange, e.g. to a dropped connection
+		// or a second tab, gets the same successor again
+		newRefreshToken, retried, err = s.retriedSuccessor(ctx, refreshToken, token)
+		if err != nil {
+			return nil, err
+		}
+		if !retried {
+			// the token was exchanged before: one of the two holders stole it,
+			// the whole session goes as there is no telling which one
+			if err := s.revokeSession(ctx, token.SessionID); err != nil {
+				return nil, err
+			}
+			if s.eventPublisher != nil {
+				_ = s.eventPublisher.PublishSessionCompromised(ctx, token.UserID.Hex(), token.SessionID)
+			}
+			return nil, mongodb.ErrRefreshTokenReused
+		}
+	}
+	if err != nil {
 		return nil, err
 	}
 
@@ -150,6 +316,9 @@ func (s *UserService) RefreshToken(ctx context.Context, refreshToken string) (*T
 	if err != nil {
 		return nil, err
 	}
+	if user.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
 
 	// Generate new tokens with same session ID
 	sessionID := token.SessionID
@@ -158,19 +327,88 @@ func (s *UserService) RefreshToken(ctx context.Context, refreshToken string) (*T
 		return nil, err
 	}
 
-	newRefreshToken, err := jwt.GenerateRefreshToken(s.cfg.RefreshTokenLength)
+	// the device may have moved, the session start stays
+	if !retried {
+		if err := s.refreshTokenRepo.Create(ctx, newRefreshToken, &domain.RefreshToken{
+			UserID:           user.ID,
+			SessionID:        sessionID,
+			Device:           deviceFromContext(ctx),
+			SessionStartedAt: cmp.Or(token.SessionStartedAt, token.CreatedAt),
+		}, s.cfg.RefreshTokenTTL); err != nil {
+			return nil, err
+		}
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
+	}, nil
+}
+
+// retriedSuccessor returns the successor of a token spent within the reuse grace, unless
+// the client has moved on to the successor already
+func (s *UserService) retriedSuccessor(ctx context.Context, refreshToken string, token *domain.RefreshToken) (string, bool, error) {
+	if token.UsedAt == nil || token.Successor == nil || time.Since(*token.UsedAt) > s.cfg.RefreshTokenReuseGrace {
+		return "", false, nil
+	}
+
+	successor, err := openSuccessor(refreshToken, token.Successor)
+	if err != nil {
+		return "", false, nil
+	}
+
+	// the successor is stored right after the token is spent, a retry may come in between
+	next, err := s.refreshTokenRepo.Find(ctx, successor)
+	if err != nil && !errors.Is(err, mongodb.ErrRefreshTokenNotFound) {
+		return "", false, err
+	}
+	if next != nil && next.UsedAt != nil {
+		return "", false, nil
+	}
+
+	return successor, true, nil
+}
+
+// successorAEAD derives the cipher of a successor from the token it replaced, the stored
+// hash of the token doesn't open it
+func successorAEAD(refreshToken string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte("refresh-token-successor:" + refreshToken))
+	block, err := aes.NewCipher(key[:])
 	if err != nil {
 		return nil, err
 	}
+	return cipher.NewGCM(block)
+}
 
-	if err := s.refreshTokenRepo.Create(ctx, newRefreshToken, user.ID, sessionID, s.cfg.RefreshTokenTTL); err != nil {
+func sealSuccessor(refreshToken, successor string) ([]byte, error) {
+	aead, err := successorAEAD(refreshToken)
+	if err != nil {
 		return nil, err
 	}
 
-	return &TokenPair{
-		AccessToken:  accessToken,
-		RefreshToken: newRefreshToken,
-	}, nil
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, []byte(successor), nil), nil
+}
+
+func openSuccessor(refreshToken string, sealed []byte) (string, error) {
+	aead, err := successorAEAD(refreshToken)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("sealed successor too short")
+	}
+
+	successor, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(successor), nil
 }
 
 // GetProfile returns user profile
@@ -185,6 +423,11 @@ func (s *UserService) GetProfile(ctx context.Context, userID string) (*domain.Us
 
 // generateTokens creates a new access and refresh token pair
 func (s *UserService) generateTokens(ctx context.Context, user *domain.User) (*TokenPair, error) {
+	// the last check for logins that passed a factor before an admin disabled the user
+	if user.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+
 	sessionID, err := jwt.GenerateSessionID()
 	if err != nil {
 		return nil, err
@@ -200,7 +443,11 @@ func (s *UserService) generateTokens(ctx context.Context, user *domain.User) (*T
 		return nil, err
 	}
 
-	if err := s.refreshTokenRepo.Create(ctx, refreshToken, user.ID, sessionID, s.cfg.RefreshTokenTTL); err != nil {
+	if err := s.refreshTokenRepo.Create(ctx, refreshToken, &domain.RefreshToken{
+		UserID:    user.ID,
+		SessionID: sessionID,
+		Device:    deviceFromContext(ctx),
+	}, s.cfg.RefreshTokenTTL); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/user-service/internal/repository/mongodb"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	env.createUser(t, "user@example.com", "password1")
+	tokens := env.login(t, "user@example.com", "password1")
+	sessionID := env.sessionOf(t, tokens)
+
+	refreshed, err := env.svc.RefreshToken(ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.RefreshToken == tokens.RefreshToken {
+		t.Error("Refresh token should be rotated")
+	}
+	if got := env.sessionOf(t, refreshed); got != sessionID {
+		t.Errorf("Refreshed session = %s, want %s", got, sessionID)
+	}
+
+	first, _ := env.tokens.Find(ctx, tokens.RefreshToken)
+	next, err := env.tokens.Find(ctx, refreshed.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.UsedAt == nil || next.UsedAt != nil {
+		t.Errorf("Spent token used at %v, successor used at %v", first.UsedAt, next.UsedAt)
+	}
+	if !next.SessionStartedAt.Equal(first.SessionStartedAt) {
+		t.Errorf("Session start moved from %s to %s", first.SessionStartedAt, next.SessionStartedAt)
+	}
+
+	if _, err := env.svc.RefreshToken(ctx, refreshed.RefreshToken); err != nil {
+		t.Errorf("Successor should be exchangeable: %v", err)
+	}
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		// reuse replays the spent token of the session after its exchange to successor
+		reuse   func(env *testEnv, spent, successor string) (*TokenPair, error)
+		revoked bool
+	}{
+		{
+			name: "retry within the grace",
+			reuse: func(env *testEnv, spent, successor string) (*TokenPair, error) {
+				return env.svc.RefreshToken(ctx, spent)
+			},
+		},
+		{
+			name: "after the grace",
+			reuse: func(env *testEnv, spent, successor string) (*TokenPair, error) {
+				env.tokens.age(spent, env.cfg.RefreshTokenReuseGrace+time.Second)
+				return env.svc.RefreshToken(ctx, spent)
+			},
+			revoked: true,
+		},
+		{
+			name: "after the successor was used",
+			reuse: func(env *testEnv, spent, successor string) (*TokenPair, error) {
+				if _, err := env.svc.RefreshToken(ctx, successor); err != nil {
+					return nil, err
+				}
+				return env.svc.RefreshToken(ctx, spent)
+			},
+			revoked: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.createUser(t, "user@example.com", "password1")
+			tokens := env.login(t, "user@example.com", "password1")
+			other := env.login(t, "user@example.com", "password1")
+
+			refreshed, err := env.svc.RefreshToken(ctx, tokens.RefreshToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			retried, err := tt.reuse(env, tokens.RefreshToken, refreshed.RefreshToken)
+			if !tt.revoked {
+				if err != nil {
+					t.Fatalf("Retry should succeed: %v", err)
+				}
+				if retried.RefreshToken != refreshed.RefreshToken {
+					t.Error("Retry should get the same successor")
+				}
+				if _, err := env.auth.ValidateSession(ctx, retried.AccessToken); err != nil {
+					t.Errorf("Session should stay valid: %v", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, mongodb.ErrRefreshTokenReused) {
+				t.Fatalf("Reuse: got %v, want ErrRefreshTokenReused", err)
+			}
+			if _, err := env.auth.ValidateSession(ctx, refreshed.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+				t.Errorf("Session of a reused token: got %v, want ErrSessionRevoked", err)
+			}
+			if _, err := env.svc.RefreshToken(ctx, refreshed.RefreshToken); !errors.Is(err, mongodb.ErrRefreshTokenNotFound) {
+				t.Errorf("Successor of a reused token: got %v, want ErrRefreshTokenNotFound", err)
+			}
+			if _, err := env.auth.ValidateSession(ctx, other.AccessToken); err != nil {
+				t.Errorf("Other session should stay valid: %v", err)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenExpired(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	env.createUser(t, "user@example.com", "password1")
+	tokens := env.login(t, "user@example.com", "password1")
+	env.tokens.age(tokens.RefreshToken, env.cfg.RefreshTokenTTL)
+
+	for range 2 {
+		if _, err := env.svc.RefreshToken(ctx, tokens.RefreshToken); !errors.Is(err, mongodb.ErrRefreshTokenExpired) {
+			t.Errorf("Expired token: got %v, want ErrRefreshTokenExpired", err)
+		}
+	}
+
+	// an expired token isn't spent, so a retry isn't taken for a reuse
+	token, _ := env.tokens.Find(ctx, tokens.RefreshToken)
+	if token.UsedAt != nil {
+		t.Error("Expired token should not be marked used")
+	}
+	if _, err := env.auth.ValidateSession(ctx, tokens.AccessToken); err != nil {
+		t.Errorf("Session should not be revoked: %v", err)
+	}
+}
+
+func TestLogoutAll(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := env.createUser(t, "user@example.com", "password1")
+	env.createUser(t, "other@example.com", "password1")
+
+	first := env.login(t, "user@example.com", "password1")
+	second := env.login(t, "user@example.com", "password1")
+	if _, err := env.svc.RefreshToken(ctx, second.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	other := env.login(t, "other@example.com", "password1")
+
+	n, err := env.svc.LogoutAll(ctx, user.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("LogoutAll revoked %d sessions, want 2", n)
+	}
+
+	for _, tokens := range []*TokenPair{first, second} {
+		if _, err := env.auth.ValidateSession(ctx, tokens.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+			t.Errorf("Session after LogoutAll: got %v, want ErrSessionRevoked", err)
+		}
+	}
+	if sessions, _ := env.svc.ListSessions(ctx, user.ID.Hex()); len(sessions) != 0 {
+		t.Errorf("Sessions left after LogoutAll: %v", sessions)
+	}
+	if _, err := env.auth.ValidateSession(ctx, other.AccessToken); err != nil {
+		t.Errorf("Session of another user should stay valid: %v", err)
+	}
+}
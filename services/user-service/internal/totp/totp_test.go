@@ -0,0 +1,107 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of RFC 6238 appendix B, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238(t *testing.T) {
+	// appendix B lists 8 digit codes, the 6 digit ones are their last digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		now := time.Unix(tt.unix, 0)
+		want := tt.code[len(tt.code)-digits:]
+
+		got, err := Code(rfcSecret, Step(now))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, want)
+		}
+
+		// secrets are accepted in lower case too
+		if step, ok := Validate(strings.ToLower(rfcSecret), want, now); !ok || step != Step(now) {
+			t.Errorf("Validate at %d = %d, %v, want step %d", tt.unix, step, ok, Step(now))
+		}
+	}
+}
+
+func TestValidateWindow(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := Step(now)
+
+	for offset := int64(-3); offset <= 3; offset++ {
+		code, err := Code(rfcSecret, current+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		step, ok := Validate(rfcSecret, code, now)
+		if inWindow := offset >= -skew && offset <= skew; ok != inWindow {
+			t.Errorf("Code of step %+d accepted = %v, want %v", offset, ok, inWindow)
+			continue
+		}
+		if ok && step != current+offset {
+			t.Errorf("Code of step %+d matched step %d, want %d", offset, step, current+offset)
+		}
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	for _, code := range []string{"", "28708", "2870820", "000000", "94287082"} {
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Errorf("Code %q should be rejected", code)
+		}
+	}
+	if _, ok := Validate("not base32!", "287082", now); ok {
+		t.Error("Invalid secret should reject every code")
+	}
+	if _, ok := Validate(rfcSecret, " 287082 ", now); !ok {
+		t.Error("Code with surrounding spaces should be accepted")
+	}
+}
+
+func TestIsCode(t *testing.T) {
+	for s, want := range map[string]bool{
+		"123456":      true,
+		" 123456 ":    true,
+		"12345":       false,
+		"12345a":      false,
+		"k3f9a-p2x7q": false,
+	} {
+		if got := IsCode(s); got != want {
+			t.Errorf("IsCode(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := encoding.DecodeString(secret); err != nil || len(key) != secretSize {
+		t.Errorf("Secret %q decodes to %d bytes, %v", secret, len(key), err)
+	}
+	if _, err := Code(secret, 1); err != nil {
+		t.Errorf("Generated secret should give codes: %v", err)
+	}
+}
@@ -1,8 +1,38 @@
 #!/bin/bash
 
-mkdir -p /opt/envoy && /opt/conf-generator/conf-generator -api-conf /opt/auth-adapter/config.yaml -out-envoy-conf /opt/envoy/envoy.yaml
+mkdir -p /opt/envoy
+
+if [ "${XDS_MODE}" = "true" ]; then
+  # Control plane mode: conf-generator keeps running, writes an ADS bootstrap
+  # and pushes route/cluster changes from config.yaml to Envoy without restart
+  /opt/conf-generator/conf-generator -mode xds -api-conf /opt/auth-adapter/config.yaml -out-envoy-conf /opt/envoy/envoy.yaml &
+  CONF_GENERATOR_PID=$!
+
+  while [ ! -s /opt/envoy/envoy.yaml ]; do
+    kill -0 ${CONF_GENERATOR_PID} 2>/dev/null || exit 1
+    sleep 0.2
+  done
+else
+  /opt/conf-generator/conf-generator -api-conf /opt/auth-adapter/config.yaml -out-envoy-conf /opt/envoy/envoy.yaml
+fi
+
 cat /opt/envoy/envoy.yaml | envsubst \$JAEGER_AGENT_HOST > /etc/envoy/envoy.yaml
 
 cat /opt/envoy/envoy.yaml
 
+if [ "${XDS_MODE}" = "true" ]; then
+  # Envoy keeps serving the last snapshot without its control plane, so the
+  # container exits when either one dies and Kubernetes restarts both
+  /usr/local/bin/envoy -c /etc/envoy/envoy.yaml -l ${LOG_LEVEL} &
+  ENVOY_PID=$!
+
+  trap 'kill -TERM ${ENVOY_PID} ${CONF_GENERATOR_PID} 2>/dev/null' TERM INT
+
+  wait -n
+  STATUS=$?
+  kill -TERM ${ENVOY_PID} ${CONF_GENERATOR_PID} 2>/dev/null
+  wait
+  exit ${STATUS}
+fi
+
 /usr/local/bin/envoy -c /etc/envoy/envoy.yaml -l ${LOG_LEVEL}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpointv3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	tlsv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	upstreamhttpv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/upstreams/http/v3"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
+)
+
+const httpProtocolOptionsKey = "envoy.extensions.upstreams.http.v3.HttpProtocolOptions"
+
+// BuildCluster builds the upstream cluster for a config.yaml cluster entry
+func BuildCluster(cl apiconf.Cluster) (*clusterv3.Cluster, error) {
+	port, err := strconv.ParseUint(cl.AddrPort(), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port for cluster %s: %w", cl.Name, err)
+	}
+
+	c := &clusterv3.Cluster{
+		Name:                 cl.Name,
+		ConnectTimeout:       durationpb.New(5 * time.Second),
+		ClusterDiscoveryType: &clusterv3.Cluster_Type{Type: clusterv3.Cluster_STRICT_DNS},
+		LbPolicy:             clusterv3.Cluster_ROUND_ROBIN,
+		LoadAssignment:       loadAssignment(cl.Name, cl.AddrHost(), uint32(port)),
+		UpstreamConnectionOptions: &clusterv3.UpstreamConnectionOptions{
+			TcpKeepalive: &corev3.TcpKeepalive{
+				KeepaliveProbes:   wrapperspb.UInt32(2),
+				KeepaliveTime:     wrapperspb.UInt32(10),
+				KeepaliveInterval: wrapperspb.UInt32(10),
+			},
+		},
+	}
+
+	alpn := "http/1.1"
+	if cl.IsGRPC() {
+		alpn = "h2"
+		c.TypedExtensionProtocolOptions, err = http2ProtocolOptions(&corev3.Http2ProtocolOptions{
+			MaxConcurrentStreams:        wrapperspb.UInt32(1024),
+			InitialStreamWindowSize:     wrapperspb.UInt32(16777216), // 16MiB
+			InitialConnectionWindowSize: wrapperspb.UInt32(25165824), // 24MiB
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cl.CircuitBreaker != nil {
+		c.CircuitBreakers = buildCircuitBreakers(cl.CircuitBreaker)
+	}
+
+	if cl.HealthCheck != nil {
+		c.HealthChecks = []*corev3.HealthCheck{buildHealthCheck(cl.HealthCheck)}
+	}
+
+	if cl.IsTLS() {
+		c.TransportSocket, err = buildUpstreamTLS(cl.GetSNI(), cl.GetCACert(), alpn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// buildInternalCluster builds clusters of the gateway's own sidecars (auth-adapter, otel collector)
+func buildInternalCluster(name, host string, port uint32, connectTimeout time.Duration) (*clusterv3.Cluster, error) {
+	protocolOptions, err := http2ProtocolOptions(&corev3.Http2ProtocolOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	c := &clusterv3.Cluster{
+		Name:                          name,
+		ClusterDiscoveryType:          &clusterv3.Cluster_Type{Type: clusterv3.Cluster_STRICT_DNS},
+		LbPolicy:                      clusterv3.Cluster_ROUND_ROBIN,
+		TypedExtensionProtocolOptions: protocolOptions,
+		LoadAssignment:                loadAssignment(name, host, port),
+	}
+	if connectTimeout > 0 {
+		c.ConnectTimeout = durationpb.New(connectTimeout)
+	}
+
+	return c, nil
+}
+
+func loadAssignment(clusterName, host string, port uint32) *endpointv3.ClusterLoadAssignment {
+	return &endpointv3.ClusterLoadAssignment{
+		ClusterName: clusterName,
+		Endpoints: []*endpointv3.LocalityLbEndpoints{
+			{
+				LbEndpoints: []*endpointv3.LbEndpoint{
+					{
+						HostIdentifier: &endpointv3.LbEndpoint_Endpoint{
+							Endpoint: &endpointv3.Endpoint{Address: socketAddress(host, port)},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func socketAddress(host string, port uint32) *corev3.Address {
+	return &corev3.Address{
+		Address: &corev3.Address_SocketAddress{
+			SocketAddress: &corev3.SocketAddress{
+				Address:       host,
+				PortSpecifier: &corev3.SocketAddress_PortValue{PortValue: port},
+			},
+		},
+	}
+}
+
+func http2ProtocolOptions(opts *corev3.Http2ProtocolOptions) (map[string]*anypb.Any, error) {
+	packed, err := anypb.New(&upstreamhttpv3.HttpProtocolOptions{
+		UpstreamProtocolOptions: &upstreamhttpv3.HttpProtocolOptions_ExplicitHttpConfig_{
+			ExplicitHttpConfig: &upstreamhttpv3.HttpProtocolOptions_ExplicitHttpConfig{
+				ProtocolConfig: &upstreamhttpv3.HttpProtocolOptions_ExplicitHttpConfig_Http2ProtocolOptions{
+					Http2ProtocolOptions: opts,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]*anypb.Any{httpProtocolOptionsKey: packed}, nil
+}
+
+func buildCircuitBreakers(cb *apiconf.CircuitBreaker) *clusterv3.CircuitBreakers {
+	threshold := func(priority corev3.RoutingPriority) *clusterv3.CircuitBreakers_Thresholds {
+		return &clusterv3.CircuitBreakers_Thresholds{
+			Priority:           priority,
+			MaxConnections:     wrapperspb.UInt32(uint32(cb.MaxConnections)),
+			MaxPendingRequests: wrapperspb.UInt32(uint32(cb.MaxPendingRequests)),
+			MaxRequests:        wrapperspb.UInt32(uint32(cb.MaxRequests)),
+			MaxRetries:         wrapperspb.UInt32(uint32(cb.MaxRetries)),
+		}
+	}
+
+	return &clusterv3.CircuitBreakers{
+		Thresholds: []*clusterv3.CircuitBreakers_Thresholds{
+			threshold(corev3.RoutingPriority_DEFAULT),
+			threshold(corev3.RoutingPriority_HIGH),
+		},
+	}
+}
+
+func buildHealthCheck(hc *apiconf.HealthCheck) *corev3.HealthCheck {
+	return &corev3.HealthCheck{
+		Timeout:            durationpb.New(time.Duration(hc.TimeoutSeconds) * time.Second),
+		Interval:           durationpb.New(time.Duration(hc.IntervalSeconds) * time.Second),
+		UnhealthyThreshold: wrapperspb.UInt32(uint32(hc.UnhealthyThreshold)),
+		HealthyThreshold:   wrapperspb.UInt32(uint32(hc.HealthyThreshold)),
+		HealthChecker: &corev3.HealthCheck_HttpHealthCheck_{
+			HttpHealthCheck: &corev3.HealthCheck_HttpHealthCheck{
+				Path: hc.Path,
+				RequestHeadersToAdd: []*corev3.HeaderValueOption{
+					headerValue("user-agent", "envoy-health-check", corev3.HeaderValueOption_APPEND_IF_EXISTS_OR_ADD),
+				},
+			},
+		},
+	}
+}
+
+func buildUpstreamTLS(sni, caCert, alpn string) (*corev3.TransportSocket, error) {
+	packed, err := anypb.New(&tlsv3.UpstreamTlsContext{
+		Sni: sni,
+		CommonTlsContext: &tlsv3.CommonTlsContext{
+			ValidationContextType: &tlsv3.CommonTlsContext_ValidationContext{
+				ValidationContext: &tlsv3.CertificateValidationContext{
+					TrustedCa: &corev3.DataSource{
+						Specifier: &corev3.DataSource_Filename{Filename: caCert},
+					},
+				},
+			},
+			AlpnProtocols: []string{alpn},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &corev3.TransportSocket{
+		Name:       "envoy.transport_sockets.tls",
+		ConfigType: &corev3.TransportSocket_TypedConfig{TypedConfig: packed},
+	}, nil
+}
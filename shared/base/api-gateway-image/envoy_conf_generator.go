@@ -1,573 +1,417 @@
 package main
 
 import (
-	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"strconv"
-	"text/template"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"gopkg.in/yaml.v3"
+
+	accesslogv3 "github.com/envoyproxy/go-control-plane/envoy/config/accesslog/v3"
+	bootstrapv3 "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	ratelimitconfv3 "github.com/envoyproxy/go-control-plane/envoy/config/ratelimit/v3"
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	tracev3 "github.com/envoyproxy/go-control-plane/envoy/config/trace/v3"
+	streamv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/stream/v3"
+	corsv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/cors/v3"
+	extauthzv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_authz/v3"
+	grpcwebv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/grpc_web/v3"
+	localratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/local_ratelimit/v3"
+	ratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ratelimit/v3"
+	routerv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/router/v3"
+	hcmv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	tlsv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	matcherv3 "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
 )
 
-var (
-	// Route template for gRPC - keeps full path (e.g., /api/FakeService/Handle -> /FakeService/Handle)
-	envoyGrpcRouteTmpl = template.Must(template.New("grpcRouteTmpl").Parse(`
-              - match: { prefix: "{{.APIRoute}}{{.APIName}}" }
-                route:
-                  cluster: {{.ClusterName}}
-                  timeout: 0s
-                  prefix_rewrite: "/{{.APIName}}"{{if .HostRewrite}}
-                  host_rewrite_literal: "{{.HostRewrite}}"{{end}}
-                  max_stream_duration:
-                    max_stream_duration: 600s
-                    grpc_timeout_header_max: 0s
-{{.RateLimitConfig}}
-`))
-
-	// Route template for HTTP - strips service name (e.g., /api/game/calculate -> /calculate)
-	envoyHttpRouteTmpl = template.Must(template.New("httpRouteTmpl").Parse(`
-              - match: { prefix: "{{.APIRoute}}{{.APIName}}" }
-                route:
-                  cluster: {{.ClusterName}}
-                  timeout: 30s
-                  prefix_rewrite: "/{{.MethodName}}"{{if .HostRewrite}}
-                  host_rewrite_literal: "{{.HostRewrite}}"{{end}}
-                request_headers_to_add:
-                  - header:
-                      key: "x-real-ip"
-                      value: "%DOWNSTREAM_REMOTE_ADDRESS_WITHOUT_PORT%"
-                    append_action: OVERWRITE_IF_EXISTS_OR_ADD{{if .HostRewrite}}
-                  - header:
-                      key: "x-forwarded-proto"
-                      value: "https"
-                    append_action: OVERWRITE_IF_EXISTS_OR_ADD
-                  - header:
-                      key: "x-forwarded-for"
-                      value: "%DOWNSTREAM_REMOTE_ADDRESS%"
-                    append_action: APPEND_IF_EXISTS_OR_ADD{{end}}
-{{.RateLimitConfig}}
-`))
-
-	// Fallback for API-level routes (matches /api/game/ prefix)
-	envoyHttpApiRouteTmpl = template.Must(template.New("httpApiRouteTmpl").Parse(`
-              - match: { prefix: "{{.APIRoute}}{{.ServiceName}}/" }
-                route:
-                  cluster: {{.ClusterName}}
-                  timeout: 30s
-                  regex_rewrite:
-                    pattern:
-                      regex: "^{{.APIRoute}}{{.ServiceName}}/(.*)"
-                    substitution: "/\\1"{{if .HostRewrite}}
-                  host_rewrite_literal: "{{.HostRewrite}}"{{end}}
-                request_headers_to_add:
-                  - header:
-                      key: "x-real-ip"
-                      value: "%DOWNSTREAM_REMOTE_ADDRESS_WITHOUT_PORT%"
-                    append_action: OVERWRITE_IF_EXISTS_OR_ADD{{if .HostRewrite}}
-                  - header:
-                      key: "x-forwarded-proto"
-                      value: "https"
-                    append_action: OVERWRITE_IF_EXISTS_OR_ADD
-                  - header:
-                      key: "x-forwarded-for"
-                      value: "%DOWNSTREAM_REMOTE_ADDRESS%"
-                    append_action: APPEND_IF_EXISTS_OR_ADD{{end}}
-{{.RateLimitConfig}}
-`))
-	envoyGrpcClusterTmpl = template.Must(template.New("grpcClusterTmpl").Parse(`
-  - name: {{.ClusterName}}
-    connect_timeout: 5s
-    type: STRICT_DNS
-    typed_extension_protocol_options:
-      envoy.extensions.upstreams.http.v3.HttpProtocolOptions:
-        "@type": type.googleapis.com/envoy.extensions.upstreams.http.v3.HttpProtocolOptions
-        explicit_http_config:
-          http2_protocol_options:
-            max_concurrent_streams: 1024
-            initial_stream_window_size: 16777216  # 16MiB
-            initial_connection_window_size: 25165824  # 24MiB
-    lb_policy: ROUND_ROBIN{{.CircuitBreakerConfig}}{{.HealthCheckConfig}}
-    load_assignment:
-      cluster_name: {{.ClusterName}}
-      endpoints:
-        - lb_endpoints:
-          - endpoint:
-              address:
-                socket_address:
-                  address: "{{.ClusterAddr}}"
-                  port_value: {{.ClusterPort}}{{if .TLSEnabled}}
-    transport_socket:
-      name: envoy.transport_sockets.tls
-      typed_config:
-        "@type": type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext
-        sni: "{{.TLSSNI}}"
-        common_tls_context:
-          validation_context:
-            trusted_ca:
-              filename: "{{.TLSCACert}}"
-          alpn_protocols: ["h2"]{{end}}
-    upstream_connection_options:
-        tcp_keepalive:
-            keepalive_probes: 2
-            keepalive_time: 10
-            keepalive_interval: 10
-`))
-
-	envoyHttpClusterTmpl = template.Must(template.New("httpClusterTmpl").Parse(`
-  - name: {{.ClusterName}}
-    connect_timeout: 5s
-    type: STRICT_DNS
-    lb_policy: ROUND_ROBIN{{.CircuitBreakerConfig}}{{.HealthCheckConfig}}
-    load_assignment:
-      cluster_name: {{.ClusterName}}
-      endpoints:
-        - lb_endpoints:
-          - endpoint:
-              address:
-                socket_address:
-                  address: "{{.ClusterAddr}}"
-                  port_value: {{.ClusterPort}}{{if .TLSEnabled}}
-    transport_socket:
-      name: envoy.transport_sockets.tls
-      typed_config:
-        "@type": type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext
-        sni: "{{.TLSSNI}}"
-        common_tls_context:
-          validation_context:
-            trusted_ca:
-              filename: "{{.TLSCACert}}"
-          alpn_protocols: ["http/1.1"]{{end}}
-    upstream_connection_options:
-        tcp_keepalive:
-            keepalive_probes: 2
-            keepalive_time: 10
-            keepalive_interval: 10
-`))
-
-	envoyRateLimitTmpl = template.Must(template.New("rateLimitTmpl").Parse(`
-                typed_per_filter_config:
-                  envoy.filters.http.local_ratelimit:
-                    "@type": type.googleapis.com/envoy.extensions.filters.http.local_ratelimit.v3.LocalRateLimit
-                    stat_prefix: {{.StatPrefix}}
-                    token_bucket:
-                      max_tokens: {{.MaxTokens}}
-                      tokens_per_fill: {{.TokensPerFill}}
-                      fill_interval: {{.FillInterval}}
-                    filter_enabled:
-                      runtime_key: local_rate_limit_enabled
-                      default_value:
-                        numerator: 100
-                        denominator: HUNDRED
-                    filter_enforced:
-                      runtime_key: local_rate_limit_enforced
-                      default_value:
-                        numerator: 100
-                        denominator: HUNDRED
-`))
-
-	envoyHealthCheckTmpl = template.Must(template.New("healthCheckTmpl").Parse(`
-    health_checks:
-      - timeout: {{.TimeoutSeconds}}s
-        interval: {{.IntervalSeconds}}s
-        unhealthy_threshold: {{.UnhealthyThreshold}}
-        healthy_threshold: {{.HealthyThreshold}}
-        http_health_check:
-          path: "{{.Path}}"
-          request_headers_to_add:
-            - header:
-                key: "user-agent"
-                value: "envoy-health-check"
-`))
-
-	envoyCircuitBreakerTmpl = template.Must(template.New("circuitBreakerTmpl").Parse(`
-    circuit_breakers:
-      thresholds:
-        - priority: DEFAULT
-          max_connections: {{.MaxConnections}}
-          max_pending_requests: {{.MaxPendingRequests}}
-          max_requests: {{.MaxRequests}}
-          max_retries: {{.MaxRetries}}
-        - priority: HIGH
-          max_connections: {{.MaxConnections}}
-          max_pending_requests: {{.MaxPendingRequests}}
-          max_requests: {{.MaxRequests}}
-          max_retries: {{.MaxRetries}}
-`))
-
-	envoyConfTmpl = template.Must(template.New("envoyTmpl").Parse(`
-admin:
-  access_log_path: /dev/null
-  address:
-    socket_address: { address: 0.0.0.0, port_value: 8000 }
-
-static_resources:
-  listeners:
-  - name: web_grpc_listener
-    address:
-      socket_address: { address: 0.0.0.0, port_value: 8080 }
-    filter_chains:
-    - filters:
-      - name: envoy.filters.network.http_connection_manager
-        typed_config:
-          "@type": type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
-          tracing:
-            provider:
-              name: envoy.tracers.opentelemetry
-              typed_config:
-                "@type": type.googleapis.com/envoy.config.trace.v3.OpenTelemetryConfig
-                grpc_service:
-                  envoy_grpc:
-                    cluster_name: opentelemetry_collector
-                  timeout: 0.250s
-                service_name: api-gateway
-          generate_request_id: true
-          codec_type: auto
-          stat_prefix: ingress_http
-          use_remote_address: true
-          xff_num_trusted_hops: {{.XffNumTrustedHops}}
-          access_log:
-            - name: envoy.access_loggers.stdout
-              typed_config:
-                "@type": type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
-          route_config:
-            name: local_route
-            virtual_hosts:
-            - name: grpc_proxy
-              domains: ["*"]
-              response_headers_to_remove: ["grpc-message"]
-              cors:
-                allow_origin_string_match:
-                - prefix: "*"
-                allow_methods: "GET, PUT, DELETE, POST, OPTIONS"
-                allow_headers: "keep-alive,user-agent,cache-control,content-type,content-transfer-encoding,custom-header-1,x-accept-content-transfer-encoding,x-accept-response-streaming,x-user-agent,x-grpc-web,grpc-timeout,authorization"
-                max_age: "1728000"
-                expose_headers: "grpc-status,grpc-message,grpc-status-details-bin,grpc-status-details-text"
-              routes:
-{{.Routes}}
-          http_filters:
-          - name: envoy.filters.http.local_ratelimit
-            typed_config:
-              "@type": type.googleapis.com/envoy.extensions.filters.http.local_ratelimit.v3.LocalRateLimit
-              stat_prefix: local_rate_limiter
-          - name: envoy.filters.http.cors
-            typed_config:
-              "@type": type.googleapis.com/envoy.extensions.filters.http.cors.v3.Cors
-          - name: envoy.filters.ext_authz
-            typed_config:
-                "@type": type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthz
-                transport_api_version: V3
-                grpc_service:
-                  timeout: 30s
-                  envoy_grpc:
-                    cluster_name: ext_auth
-                with_request_body:
-                  max_request_bytes: 1024
-                  allow_partial_message: true
-                allowed_headers:
-                  patterns:
-                    - exact: "cookie"
-                    - exact: "authorization"
-                    - exact: "x-real-ip"
-                    - exact: "x-forwarded-for"
-                    - exact: "x-rc-token"
-                    - exact: "x-rc-token-2"
-          - name: envoy.filters.http.grpc_web
-            typed_config:
-              "@type": type.googleapis.com/envoy.extensions.filters.http.grpc_web.v3.GrpcWeb
-          - name: envoy.filters.http.router
-            typed_config:
-              "@type": type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
-
-  clusters:
-  - name: ext_auth
-    connect_timeout: 2s
-    type: STRICT_DNS
-    typed_extension_protocol_options:
-      envoy.extensions.upstreams.http.v3.HttpProtocolOptions:
-        "@type": type.googleapis.com/envoy.extensions.upstreams.http.v3.HttpProtocolOptions
-        explicit_http_config:
-          http2_protocol_options: {}
-    lb_policy: ROUND_ROBIN
-    load_assignment:
-      cluster_name: ext_auth
-      endpoints:
-        - lb_endpoints:
-          - endpoint:
-              address:
-                socket_address:
-                  address: {{.AuthAdapterHost}}
-                  port_value: 9000
-  - name: opentelemetry_collector
-    type: STRICT_DNS
-    lb_policy: ROUND_ROBIN
-    typed_extension_protocol_options:
-      envoy.extensions.upstreams.http.v3.HttpProtocolOptions:
-        "@type": type.googleapis.com/envoy.extensions.upstreams.http.v3.HttpProtocolOptions
-        explicit_http_config:
-          http2_protocol_options: {}
-    load_assignment:
-      cluster_name: opentelemetry_collector
-      endpoints:
-      - lb_endpoints:
-        - endpoint:
-            address:
-              socket_address:
-                address: {{.OpenTelemetryHost}}
-                port_value: {{.OpenTelemetryPort}}
-{{.Clusters}}
-`))
+const (
+	listenerName = "web_grpc_listener"
+
+	clusterExtAuth          = "ext_auth"
+	clusterOpenTelemetry    = "opentelemetry_collector"
+	clusterRateLimitService = "rate_limit_service"
 )
 
-func GenerateEnvoyConfig(cfg *APIConf, outFile string) error {
-	// Build cluster maps for quick lookup
-	clusterTypes := make(map[string]bool) // true = HTTP, false = gRPC
-	clusterMap := make(map[string]ClusterConf)
-	for _, cl := range cfg.Clusters {
-		clusterTypes[cl.Name] = cl.IsHTTP()
-		clusterMap[cl.Name] = cl
-	}
-
-	routesBuf := new(bytes.Buffer)
-	for _, api := range cfg.APIsDescr {
-		isHTTPCluster := clusterTypes[api.Cluster]
-
-		// Generate route for each method with potential rate limiting
-		for _, method := range api.Methods {
-			routePath := api.Name + "/" + method.Name
-
-			// Generate rate limit config if specified
-			rateLimitConfig := ""
-			if method.Auth != nil && method.Auth.RateLimit != nil {
-				rlData := struct {
-					StatPrefix    string
-					MaxTokens     int
-					TokensPerFill int
-					FillInterval  string
-				}{
-					StatPrefix:    "rate_limit_" + api.Name + "_" + method.Name,
-					MaxTokens:     method.Auth.RateLimit.GetMaxTokens(),
-					TokensPerFill: method.Auth.RateLimit.GetTokensPerFill(),
-					FillInterval:  method.Auth.RateLimit.GetFillIntervalSeconds(),
-				}
-
-				rlBuf := new(bytes.Buffer)
-				err := envoyRateLimitTmpl.Execute(rlBuf, rlData)
-				if err != nil {
-					return err
-				}
-				rateLimitConfig = rlBuf.String()
-			}
-
-			// Choose template based on cluster type
-			var routeTmpl *template.Template
-			if isHTTPCluster {
-				routeTmpl = envoyHttpRouteTmpl
-			} else {
-				routeTmpl = envoyGrpcRouteTmpl
-			}
-
-			// Get host rewrite for TLS clusters (used by ingress for routing)
-			var hostRewrite string
-			if cluster, ok := clusterMap[api.Cluster]; ok && cluster.IsTLS() {
-				hostRewrite = cluster.GetSNI()
-			}
-
-			routeData := struct {
-				APIRoute        string
-				APIName         string
-				MethodName      string
-				ServiceName     string
-				ClusterName     string
-				RateLimitConfig string
-				HostRewrite     string
-			}{
-				APIRoute:        cfg.APIRoute,
-				APIName:         routePath,
-				MethodName:      method.Name,
-				ServiceName:     api.Name,
-				ClusterName:     api.Cluster,
-				RateLimitConfig: rateLimitConfig,
-				HostRewrite:     hostRewrite,
-			}
-
-			err := routeTmpl.Execute(routesBuf, routeData)
-			if err != nil {
-				return err
-			}
-		}
+// envoyEnv holds the deployment settings that come from the environment rather than config.yaml
+type envoyEnv struct {
+	AuthAdapterHost   string
+	OpenTelemetryHost string
+	OpenTelemetryPort uint32
+	XffNumTrustedHops uint32
+}
+
+func envoyEnvFromOS() envoyEnv {
+	env := envoyEnv{
+		AuthAdapterHost:   "127.0.0.1",
+		OpenTelemetryHost: "127.0.0.1",
+		OpenTelemetryPort: 4317,
+		XffNumTrustedHops: 1, // Default: trust 1 proxy hop (typical K8s ingress setup)
+	}
+
+	if authAdapterHost := os.Getenv("AUTH_ADAPTER_HOST"); authAdapterHost != "" {
+		env.AuthAdapterHost = authAdapterHost
+	}
 
-		// Also generate route for the API itself (without method) - catch-all for HTTP
-		// Get host rewrite for TLS clusters
-		var hostRewrite string
-		if cluster, ok := clusterMap[api.Cluster]; ok && cluster.IsTLS() {
-			hostRewrite = cluster.GetSNI()
+	if otHost := os.Getenv("OPEN_TELEMETRY_HOST"); otHost != "" {
+		env.OpenTelemetryHost = otHost
+	}
+
+	if otPort := os.Getenv("OPEN_TELEMETRY_PORT"); otPort != "" {
+		if port, err := strconv.ParseUint(otPort, 10, 32); err == nil {
+			env.OpenTelemetryPort = uint32(port)
 		}
+	}
 
-		if isHTTPCluster {
-			// For HTTP clusters, use regex rewrite to strip service name
-			routeData := struct {
-				APIRoute        string
-				ServiceName     string
-				ClusterName     string
-				RateLimitConfig string
-				HostRewrite     string
-			}{
-				APIRoute:        cfg.APIRoute,
-				ServiceName:     api.Name,
-				ClusterName:     api.Cluster,
-				RateLimitConfig: "",
-				HostRewrite:     hostRewrite,
-			}
-			err := envoyHttpApiRouteTmpl.Execute(routesBuf, routeData)
-			if err != nil {
-				return err
-			}
-		} else {
-			// For gRPC clusters, keep original behavior
-			routeData := struct {
-				APIRoute        string
-				APIName         string
-				MethodName      string
-				ServiceName     string
-				ClusterName     string
-				RateLimitConfig string
-				HostRewrite     string
-			}{
-				APIRoute:        cfg.APIRoute,
-				APIName:         api.Name,
-				MethodName:      "",
-				ServiceName:     api.Name,
-				ClusterName:     api.Cluster,
-				RateLimitConfig: "",
-				HostRewrite:     hostRewrite,
-			}
-			err := envoyGrpcRouteTmpl.Execute(routesBuf, routeData)
-			if err != nil {
-				return err
-			}
+	if xffHops := os.Getenv("XFF_NUM_TRUSTED_HOPS"); xffHops != "" {
+		if hops, err := strconv.ParseUint(xffHops, 10, 32); err == nil {
+			env.XffNumTrustedHops = uint32(hops)
 		}
 	}
 
-	clustersBuf := new(bytes.Buffer)
-	for _, cl := range cfg.Clusters {
-		// Generate health check config if specified
-		healthCheckConfig := ""
-		if cl.HealthCheck != nil {
-			hcData := struct {
-				Path               string
-				TimeoutSeconds     int
-				IntervalSeconds    int
-				HealthyThreshold   int
-				UnhealthyThreshold int
-			}{
-				Path:               cl.HealthCheck.Path,
-				TimeoutSeconds:     cl.HealthCheck.TimeoutSeconds,
-				IntervalSeconds:    cl.HealthCheck.IntervalSeconds,
-				HealthyThreshold:   cl.HealthCheck.HealthyThreshold,
-				UnhealthyThreshold: cl.HealthCheck.UnhealthyThreshold,
-			}
-
-			hcBuf := new(bytes.Buffer)
-			err := envoyHealthCheckTmpl.Execute(hcBuf, hcData)
-			if err != nil {
-				return err
-			}
-			healthCheckConfig = hcBuf.String()
+	return env
+}
+
+func GenerateEnvoyConfig(cfg *apiconf.Config, outFile string) error {
+	outF, err := os.Create(outFile)
+	if err != nil {
+		return err
+	}
+	defer outF.Close()
+
+	return RenderEnvoyConfig(cfg, outF)
+}
+
+// RenderEnvoyConfig writes the static Envoy config for cfg to w
+func RenderEnvoyConfig(cfg *apiconf.Config, w io.Writer) error {
+	b, err := BuildBootstrap(cfg)
+	if err != nil {
+		return err
+	}
+
+	out, err := MarshalYAML(b)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(out)
+	return err
+}
+
+// BuildBootstrap builds the complete static Envoy config for cfg
+func BuildBootstrap(cfg *apiconf.Config) (*bootstrapv3.Bootstrap, error) {
+	env := envoyEnvFromOS()
+
+	rc, err := BuildRouteConfiguration(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := BuildListener(cfg, env, rc, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	clusters, err := BuildClusters(cfg, env)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bootstrapv3.Bootstrap{
+		Admin: &bootstrapv3.Admin{
+			Address: socketAddress("0.0.0.0", 8000),
+		},
+		StaticResources: &bootstrapv3.Bootstrap_StaticResources{
+			Listeners: []*listenerv3.Listener{l},
+			Clusters:  clusters,
+		},
+	}, nil
+}
+
+// BuildClusters builds the sidecar clusters followed by the config.yaml clusters
+func BuildClusters(cfg *apiconf.Config, env envoyEnv) ([]*clusterv3.Cluster, error) {
+	extAuth, err := buildInternalCluster(clusterExtAuth, env.AuthAdapterHost, 9000, 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	otel, err := buildInternalCluster(clusterOpenTelemetry, env.OpenTelemetryHost, env.OpenTelemetryPort, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	clusters := []*clusterv3.Cluster{extAuth, otel}
+
+	if rls := cfg.RateLimitService; rls != nil {
+		port, err := strconv.ParseUint(rls.AddrPort(), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate_limit_service port: %w", err)
 		}
 
-		// Generate circuit breaker config if specified
-		circuitBreakerConfig := ""
-		if cl.CircuitBreaker != nil {
-			cbData := struct {
-				MaxConnections     int
-				MaxPendingRequests int
-				MaxRequests        int
-				MaxRetries         int
-			}{
-				MaxConnections:     cl.CircuitBreaker.MaxConnections,
-				MaxPendingRequests: cl.CircuitBreaker.MaxPendingRequests,
-				MaxRequests:        cl.CircuitBreaker.MaxRequests,
-				MaxRetries:         cl.CircuitBreaker.MaxRetries,
-			}
-
-			cbBuf := new(bytes.Buffer)
-			err := envoyCircuitBreakerTmpl.Execute(cbBuf, cbData)
-			if err != nil {
-				return err
-			}
-			circuitBreakerConfig = cbBuf.String()
+		c, err := buildInternalCluster(clusterRateLimitService, rls.AddrHost(), uint32(port), 2*time.Second)
+		if err != nil {
+			return nil, err
 		}
+		clusters = append(clusters, c)
+	}
 
-		clusterData := struct {
-			ClusterName          string
-			ClusterAddr          string
-			ClusterPort          string
-			HealthCheckConfig    string
-			CircuitBreakerConfig string
-			TLSEnabled           bool
-			TLSSNI               string
-			TLSCACert            string
-		}{
-			ClusterName:          cl.Name,
-			ClusterAddr:          cl.AddrHost(),
-			ClusterPort:          cl.AddrPort(),
-			HealthCheckConfig:    healthCheckConfig,
-			CircuitBreakerConfig: circuitBreakerConfig,
-			TLSEnabled:           cl.IsTLS(),
-			TLSSNI:               cl.GetSNI(),
-			TLSCACert:            cl.GetCACert(),
+	for _, cl := range cfg.Clusters {
+		c, err := BuildCluster(cl)
+		if err != nil {
+			return nil, err
 		}
+		clusters = append(clusters, c)
+	}
+
+	return clusters, nil
+}
 
-		// Choose template based on cluster type
-		var tmpl *template.Template
-		if cl.IsHTTP() {
-			tmpl = envoyHttpClusterTmpl
-		} else {
-			tmpl = envoyGrpcClusterTmpl
+// BuildListener builds the public listener with rc inlined, or referenced over RDS when rdsSource is set
+func BuildListener(cfg *apiconf.Config, env envoyEnv, rc *routev3.RouteConfiguration, rdsSource *corev3.ConfigSource) (*listenerv3.Listener, error) {
+	hcm, err := buildHTTPConnectionManager(env, cfg.RateLimitService)
+	if err != nil {
+		return nil, err
+	}
+
+	if rdsSource != nil {
+		hcm.RouteSpecifier = &hcmv3.HttpConnectionManager_Rds{
+			Rds: &hcmv3.Rds{ConfigSource: rdsSource, RouteConfigName: rc.Name},
 		}
+	} else {
+		hcm.RouteSpecifier = &hcmv3.HttpConnectionManager_RouteConfig{RouteConfig: rc}
+	}
 
-		err := tmpl.Execute(clustersBuf, clusterData)
+	packed, err := anypb.New(hcm)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := &listenerv3.FilterChain{
+		Filters: []*listenerv3.Filter{
+			{
+				Name:       "envoy.filters.network.http_connection_manager",
+				ConfigType: &listenerv3.Filter_TypedConfig{TypedConfig: packed},
+			},
+		},
+	}
+
+	if cfg.DownstreamTLS != nil {
+		chain.TransportSocket, err = buildDownstreamTLS(cfg.DownstreamTLS)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	tmplData := struct {
-		Routes            string
-		Clusters          string
-		AuthAdapterHost   string
-		OpenTelemetryHost string
-		OpenTelemetryPort string
-		XffNumTrustedHops int
-	}{
-		Routes:            string(routesBuf.Bytes()),
-		Clusters:          string(clustersBuf.Bytes()),
-		AuthAdapterHost:   "127.0.0.1",
-		OpenTelemetryHost: "127.0.0.1",
-		OpenTelemetryPort: "4317",
-		XffNumTrustedHops: 1, // Default: trust 1 proxy hop (typical K8s ingress setup)
+	return &listenerv3.Listener{
+		Name:         listenerName,
+		Address:      socketAddress("0.0.0.0", 8080),
+		FilterChains: []*listenerv3.FilterChain{chain},
+	}, nil
+}
+
+// buildDownstreamTLS terminates TLS on the listener. With a client CA the peer certificate
+// is validated and Envoy fills the ext_authz CheckRequest source principal from its SAN
+func buildDownstreamTLS(t *apiconf.DownstreamTLS) (*corev3.TransportSocket, error) {
+	common := &tlsv3.CommonTlsContext{
+		TlsCertificates: []*tlsv3.TlsCertificate{
+			{
+				CertificateChain: &corev3.DataSource{Specifier: &corev3.DataSource_Filename{Filename: t.Cert}},
+				PrivateKey:       &corev3.DataSource{Specifier: &corev3.DataSource_Filename{Filename: t.Key}},
+			},
+		},
+		// gRPC needs h2, grpc-web and REST clients may stay on HTTP/1.1
+		AlpnProtocols: []string{"h2", "http/1.1"},
 	}
 
-	if authAdapterHost := os.Getenv("AUTH_ADAPTER_HOST"); authAdapterHost != "" {
-		tmplData.AuthAdapterHost = authAdapterHost
+	if t.ClientCerts() {
+		common.ValidationContextType = &tlsv3.CommonTlsContext_ValidationContext{
+			ValidationContext: &tlsv3.CertificateValidationContext{
+				TrustedCa: &corev3.DataSource{Specifier: &corev3.DataSource_Filename{Filename: t.ClientCA}},
+			},
+		}
 	}
 
-	if otHost := os.Getenv("OPEN_TELEMETRY_HOST"); otHost != "" {
-		tmplData.OpenTelemetryHost = otHost
+	packed, err := anypb.New(&tlsv3.DownstreamTlsContext{
+		CommonTlsContext:         common,
+		RequireClientCertificate: wrapperspb.Bool(t.RequireClientCert),
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if otPort := os.Getenv("OPEN_TELEMETRY_PORT"); otPort != "" {
-		tmplData.OpenTelemetryPort = otPort
+	return &corev3.TransportSocket{
+		Name:       "envoy.transport_sockets.tls",
+		ConfigType: &corev3.TransportSocket_TypedConfig{TypedConfig: packed},
+	}, nil
+}
+
+func buildHTTPConnectionManager(env envoyEnv, rls *apiconf.RateLimitService) (*hcmv3.HttpConnectionManager, error) {
+	tracer, err := anypb.New(&tracev3.OpenTelemetryConfig{
+		GrpcService: &corev3.GrpcService{
+			TargetSpecifier: &corev3.GrpcService_EnvoyGrpc_{
+				EnvoyGrpc: &corev3.GrpcService_EnvoyGrpc{ClusterName: clusterOpenTelemetry},
+			},
+			Timeout: durationpb.New(250 * time.Millisecond),
+		},
+		ServiceName: "api-gateway",
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if xffHops := os.Getenv("XFF_NUM_TRUSTED_HOPS"); xffHops != "" {
-		if hops, err := strconv.Atoi(xffHops); err == nil && hops >= 0 {
-			tmplData.XffNumTrustedHops = hops
+	accessLog, err := anypb.New(&streamv3.StdoutAccessLog{})
+	if err != nil {
+		return nil, err
+	}
+
+	filters, err := buildHTTPFilters(rls)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hcmv3.HttpConnectionManager{
+		Tracing: &hcmv3.HttpConnectionManager_Tracing{
+			Provider: &tracev3.Tracing_Http{
+				Name:       "envoy.tracers.opentelemetry",
+				ConfigType: &tracev3.Tracing_Http_TypedConfig{TypedConfig: tracer},
+			},
+		},
+		GenerateRequestId: wrapperspb.Bool(true),
+		CodecType:         hcmv3.HttpConnectionManager_AUTO,
+		StatPrefix:        "ingress_http",
+		UseRemoteAddress:  wrapperspb.Bool(true),
+		XffNumTrustedHops: env.XffNumTrustedHops,
+		AccessLog: []*accesslogv3.AccessLog{
+			{
+				Name:       "envoy.access_loggers.stdout",
+				ConfigType: &accesslogv3.AccessLog_TypedConfig{TypedConfig: accessLog},
+			},
+		},
+		HttpFilters: filters,
+	}, nil
+}
+
+// buildHTTPFilters builds the filter chain; order matters, router must be the last one.
+// The global rate limit filter goes after ext_authz, which sets the user-id header limits can be keyed by
+func buildHTTPFilters(rls *apiconf.RateLimitService) ([]*hcmv3.HttpFilter, error) {
+	allowedHeaders := []string{"cookie", "authorization", "x-real-ip", "x-forwarded-for", "x-rc-token", "x-rc-token-2", headerAPIKey}
+	patterns := make([]*matcherv3.StringMatcher, 0, len(allowedHeaders))
+	for _, h := range allowedHeaders {
+		patterns = append(patterns, &matcherv3.StringMatcher{MatchPattern: &matcherv3.StringMatcher_Exact{Exact: h}})
+	}
+
+	type httpFilter struct {
+		name   string
+		config proto.Message
+	}
+
+	filters := []httpFilter{
+		{filterLocalRateLimit, &localratelimitv3.LocalRateLimit{StatPrefix: "local_rate_limiter"}},
+		{filterCors, &corsv3.Cors{}},
+		{"envoy.filters.ext_authz", &extauthzv3.ExtAuthz{
+			TransportApiVersion: corev3.ApiVersion_V3,
+			Services: &extauthzv3.ExtAuthz_GrpcService{
+				GrpcService: &corev3.GrpcService{
+					TargetSpecifier: &corev3.GrpcService_EnvoyGrpc_{
+						EnvoyGrpc: &corev3.GrpcService_EnvoyGrpc{ClusterName: clusterExtAuth},
+					},
+					Timeout: durationpb.New(30 * time.Second),
+				},
+			},
+			WithRequestBody: &extauthzv3.BufferSettings{
+				MaxRequestBytes:     1024,
+				AllowPartialMessage: true,
+			},
+			AllowedHeaders: &matcherv3.ListStringMatcher{Patterns: patterns},
+		}},
+	}
+
+	if rls != nil {
+		filters = append(filters, httpFilter{filterRateLimit, &ratelimitv3.RateLimit{
+			Domain:          rls.Domain,
+			Timeout:         durationpb.New(rls.Timeout),
+			FailureModeDeny: rls.FailureModeDeny,
+			RateLimitService: &ratelimitconfv3.RateLimitServiceConfig{
+				GrpcService: &corev3.GrpcService{
+					TargetSpecifier: &corev3.GrpcService_EnvoyGrpc_{
+						EnvoyGrpc: &corev3.GrpcService_EnvoyGrpc{ClusterName: clusterRateLimitService},
+					},
+				},
+				TransportApiVersion: corev3.ApiVersion_V3,
+			},
+			EnableXRatelimitHeaders: ratelimitv3.RateLimit_DRAFT_VERSION_03,
+		}})
+	}
+
+	filters = append(filters,
+		httpFilter{"envoy.filters.http.grpc_web", &grpcwebv3.GrpcWeb{}},
+		httpFilter{"envoy.filters.http.router", &routerv3.Router{}},
+	)
+
+	out := make([]*hcmv3.HttpFilter, 0, len(filters))
+	for _, f := range filters {
+		packed, err := anypb.New(f.config)
+		if err != nil {
+			return nil, err
 		}
+		out = append(out, &hcmv3.HttpFilter{
+			Name:       f.name,
+			ConfigType: &hcmv3.HttpFilter_TypedConfig{TypedConfig: packed},
+		})
 	}
 
-	outF, err := os.Create(outFile)
+	return out, nil
+}
+
+// MarshalYAML marshals an Envoy message with protojson and re-encodes it as YAML,
+// keeping the proto field order and snake_case names Envoy docs use
+func MarshalYAML(m proto.Message) ([]byte, error) {
+	js, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is valid YAML, decoding it into a node keeps the key order
+	var node yaml.Node
+	if err := yaml.Unmarshal(js, &node); err != nil {
+		return nil, err
+	}
+	clearStyle(&node)
+
+	return yaml.Marshal(&node)
+}
+
+// clearStyle drops the JSON flow/quoted styles so the output reads as regular block YAML
+func clearStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		clearStyle(c)
+	}
+}
+
+// UnmarshalYAML is the reverse of MarshalYAML, used to read back a rendered envoy.yaml
+func UnmarshalYAML(data []byte, m proto.Message) error {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	js, err := json.Marshal(raw)
 	if err != nil {
 		return err
 	}
 
-	return envoyConfTmpl.Execute(outF, tmplData)
+	return protojson.Unmarshal(js, m)
 }
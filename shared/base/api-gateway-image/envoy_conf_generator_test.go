@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	bootstrapv3 "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	localratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/local_ratelimit/v3"
+	ratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ratelimit/v3"
+	hcmv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	upstreamhttpv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/upstreams/http/v3"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
+)
+
+const generatorTestConfig = `
+api_route: /api/
+
+clusters:
+  - name: user-service
+    addr: "user-service-sv:8081"
+    type: "grpc"
+    health_check:
+      path: /healthz
+    circuit_breaker:
+      max_connections: 100
+      max_pending_requests: 10
+      max_requests: 200
+      max_retries: 3
+  - name: game
+    addr: "game.example.com:443"
+    type: "http"
+    tls:
+      enabled: true
+
+apis:
+  - name: UserService
+    cluster: user-service
+    auth: {policy: no-need}
+    methods:
+      - name: Login
+        auth:
+          policy: no-need
+          rate_limit: {period: 5m, count: 20, key: ip}
+      - name: Register
+        auth:
+          policy: no-need
+          rate_limit: {period: 90s, count: 10, burst: 15, key: route}
+      - name: Logout
+        auth: {policy: required}
+  - name: game
+    cluster: game
+    auth: {policy: required}
+    methods:
+      - name: calculate
+        auth: {policy: required}
+`
+
+func loadGeneratorTestConfig(t *testing.T) *apiconf.Config {
+	t.Helper()
+
+	cfg, err := apiconf.Parse([]byte(generatorTestConfig))
+	if err != nil {
+		t.Fatal("Failed to parse config:", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal("Invalid config:", err)
+	}
+
+	return cfg
+}
+
+func TestBuildCluster(t *testing.T) {
+	cfg := loadGeneratorTestConfig(t)
+
+	c, err := BuildCluster(cfg.Clusters[0])
+	if err != nil {
+		t.Fatalf("Failed to build cluster: %v", err)
+	}
+
+	if len(c.HealthChecks) != 1 {
+		t.Fatalf("Expected one health check, got %d", len(c.HealthChecks))
+	}
+	hc := c.HealthChecks[0]
+	if hc.GetHttpHealthCheck().GetPath() != "/healthz" {
+		t.Errorf("Expected health check path /healthz, got %q", hc.GetHttpHealthCheck().GetPath())
+	}
+	// Defaults filled in by Validate
+	if hc.GetInterval().AsDuration() != 30*time.Second || hc.GetTimeout().AsDuration() != 5*time.Second {
+		t.Errorf("Unexpected health check timing: interval=%s timeout=%s", hc.GetInterval().AsDuration(), hc.GetTimeout().AsDuration())
+	}
+
+	thresholds := c.GetCircuitBreakers().GetThresholds()
+	if len(thresholds) != 2 {
+		t.Fatalf("Expected DEFAULT and HIGH circuit breaker thresholds, got %d", len(thresholds))
+	}
+	for _, th := range thresholds {
+		if th.GetMaxConnections().GetValue() != 100 || th.GetMaxRetries().GetValue() != 3 {
+			t.Errorf("Unexpected %s thresholds: %v", th.GetPriority(), th)
+		}
+	}
+
+	opts := &upstreamhttpv3.HttpProtocolOptions{}
+	if err := c.TypedExtensionProtocolOptions[httpProtocolOptionsKey].UnmarshalTo(opts); err != nil {
+		t.Fatalf("gRPC cluster should carry http protocol options: %v", err)
+	}
+	h2 := opts.GetExplicitHttpConfig().GetHttp2ProtocolOptions()
+	if h2.GetMaxConcurrentStreams().GetValue() != 1024 {
+		t.Errorf("Expected 1024 concurrent streams, got %d", h2.GetMaxConcurrentStreams().GetValue())
+	}
+
+	if c.TransportSocket != nil {
+		t.Error("Cluster without TLS should not have a transport socket")
+	}
+
+	httpCluster, err := BuildCluster(cfg.Clusters[1])
+	if err != nil {
+		t.Fatalf("Failed to build cluster: %v", err)
+	}
+	if httpCluster.TypedExtensionProtocolOptions != nil {
+		t.Error("HTTP cluster should not be forced to http2")
+	}
+}
+
+func TestRouteRateLimit(t *testing.T) {
+	b, err := BuildBootstrap(loadGeneratorTestConfig(t))
+	if err != nil {
+		t.Fatalf("Failed to build config: %v", err)
+	}
+
+	register := findRoute(t, b, "/api/UserService/Register")
+	packed, ok := register.TypedPerFilterConfig[filterLocalRateLimit]
+	if !ok {
+		t.Fatal("Route keyed limit should carry local_ratelimit per-filter config")
+	}
+
+	rl := &localratelimitv3.LocalRateLimit{}
+	if err := packed.UnmarshalTo(rl); err != nil {
+		t.Fatalf("Failed to decode rate limit: %v", err)
+	}
+	if rl.StatPrefix != "rate_limit_UserService_Register" {
+		t.Errorf("Unexpected stat prefix %q", rl.StatPrefix)
+	}
+	bucket := rl.GetTokenBucket()
+	if bucket.GetMaxTokens() != 15 || bucket.GetTokensPerFill().GetValue() != 10 || bucket.GetFillInterval().AsDuration() != 90*time.Second {
+		t.Errorf("Unexpected token bucket: %v", bucket)
+	}
+
+	// per client IP limits can't be counted by a local token bucket, only descriptors are rendered
+	login := findRoute(t, b, "/api/UserService/Login")
+	if _, ok := login.TypedPerFilterConfig[filterLocalRateLimit]; ok {
+		t.Error("IP keyed limit should not carry a shared local_ratelimit bucket")
+	}
+
+	if _, ok := findRoute(t, b, "/api/UserService/Logout").TypedPerFilterConfig[filterLocalRateLimit]; ok {
+		t.Error("Route without rate_limit should not carry local_ratelimit config")
+	}
+	if len(findRoute(t, b, "/api/UserService/Logout").GetRoute().GetRateLimits()) != 0 {
+		t.Error("Route without rate_limit should not carry rate limit descriptors")
+	}
+}
+
+func TestRateLimitDescriptors(t *testing.T) {
+	testCases := []struct {
+		key    string
+		action func(*routev3.RateLimit_Action) bool
+	}{
+		{apiconf.RateLimitKeyIP, func(a *routev3.RateLimit_Action) bool {
+			return a.GetRemoteAddress() != nil
+		}},
+		{apiconf.RateLimitKeyUserID, func(a *routev3.RateLimit_Action) bool {
+			return a.GetRequestHeaders().GetHeaderName() == "user-id" && a.GetRequestHeaders().GetDescriptorKey() == "user_id"
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.key, func(t *testing.T) {
+			limits := buildRateLimits("UserService/Login", &apiconf.RateLimit{Period: time.Minute, Count: 1, Burst: 1, Key: tc.key})
+			if len(limits) != 1 || len(limits[0].Actions) != 2 {
+				t.Fatalf("Expected one descriptor of two entries, got %v", limits)
+			}
+
+			route := limits[0].Actions[0].GetGenericKey()
+			if route.GetDescriptorKey() != "route" || route.GetDescriptorValue() != "UserService/Login" {
+				t.Errorf("Unexpected route entry: %v", route)
+			}
+			if !tc.action(limits[0].Actions[1]) {
+				t.Errorf("Unexpected key entry: %v", limits[0].Actions[1])
+			}
+		})
+	}
+
+	if limits := buildRateLimits("UserService/Login", &apiconf.RateLimit{Key: apiconf.RateLimitKeyRoute}); len(limits[0].Actions) != 1 {
+		t.Errorf("Route keyed limit should only have the route entry, got %v", limits)
+	}
+}
+
+func TestRateLimitDescriptorsAPIKey(t *testing.T) {
+	limits := buildRateLimits("ReportService/List", &apiconf.RateLimit{Period: time.Minute, Count: 1, Burst: 1, Key: apiconf.RateLimitKeyAPIKey})
+	if len(limits) != 2 {
+		t.Fatalf("Expected client and fallback descriptors, got %v", limits)
+	}
+
+	// the validated client set by auth-adapter, not the raw key
+	client := limits[0].Actions
+	if len(client) != 2 || client[1].GetRequestHeaders().GetHeaderName() != "client-id" || client[1].GetRequestHeaders().GetDescriptorKey() != "client_id" {
+		t.Errorf("Unexpected client descriptor: %v", client)
+	}
+
+	// requests without a validated client are counted per client IP
+	fallback := limits[1].Actions
+	if len(fallback) != 3 {
+		t.Fatalf("Unexpected fallback descriptor: %v", fallback)
+	}
+	match := fallback[1].GetHeaderValueMatch()
+	if match.GetExpectMatch().GetValue() || len(match.GetHeaders()) != 1 ||
+		match.GetHeaders()[0].GetName() != "client-id" || !match.GetHeaders()[0].GetPresentMatch() {
+		t.Errorf("Fallback should apply only without client-id: %v", match)
+	}
+	if fallback[2].GetRemoteAddress() == nil {
+		t.Errorf("Fallback should be keyed by client IP: %v", fallback[2])
+	}
+	for _, l := range limits {
+		for _, a := range l.Actions {
+			if a.GetRequestHeaders().GetHeaderName() == "x-api-key" {
+				t.Errorf("Raw API key must not be a descriptor: %v", a)
+			}
+		}
+	}
+}
+
+func TestRenderEnvoyConfigRoundTrip(t *testing.T) {
+	cfg := loadGeneratorTestConfig(t)
+
+	built, err := BuildBootstrap(cfg)
+	if err != nil {
+		t.Fatalf("Failed to build config: %v", err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := RenderEnvoyConfig(cfg, buf); err != nil {
+		t.Fatalf("Failed to render config: %v", err)
+	}
+
+	parsed := &bootstrapv3.Bootstrap{}
+	if err := UnmarshalYAML(buf.Bytes(), parsed); err != nil {
+		t.Fatalf("Rendered config is not a valid Envoy bootstrap: %v", err)
+	}
+	if err := parsed.ValidateAll(); err != nil {
+		t.Errorf("Rendered config failed Envoy validation: %v", err)
+	}
+	if !proto.Equal(built, parsed) {
+		t.Error("Rendered config does not match the built bootstrap")
+	}
+}
+
+func TestRenderEnvoyConfigEnv(t *testing.T) {
+	t.Setenv("AUTH_ADAPTER_HOST", "auth-adapter")
+	t.Setenv("XFF_NUM_TRUSTED_HOPS", "2")
+
+	b, err := BuildBootstrap(loadGeneratorTestConfig(t))
+	if err != nil {
+		t.Fatalf("Failed to build config: %v", err)
+	}
+
+	addr := findCluster(t, b, clusterExtAuth).GetLoadAssignment().GetEndpoints()[0].GetLbEndpoints()[0].
+		GetEndpoint().GetAddress().GetSocketAddress()
+	if addr.GetAddress() != "auth-adapter" || addr.GetPortValue() != 9000 {
+		t.Errorf("Expected ext_auth at auth-adapter:9000, got %s:%d", addr.GetAddress(), addr.GetPortValue())
+	}
+
+	hcm := &hcmv3.HttpConnectionManager{}
+	if err := b.StaticResources.Listeners[0].FilterChains[0].Filters[0].GetTypedConfig().UnmarshalTo(hcm); err != nil {
+		t.Fatalf("Failed to decode connection manager: %v", err)
+	}
+	if hcm.XffNumTrustedHops != 2 {
+		t.Errorf("Expected xff_num_trusted_hops 2, got %d", hcm.XffNumTrustedHops)
+	}
+}
+
+func TestGlobalRateLimit(t *testing.T) {
+	cfg, err := apiconf.Parse([]byte(strings.Replace(generatorTestConfig, "api_route: /api/\n",
+		"api_route: /api/\nrate_limit_service: {addr: \"ratelimit-sv:8081\", failure_mode_deny: true}\n", 1)))
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Invalid config: %v", err)
+	}
+
+	b, err := BuildBootstrap(cfg)
+	if err != nil {
+		t.Fatalf("Failed to build config: %v", err)
+	}
+	if err := b.ValidateAll(); err != nil {
+		t.Fatalf("Generated config violates Envoy schema: %v", err)
+	}
+
+	addr := findCluster(t, b, clusterRateLimitService).GetLoadAssignment().GetEndpoints()[0].GetLbEndpoints()[0].
+		GetEndpoint().GetAddress().GetSocketAddress()
+	if addr.GetAddress() != "ratelimit-sv" || addr.GetPortValue() != 8081 {
+		t.Errorf("Expected rate limit service at ratelimit-sv:8081, got %s:%d", addr.GetAddress(), addr.GetPortValue())
+	}
+
+	hcm := &hcmv3.HttpConnectionManager{}
+	if err := b.StaticResources.Listeners[0].FilterChains[0].Filters[0].GetTypedConfig().UnmarshalTo(hcm); err != nil {
+		t.Fatalf("Failed to decode connection manager: %v", err)
+	}
+
+	var names []string
+	for _, f := range hcm.HttpFilters {
+		names = append(names, f.Name)
+	}
+	// user-id keyed descriptors need the header set by ext_authz
+	want := "envoy.filters.ext_authz," + filterRateLimit + ",envoy.filters.http.grpc_web"
+	if !strings.Contains(strings.Join(names, ","), want) {
+		t.Errorf("Expected %s in the filter chain, got %v", want, names)
+	}
+
+	rl := &ratelimitv3.RateLimit{}
+	if err := hcm.HttpFilters[3].GetTypedConfig().UnmarshalTo(rl); err != nil {
+		t.Fatalf("Failed to decode rate limit filter: %v", err)
+	}
+	if rl.Domain != "api-gateway" || !rl.FailureModeDeny || rl.GetRateLimitService().GetGrpcService().GetEnvoyGrpc().GetClusterName() != clusterRateLimitService {
+		t.Errorf("Unexpected rate limit filter: %v", rl)
+	}
+
+	// route keyed limits go to the service as well, no per-replica bucket
+	register := findRoute(t, b, "/api/UserService/Register")
+	if _, ok := register.TypedPerFilterConfig[filterLocalRateLimit]; ok {
+		t.Error("Route keyed limit should not use local_ratelimit with a rate limit service")
+	}
+	if len(register.GetRoute().GetRateLimits()) != 1 {
+		t.Error("Route keyed limit should be sent as descriptor")
+	}
+}
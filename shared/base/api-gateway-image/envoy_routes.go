@@ -0,0 +1,303 @@
+package main
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	corsv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/cors/v3"
+	localratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/local_ratelimit/v3"
+	matcherv3 "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
+)
+
+const (
+	routeConfigName = "local_route"
+
+	// http filter names, also used as typed_per_filter_config keys
+	filterLocalRateLimit = "envoy.filters.http.local_ratelimit"
+	filterRateLimit      = "envoy.filters.http.ratelimit"
+	filterCors           = "envoy.filters.http.cors"
+
+	// request headers rate limits can be keyed by, set by auth-adapter (ext_authz) once the
+	// session or the API key is validated
+	headerUserID   = "user-id"
+	headerClientID = "client-id"
+
+	headerAPIKey = "x-api-key"
+)
+
+// BuildRouteConfiguration builds the gateway routes: one route per method
+// (with optional rate limit) followed by a catch-all route per API.
+// Routes are named "API/method" and "API" after the config entries they come from.
+func BuildRouteConfiguration(cfg *apiconf.Config) (*routev3.RouteConfiguration, error) {
+	clusterMap := make(map[string]apiconf.Cluster)
+	for _, cl := range cfg.Clusters {
+		clusterMap[cl.Name] = cl
+	}
+
+	var routes []*routev3.Route
+	for _, api := range cfg.APIs {
+		cluster := clusterMap[api.Cluster]
+
+		// Get host rewrite for TLS clusters (used by ingress for routing)
+		var hostRewrite string
+		if cluster.IsTLS() {
+			hostRewrite = cluster.GetSNI()
+		}
+
+		for _, method := range api.Methods {
+			var rl *apiconf.RateLimit
+			if method.Auth != nil {
+				rl = method.Auth.RateLimit
+			}
+
+			var (
+				r   *routev3.Route
+				err error
+			)
+			if cluster.IsHTTP() {
+				r = buildHTTPMethodRoute(cfg.APIRoute, api.Name, method.Name, api.Cluster, hostRewrite)
+			} else {
+				r = buildGRPCRoute(cfg.APIRoute, api.Name+"/"+method.Name, api.Cluster, hostRewrite)
+			}
+			r.Name = api.Name + "/" + method.Name
+
+			if rl != nil {
+				r.GetRoute().RateLimits = buildRateLimits(r.Name, rl)
+
+				// with a rate limit service every limit is counted there, cluster-wide
+				if rl.Key == apiconf.RateLimitKeyRoute && cfg.RateLimitService == nil {
+					r.TypedPerFilterConfig, err = typedPerFilterConfig(filterLocalRateLimit,
+						buildLocalRateLimit("rate_limit_"+api.Name+"_"+method.Name, rl))
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+
+			routes = append(routes, r)
+		}
+
+		// Also generate route for the API itself (without method) - catch-all
+		var catchAll *routev3.Route
+		if cluster.IsHTTP() {
+			catchAll = buildHTTPAPIRoute(cfg.APIRoute, api.Name, api.Cluster, hostRewrite)
+		} else {
+			catchAll = buildGRPCRoute(cfg.APIRoute, api.Name, api.Cluster, hostRewrite)
+		}
+		catchAll.Name = api.Name
+		routes = append(routes, catchAll)
+	}
+
+	corsConfig, err := anypb.New(buildCorsPolicy())
+	if err != nil {
+		return nil, err
+	}
+
+	return &routev3.RouteConfiguration{
+		Name: routeConfigName,
+		VirtualHosts: []*routev3.VirtualHost{
+			{
+				Name:                    "grpc_proxy",
+				Domains:                 []string{"*"},
+				ResponseHeadersToRemove: []string{"grpc-message"},
+				Routes:                  routes,
+				TypedPerFilterConfig: map[string]*anypb.Any{
+					filterCors: corsConfig,
+				},
+			},
+		},
+	}, nil
+}
+
+func buildCorsPolicy() *corsv3.CorsPolicy {
+	return &corsv3.CorsPolicy{
+		AllowOriginStringMatch: []*matcherv3.StringMatcher{
+			{MatchPattern: &matcherv3.StringMatcher_Prefix{Prefix: "*"}},
+		},
+		AllowMethods:  "GET, PUT, DELETE, POST, OPTIONS",
+		AllowHeaders:  "keep-alive,user-agent,cache-control,content-type,content-transfer-encoding,custom-header-1,x-accept-content-transfer-encoding,x-accept-response-streaming,x-user-agent,x-grpc-web,grpc-timeout,authorization",
+		MaxAge:        "1728000",
+		ExposeHeaders: "grpc-status,grpc-message,grpc-status-details-bin,grpc-status-details-text",
+	}
+}
+
+// buildGRPCRoute keeps full path (e.g., /api/FakeService/Handle -> /FakeService/Handle)
+func buildGRPCRoute(apiRoute, path, cluster, hostRewrite string) *routev3.Route {
+	action := &routev3.RouteAction{
+		ClusterSpecifier: &routev3.RouteAction_Cluster{Cluster: cluster},
+		Timeout:          durationpb.New(0),
+		PrefixRewrite:    "/" + path,
+		MaxStreamDuration: &routev3.RouteAction_MaxStreamDuration{
+			MaxStreamDuration:    durationpb.New(600 * time.Second),
+			GrpcTimeoutHeaderMax: durationpb.New(0),
+		},
+	}
+	setHostRewrite(action, hostRewrite)
+
+	return &routev3.Route{
+		Match:  prefixMatch(apiRoute + path),
+		Action: &routev3.Route_Route{Route: action},
+	}
+}
+
+// buildHTTPMethodRoute strips service name (e.g., /api/game/calculate -> /calculate)
+func buildHTTPMethodRoute(apiRoute, service, method, cluster, hostRewrite string) *routev3.Route {
+	action := &routev3.RouteAction{
+		ClusterSpecifier: &routev3.RouteAction_Cluster{Cluster: cluster},
+		Timeout:          durationpb.New(30 * time.Second),
+		PrefixRewrite:    "/" + method,
+	}
+	setHostRewrite(action, hostRewrite)
+
+	return &routev3.Route{
+		Match:               prefixMatch(apiRoute + service + "/" + method),
+		Action:              &routev3.Route_Route{Route: action},
+		RequestHeadersToAdd: httpRequestHeaders(hostRewrite != ""),
+	}
+}
+
+// buildHTTPAPIRoute is the fallback for API-level routes (matches /api/game/ prefix)
+func buildHTTPAPIRoute(apiRoute, service, cluster, hostRewrite string) *routev3.Route {
+	action := &routev3.RouteAction{
+		ClusterSpecifier: &routev3.RouteAction_Cluster{Cluster: cluster},
+		Timeout:          durationpb.New(30 * time.Second),
+		RegexRewrite: &matcherv3.RegexMatchAndSubstitute{
+			Pattern:      &matcherv3.RegexMatcher{Regex: "^" + apiRoute + service + "/(.*)"},
+			Substitution: `/\1`,
+		},
+	}
+	setHostRewrite(action, hostRewrite)
+
+	return &routev3.Route{
+		Match:               prefixMatch(apiRoute + service + "/"),
+		Action:              &routev3.Route_Route{Route: action},
+		RequestHeadersToAdd: httpRequestHeaders(hostRewrite != ""),
+	}
+}
+
+func prefixMatch(prefix string) *routev3.RouteMatch {
+	return &routev3.RouteMatch{PathSpecifier: &routev3.RouteMatch_Prefix{Prefix: prefix}}
+}
+
+func setHostRewrite(action *routev3.RouteAction, hostRewrite string) {
+	if hostRewrite != "" {
+		action.HostRewriteSpecifier = &routev3.RouteAction_HostRewriteLiteral{HostRewriteLiteral: hostRewrite}
+	}
+}
+
+// httpRequestHeaders passes the client IP to HTTP upstreams. TLS upstreams behind an ingress
+// also get the forwarded proto/for headers, otherwise they answer with an https redirect
+func httpRequestHeaders(tls bool) []*corev3.HeaderValueOption {
+	headers := []*corev3.HeaderValueOption{
+		headerValue("x-real-ip", "%DOWNSTREAM_REMOTE_ADDRESS_WITHOUT_PORT%", corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD),
+	}
+
+	if tls {
+		headers = append(headers,
+			headerValue("x-forwarded-proto", "https", corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD),
+			headerValue("x-forwarded-for", "%DOWNSTREAM_REMOTE_ADDRESS%", corev3.HeaderValueOption_APPEND_IF_EXISTS_OR_ADD),
+		)
+	}
+
+	return headers
+}
+
+func headerValue(key, value string, action corev3.HeaderValueOption_HeaderAppendAction) *corev3.HeaderValueOption {
+	return &corev3.HeaderValueOption{
+		Header:       &corev3.HeaderValue{Key: key, Value: value},
+		AppendAction: action,
+	}
+}
+
+// buildRateLimits renders the limit key as a descriptor {route: "API/method", <key>: value},
+// e.g. {route: "UserService/Login", remote_address: "1.2.3.4"} for the per client IP limit.
+// Local token buckets of Envoy 1.32 only match fixed descriptor values, so keyed limits are
+// counted by auth-adapter or, with rate_limit_service set, by the rate limit service the descriptors are sent to.
+// api-key limits count the client of a validated key, never the raw x-api-key header: requests
+// without a valid key get {route, api_key: "invalid", remote_address} instead
+func buildRateLimits(route string, rl *apiconf.RateLimit) []*routev3.RateLimit {
+	routeAction := &routev3.RateLimit_Action{ActionSpecifier: &routev3.RateLimit_Action_GenericKey_{
+		GenericKey: &routev3.RateLimit_Action_GenericKey{DescriptorKey: "route", DescriptorValue: route},
+	}}
+
+	switch rl.Key {
+	case apiconf.RateLimitKeyIP:
+		return []*routev3.RateLimit{{Actions: []*routev3.RateLimit_Action{routeAction, remoteAddressAction()}}}
+	case apiconf.RateLimitKeyUserID:
+		return []*routev3.RateLimit{{Actions: []*routev3.RateLimit_Action{routeAction, requestHeaderAction(headerUserID, "user_id")}}}
+	case apiconf.RateLimitKeyAPIKey:
+		// Envoy skips a descriptor whose header is missing, so exactly one of them is sent
+		noClient := &routev3.RateLimit_Action{ActionSpecifier: &routev3.RateLimit_Action_HeaderValueMatch_{
+			HeaderValueMatch: &routev3.RateLimit_Action_HeaderValueMatch{
+				DescriptorKey:   "api_key",
+				DescriptorValue: "invalid",
+				ExpectMatch:     wrapperspb.Bool(false),
+				Headers: []*routev3.HeaderMatcher{{
+					Name:                 headerClientID,
+					HeaderMatchSpecifier: &routev3.HeaderMatcher_PresentMatch{PresentMatch: true},
+				}},
+			},
+		}}
+
+		return []*routev3.RateLimit{
+			{Actions: []*routev3.RateLimit_Action{routeAction, requestHeaderAction(headerClientID, "client_id")}},
+			{Actions: []*routev3.RateLimit_Action{routeAction, noClient, remoteAddressAction()}},
+		}
+	}
+
+	return []*routev3.RateLimit{{Actions: []*routev3.RateLimit_Action{routeAction}}}
+}
+
+func remoteAddressAction() *routev3.RateLimit_Action {
+	return &routev3.RateLimit_Action{ActionSpecifier: &routev3.RateLimit_Action_RemoteAddress_{
+		RemoteAddress: &routev3.RateLimit_Action_RemoteAddress{},
+	}}
+}
+
+func requestHeaderAction(header, descriptorKey string) *routev3.RateLimit_Action {
+	return &routev3.RateLimit_Action{ActionSpecifier: &routev3.RateLimit_Action_RequestHeaders_{
+		RequestHeaders: &routev3.RateLimit_Action_RequestHeaders{HeaderName: header, DescriptorKey: descriptorKey},
+	}}
+}
+
+// buildLocalRateLimit is the token bucket of a "route" keyed limit, shared by all clients of the route
+func buildLocalRateLimit(statPrefix string, rl *apiconf.RateLimit) *localratelimitv3.LocalRateLimit {
+	return &localratelimitv3.LocalRateLimit{
+		StatPrefix: statPrefix,
+		TokenBucket: &typev3.TokenBucket{
+			MaxTokens:     uint32(rl.Burst),
+			TokensPerFill: wrapperspb.UInt32(uint32(rl.Count)),
+			FillInterval:  durationpb.New(rl.Period),
+		},
+		FilterEnabled:  fullRuntimeFraction("local_rate_limit_enabled"),
+		FilterEnforced: fullRuntimeFraction("local_rate_limit_enforced"),
+	}
+}
+
+func typedPerFilterConfig(filter string, m proto.Message) (map[string]*anypb.Any, error) {
+	packed, err := anypb.New(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]*anypb.Any{filter: packed}, nil
+}
+
+func fullRuntimeFraction(runtimeKey string) *corev3.RuntimeFractionalPercent {
+	return &corev3.RuntimeFractionalPercent{
+		RuntimeKey: runtimeKey,
+		DefaultValue: &typev3.FractionalPercent{
+			Numerator:   100,
+			Denominator: typev3.FractionalPercent_HUNDRED,
+		},
+	}
+}
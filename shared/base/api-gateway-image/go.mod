@@ -1,5 +1,26 @@
 module api-config
 
-require gopkg.in/yaml.v3 v3.0.1
+require (
+	github.com/envoyproxy/go-control-plane v0.13.0
+	gitlab.com/gitops-poc-dzha/shared/base/apiconf v0.0.0-00010101000000-000000000000
+	google.golang.org/grpc v1.68.1
+	google.golang.org/protobuf v1.35.2
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	cel.dev/expr v0.16.1 // indirect
+	github.com/census-instrumentation/opencensus-proto v0.4.1 // indirect
+	github.com/cncf/xds/go v0.0.0-20240905190251-b4127c9b8d78 // indirect
+	github.com/envoyproxy/protoc-gen-validate v1.1.0 // indirect
+	golang.org/x/net v0.29.0 // indirect
+	golang.org/x/sys v0.25.0 // indirect
+	golang.org/x/text v0.18.0 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20240903143218-8af14fe29dc1 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240903143218-8af14fe29dc1 // indirect
+)
 
 go 1.23
+
+// config schema shared with auth-adapter, built from this checkout
+replace gitlab.com/gitops-poc-dzha/shared/base/apiconf => ../apiconf
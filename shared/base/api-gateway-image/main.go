@@ -1,19 +1,41 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
+)
+
+const (
+	// run modes
+	modeStatic = "static"
+	modeXDS    = "xds"
 )
 
 var (
 	apiConfPath      string
 	envoyConfOutPath string
+
+	mode            string
+	xdsListenAddr   string
+	xdsNodeID       string
+	xdsPollInterval time.Duration
 )
 
 func init() {
 	flag.StringVar(&apiConfPath, "api-conf", "config.yaml", "API config file path")
-	flag.StringVar(&envoyConfOutPath, "out-envoy-conf", "conf_out.yaml", "out Envoy config file")
+	flag.StringVar(&envoyConfOutPath, "out-envoy-conf", "conf_out.yaml", "out Envoy config file (bootstrap in xds mode)")
+
+	flag.StringVar(&mode, "mode", modeStatic, "static - generate Envoy config and exit, xds - serve it as xDS control plane")
+	flag.StringVar(&xdsListenAddr, "xds-listen", "127.0.0.1:18000", "xDS gRPC listen address")
+	flag.StringVar(&xdsNodeID, "xds-node-id", "api-gateway", "Envoy node id served by the control plane")
+	flag.DurationVar(&xdsPollInterval, "xds-poll-interval", 2*time.Second, "API config change check interval")
 }
 
 func main() {
@@ -23,9 +45,30 @@ func main() {
 			os.Exit(1)
 		}
 	}()
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			os.Exit(runValidate(os.Args[2:]))
+		case "schema":
+			// JSON Schema of config.yaml, for editors and CI
+			schema, err := apiconf.JSONSchema()
+			if err != nil {
+				panic(err)
+			}
+			os.Stdout.Write(schema)
+			return
+		}
+	}
+
 	flag.Parse()
 
-	c, err := LoadConfig(apiConfPath)
+	if mode == modeXDS {
+		runXDS()
+		return
+	}
+
+	c, err := apiconf.Load(apiConfPath)
 	if err != nil {
 		panic(err)
 	}
@@ -41,3 +84,71 @@ func main() {
 
 	fmt.Println("done")
 }
+
+func runXDS() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	s := NewXDSServer(apiConfPath, xdsNodeID)
+
+	// fail fast on a broken initial config, before Envoy is pointed at us
+	if err := s.Reload(ctx); err != nil {
+		panic(err)
+	}
+
+	if err := GenerateXDSBootstrap(xdsNodeID, xdsListenAddr, envoyConfOutPath); err != nil {
+		panic(err)
+	}
+
+	if err := s.Run(ctx, xdsListenAddr, xdsPollInterval); err != nil {
+		panic(err)
+	}
+
+	fmt.Println("done")
+}
+
+// runValidate implements "conf-generator validate [flags]" and returns the process exit code:
+// 0 - no findings at the -fail-on level, 1 - findings, 2 - usage or I/O error
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	confPath := fs.String("api-conf", "config.yaml", "API config file path")
+	format := fs.String("format", formatText, "output format: text, json or sarif")
+	failOn := fs.String("fail-on", severityError, "lowest severity that fails the check: error or warning")
+	out := fs.String("out", "", "write diagnostics to this file instead of stdout")
+	_ = fs.Parse(args)
+
+	if *failOn != severityError && *failOn != severityWarning {
+		fmt.Printf("[ERROR] unknown -fail-on value %s\n", *failOn)
+		return 2
+	}
+
+	data, err := os.ReadFile(*confPath)
+	if err != nil {
+		fmt.Printf("[ERROR] %s\n", err)
+		return 2
+	}
+
+	diags := ValidateConfig(data)
+
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Printf("[ERROR] %s\n", err)
+			return 2
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := WriteDiagnostics(w, *format, *confPath, diags); err != nil {
+		fmt.Printf("[ERROR] %s\n", err)
+		return 2
+	}
+
+	if HasErrors(diags, *failOn) {
+		return 1
+	}
+
+	return 0
+}
@@ -1,22 +1,29 @@
 package main
 
 import (
-	"os"
-	"strings"
 	"testing"
+
+	bootstrapv3 "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	hcmv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	tlsv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
 )
 
 func TestTLSWithSNIOverride(t *testing.T) {
 	// Test scenario: connecting to IP-based ingress with custom Host header
 	// This simulates connecting to another K8s cluster's ingress controller
-	cfg := &APIConf{
+	cfg := &apiconf.Config{
 		APIRoute: "/api/",
-		Clusters: []ClusterConf{
+		Clusters: []apiconf.Cluster{
 			{
 				Name: "remote_cluster_api",
 				Addr: "10.0.0.50:443", // IP address of remote ingress
 				Type: "http",
-				TLS: &TLSConf{
+				TLS: &apiconf.TLS{
 					Enabled: true,
 					SNI:     "api.remote-cluster.example.com", // Virtual host for ingress routing
 				},
@@ -28,32 +35,18 @@ func TestTLSWithSNIOverride(t *testing.T) {
 				// No TLS - backward compatibility
 			},
 		},
-		APIsDescr: []struct {
-			Name    string    `yaml:"name"`
-			Cluster string    `yaml:"cluster"`
-			Auth    *AuthConf `yaml:"auth"`
-			Methods []struct {
-				Name string    `yaml:"name"`
-				Auth *AuthConf `yaml:"auth"`
-			} `yaml:"methods"`
-		}{
+		APIs: []apiconf.API{
 			{
 				Name:    "RemoteService",
 				Cluster: "remote_cluster_api",
-				Methods: []struct {
-					Name string    `yaml:"name"`
-					Auth *AuthConf `yaml:"auth"`
-				}{
+				Methods: []apiconf.Method{
 					{Name: "GetData"},
 				},
 			},
 			{
 				Name:    "LocalService",
 				Cluster: "local_service",
-				Methods: []struct {
-					Name string    `yaml:"name"`
-					Auth *AuthConf `yaml:"auth"`
-				}{
+				Methods: []apiconf.Method{
 					{Name: "Process"},
 				},
 			},
@@ -82,91 +75,52 @@ func TestTLSWithSNIOverride(t *testing.T) {
 	}
 	cfg.Clusters[0].TLS.SNI = "api.remote-cluster.example.com" // restore
 
-	// Generate config
-	outFile := "/tmp/envoy_tls_sni_test.yaml"
-	defer os.Remove(outFile)
-
-	err := GenerateEnvoyConfig(cfg, outFile)
+	b, err := BuildBootstrap(cfg)
 	if err != nil {
-		t.Fatalf("Failed to generate config: %v", err)
-	}
-
-	data, err := os.ReadFile(outFile)
-	if err != nil {
-		t.Fatalf("Failed to read generated config: %v", err)
-	}
-	content := string(data)
-
-	// Verify TLS transport_socket is present
-	if !strings.Contains(content, "transport_socket:") {
-		t.Error("Expected transport_socket in generated config")
+		t.Fatalf("Failed to build config: %v", err)
 	}
 
 	// Verify SNI is set correctly for TLS handshake
-	if !strings.Contains(content, `sni: "api.remote-cluster.example.com"`) {
-		t.Error("Expected SNI 'api.remote-cluster.example.com' in TLS config")
+	if tlsCtx := findUpstreamTLS(t, b, "remote_cluster_api"); tlsCtx.GetSni() != "api.remote-cluster.example.com" {
+		t.Errorf("Expected SNI 'api.remote-cluster.example.com', got %q", tlsCtx.GetSni())
 	}
 
 	// Verify host_rewrite_literal is set for ingress routing
-	if !strings.Contains(content, `host_rewrite_literal: "api.remote-cluster.example.com"`) {
-		t.Error("Expected host_rewrite_literal for ingress routing")
+	if host := findRoute(t, b, "/api/RemoteService/GetData").GetRoute().GetHostRewriteLiteral(); host != "api.remote-cluster.example.com" {
+		t.Errorf("Expected host_rewrite_literal for ingress routing, got %q", host)
 	}
 
 	// Verify local_service does NOT have TLS
-	parts := strings.Split(content, "- name: local_service")
-	if len(parts) < 2 {
-		t.Fatal("Could not find local_service cluster")
-	}
-	localSection := parts[1]
-	if idx := strings.Index(localSection, "- name:"); idx > 0 {
-		localSection = localSection[:idx]
-	}
-	if strings.Contains(localSection, "transport_socket:") {
+	if findCluster(t, b, "local_service").GetTransportSocket() != nil {
 		t.Error("local_service should NOT have transport_socket")
 	}
 
 	// Verify LocalService routes do NOT have host_rewrite
-	routeSection := strings.Split(content, "routes:")[1]
-	routeSection = strings.Split(routeSection, "http_filters:")[0]
-
-	localRouteSection := strings.Split(routeSection, "LocalService")[1]
-	localRouteSection = strings.Split(localRouteSection, "- match")[0]
-	if strings.Contains(localRouteSection, "host_rewrite_literal") {
+	if findRoute(t, b, "/api/LocalService/Process").GetRoute().GetHostRewriteLiteral() != "" {
 		t.Error("LocalService routes should NOT have host_rewrite_literal")
 	}
 }
 
 func TestTLSWithExampleCom(t *testing.T) {
 	// Test with real example.com
-	cfg := &APIConf{
+	cfg := &apiconf.Config{
 		APIRoute: "/api/",
-		Clusters: []ClusterConf{
+		Clusters: []apiconf.Cluster{
 			{
 				Name: "example_com",
 				Addr: "example.com:443",
 				Type: "http",
-				TLS: &TLSConf{
+				TLS: &apiconf.TLS{
 					Enabled: true,
 					// SNI auto-detected from addr
 				},
 			},
 		},
-		APIsDescr: []struct {
-			Name    string    `yaml:"name"`
-			Cluster string    `yaml:"cluster"`
-			Auth    *AuthConf `yaml:"auth"`
-			Methods []struct {
-				Name string    `yaml:"name"`
-				Auth *AuthConf `yaml:"auth"`
-			} `yaml:"methods"`
-		}{
+		APIs: []apiconf.API{
 			{
 				Name:    "Example",
 				Cluster: "example_com",
-				Methods: []struct {
-					Name string    `yaml:"name"`
-					Auth *AuthConf `yaml:"auth"`
-				}{
+				Methods: []apiconf.Method{
 					{Name: "Get"},
 				},
 			},
@@ -179,118 +133,79 @@ func TestTLSWithExampleCom(t *testing.T) {
 		t.Errorf("Expected auto-detected SNI 'example.com', got '%s'", sni)
 	}
 
-	outFile := "/tmp/envoy_example_com_test.yaml"
-	defer os.Remove(outFile)
-
-	err := GenerateEnvoyConfig(cfg, outFile)
+	b, err := BuildBootstrap(cfg)
 	if err != nil {
-		t.Fatalf("Failed to generate config: %v", err)
+		t.Fatalf("Failed to build config: %v", err)
 	}
 
-	data, err := os.ReadFile(outFile)
-	if err != nil {
-		t.Fatalf("Failed to read config: %v", err)
-	}
-	content := string(data)
-
 	// Verify all TLS components
-	if !strings.Contains(content, `sni: "example.com"`) {
-		t.Error("Expected SNI 'example.com'")
+	tlsCtx := findUpstreamTLS(t, b, "example_com")
+	if tlsCtx.GetSni() != "example.com" {
+		t.Errorf("Expected SNI 'example.com', got %q", tlsCtx.GetSni())
 	}
-	if !strings.Contains(content, `host_rewrite_literal: "example.com"`) {
-		t.Error("Expected host_rewrite_literal 'example.com'")
+	if host := findRoute(t, b, "/api/Example/Get").GetRoute().GetHostRewriteLiteral(); host != "example.com" {
+		t.Errorf("Expected host_rewrite_literal 'example.com', got %q", host)
 	}
-	if !strings.Contains(content, `alpn_protocols: ["http/1.1"]`) {
-		t.Error("Expected HTTP/1.1 ALPN for HTTP cluster")
+	if alpn := tlsCtx.GetCommonTlsContext().GetAlpnProtocols(); len(alpn) != 1 || alpn[0] != "http/1.1" {
+		t.Errorf("Expected HTTP/1.1 ALPN for HTTP cluster, got %v", alpn)
 	}
 }
 
 func TestGRPCWithTLS(t *testing.T) {
-	cfg := &APIConf{
+	cfg := &apiconf.Config{
 		APIRoute: "/api/",
-		Clusters: []ClusterConf{
+		Clusters: []apiconf.Cluster{
 			{
 				Name: "grpc_service",
 				Addr: "grpc.example.com:443",
 				Type: "grpc",
-				TLS: &TLSConf{
+				TLS: &apiconf.TLS{
 					Enabled: true,
 				},
 			},
 		},
-		APIsDescr: []struct {
-			Name    string    `yaml:"name"`
-			Cluster string    `yaml:"cluster"`
-			Auth    *AuthConf `yaml:"auth"`
-			Methods []struct {
-				Name string    `yaml:"name"`
-				Auth *AuthConf `yaml:"auth"`
-			} `yaml:"methods"`
-		}{
+		APIs: []apiconf.API{
 			{
 				Name:    "GrpcService",
 				Cluster: "grpc_service",
-				Methods: []struct {
-					Name string    `yaml:"name"`
-					Auth *AuthConf `yaml:"auth"`
-				}{
+				Methods: []apiconf.Method{
 					{Name: "Call"},
 				},
 			},
 		},
 	}
 
-	outFile := "/tmp/envoy_grpc_tls_test.yaml"
-	defer os.Remove(outFile)
-
-	err := GenerateEnvoyConfig(cfg, outFile)
+	b, err := BuildBootstrap(cfg)
 	if err != nil {
-		t.Fatalf("Failed to generate config: %v", err)
+		t.Fatalf("Failed to build config: %v", err)
 	}
 
-	data, err := os.ReadFile(outFile)
-	if err != nil {
-		t.Fatalf("Failed to read config: %v", err)
-	}
-	content := string(data)
-
 	// gRPC should use h2 ALPN
-	if !strings.Contains(content, `alpn_protocols: ["h2"]`) {
-		t.Error("Expected h2 ALPN for gRPC cluster")
+	if alpn := findUpstreamTLS(t, b, "grpc_service").GetCommonTlsContext().GetAlpnProtocols(); len(alpn) != 1 || alpn[0] != "h2" {
+		t.Errorf("Expected h2 ALPN for gRPC cluster, got %v", alpn)
 	}
 	// Should have host_rewrite for gRPC too
-	if !strings.Contains(content, `host_rewrite_literal: "grpc.example.com"`) {
-		t.Error("Expected host_rewrite_literal for gRPC routes")
+	if host := findRoute(t, b, "/api/GrpcService/Call").GetRoute().GetHostRewriteLiteral(); host != "grpc.example.com" {
+		t.Errorf("Expected host_rewrite_literal for gRPC routes, got %q", host)
 	}
 }
 
 func TestBackwardCompatibility(t *testing.T) {
 	// Config without any TLS should work as before
-	cfg := &APIConf{
+	cfg := &apiconf.Config{
 		APIRoute: "/api/",
-		Clusters: []ClusterConf{
+		Clusters: []apiconf.Cluster{
 			{
 				Name: "old_service",
 				Addr: "service.local:9090",
 				Type: "grpc",
 			},
 		},
-		APIsDescr: []struct {
-			Name    string    `yaml:"name"`
-			Cluster string    `yaml:"cluster"`
-			Auth    *AuthConf `yaml:"auth"`
-			Methods []struct {
-				Name string    `yaml:"name"`
-				Auth *AuthConf `yaml:"auth"`
-			} `yaml:"methods"`
-		}{
+		APIs: []apiconf.API{
 			{
 				Name:    "OldService",
 				Cluster: "old_service",
-				Methods: []struct {
-					Name string    `yaml:"name"`
-					Auth *AuthConf `yaml:"auth"`
-				}{
+				Methods: []apiconf.Method{
 					{Name: "Method"},
 				},
 			},
@@ -301,30 +216,152 @@ func TestBackwardCompatibility(t *testing.T) {
 		t.Error("Cluster without TLS config should return false for IsTLS()")
 	}
 
-	outFile := "/tmp/envoy_backward_test.yaml"
-	defer os.Remove(outFile)
+	b, err := BuildBootstrap(cfg)
+	if err != nil {
+		t.Fatalf("Failed to build config: %v", err)
+	}
+
+	// Should NOT have transport_socket
+	if findCluster(t, b, "old_service").GetTransportSocket() != nil {
+		t.Error("Non-TLS cluster should NOT have transport_socket")
+	}
+	// Should NOT have host_rewrite
+	for _, r := range routesOf(t, b) {
+		if r.GetRoute().GetHostRewriteLiteral() != "" {
+			t.Errorf("Non-TLS config should NOT have host_rewrite_literal, found on %s", r.GetMatch().GetPrefix())
+		}
+	}
+}
+
+func TestDownstreamTLS(t *testing.T) {
+	cfg := &apiconf.Config{
+		APIRoute: "/api/",
+		Clusters: []apiconf.Cluster{{Name: "billing", Addr: "billing-sv:9090", Type: "grpc"}},
+		APIs: []apiconf.API{
+			{Name: "BillingService", Cluster: "billing", Auth: &apiconf.Auth{Policy: apiconf.PolicyMTLS}},
+		},
+	}
+
+	b, err := BuildBootstrap(cfg)
+	if err != nil {
+		t.Fatalf("Failed to build config: %v", err)
+	}
+	if b.GetStaticResources().GetListeners()[0].FilterChains[0].GetTransportSocket() != nil {
+		t.Error("Listener without downstream_tls should stay plaintext")
+	}
+
+	cfg.DownstreamTLS = &apiconf.DownstreamTLS{
+		Cert:              "/etc/envoy/tls/tls.crt",
+		Key:               "/etc/envoy/tls/tls.key",
+		ClientCA:          "/etc/envoy/tls/ca.crt",
+		RequireClientCert: true,
+	}
 
-	err := GenerateEnvoyConfig(cfg, outFile)
+	b, err = BuildBootstrap(cfg)
 	if err != nil {
-		t.Fatalf("Failed to generate config: %v", err)
+		t.Fatalf("Failed to build config: %v", err)
+	}
+
+	ts := b.GetStaticResources().GetListeners()[0].FilterChains[0].GetTransportSocket()
+	if ts == nil {
+		t.Fatal("Expected transport_socket on the listener")
+	}
+	tlsCtx := &tlsv3.DownstreamTlsContext{}
+	if err := ts.GetTypedConfig().UnmarshalTo(tlsCtx); err != nil {
+		t.Fatalf("Failed to decode downstream TLS context: %v", err)
+	}
+
+	common := tlsCtx.GetCommonTlsContext()
+	if cert := common.GetTlsCertificates()[0]; cert.GetCertificateChain().GetFilename() != "/etc/envoy/tls/tls.crt" ||
+		cert.GetPrivateKey().GetFilename() != "/etc/envoy/tls/tls.key" {
+		t.Errorf("Unexpected server certificate %v", cert)
+	}
+	if ca := common.GetValidationContext().GetTrustedCa().GetFilename(); ca != "/etc/envoy/tls/ca.crt" {
+		t.Errorf("Expected client CA /etc/envoy/tls/ca.crt, got %q", ca)
+	}
+	if !tlsCtx.GetRequireClientCertificate().GetValue() {
+		t.Error("Client certificate should be required")
 	}
 
-	data, err := os.ReadFile(outFile)
+	// server TLS only, no client certificates
+	cfg.DownstreamTLS.ClientCA = ""
+	cfg.DownstreamTLS.RequireClientCert = false
+	ts, err = buildDownstreamTLS(cfg.DownstreamTLS)
 	if err != nil {
-		t.Fatalf("Failed to read config: %v", err)
+		t.Fatal(err)
+	}
+	if err := ts.GetTypedConfig().UnmarshalTo(tlsCtx); err != nil {
+		t.Fatal(err)
+	}
+	if tlsCtx.GetCommonTlsContext().GetValidationContext() != nil {
+		t.Error("Client certificates should not be validated without client_ca")
 	}
-	content := string(data)
+}
 
-	// Should NOT have transport_socket
-	clusterSection := strings.Split(content, "- name: old_service")[1]
-	if idx := strings.Index(clusterSection, "- name:"); idx > 0 {
-		clusterSection = clusterSection[:idx]
+// routesOf returns the routes of the gateway listener's inline route config
+func routesOf(t *testing.T, b *bootstrapv3.Bootstrap) []*routev3.Route {
+	t.Helper()
+
+	for _, l := range b.GetStaticResources().GetListeners() {
+		hcm := &hcmv3.HttpConnectionManager{}
+		if err := l.FilterChains[0].Filters[0].GetTypedConfig().UnmarshalTo(hcm); err != nil {
+			t.Fatalf("Failed to decode connection manager: %v", err)
+		}
+		return hcm.GetRouteConfig().GetVirtualHosts()[0].GetRoutes()
 	}
-	if strings.Contains(clusterSection, "transport_socket:") {
-		t.Error("Non-TLS cluster should NOT have transport_socket")
+
+	t.Fatal("No listener in generated config")
+	return nil
+}
+
+func findRoute(t *testing.T, b *bootstrapv3.Bootstrap, prefix string) *routev3.Route {
+	t.Helper()
+
+	for _, r := range routesOf(t, b) {
+		if r.GetMatch().GetPrefix() == prefix {
+			return r
+		}
 	}
-	// Should NOT have host_rewrite
-	if strings.Contains(content, "host_rewrite_literal") {
-		t.Error("Non-TLS config should NOT have host_rewrite_literal")
+
+	t.Fatalf("Route %s not found", prefix)
+	return nil
+}
+
+func findCluster(t *testing.T, b *bootstrapv3.Bootstrap, name string) *clusterv3.Cluster {
+	t.Helper()
+
+	for _, c := range b.GetStaticResources().GetClusters() {
+		if c.Name == name {
+			return c
+		}
 	}
+
+	t.Fatalf("Cluster %s not found", name)
+	return nil
+}
+
+func findUpstreamTLS(t *testing.T, b *bootstrapv3.Bootstrap, cluster string) *tlsv3.UpstreamTlsContext {
+	t.Helper()
+
+	ts := findCluster(t, b, cluster).GetTransportSocket()
+	if ts == nil {
+		t.Fatalf("Expected transport_socket on cluster %s", cluster)
+	}
+
+	tlsCtx := &tlsv3.UpstreamTlsContext{}
+	if err := ts.GetTypedConfig().UnmarshalTo(tlsCtx); err != nil {
+		t.Fatalf("Failed to decode TLS context of %s: %v", cluster, err)
+	}
+
+	return tlsCtx
+}
+
+// findHeader returns the request header the route adds under key, or nil
+func findHeader(r *routev3.Route, key string) *corev3.HeaderValueOption {
+	for _, h := range r.GetRequestHeadersToAdd() {
+		if h.GetHeader().GetKey() == key {
+			return h
+		}
+	}
+	return nil
 }
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
+)
+
+func TestUniversalTLSFix(t *testing.T) {
+	testCases := []struct {
+		name        string
+		config      string
+		checkRoutes []string
+		description string
+	}{
+		{
+			name: "API without methods (catch-all only)",
+			config: `
+api_route: /api/
+
+clusters:
+  - name: external
+    addr: "api.external.com:443"
+    type: "http"
+    tls:
+      enabled: true
+      sni: "api.external.com"
+
+apis:
+  - name: service
+    cluster: external
+    auth: {policy: no-need}
+`,
+			checkRoutes: []string{"/api/service/"},
+			description: "Should add headers to catch-all route",
+		},
+		{
+			name: "API with specific methods",
+			config: `
+api_route: /api/
+
+clusters:
+  - name: external
+    addr: "api.external.com:443"
+    type: "http"
+    tls:
+      enabled: true
+      sni: "api.external.com"
+
+apis:
+  - name: service
+    cluster: external
+    auth: {policy: no-need}
+    methods:
+      - name: ping
+        auth: {policy: no-need}
+      - name: health
+        auth: {policy: no-need}
+`,
+			checkRoutes: []string{
+				"/api/service/ping",
+				"/api/service/health",
+				"/api/service/",
+			},
+			description: "Should add headers to all routes (methods + catch-all)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := apiconf.Parse([]byte(tc.config))
+			if err != nil {
+				t.Fatal("Failed to load config:", err)
+			}
+			b, err := BuildBootstrap(cfg)
+			if err != nil {
+				t.Fatal("Failed to build config:", err)
+			}
+
+			// Check each route has the fix
+			for _, route := range tc.checkRoutes {
+				t.Run(route, func(t *testing.T) {
+					r := findRoute(t, b, route)
+
+					// Check for anti-redirect measures
+					if host := r.GetRoute().GetHostRewriteLiteral(); host != "api.external.com" {
+						t.Errorf("Route %s missing host_rewrite, got %q", route, host)
+					}
+					proto := findHeader(r, "x-forwarded-proto")
+					if proto == nil {
+						t.Fatalf("Route %s missing x-forwarded-proto", route)
+					}
+					if proto.GetHeader().GetValue() != "https" {
+						t.Errorf("Route %s missing https value, got %q", route, proto.GetHeader().GetValue())
+					}
+					if proto.GetAppendAction() != corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD {
+						t.Errorf("Route %s missing overwrite action, got %s", route, proto.GetAppendAction())
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestAllTLSRoutesGetHeaders(t *testing.T) {
+	// Comprehensive test: any TLS cluster should trigger header addition
+	config := `
+api_route: /
+
+clusters:
+  - name: tls-cluster
+    addr: "secure.example.com:443"
+    type: "http"
+    tls:
+      enabled: true
+      sni: "secure.example.com"
+
+  - name: non-tls-cluster
+    addr: "internal-service:8080"
+    type: "http"
+
+apis:
+  - name: secure-api
+    cluster: tls-cluster
+    auth: {policy: no-need}
+    methods:
+      - name: test
+        auth: {policy: no-need}
+
+  - name: internal-api
+    cluster: non-tls-cluster
+    auth: {policy: no-need}
+    methods:
+      - name: test
+        auth: {policy: no-need}
+`
+
+	cfg, err := apiconf.Parse([]byte(config))
+	if err != nil {
+		t.Fatal("Failed to load config:", err)
+	}
+	b, err := BuildBootstrap(cfg)
+	if err != nil {
+		t.Fatal("Failed to build config:", err)
+	}
+
+	// Check TLS routes have headers
+	tlsRoute := findRoute(t, b, "/secure-api/test")
+	if findHeader(tlsRoute, "x-forwarded-proto") == nil {
+		t.Error("TLS route should have x-forwarded-proto header")
+	}
+	if tlsRoute.GetRoute().GetHostRewriteLiteral() == "" {
+		t.Error("TLS route should have host_rewrite_literal")
+	}
+
+	// Check non-TLS routes DON'T have unnecessary headers
+	nonTLSRoute := findRoute(t, b, "/internal-api/test")
+	if nonTLSRoute.GetRoute().GetHostRewriteLiteral() != "" {
+		t.Error("Non-TLS route should NOT have host_rewrite_literal")
+	}
+	if findHeader(nonTLSRoute, "x-forwarded-proto") != nil {
+		t.Error("Non-TLS route should NOT have x-forwarded-proto header")
+	}
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	bootstrapv3 "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
+)
+
+const (
+	// diagnostic severities, named after SARIF result levels
+	severityError   = "error"
+	severityWarning = "warning"
+
+	// output formats of the validate command
+	formatText  = "text"
+	formatJSON  = "json"
+	formatSARIF = "sarif"
+)
+
+// lint rules reported by the validate command
+const (
+	ruleConfig           = "config"
+	ruleEnvoySchema      = "envoy-schema"
+	ruleWeakerMethodAuth = "weaker-method-auth"
+	ruleAPIWithoutRoutes = "api-without-routes"
+	ruleShadowedRoute    = "shadowed-route"
+)
+
+var lintRules = []struct {
+	ID          string
+	Description string
+}{
+	{ruleConfig, "API config must parse and pass the generator checks"},
+	{ruleEnvoySchema, "Generated Envoy config must satisfy the Envoy v3 proto schema"},
+	{ruleWeakerMethodAuth, "Method auth policy must not be weaker than the API-level default"},
+	{ruleAPIWithoutRoutes, "API must declare methods or an API-level auth policy for its catch-all"},
+	{ruleShadowedRoute, "Route must not be shadowed by an earlier route prefix"},
+}
+
+// Diagnostic is a single validate finding. Line is the 1-based config line, 0 when unknown.
+type Diagnostic struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Path     string `json:"path,omitempty"`
+	Line     int    `json:"line,omitempty"`
+}
+
+// ValidateConfig runs the config checks, Envoy schema checks and lint rules against the API config data
+func ValidateConfig(data []byte) []Diagnostic {
+	lines := configLines(data)
+
+	cfg, err := apiconf.Parse(data)
+	if err != nil {
+		return []Diagnostic{{Rule: ruleConfig, Severity: severityError, Message: err.Error()}}
+	}
+
+	// the generator can't build anything from a config that fails its own checks
+	if err := cfg.Validate(); err != nil {
+		return []Diagnostic{{Rule: ruleConfig, Severity: severityError, Message: err.Error()}}
+	}
+
+	var diags []Diagnostic
+	diags = append(diags, checkEnvoySchema(cfg)...)
+	diags = append(diags, lintMethodAuth(cfg)...)
+	diags = append(diags, lintAPIRoutes(cfg)...)
+	diags = append(diags, lintShadowedRoutes(cfg)...)
+
+	for i := range diags {
+		diags[i].Line = lines[diags[i].Path]
+	}
+
+	return diags
+}
+
+// checkEnvoySchema renders the static Envoy config, reads it back the way Envoy would
+// and runs the proto validation rules (PGV) of every message in it
+func checkEnvoySchema(cfg *apiconf.Config) []Diagnostic {
+	schemaErr := func(err error) Diagnostic {
+		return Diagnostic{Rule: ruleEnvoySchema, Severity: severityError, Message: err.Error()}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := RenderEnvoyConfig(cfg, buf); err != nil {
+		return []Diagnostic{schemaErr(err)}
+	}
+
+	b := &bootstrapv3.Bootstrap{}
+	if err := UnmarshalYAML(buf.Bytes(), b); err != nil {
+		return []Diagnostic{schemaErr(err)}
+	}
+
+	err := b.ValidateAll()
+	if err == nil {
+		return nil
+	}
+
+	multi, ok := err.(interface{ AllErrors() []error })
+	if !ok {
+		return []Diagnostic{schemaErr(err)}
+	}
+
+	var diags []Diagnostic
+	for _, e := range multi.AllErrors() {
+		diags = append(diags, schemaErr(e))
+	}
+
+	return diags
+}
+
+// authStrength orders auth policies, a larger value lets fewer requests through
+func authStrength(a *apiconf.Auth) int {
+	switch a.Policy {
+	case apiconf.PolicyRequired, apiconf.PolicyAPIKey, apiconf.PolicyMTLS:
+		if a.Restricted() {
+			return 3
+		}
+		return 2
+	case apiconf.PolicyOptional:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func describeAuth(a *apiconf.Auth) string {
+	if (a.Required() || a.APIKey() || a.MTLS()) && a.Permission != "" {
+		return fmt.Sprintf("%s (permission %s)", a.Policy, a.Permission)
+	}
+	if (a.Required() || a.APIKey() || a.MTLS()) && a.Restricted() {
+		return fmt.Sprintf("%s (policy rules)", a.Policy)
+	}
+	return a.Policy
+}
+
+// lintMethodAuth flags methods that relax the API-level auth, usually a copy-paste leftover
+func lintMethodAuth(cfg *apiconf.Config) []Diagnostic {
+	var diags []Diagnostic
+
+	for _, api := range cfg.APIs {
+		if api.Auth == nil {
+			continue
+		}
+
+		for _, m := range api.Methods {
+			if m.Auth == nil || authStrength(m.Auth) >= authStrength(api.Auth) {
+				continue
+			}
+
+			diags = append(diags, Diagnostic{
+				Rule:     ruleWeakerMethodAuth,
+				Severity: severityWarning,
+				Message: fmt.Sprintf("method %s/%s uses auth %s, weaker than API default %s",
+					api.Name, m.Name, describeAuth(m.Auth), describeAuth(api.Auth)),
+				Path: methodPath(api.Name, m.Name),
+			})
+		}
+	}
+
+	return diags
+}
+
+// lintAPIRoutes flags APIs that can't serve anything: auth-adapter rejects every method
+// that has neither its own auth nor an API-level one to fall back to
+func lintAPIRoutes(cfg *apiconf.Config) []Diagnostic {
+	var diags []Diagnostic
+
+	for _, api := range cfg.APIs {
+		if api.Auth != nil || len(api.Methods) > 0 {
+			continue
+		}
+
+		diags = append(diags, Diagnostic{
+			Rule:     ruleAPIWithoutRoutes,
+			Severity: severityError,
+			Message:  fmt.Sprintf("API %s has no methods and no API-level auth, all its requests are rejected", api.Name),
+			Path:     apiPath(api.Name),
+		})
+	}
+
+	return diags
+}
+
+// lintShadowedRoutes flags routes that never match because Envoy picks the first matching
+// route and an earlier prefix already covers them (e.g. /api/user/login before /api/user/loginV2)
+func lintShadowedRoutes(cfg *apiconf.Config) []Diagnostic {
+	rc, err := BuildRouteConfiguration(cfg)
+	if err != nil {
+		return nil // reported by checkEnvoySchema
+	}
+
+	var diags []Diagnostic
+
+	for _, vh := range rc.VirtualHosts {
+		for j, r := range vh.Routes {
+			prefix := r.GetMatch().GetPrefix()
+
+			for _, earlier := range vh.Routes[:j] {
+				if !strings.HasPrefix(prefix, earlier.GetMatch().GetPrefix()) {
+					continue
+				}
+
+				diags = append(diags, Diagnostic{
+					Rule:     ruleShadowedRoute,
+					Severity: severityWarning,
+					Message: fmt.Sprintf("route %s (%s) is unreachable, shadowed by earlier prefix %s (%s)",
+						prefix, r.Name, earlier.GetMatch().GetPrefix(), earlier.Name),
+					Path: routePath(r.Name),
+				})
+				break
+			}
+		}
+	}
+
+	return diags
+}
+
+// Diagnostic paths, also the keys of configLines
+func apiPath(api string) string {
+	return "apis/" + api
+}
+
+func methodPath(api, method string) string {
+	return "apis/" + api + "/methods/" + method
+}
+
+// routePath maps a route name from BuildRouteConfiguration back to its config entry
+func routePath(routeName string) string {
+	if api, method, ok := strings.Cut(routeName, "/"); ok {
+		return methodPath(api, method)
+	}
+	return apiPath(routeName)
+}
+
+// configLines indexes the lines of APIs and methods in the config source
+func configLines(data []byte) map[string]int {
+	lines := make(map[string]int)
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+		return lines
+	}
+
+	apis := mappingValue(doc.Content[0], "apis")
+	if apis == nil {
+		return lines
+	}
+
+	for _, api := range apis.Content {
+		name := mappingValue(api, "name")
+		if name == nil {
+			continue
+		}
+		lines[apiPath(name.Value)] = api.Line
+
+		methods := mappingValue(api, "methods")
+		if methods == nil {
+			continue
+		}
+		for _, m := range methods.Content {
+			if mName := mappingValue(m, "name"); mName != nil {
+				lines[methodPath(name.Value, mName.Value)] = m.Line
+			}
+		}
+	}
+
+	return lines
+}
+
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// HasErrors reports whether any diagnostic is at least as severe as failOn
+func HasErrors(diags []Diagnostic, failOn string) bool {
+	for _, d := range diags {
+		if d.Severity == severityError || failOn == severityWarning {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteDiagnostics writes diags for the config file in the given format
+func WriteDiagnostics(w io.Writer, format, file string, diags []Diagnostic) error {
+	switch format {
+	case formatText:
+		for _, d := range diags {
+			loc := file
+			if d.Line > 0 {
+				loc = fmt.Sprintf("%s:%d", file, d.Line)
+			}
+			if _, err := fmt.Fprintf(w, "%s: %s [%s] %s\n", loc, d.Severity, d.Rule, d.Message); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintf(w, "%d problem(s)\n", len(diags))
+		return err
+	case formatJSON:
+		if diags == nil {
+			diags = []Diagnostic{}
+		}
+		return writeJSON(w, struct {
+			File        string       `json:"file"`
+			Diagnostics []Diagnostic `json:"diagnostics"`
+		}{file, diags})
+	case formatSARIF:
+		return writeJSON(w, buildSARIF(file, diags))
+	default:
+		return fmt.Errorf("unknown format %s", format)
+	}
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// SARIF 2.1.0 subset, enough for code scanning UIs to show findings inline
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+func buildSARIF(file string, diags []Diagnostic) sarifLog {
+	rules := make([]sarifRule, 0, len(lintRules))
+	for _, r := range lintRules {
+		rules = append(rules, sarifRule{ID: r.ID, ShortDescription: sarifMessage{Text: r.Description}})
+	}
+
+	results := make([]sarifResult, 0, len(diags))
+	for _, d := range diags {
+		loc := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: file}}
+		if d.Line > 0 {
+			loc.Region = &sarifRegion{StartLine: d.Line}
+		}
+
+		results = append(results, sarifResult{
+			RuleID:    d.Rule,
+			Level:     d.Severity,
+			Message:   sarifMessage{Text: d.Message},
+			Locations: []sarifLocation{{PhysicalLocation: loc}},
+		})
+	}
+
+	return sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{
+			{
+				Tool:    sarifTool{Driver: sarifDriver{Name: "conf-generator", Rules: rules}},
+				Results: results,
+			},
+		},
+	}
+}
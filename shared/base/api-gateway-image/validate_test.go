@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const validateTestConfig = `
+api_route: /api/
+
+clusters:
+  - name: user-service
+    addr: "user-service-sv:8081"
+    type: "grpc"
+
+apis:
+  - name: UserService
+    cluster: user-service
+    auth: {policy: required, permission: ADMIN}
+    methods:
+      - name: Login
+        auth: {policy: no-need}
+      - name: LoginV2
+        auth: {policy: no-need}
+      - name: Logout
+        auth: {policy: required, permission: ADMIN}
+  - name: Empty
+    cluster: user-service
+  - name: UserServiceV2
+    cluster: user-service
+    auth: {policy: no-need}
+`
+
+func findDiagnostics(diags []Diagnostic, rule string) []Diagnostic {
+	var out []Diagnostic
+	for _, d := range diags {
+		if d.Rule == rule {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+func TestValidateConfigLint(t *testing.T) {
+	diags := ValidateConfig([]byte(validateTestConfig))
+
+	if schema := findDiagnostics(diags, ruleEnvoySchema); len(schema) != 0 {
+		t.Errorf("Expected no schema errors, got %v", schema)
+	}
+
+	weaker := findDiagnostics(diags, ruleWeakerMethodAuth)
+	if len(weaker) != 2 {
+		t.Fatalf("Expected Login and LoginV2 to be flagged as weaker, got %v", weaker)
+	}
+	if weaker[0].Path != "apis/UserService/methods/Login" || weaker[0].Line != 14 {
+		t.Errorf("Unexpected location of weaker auth finding: %s:%d", weaker[0].Path, weaker[0].Line)
+	}
+
+	empty := findDiagnostics(diags, ruleAPIWithoutRoutes)
+	if len(empty) != 1 || empty[0].Path != "apis/Empty" || empty[0].Severity != severityError {
+		t.Errorf("Expected API Empty to be flagged, got %v", empty)
+	}
+
+	// /api/UserService/Login shadows /api/UserService/LoginV2, and the gRPC
+	// catch-all /api/UserService shadows every /api/UserServiceV2 route
+	shadowed := map[string]bool{}
+	for _, d := range findDiagnostics(diags, ruleShadowedRoute) {
+		shadowed[d.Path] = true
+	}
+	for _, p := range []string{"apis/UserService/methods/LoginV2", "apis/UserServiceV2"} {
+		if !shadowed[p] {
+			t.Errorf("Expected %s to be reported as shadowed, got %v", p, shadowed)
+		}
+	}
+	if shadowed["apis/UserService/methods/Logout"] {
+		t.Error("Logout is reachable and should not be reported")
+	}
+
+	if !HasErrors(diags, severityError) {
+		t.Error("Config with an error finding should fail the check")
+	}
+}
+
+func TestValidateConfigClean(t *testing.T) {
+	diags := ValidateConfig([]byte(xdsTestConfig))
+	if len(diags) != 0 {
+		t.Errorf("Expected no findings, got %v", diags)
+	}
+	if HasErrors(diags, severityWarning) {
+		t.Error("Clean config should pass with -fail-on warning")
+	}
+}
+
+func TestValidateConfigInvalid(t *testing.T) {
+	diags := ValidateConfig([]byte("api_route: api\n"))
+	if len(diags) != 1 || diags[0].Rule != ruleConfig {
+		t.Fatalf("Expected a single config error, got %v", diags)
+	}
+}
+
+func TestWriteDiagnosticsSARIF(t *testing.T) {
+	diags := []Diagnostic{{
+		Rule:     ruleShadowedRoute,
+		Severity: severityWarning,
+		Message:  "route is unreachable",
+		Path:     "apis/A/methods/B",
+		Line:     7,
+	}}
+
+	buf := new(bytes.Buffer)
+	if err := WriteDiagnostics(buf, formatSARIF, "config.yaml", diags); err != nil {
+		t.Fatalf("Failed to write SARIF: %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("SARIF output is not valid JSON: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("Unexpected SARIF log: %s", buf.String())
+	}
+	if len(log.Runs[0].Tool.Driver.Rules) != len(lintRules) {
+		t.Error("SARIF driver should list all lint rules")
+	}
+
+	res := log.Runs[0].Results[0]
+	if res.RuleID != ruleShadowedRoute || res.Level != "warning" {
+		t.Errorf("Unexpected SARIF result: %+v", res)
+	}
+	loc := res.Locations[0].PhysicalLocation
+	if loc.ArtifactLocation.URI != "config.yaml" || loc.Region == nil || loc.Region.StartLine != 7 {
+		t.Errorf("Unexpected SARIF location: %+v", loc)
+	}
+}
+
+func TestWriteDiagnosticsJSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := WriteDiagnostics(buf, formatJSON, "config.yaml", nil); err != nil {
+		t.Fatalf("Failed to write JSON: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"diagnostics": []`) {
+		t.Errorf("Empty result should be an empty list, got %s", buf.String())
+	}
+
+	if err := WriteDiagnostics(buf, "xml", "config.yaml", nil); err == nil {
+		t.Error("Unknown format should be rejected")
+	}
+}
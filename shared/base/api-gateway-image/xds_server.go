@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	bootstrapv3 "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpointv3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	clusterservice "github.com/envoyproxy/go-control-plane/envoy/service/cluster/v3"
+	discoverygrpc "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	endpointservice "github.com/envoyproxy/go-control-plane/envoy/service/endpoint/v3"
+	listenerservice "github.com/envoyproxy/go-control-plane/envoy/service/listener/v3"
+	routeservice "github.com/envoyproxy/go-control-plane/envoy/service/route/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	serverv3 "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
+)
+
+const clusterXDS = "xds_cluster"
+
+// BuildXDSBootstrap builds the bootstrap for xDS mode: listeners and clusters come from the control plane over ADS,
+// routes and endpoints are fetched by the listeners/clusters themselves (RDS/EDS over ADS)
+func BuildXDSBootstrap(nodeID string, xdsPort uint32) (*bootstrapv3.Bootstrap, error) {
+	protocolOptions, err := http2ProtocolOptions(&corev3.Http2ProtocolOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &bootstrapv3.Bootstrap{
+		Node: &corev3.Node{
+			Id:      nodeID,
+			Cluster: "api-gateway",
+		},
+		Admin: &bootstrapv3.Admin{
+			Address: socketAddress("0.0.0.0", 8000),
+		},
+		DynamicResources: &bootstrapv3.Bootstrap_DynamicResources{
+			AdsConfig: &corev3.ApiConfigSource{
+				ApiType:                   corev3.ApiConfigSource_GRPC,
+				TransportApiVersion:       corev3.ApiVersion_V3,
+				SetNodeOnFirstMessageOnly: true,
+				GrpcServices: []*corev3.GrpcService{
+					{
+						TargetSpecifier: &corev3.GrpcService_EnvoyGrpc_{
+							EnvoyGrpc: &corev3.GrpcService_EnvoyGrpc{ClusterName: clusterXDS},
+						},
+					},
+				},
+			},
+			CdsConfig: adsConfigSource(),
+			LdsConfig: adsConfigSource(),
+		},
+		StaticResources: &bootstrapv3.Bootstrap_StaticResources{
+			Clusters: []*clusterv3.Cluster{
+				{
+					Name:                          clusterXDS,
+					ConnectTimeout:                durationpb.New(time.Second),
+					ClusterDiscoveryType:          &clusterv3.Cluster_Type{Type: clusterv3.Cluster_STATIC},
+					TypedExtensionProtocolOptions: protocolOptions,
+					LoadAssignment:                loadAssignment(clusterXDS, "127.0.0.1", xdsPort),
+				},
+			},
+		},
+	}, nil
+}
+
+// GenerateXDSBootstrap writes the Envoy bootstrap that points Envoy to the control plane listening on xdsAddr
+func GenerateXDSBootstrap(nodeID, xdsAddr, outFile string) error {
+	_, port, err := net.SplitHostPort(xdsAddr)
+	if err != nil {
+		return fmt.Errorf("invalid xDS listen address %s: %w", xdsAddr, err)
+	}
+
+	xdsPort, err := strconv.ParseUint(port, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid xDS listen port %s: %w", port, err)
+	}
+
+	b, err := BuildXDSBootstrap(nodeID, uint32(xdsPort))
+	if err != nil {
+		return err
+	}
+
+	out, err := MarshalYAML(b)
+	if err != nil {
+		return err
+	}
+
+	// entrypoint.sh starts Envoy as soon as the file appears, so it must never be seen half-written
+	tmpFile := outFile + ".tmp"
+	if err := os.WriteFile(tmpFile, out, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile, outFile)
+}
+
+// BuildSnapshot builds the Envoy resources for cfg as an xDS snapshot:
+// the listener gets its routes over RDS and clusters with IP endpoints get them over EDS.
+// Clusters addressed by hostname stay STRICT_DNS, since Envoy does not resolve EDS hostnames.
+func BuildSnapshot(cfg *apiconf.Config) (*cache.Snapshot, error) {
+	env := envoyEnvFromOS()
+
+	rc, err := BuildRouteConfiguration(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := BuildListener(cfg, env, rc, adsConfigSource())
+	if err != nil {
+		return nil, err
+	}
+
+	built, err := BuildClusters(cfg, env)
+	if err != nil {
+		return nil, err
+	}
+
+	var clusters, endpoints []types.Resource
+	for _, cl := range built {
+		if la := moveEndpointsToEDS(cl); la != nil {
+			endpoints = append(endpoints, la)
+		}
+		clusters = append(clusters, cl)
+	}
+
+	snap, err := cache.NewSnapshot("", map[resource.Type][]types.Resource{
+		resource.ListenerType: {l},
+		resource.RouteType:    {rc},
+		resource.ClusterType:  clusters,
+		resource.EndpointType: endpoints,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Version each resource type by its own content, so a route change is pushed
+	// as an RDS update only and Envoy keeps its listeners (and open streams) as is
+	for i := range snap.Resources {
+		version, err := resourcesVersion(snap.Resources[i].Items)
+		if err != nil {
+			return nil, err
+		}
+		snap.Resources[i].Version = version
+	}
+
+	if err := snap.Consistent(); err != nil {
+		return nil, err
+	}
+
+	return snap, nil
+}
+
+func adsConfigSource() *corev3.ConfigSource {
+	return &corev3.ConfigSource{
+		ResourceApiVersion:    corev3.ApiVersion_V3,
+		ConfigSourceSpecifier: &corev3.ConfigSource_Ads{Ads: &corev3.AggregatedConfigSource{}},
+	}
+}
+
+// moveEndpointsToEDS switches a STRICT_DNS cluster whose endpoints are all IP addresses to EDS
+// and returns its load assignment, or returns nil leaving the cluster untouched
+func moveEndpointsToEDS(cl *clusterv3.Cluster) *endpointv3.ClusterLoadAssignment {
+	if cl.GetType() != clusterv3.Cluster_STRICT_DNS || cl.GetLoadAssignment() == nil {
+		return nil
+	}
+
+	for _, lle := range cl.LoadAssignment.GetEndpoints() {
+		for _, lb := range lle.GetLbEndpoints() {
+			addr := lb.GetEndpoint().GetAddress().GetSocketAddress().GetAddress()
+			if net.ParseIP(addr) == nil {
+				return nil
+			}
+		}
+	}
+
+	la := cl.LoadAssignment
+	la.ClusterName = cl.Name
+
+	cl.LoadAssignment = nil
+	cl.ClusterDiscoveryType = &clusterv3.Cluster_Type{Type: clusterv3.Cluster_EDS}
+	cl.EdsClusterConfig = &clusterv3.Cluster_EdsClusterConfig{EdsConfig: adsConfigSource()}
+
+	return la
+}
+
+// resourcesVersion hashes resources in name order, so equal content always gives the same version
+func resourcesVersion(items map[string]types.ResourceWithTTL) (string, error) {
+	names := make([]string, 0, len(items))
+	for name := range items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		data, err := proto.MarshalOptions{Deterministic: true}.Marshal(items[name].Resource)
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte(name))
+		h.Write(data)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+// XDSServer serves the gateway config to Envoy over ADS and pushes a new
+// snapshot whenever the API config file changes on disk
+type XDSServer struct {
+	confPath string
+	nodeID   string
+	cache    cache.SnapshotCache
+
+	confHash string
+	// failedHash is the last config that failed, it is reported once and skipped until it changes
+	failedHash string
+}
+
+func NewXDSServer(confPath, nodeID string) *XDSServer {
+	return &XDSServer{
+		confPath: confPath,
+		nodeID:   nodeID,
+		cache:    cache.NewSnapshotCache(true, cache.IDHash{}, nil),
+	}
+}
+
+// Reload re-reads the API config and pushes a new snapshot if the file has changed.
+// On error the previously pushed snapshot keeps being served, and the same invalid
+// config is not tried again until the file changes.
+func (s *XDSServer) Reload(ctx context.Context) error {
+	data, err := os.ReadFile(s.confPath)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	confHash := hex.EncodeToString(sum[:])
+	if confHash == s.confHash {
+		// a revert to the served config, a new failure of the last invalid one is reported again
+		s.failedHash = ""
+		return nil
+	}
+	if confHash == s.failedHash {
+		return nil
+	}
+
+	if err := s.push(ctx, data); err != nil {
+		s.failedHash = confHash
+		return err
+	}
+	s.confHash = confHash
+	s.failedHash = ""
+
+	return nil
+}
+
+// push builds a snapshot of the API config and serves it
+func (s *XDSServer) push(ctx context.Context, data []byte) error {
+	c, err := apiconf.Parse(data)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	snap, err := BuildSnapshot(c)
+	if err != nil {
+		return err
+	}
+
+	if err := s.cache.SetSnapshot(ctx, s.nodeID, snap); err != nil {
+		return err
+	}
+
+	fmt.Printf("[INFO] xDS snapshot pushed: listeners=%s routes=%s clusters=%s endpoints=%s\n",
+		snap.GetVersion(resource.ListenerType), snap.GetVersion(resource.RouteType),
+		snap.GetVersion(resource.ClusterType), snap.GetVersion(resource.EndpointType))
+
+	return nil
+}
+
+// Run serves xDS on addr until ctx is done, checking the API config for changes every pollInterval.
+// The initial config must be valid, later invalid revisions are logged and skipped.
+func (s *XDSServer) Run(ctx context.Context, addr string, pollInterval time.Duration) error {
+	if err := s.Reload(ctx); err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	grpcServer := grpc.NewServer()
+	xds := serverv3.NewServer(ctx, s.cache, nil)
+
+	discoverygrpc.RegisterAggregatedDiscoveryServiceServer(grpcServer, xds)
+	listenerservice.RegisterListenerDiscoveryServiceServer(grpcServer, xds)
+	routeservice.RegisterRouteDiscoveryServiceServer(grpcServer, xds)
+	clusterservice.RegisterClusterDiscoveryServiceServer(grpcServer, xds)
+	endpointservice.RegisterEndpointDiscoveryServiceServer(grpcServer, xds)
+
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				grpcServer.GracefulStop()
+				return
+			case <-ticker.C:
+				if err := s.Reload(ctx); err != nil {
+					fmt.Printf("[ERROR] config reload failed, keeping previous snapshot: %s\n", err)
+				}
+			}
+		}
+	}()
+
+	fmt.Printf("[INFO] xDS server listening on %s (node %s)\n", addr, s.nodeID)
+
+	return grpcServer.Serve(listener)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bootstrapv3 "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	endpointv3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	hcmv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
+)
+
+const xdsTestConfig = `
+api_route: /api/
+
+clusters:
+  - name: user-service
+    addr: "user-service-sv:8081"
+    type: "http"
+  - name: static-ip
+    addr: "10.0.0.7:9090"
+    type: "grpc"
+
+apis:
+  - name: user
+    cluster: user-service
+    auth: {policy: no-need}
+    methods:
+      - name: login
+        auth: {policy: no-need}
+  - name: Static
+    cluster: static-ip
+    auth: {policy: no-need}
+    methods:
+      - name: Get
+        auth: {policy: no-need}
+`
+
+func TestBuildSnapshot(t *testing.T) {
+	cfg, err := apiconf.Parse([]byte(xdsTestConfig))
+	if err != nil {
+		t.Fatal("Failed to parse config:", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal("Invalid config:", err)
+	}
+
+	snap, err := BuildSnapshot(cfg)
+	if err != nil {
+		t.Fatalf("Failed to build snapshot: %v", err)
+	}
+
+	// Listener must reference routes over RDS instead of carrying them inline
+	l, ok := snap.GetResources(resource.ListenerType)["web_grpc_listener"].(*listenerv3.Listener)
+	if !ok {
+		t.Fatal("Listener web_grpc_listener not found in snapshot")
+	}
+	hcm := &hcmv3.HttpConnectionManager{}
+	if err := l.FilterChains[0].Filters[0].GetTypedConfig().UnmarshalTo(hcm); err != nil {
+		t.Fatalf("Failed to decode connection manager: %v", err)
+	}
+	if hcm.GetRouteConfig() != nil {
+		t.Error("Listener should not carry inline route_config in xDS mode")
+	}
+	if hcm.GetRds().GetRouteConfigName() != "local_route" {
+		t.Errorf("Expected RDS route config local_route, got %q", hcm.GetRds().GetRouteConfigName())
+	}
+
+	rc, ok := snap.GetResources(resource.RouteType)["local_route"].(*routev3.RouteConfiguration)
+	if !ok {
+		t.Fatal("Route config local_route not found in snapshot")
+	}
+	prefixes := map[string]bool{}
+	for _, r := range rc.VirtualHosts[0].Routes {
+		prefixes[r.GetMatch().GetPrefix()] = true
+	}
+	for _, p := range []string{"/api/user/login", "/api/user/", "/api/Static/Get", "/api/Static"} {
+		if !prefixes[p] {
+			t.Errorf("Route %s not found in RDS resource", p)
+		}
+	}
+
+	// Hostname cluster stays STRICT_DNS, IP cluster goes to EDS
+	clusters := snap.GetResources(resource.ClusterType)
+	dnsCluster := clusters["user-service"].(*clusterv3.Cluster)
+	if dnsCluster.GetType() != clusterv3.Cluster_STRICT_DNS || dnsCluster.GetLoadAssignment() == nil {
+		t.Error("Hostname cluster should stay STRICT_DNS with inline endpoints")
+	}
+	ipCluster := clusters["static-ip"].(*clusterv3.Cluster)
+	if ipCluster.GetType() != clusterv3.Cluster_EDS || ipCluster.GetLoadAssignment() != nil {
+		t.Error("IP cluster should be served over EDS")
+	}
+
+	la, ok := snap.GetResources(resource.EndpointType)["static-ip"].(*endpointv3.ClusterLoadAssignment)
+	if !ok {
+		t.Fatal("Endpoints for static-ip not found in snapshot")
+	}
+	port := la.Endpoints[0].LbEndpoints[0].GetEndpoint().GetAddress().GetSocketAddress().GetPortValue()
+	if port != 9090 {
+		t.Errorf("Expected EDS endpoint port 9090, got %d", port)
+	}
+}
+
+func TestBuildSnapshotVersions(t *testing.T) {
+	build := func(conf string) map[resource.Type]string {
+		cfg, err := apiconf.Parse([]byte(conf))
+		if err != nil {
+			t.Fatal("Failed to parse config:", err)
+		}
+		snap, err := BuildSnapshot(cfg)
+		if err != nil {
+			t.Fatalf("Failed to build snapshot: %v", err)
+		}
+		versions := map[resource.Type]string{}
+		for _, typ := range []resource.Type{resource.ListenerType, resource.RouteType, resource.ClusterType} {
+			versions[typ] = snap.GetVersion(typ)
+		}
+		return versions
+	}
+
+	base := build(xdsTestConfig)
+	if same := build(xdsTestConfig); same[resource.RouteType] != base[resource.RouteType] {
+		t.Error("Same config should produce the same route version")
+	}
+
+	// Adding a method changes routes only; listener must stay the same so Envoy doesn't drain it
+	changed := build(xdsTestConfig + `
+      - name: List
+        auth: {policy: no-need}
+`)
+	if changed[resource.RouteType] == base[resource.RouteType] {
+		t.Error("Route version should change when a method is added")
+	}
+	if changed[resource.ListenerType] != base[resource.ListenerType] {
+		t.Error("Listener version should not change when only routes change")
+	}
+	if changed[resource.ClusterType] != base[resource.ClusterType] {
+		t.Error("Cluster version should not change when only routes change")
+	}
+}
+
+func TestXDSServerReload(t *testing.T) {
+	confFile := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(confFile, []byte(xdsTestConfig), 0644); err != nil {
+		t.Fatal("Failed to write config:", err)
+	}
+
+	ctx := context.Background()
+	s := NewXDSServer(confFile, "test-node")
+	if err := s.Reload(ctx); err != nil {
+		t.Fatalf("Initial reload failed: %v", err)
+	}
+
+	snap, err := s.cache.GetSnapshot("test-node")
+	if err != nil {
+		t.Fatalf("Snapshot not set for node: %v", err)
+	}
+	routeVersion := snap.GetVersion(resource.RouteType)
+
+	// Invalid config must be rejected and the previous snapshot kept
+	if err := os.WriteFile(confFile, []byte("api_route: api\n"), 0644); err != nil {
+		t.Fatal("Failed to write config:", err)
+	}
+	if err := s.Reload(ctx); err == nil {
+		t.Error("Expected reload of invalid config to fail")
+	}
+	snap, _ = s.cache.GetSnapshot("test-node")
+	if snap.GetVersion(resource.RouteType) != routeVersion {
+		t.Error("Invalid config should not replace the served snapshot")
+	}
+
+	// The failure is reported once per revision, not on every poll
+	if err := s.Reload(ctx); err != nil {
+		t.Errorf("Unchanged invalid config should not fail again: %v", err)
+	}
+	if err := os.WriteFile(confFile, []byte("api_route: other\n"), 0644); err != nil {
+		t.Fatal("Failed to write config:", err)
+	}
+	if err := s.Reload(ctx); err == nil {
+		t.Error("Expected reload of another invalid config to fail")
+	}
+
+	// After a revert to the served config the same invalid config is reported again
+	if err := os.WriteFile(confFile, []byte(xdsTestConfig), 0644); err != nil {
+		t.Fatal("Failed to write config:", err)
+	}
+	if err := s.Reload(ctx); err != nil {
+		t.Fatalf("Reload of the served config failed: %v", err)
+	}
+	if err := os.WriteFile(confFile, []byte("api_route: other\n"), 0644); err != nil {
+		t.Fatal("Failed to write config:", err)
+	}
+	if err := s.Reload(ctx); err == nil {
+		t.Error("Expected reload of the invalid config to fail after a revert")
+	}
+}
+
+func TestGenerateXDSBootstrap(t *testing.T) {
+	outFile := filepath.Join(t.TempDir(), "envoy.yaml")
+	if err := GenerateXDSBootstrap("gw-1", "127.0.0.1:18000", outFile); err != nil {
+		t.Fatalf("Failed to generate bootstrap: %v", err)
+	}
+
+	data, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatal("Failed to read bootstrap:", err)
+	}
+
+	b := &bootstrapv3.Bootstrap{}
+	if err := UnmarshalYAML(data, b); err != nil {
+		t.Fatalf("Bootstrap is not a valid Envoy config: %v", err)
+	}
+	if err := b.ValidateAll(); err != nil {
+		t.Errorf("Bootstrap failed Envoy validation: %v", err)
+	}
+	if b.GetNode().GetId() != "gw-1" {
+		t.Errorf("Expected node id gw-1, got %q", b.GetNode().GetId())
+	}
+	if b.GetDynamicResources().GetAdsConfig() == nil {
+		t.Error("Bootstrap should configure ADS")
+	}
+	port := b.GetStaticResources().GetClusters()[0].GetLoadAssignment().
+		GetEndpoints()[0].GetLbEndpoints()[0].GetEndpoint().GetAddress().GetSocketAddress().GetPortValue()
+	if port != 18000 {
+		t.Errorf("Expected xds_cluster port 18000, got %d", port)
+	}
+}
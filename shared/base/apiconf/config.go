@@ -0,0 +1,361 @@
+// Package apiconf owns the schema of the api-gateway config.yaml. The same file is read by
+// the Envoy config generator (api-gateway-image) and by auth-adapter, both decode it with
+// this package so a field added for one side is known to the other.
+package apiconf
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// auth policies
+	PolicyRequired = "required"
+	PolicyOptional = "optional"
+	PolicyNoNeed   = "no-need"
+	PolicyAPIKey   = "api-key" // machine clients with an x-api-key header instead of a session
+	PolicyMTLS     = "mtls"    // internal services with a client certificate mapped in downstream_tls
+
+	// cluster types
+	ClusterGRPC = "grpc"
+	ClusterHTTP = "http"
+
+	// rate limit keys, what a limit is counted per
+	RateLimitKeyIP     = "ip"
+	RateLimitKeyUserID = "user-id"
+	RateLimitKeyAPIKey = "api-key"
+	RateLimitKeyRoute  = "route"
+)
+
+type Config struct {
+	APIRoute         string            `yaml:"api_route" desc:"Path prefix of all gateway routes, e.g. /api/" required:"true"`
+	RateLimitService *RateLimitService `yaml:"rate_limit_service" desc:"Count rate limits cluster-wide in a rate limit service instead of per gateway replica"`
+	DownstreamTLS    *DownstreamTLS    `yaml:"downstream_tls" desc:"TLS on the gateway listener, with client certificates of internal services"`
+	Clusters         []Cluster         `yaml:"clusters" desc:"Upstream services"`
+	APIs             []API             `yaml:"apis" desc:"APIs exposed through the gateway"`
+}
+
+// RateLimitService is an envoy.service.ratelimit.v3 server (ratelimit-service) shared by all
+// gateway replicas. When set, Envoy asks it about every rate limited route and the
+// per-replica counters (Envoy local_ratelimit, auth-adapter) are not used
+type RateLimitService struct {
+	Addr            string        `yaml:"addr" desc:"Rate limit service host:port" required:"true"`
+	Domain          string        `yaml:"domain" desc:"Rate limit domain of the gateway descriptors" default:"api-gateway"`
+	Timeout         time.Duration `yaml:"timeout" desc:"Rate limit request timeout" default:"100ms"`
+	FailureModeDeny bool          `yaml:"failure_mode_deny" desc:"Deny requests while the rate limit service is unavailable (allowed by default)"`
+}
+
+// DownstreamTLS terminates TLS on the gateway listener. With ClientCA the listener asks for a
+// client certificate and Envoy passes its SAN to auth-adapter as the peer principal,
+// Identities map it to the service of the mtls policy
+type DownstreamTLS struct {
+	Cert              string            `yaml:"cert" desc:"Server certificate chain path" required:"true"`
+	Key               string            `yaml:"key" desc:"Server private key path" required:"true"`
+	ClientCA          string            `yaml:"client_ca" desc:"CA bundle path validating client certificates, none are requested without it"`
+	RequireClientCert bool              `yaml:"require_client_cert" desc:"Reject connections without a valid client certificate"`
+	Identities        []ServiceIdentity `yaml:"identities" desc:"Services of the client certificate SANs"`
+}
+
+// ServiceIdentity is an internal service authenticated by its client certificate,
+// e.g. {san: "spiffe://cluster.local/ns/billing/sa/billing", service: billing}
+type ServiceIdentity struct {
+	SAN         string   `yaml:"san" desc:"URI SAN (SPIFFE ID), DNS SAN or subject of the client certificate" required:"true"`
+	Service     string   `yaml:"service" desc:"Service name passed upstream in the service-id header" required:"true"`
+	Permissions []string `yaml:"permissions" desc:"Permissions of the service in mtls auths"`
+}
+
+type API struct {
+	Name    string   `yaml:"name" desc:"Service name, the first path segment after api_route" required:"true"`
+	Cluster string   `yaml:"cluster" desc:"Name of the cluster serving this API" required:"true"`
+	Auth    *Auth    `yaml:"auth" desc:"Default auth of the API, used by methods without their own auth"`
+	Methods []Method `yaml:"methods" desc:"Methods with their own route and auth"`
+}
+
+type Method struct {
+	Name string `yaml:"name" desc:"Method name, the path segment after the API name" required:"true"`
+	Auth *Auth  `yaml:"auth" desc:"Method auth, overrides the API default"`
+}
+
+// Auth of an API or method. With the required, api-key and mtls policies the session, API key or
+// service must also satisfy every rule set: permission and all_of, one of any_of, one of roles and condition.
+// The permissions of an API key are its scopes, the ones of a service come from downstream_tls.identities
+type Auth struct {
+	Policy     string     `yaml:"policy" desc:"Session requirement, api-key for machine clients, mtls for services with a client certificate" enum:"required,optional,no-need,api-key,mtls" required:"true"`
+	Permission string     `yaml:"permission" desc:"Permission the session roles must grant (required, api-key and mtls policies)"`
+	AllOf      []string   `yaml:"all_of" desc:"Permissions the session must all have (required, api-key and mtls policies)"`
+	AnyOf      []string   `yaml:"any_of" desc:"Permissions the session must have at least one of (required, api-key and mtls policies)"`
+	Roles      []string   `yaml:"roles" desc:"Roles the session must have at least one of (required policy only)"`
+	Condition  string     `yaml:"condition" desc:"CEL expression over request and session that must be true (required, api-key and mtls policies), e.g. request.segments[0] == session.user_id"`
+	ReCaptcha  bool       `yaml:"need_recaptcha" desc:"Require a reCAPTCHA v3 token (x-rc-token header)"`
+	RateLimit  *RateLimit `yaml:"rate_limit" desc:"Rate limit of the method"`
+}
+
+// RateLimit allows Count requests per Period for every value of Key,
+// e.g. {period: 5m, count: 20, key: ip} is 20 requests per 5 minutes per client IP.
+// Without a key the limit is shared by all clients of the route
+type RateLimit struct {
+	Period time.Duration `yaml:"period" desc:"Rate limit window, any Go duration from 50ms (e.g. 1s, 5m, 1h30m)" required:"true"`
+	Count  int           `yaml:"count" desc:"Requests allowed per period" required:"true"`
+	Burst  int           `yaml:"burst" desc:"Requests allowed at once, the token bucket size (defaults to twice the count)"`
+	Key    string        `yaml:"key" desc:"What the limit is counted per: client IP, user-id header, validated API key client or the whole route" enum:"ip,user-id,api-key,route" default:"route"`
+	Delay  time.Duration `yaml:"delay" desc:"Delay of the responses once the limit is exceeded (auth-adapter)"`
+}
+
+type HealthCheck struct {
+	Path               string `yaml:"path" desc:"Health check path" required:"true"`
+	IntervalSeconds    int    `yaml:"interval_seconds" desc:"Check interval" default:"30"`
+	TimeoutSeconds     int    `yaml:"timeout_seconds" desc:"Request timeout" default:"5"`
+	HealthyThreshold   int    `yaml:"healthy_threshold" desc:"Successful checks to mark the host healthy" default:"2"`
+	UnhealthyThreshold int    `yaml:"unhealthy_threshold" desc:"Failed checks to mark the host unhealthy" default:"3"`
+}
+
+type CircuitBreaker struct {
+	MaxConnections     int `yaml:"max_connections" desc:"Max connections" default:"1024"`
+	MaxPendingRequests int `yaml:"max_pending_requests" desc:"Max pending requests" default:"1024"`
+	MaxRequests        int `yaml:"max_requests" desc:"Max requests" default:"1024"`
+	MaxRetries         int `yaml:"max_retries" desc:"Max retries" default:"3"`
+}
+
+// TLS configures TLS for upstream connections
+// SNI is used both for TLS handshake and Host header rewrite (for ingress routing)
+type TLS struct {
+	Enabled bool   `yaml:"enabled" desc:"Enable TLS for upstream"`
+	SNI     string `yaml:"sni,omitempty" desc:"SNI for TLS + Host header (auto-detected from addr if empty)"`
+	CACert  string `yaml:"ca_cert,omitempty" desc:"Custom CA cert path (uses system CA if empty)"`
+}
+
+type Cluster struct {
+	Name           string          `yaml:"name" desc:"Cluster name referenced by apis" required:"true"`
+	Addr           string          `yaml:"addr" desc:"Upstream host:port" required:"true"`
+	Type           string          `yaml:"type" desc:"Upstream protocol" enum:"grpc,http" default:"grpc"`
+	TLS            *TLS            `yaml:"tls" desc:"Optional TLS configuration"`
+	HealthCheck    *HealthCheck    `yaml:"health_check" desc:"Optional active health check"`
+	CircuitBreaker *CircuitBreaker `yaml:"circuit_breaker" desc:"Optional circuit breaker"`
+}
+
+// Load reads and decodes the config file, see Parse
+func Load(file string) (*Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+// Parse decodes config data and fills in defaults. Unknown fields are rejected,
+// a typo in config.yaml must not silently turn into a missing setting.
+// The result still has to be checked with Validate.
+func Parse(data []byte) (*Config, error) {
+	c := &Config{}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil {
+		return nil, err
+	}
+
+	c.SetDefaults()
+
+	return c, nil
+}
+
+// SetDefaults fills in optional settings left empty in the config
+func (c *Config) SetDefaults() {
+	if rls := c.RateLimitService; rls != nil {
+		if rls.Domain == "" {
+			rls.Domain = "api-gateway"
+		}
+		if rls.Timeout <= 0 {
+			rls.Timeout = 100 * time.Millisecond
+		}
+	}
+
+	for _, api := range c.APIs {
+		api.Auth.setDefaults()
+		for _, m := range api.Methods {
+			m.Auth.setDefaults()
+		}
+	}
+
+	for i := range c.Clusters {
+		cl := &c.Clusters[i]
+
+		if cl.Type == "" {
+			cl.Type = ClusterGRPC
+		}
+
+		if hc := cl.HealthCheck; hc != nil {
+			if hc.IntervalSeconds <= 0 {
+				hc.IntervalSeconds = 30
+			}
+			if hc.TimeoutSeconds <= 0 {
+				hc.TimeoutSeconds = 5
+			}
+			if hc.HealthyThreshold <= 0 {
+				hc.HealthyThreshold = 2
+			}
+			if hc.UnhealthyThreshold <= 0 {
+				hc.UnhealthyThreshold = 3
+			}
+		}
+
+		if cb := cl.CircuitBreaker; cb != nil {
+			if cb.MaxConnections <= 0 {
+				cb.MaxConnections = 1024
+			}
+			if cb.MaxPendingRequests <= 0 {
+				cb.MaxPendingRequests = 1024
+			}
+			if cb.MaxRequests <= 0 {
+				cb.MaxRequests = 1024
+			}
+			if cb.MaxRetries <= 0 {
+				cb.MaxRetries = 3
+			}
+		}
+	}
+}
+
+// RateLimits returns the method rate limits keyed by "API/method",
+// the route name the gateway puts into rate limit descriptors
+func (c *Config) RateLimits() map[string]*RateLimit {
+	limits := make(map[string]*RateLimit)
+	for _, api := range c.APIs {
+		for _, m := range api.Methods {
+			if m.Auth != nil && m.Auth.RateLimit != nil {
+				limits[api.Name+"/"+m.Name] = m.Auth.RateLimit
+			}
+		}
+	}
+
+	return limits
+}
+
+func (a *Auth) setDefaults() {
+	if a == nil || a.RateLimit == nil {
+		return
+	}
+
+	rl := a.RateLimit
+	if rl.Key == "" {
+		rl.Key = RateLimitKeyRoute
+	}
+	// twice the count, the bucket size of the limits before burst was configurable
+	if rl.Burst <= 0 {
+		rl.Burst = 2 * rl.Count
+	}
+}
+
+func (a Auth) NoNeed() bool {
+	return a.Policy == PolicyNoNeed
+}
+
+func (a Auth) Optional() bool {
+	return a.Policy == PolicyOptional
+}
+
+func (a Auth) Required() bool {
+	return a.Policy == PolicyRequired
+}
+
+func (a Auth) APIKey() bool {
+	return a.Policy == PolicyAPIKey
+}
+
+func (a Auth) MTLS() bool {
+	return a.Policy == PolicyMTLS
+}
+
+// Restricted reports whether the auth checks more than a valid session
+func (a Auth) Restricted() bool {
+	return a.Permission != "" || len(a.AllOf) > 0 || len(a.AnyOf) > 0 || len(a.Roles) > 0 || a.Condition != ""
+}
+
+func (a Auth) NeedReCaptcha() bool {
+	return a.ReCaptcha
+}
+
+// ClientCerts reports whether the listener asks for client certificates
+func (t *DownstreamTLS) ClientCerts() bool {
+	return t != nil && t.ClientCA != ""
+}
+
+// Identity returns the service of a client certificate SAN, nil for an unknown one
+func (t *DownstreamTLS) Identity(san string) *ServiceIdentity {
+	if t == nil {
+		return nil
+	}
+
+	for i := range t.Identities {
+		if t.Identities[i].SAN == san {
+			return &t.Identities[i]
+		}
+	}
+
+	return nil
+}
+
+func (r RateLimitService) AddrHost() string {
+	return strings.Split(r.Addr, ":")[0]
+}
+
+func (r RateLimitService) AddrPort() string {
+	return strings.Split(r.Addr, ":")[1]
+}
+
+func (c Cluster) AddrHost() string {
+	return strings.Split(c.Addr, ":")[0]
+}
+
+func (c Cluster) AddrPort() string {
+	return strings.Split(c.Addr, ":")[1]
+}
+
+func (c Cluster) IsGRPC() bool {
+	return c.Type == "" || c.Type == ClusterGRPC // default to gRPC
+}
+
+func (c Cluster) IsHTTP() bool {
+	return c.Type == ClusterHTTP
+}
+
+func (c Cluster) IsTLS() bool {
+	return c.TLS != nil && c.TLS.Enabled
+}
+
+// GetSNI returns SNI for TLS and Host header rewrite
+// If not set explicitly, auto-detects from address hostname
+func (c Cluster) GetSNI() string {
+	if c.TLS != nil && c.TLS.SNI != "" {
+		return c.TLS.SNI
+	}
+	// Auto-detect from address (strip port)
+	addr := c.Addr
+	if idx := strings.LastIndex(addr, ":"); idx != -1 {
+		addr = addr[:idx]
+	}
+	return addr
+}
+
+func (c Cluster) GetCACert() string {
+	if c.TLS != nil && c.TLS.CACert != "" {
+		return c.TLS.CACert
+	}
+	// Try common system CA paths
+	caPaths := []string{
+		"/etc/ssl/certs/ca-certificates.crt", // Debian/Ubuntu
+		"/etc/ssl/cert.pem",                  // Alpine/macOS
+		"/etc/pki/tls/certs/ca-bundle.crt",   // RHEL/CentOS
+	}
+	for _, path := range caPaths {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return "/etc/ssl/certs/ca-certificates.crt"
+}
@@ -0,0 +1,218 @@
+package apiconf
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfig = `
+api_route: /api/
+
+clusters:
+  - name: user-service
+    addr: "user-service-sv:8081"
+    type: "http"
+    health_check:
+      path: /health
+      interval_seconds: 10
+  - name: web
+    addr: "web-grpc-sv:9091"
+    circuit_breaker:
+      max_connections: 100
+
+apis:
+  - name: UserService
+    cluster: user-service
+    auth: {policy: required, permission: ADMIN}
+    methods:
+      - name: Login
+        auth:
+          policy: no-need
+          need_recaptcha: true
+          rate_limit: {period: 1m, count: 5, delay: 500ms}
+  - name: FakeService
+    cluster: web
+    auth: {policy: no-need}
+`
+
+func TestParse(t *testing.T) {
+	c, err := Parse([]byte(testConfig))
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Valid config rejected: %v", err)
+	}
+
+	login := c.APIs[0].Methods[0].Auth
+	if !login.NoNeed() || !login.NeedReCaptcha() {
+		t.Errorf("Unexpected Login auth: %+v", login)
+	}
+	if login.RateLimit.Period != time.Minute || login.RateLimit.Delay != 500*time.Millisecond {
+		t.Errorf("Durations not decoded: %+v", login.RateLimit)
+	}
+	if rl := login.RateLimit; rl.Burst != 10 || rl.Key != RateLimitKeyRoute {
+		t.Errorf("Rate limit defaults not applied: %+v", rl)
+	}
+	if api := c.APIs[0].Auth; !api.Required() || api.Permission != "ADMIN" {
+		t.Errorf("Unexpected API auth: %+v", api)
+	}
+
+	// defaults
+	hc := c.Clusters[0].HealthCheck
+	if hc.IntervalSeconds != 10 || hc.TimeoutSeconds != 5 || hc.HealthyThreshold != 2 || hc.UnhealthyThreshold != 3 {
+		t.Errorf("Health check defaults not applied: %+v", hc)
+	}
+	cb := c.Clusters[1].CircuitBreaker
+	if cb.MaxConnections != 100 || cb.MaxPendingRequests != 1024 || cb.MaxRetries != 3 {
+		t.Errorf("Circuit breaker defaults not applied: %+v", cb)
+	}
+	if c.Clusters[1].Type != ClusterGRPC || !c.Clusters[1].IsGRPC() {
+		t.Errorf("Cluster type should default to grpc, got %q", c.Clusters[1].Type)
+	}
+}
+
+func TestParseUnknownField(t *testing.T) {
+	_, err := Parse([]byte(strings.Replace(testConfig, "need_recaptcha", "needs_recaptcha", 1)))
+	if err == nil || !strings.Contains(err.Error(), "needs_recaptcha") {
+		t.Errorf("Unknown field should be rejected, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		replace [2]string
+		err     string
+	}{
+		{"api route", [2]string{"api_route: /api/", "api_route: api/"}, "invalid api_route"},
+		{"duplicate cluster", [2]string{"name: web\n", "name: user-service\n"}, "cluster user-service is defined twice"},
+		{"bad addr", [2]string{`"web-grpc-sv:9091"`, `"web-grpc-sv"`}, "invalid address"},
+		{"bad type", [2]string{`type: "http"`, `type: "tcp"`}, "invalid cluster type tcp"},
+		{"undefined cluster", [2]string{"cluster: web", "cluster: nope"}, "cluster nope for API FakeService is not defined"},
+		{"bad policy", [2]string{"policy: required", "policy: always"}, "unknown auth policy always"},
+		{"short period", [2]string{"period: 1m", "period: 10ms"}, "rate limit period 10ms is shorter than 50ms"},
+		{"low burst", [2]string{"count: 5", "count: 5, burst: 3"}, "rate limit burst 3 cannot be lower than count 5"},
+		{"bad key", [2]string{"count: 5", "count: 5, key: session"}, "unknown rate limit key session"},
+		{"bad count", [2]string{"count: 5", "count: 0"}, "rate limit count must be positive"},
+		{"empty method", [2]string{"name: Login", "name: ''"}, "method name cannot be empty"},
+		{"rules without required", [2]string{"policy: no-need\n          need_recaptcha", "policy: no-need\n          roles: [ADMIN]\n          need_recaptcha"}, "need the required, api-key or mtls policy"},
+		{"roles with api key", [2]string{"policy: no-need\n          need_recaptcha", "policy: api-key\n          roles: [ADMIN]\n          need_recaptcha"}, "API keys have scopes only"},
+		{"mtls without client certs", [2]string{"policy: no-need\n          need_recaptcha", "policy: mtls\n          need_recaptcha"}, "mtls policy needs downstream_tls with client_ca"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := Parse([]byte(strings.Replace(testConfig, tc.replace[0], tc.replace[1], 1)))
+			if err != nil {
+				t.Fatalf("Failed to parse config: %v", err)
+			}
+
+			err = c.Validate()
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("Expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestRateLimitPeriods(t *testing.T) {
+	// any Go duration is a valid period, not only 1s/1m/1h
+	for _, period := range []string{"50ms", "5m", "90s", "1h30m", "24h"} {
+		c, err := Parse([]byte(strings.Replace(testConfig, "period: 1m", "period: "+period, 1)))
+		if err != nil {
+			t.Fatalf("Failed to parse config: %v", err)
+		}
+		if err := c.Validate(); err != nil {
+			t.Errorf("Period %s rejected: %v", period, err)
+		}
+	}
+}
+
+func TestRateLimitService(t *testing.T) {
+	c, err := Parse([]byte(strings.Replace(testConfig, "api_route: /api/\n",
+		"api_route: /api/\nrate_limit_service: {addr: \"ratelimit-sv:8081\"}\n", 1)))
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Valid config rejected: %v", err)
+	}
+
+	rls := c.RateLimitService
+	if rls.Domain != "api-gateway" || rls.Timeout != 100*time.Millisecond || rls.FailureModeDeny {
+		t.Errorf("Rate limit service defaults not applied: %+v", rls)
+	}
+
+	limits := c.RateLimits()
+	if len(limits) != 1 || limits["UserService/Login"] != c.APIs[0].Methods[0].Auth.RateLimit {
+		t.Errorf("Unexpected rate limits index: %v", limits)
+	}
+
+	c.RateLimitService.Addr = "ratelimit-sv"
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "invalid rate_limit_service") {
+		t.Errorf("Bad rate limit service addr should be rejected, got %v", err)
+	}
+}
+
+func TestDuplicateMethod(t *testing.T) {
+	c, err := Parse([]byte(testConfig + `    methods:
+      - name: Handle
+      - name: Handle
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "FakeService/Handle is already defined") {
+		t.Errorf("Duplicate method should be rejected, got %v", err)
+	}
+}
+
+func TestDownstreamTLS(t *testing.T) {
+	conf := strings.Replace(testConfig, "api_route: /api/\n", `api_route: /api/
+downstream_tls:
+  cert: /etc/envoy/tls/tls.crt
+  key: /etc/envoy/tls/tls.key
+  client_ca: /etc/envoy/tls/ca.crt
+  identities:
+    - san: spiffe://cluster.local/ns/billing/sa/billing
+      service: billing
+      permissions: [reports]
+`, 1)
+	conf = strings.Replace(conf, "policy: no-need\n          need_recaptcha", "policy: mtls\n          permission: reports\n          need_recaptcha", 1)
+
+	c, err := Parse([]byte(conf))
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Valid config rejected: %v", err)
+	}
+
+	if id := c.DownstreamTLS.Identity("spiffe://cluster.local/ns/billing/sa/billing"); id == nil || id.Service != "billing" {
+		t.Errorf("Unexpected identity %+v", id)
+	}
+	if id := c.DownstreamTLS.Identity("spiffe://cluster.local/ns/other/sa/other"); id != nil {
+		t.Errorf("Unknown SAN mapped to %+v", id)
+	}
+
+	testCases := []struct {
+		name string
+		tls  DownstreamTLS
+		err  string
+	}{
+		{"no key", DownstreamTLS{Cert: "tls.crt"}, "cert and key are required"},
+		{"required without ca", DownstreamTLS{Cert: "tls.crt", Key: "tls.key", RequireClientCert: true}, "need client_ca"},
+		{"empty service", DownstreamTLS{Cert: "tls.crt", Key: "tls.key", ClientCA: "ca.crt", Identities: []ServiceIdentity{{SAN: "a"}}}, "needs san and service"},
+		{"duplicate san", DownstreamTLS{Cert: "tls.crt", Key: "tls.key", ClientCA: "ca.crt", Identities: []ServiceIdentity{{SAN: "a", Service: "a"}, {SAN: "a", Service: "b"}}}, "a is defined twice"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.tls.Validate(); err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("Expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,5 @@
+module gitlab.com/gitops-poc-dzha/shared/base/apiconf
+
+go 1.23
+
+require gopkg.in/yaml.v3 v3.0.1
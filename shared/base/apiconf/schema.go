@@ -0,0 +1,108 @@
+package apiconf
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SchemaID is the $id of the exported JSON Schema
+const SchemaID = "https://gitlab.com/gitops-poc-dzha/shared/base/apiconf/-/raw/main/config.schema.json"
+
+// durationPattern matches the time.ParseDuration format used for periods and delays
+const durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// JSONSchema returns the JSON Schema (draft-07) of config.yaml for editor autocompletion.
+// It is derived from the Config struct and its yaml, desc, enum, default and required tags,
+// so a new field shows up in the schema as soon as it is added to the struct.
+func JSONSchema() ([]byte, error) {
+	s := typeSchema(reflect.TypeOf(Config{}))
+	s["$schema"] = "http://json-schema.org/draft-07/schema#"
+	s["$id"] = SchemaID
+	s["title"] = "api-gateway config.yaml"
+
+	out, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(out, '\n'), nil
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == durationType {
+		return map[string]interface{}{"type": "string", "pattern": durationPattern}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	default:
+		panic("apiconf: no JSON Schema mapping for " + t.String())
+	}
+}
+
+func structSchema(t reflect.Type) map[string]interface{} {
+	props := make(map[string]interface{})
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		p := typeSchema(f.Type)
+		if desc := f.Tag.Get("desc"); desc != "" {
+			p["description"] = desc
+		}
+		if enum := f.Tag.Get("enum"); enum != "" {
+			p["enum"] = strings.Split(enum, ",")
+		}
+		if def, ok := f.Tag.Lookup("default"); ok {
+			p["default"] = defaultValue(p["type"], def)
+		}
+		if f.Tag.Get("required") == "true" {
+			required = append(required, name)
+		}
+
+		props[name] = p
+	}
+
+	s := map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+
+	return s
+}
+
+func defaultValue(typ interface{}, def string) interface{} {
+	if typ == "integer" {
+		if n, err := strconv.Atoi(def); err == nil {
+			return n
+		}
+	}
+	return def
+}
@@ -0,0 +1,74 @@
+package apiconf
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+)
+
+var updateSchema = flag.Bool("update", false, "rewrite config.schema.json")
+
+// config.schema.json is committed for editors; it must match the Config struct
+func TestJSONSchemaUpToDate(t *testing.T) {
+	schema, err := JSONSchema()
+	if err != nil {
+		t.Fatalf("Failed to build schema: %v", err)
+	}
+
+	if *updateSchema {
+		if err := os.WriteFile("config.schema.json", schema, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	committed, err := os.ReadFile("config.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(committed, schema) {
+		t.Error("config.schema.json is outdated, run: go test -run TestJSONSchemaUpToDate -update")
+	}
+}
+
+func TestJSONSchemaContent(t *testing.T) {
+	schema, err := JSONSchema()
+	if err != nil {
+		t.Fatalf("Failed to build schema: %v", err)
+	}
+
+	var s struct {
+		Properties map[string]struct {
+			Items struct {
+				Properties map[string]struct {
+					Properties map[string]struct {
+						Enum    []string    `json:"enum"`
+						Default interface{} `json:"default"`
+					} `json:"properties"`
+				} `json:"properties"`
+			} `json:"items"`
+		} `json:"properties"`
+		Required []string `json:"required"`
+	}
+	if err := json.Unmarshal(schema, &s); err != nil {
+		t.Fatalf("Schema is not valid JSON: %v", err)
+	}
+
+	if len(s.Required) != 1 || s.Required[0] != "api_route" {
+		t.Errorf("Expected api_route to be required, got %v", s.Required)
+	}
+
+	auth := s.Properties["apis"].Items.Properties["auth"].Properties
+	if _, ok := auth["need_recaptcha"]; !ok {
+		t.Error("Schema is missing auth.need_recaptcha")
+	}
+	if enum := auth["policy"].Enum; len(enum) != 5 {
+		t.Errorf("Expected 5 auth policies, got %v", enum)
+	}
+
+	hc := s.Properties["clusters"].Items.Properties["health_check"].Properties
+	if hc["interval_seconds"].Default != float64(30) {
+		t.Errorf("Expected interval_seconds default 30, got %v", hc["interval_seconds"].Default)
+	}
+}
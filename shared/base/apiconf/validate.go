@@ -0,0 +1,205 @@
+package apiconf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (c *Config) Validate() error {
+	clusters := make(map[string]string)
+	apis := make(map[string]string)
+	methods := make(map[string]bool)
+
+	if len(c.APIRoute) == 0 || c.APIRoute[0] != '/' {
+		return fmt.Errorf("invalid api_route")
+	}
+
+	if c.RateLimitService != nil {
+		if err := c.RateLimitService.Validate(); err != nil {
+			return fmt.Errorf("invalid rate_limit_service: %s", err)
+		}
+	}
+
+	if c.DownstreamTLS != nil {
+		if err := c.DownstreamTLS.Validate(); err != nil {
+			return fmt.Errorf("invalid downstream_tls: %s", err)
+		}
+	}
+
+	for _, cl := range c.Clusters {
+		if _, ok := clusters[cl.Name]; ok {
+			return fmt.Errorf("cluster %s is defined twice", cl.Name)
+		}
+		clusters[cl.Name] = cl.Addr
+		if err := cl.Validate(); err != nil {
+			return fmt.Errorf("invalid cluster %s definition: %s", cl.Name, err)
+		}
+	}
+
+	for _, api := range c.APIs {
+		if api.Name == "" {
+			return fmt.Errorf("API name cannot be empty")
+		}
+		if _, ok := apis[api.Name]; ok {
+			return fmt.Errorf("API %s is defined twice", api.Name)
+		}
+		if _, ok := clusters[api.Cluster]; !ok {
+			return fmt.Errorf("cluster %s for API %s is not defined", api.Cluster, api.Name)
+		}
+		apis[api.Name] = api.Cluster
+
+		if api.Auth != nil {
+			if err := c.validateAuth(api.Auth); err != nil {
+				return fmt.Errorf("invalid auth for API %s: %s", api.Name, err)
+			}
+		}
+
+		for _, m := range api.Methods {
+			if m.Name == "" {
+				return fmt.Errorf("method name cannot be empty in API %s", api.Name)
+			}
+			fullMethod := fmt.Sprintf("%s/%s", api.Name, m.Name)
+			if _, ok := methods[fullMethod]; ok {
+				return fmt.Errorf("method %s is already defined", fullMethod)
+			}
+			methods[fullMethod] = true
+
+			if m.Auth != nil {
+				if err := c.validateAuth(m.Auth); err != nil {
+					return fmt.Errorf("invalid auth for method %s: %s", fullMethod, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateAuth also checks what the auth needs from the rest of the config
+func (c *Config) validateAuth(a *Auth) error {
+	if err := a.Validate(); err != nil {
+		return err
+	}
+
+	if a.MTLS() && !c.DownstreamTLS.ClientCerts() {
+		return fmt.Errorf("%s policy needs downstream_tls with client_ca", PolicyMTLS)
+	}
+
+	return nil
+}
+
+func (a *Auth) Validate() error {
+	switch a.Policy {
+	case PolicyRequired, PolicyOptional, PolicyNoNeed, PolicyAPIKey, PolicyMTLS:
+		// Policy is valid, continue validation
+	default:
+		return fmt.Errorf("unknown auth policy %s", a.Policy)
+	}
+
+	if a.Policy != PolicyRequired && a.Policy != PolicyAPIKey && a.Policy != PolicyMTLS && a.Restricted() {
+		return fmt.Errorf("permission, all_of, any_of, roles and condition need the %s, %s or %s policy", PolicyRequired, PolicyAPIKey, PolicyMTLS)
+	}
+	if a.Policy == PolicyAPIKey && len(a.Roles) > 0 {
+		return fmt.Errorf("roles need the %s policy, API keys have scopes only", PolicyRequired)
+	}
+	if a.Policy == PolicyMTLS && len(a.Roles) > 0 {
+		return fmt.Errorf("roles need the %s policy, services have permissions only", PolicyRequired)
+	}
+
+	if a.RateLimit != nil {
+		if err := a.RateLimit.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const minRateLimitPeriod = 50 * time.Millisecond
+
+func (r *RateLimit) Validate() error {
+	if r.Count <= 0 {
+		return fmt.Errorf("rate limit count must be positive")
+	}
+	if r.Period == 0 {
+		return fmt.Errorf("rate limit period cannot be empty")
+	}
+	// Envoy rejects token bucket fill intervals below 50ms
+	if r.Period < minRateLimitPeriod {
+		return fmt.Errorf("rate limit period %s is shorter than %s", r.Period, minRateLimitPeriod)
+	}
+	if r.Burst < r.Count {
+		return fmt.Errorf("rate limit burst %d cannot be lower than count %d", r.Burst, r.Count)
+	}
+
+	switch r.Key {
+	case RateLimitKeyIP, RateLimitKeyUserID, RateLimitKeyAPIKey, RateLimitKeyRoute:
+	default:
+		return fmt.Errorf("unknown rate limit key %s", r.Key)
+	}
+
+	if r.Delay < 0 {
+		return fmt.Errorf("rate limit delay cannot be negative")
+	}
+
+	return nil
+}
+
+func (t *DownstreamTLS) Validate() error {
+	if t.Cert == "" || t.Key == "" {
+		return fmt.Errorf("cert and key are required")
+	}
+	if t.ClientCA == "" && (t.RequireClientCert || len(t.Identities) > 0) {
+		return fmt.Errorf("client certificates need client_ca")
+	}
+
+	sans := make(map[string]bool)
+	for _, id := range t.Identities {
+		if id.SAN == "" || id.Service == "" {
+			return fmt.Errorf("identity needs san and service")
+		}
+		if sans[id.SAN] {
+			return fmt.Errorf("identity %s is defined twice", id.SAN)
+		}
+		sans[id.SAN] = true
+	}
+
+	return nil
+}
+
+func (r *RateLimitService) Validate() error {
+	return validateAddr(r.Addr)
+}
+
+func (c Cluster) Validate() error {
+	if err := validateAddr(c.Addr); err != nil {
+		return err
+	}
+
+	// Validate cluster type
+	if c.Type != "" && c.Type != ClusterGRPC && c.Type != ClusterHTTP {
+		return fmt.Errorf("invalid cluster type %s, must be 'grpc' or 'http'", c.Type)
+	}
+
+	// Validate health check
+	if c.HealthCheck != nil && c.HealthCheck.Path == "" {
+		return fmt.Errorf("health check path cannot be empty")
+	}
+
+	return nil
+}
+
+func validateAddr(addr string) error {
+	parts := strings.Split(addr, ":")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid address %s", addr)
+	}
+	_, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return fmt.Errorf("invalid port number %s", parts[1])
+	}
+
+	return nil
+}
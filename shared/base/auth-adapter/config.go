@@ -1,119 +1,84 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"io/ioutil"
-	"time"
+	"os"
 
-	"gopkg.in/yaml.v2"
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
 )
 
-const (
-	// auth policies
-	apRequired = "required"
-	apOptional = "optional"
-	apNoNeed   = "no-need"
-)
-
-type rateLimitConf struct {
-	Period time.Duration `yaml:"period"`
-	Count  int           `yaml:"count"`
-	Delay  time.Duration `yaml:"delay"`
-}
-
-type authConf struct {
-	Policy     string         `yaml:"policy"`
-	Permission string         `yaml:"permission"`
-	ReCaptcha  bool           `yaml:"need_recaptcha"`
-	RateLimit  *rateLimitConf `yaml:"rate_limit"`
-}
-
-func (c authConf) NoNeed() bool {
-	return c.Policy == apNoNeed
-}
-
-func (c authConf) Optional() bool {
-	return c.Policy == apOptional
-}
-
-func (c authConf) Required() bool {
-	return c.Policy == apRequired
-}
+// APIConf is the api-gateway config.yaml with the auth of every API and method indexed by path
+type APIConf struct {
+	*apiconf.Config
 
-func (c authConf) NeedReCaptcha() bool {
-	return c.ReCaptcha
+	methodsIndex map[string]*apiconf.Auth
+	// compiled rules of the required, api-key and mtls auths
+	policies map[*apiconf.Auth]*methodPolicy
+	// checksum of the file content, tells whether a reload brings anything new
+	checksum string
 }
 
-func (c authConf) Valid() bool {
-	switch c.Policy {
-	case apRequired, apOptional, apNoNeed:
-		return true
-	default:
-		return false
+func LoadConfig(file string) (*APIConf, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
 	}
-}
 
-type APIConf struct {
-	APIsDescr []struct {
-		Name    string    `yaml:"name"`
-		Auth    *authConf `yaml:"auth"`
-		Methods []struct {
-			Name string    `yaml:"name"`
-			Auth *authConf `yaml:"auth"`
-		} `yaml:"methods"`
-	} `yaml:"apis"`
-
-	methodsIndex map[string]*authConf
+	return ParseConfig(data)
 }
 
-func LoadConfig(file string) (*APIConf, error) {
-	c := &APIConf{}
-
-	data, err := ioutil.ReadFile(file)
+// ParseConfig decodes and validates config.yaml content
+func ParseConfig(data []byte) (*APIConf, error) {
+	cfg, err := apiconf.Parse(data)
 	if err != nil {
 		return nil, err
 	}
 
-	err = yaml.Unmarshal(data, c)
-	if err != nil {
+	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
 
-	mi := make(map[string]*authConf)
-	for _, api := range c.APIsDescr {
+	mi := make(map[string]*apiconf.Auth)
+	for _, api := range cfg.APIs {
 		if api.Auth != nil {
-			if !api.Auth.Valid() {
-				return nil, fmt.Errorf("unknown auth policy %s for service %s", api.Auth.Policy, api.Name)
-			}
-
 			mi[api.Name] = api.Auth
 		}
 
 		for _, method := range api.Methods {
-			fullPath := fmt.Sprintf("%s/%s", api.Name, method.Name)
-			if _, ok := mi[fullPath]; ok {
-				return nil, fmt.Errorf("method %s is already configured", fullPath)
-			}
-
 			if method.Auth != nil {
-				if !method.Auth.Valid() {
-					return nil, fmt.Errorf("unknown auth policy %s for method %s", method.Auth.Policy, fullPath)
-				}
-				mi[fullPath] = method.Auth
-
+				mi[fmt.Sprintf("%s/%s", api.Name, method.Name)] = method.Auth
 			}
 		}
 	}
 
-	c.methodsIndex = mi
+	policies := make(map[*apiconf.Auth]*methodPolicy)
+	for name, auth := range mi {
+		if !auth.Required() && !auth.APIKey() && !auth.MTLS() {
+			continue
+		}
+		p, err := compilePolicy(auth)
+		if err != nil {
+			return nil, fmt.Errorf("invalid auth for %s: %w", name, err)
+		}
+		policies[auth] = p
+	}
 
-	return c, nil
+	sum := sha256.Sum256(data)
+
+	return &APIConf{Config: cfg, methodsIndex: mi, policies: policies, checksum: hex.EncodeToString(sum[:])}, nil
 }
 
-func (c *APIConf) GetRequestedPermissions(service, method string) *authConf {
-	if auth, ok := c.methodsIndex[method]; ok {
+func (c *APIConf) GetRequestedPermissions(service, method string) *apiconf.Auth {
+	if _, auth, ok := lookupMethod(c.methodsIndex, method); ok {
 		return auth
 	}
 
 	return c.methodsIndex[service]
 }
+
+// Policy returns the compiled rules of a required, api-key or mtls auth returned by GetRequestedPermissions
+func (c *APIConf) Policy(auth *apiconf.Auth) *methodPolicy {
+	return c.policies[auth]
+}
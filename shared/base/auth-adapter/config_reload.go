@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/tel-io/tel/v2"
+)
+
+// configReloadDebounce groups the events of a single config update (write, chmod, symlink swap)
+const configReloadDebounce = 100 * time.Millisecond
+
+var (
+	configVersion = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "auth_adapter_config_version",
+		Help: "Version of the config in use: 1 at start, incremented by every applied reload",
+	})
+
+	configReloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_adapter_config_reloads_total",
+		Help: "Config reloads by result: applied, unchanged or rejected",
+	}, []string{"result"})
+)
+
+// ConfigReloader reloads config.yaml when the file changes or on SIGHUP.
+// An invalid config is rejected and the one in use is kept
+type ConfigReloader struct {
+	file   string
+	logger *tel.Telemetry
+	apply  func(*APIConf)
+
+	mx      sync.Mutex
+	current *APIConf
+	version int
+}
+
+func NewConfigReloader(file string, current *APIConf, apply func(*APIConf), logger *tel.Telemetry) *ConfigReloader {
+	configVersion.Set(1)
+
+	return &ConfigReloader{
+		file:   file,
+		logger: logger,
+		apply:  apply,
+
+		current: current,
+		version: 1,
+	}
+}
+
+// Reload loads the file and applies it unless it is invalid or has not changed
+func (r *ConfigReloader) Reload() error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	cfg, err := LoadConfig(r.file)
+	if err != nil {
+		configReloads.WithLabelValues("rejected").Inc()
+		r.logger.Error("config is rejected, keeping the current one",
+			tel.String("file", r.file), tel.Int("version", r.version), tel.Error(err))
+		return err
+	}
+
+	if cfg.checksum == r.current.checksum {
+		configReloads.WithLabelValues("unchanged").Inc()
+		return nil
+	}
+
+	r.apply(cfg)
+	r.current = cfg
+	r.version++
+
+	configVersion.Set(float64(r.version))
+	configReloads.WithLabelValues("applied").Inc()
+	r.logger.Info("config reloaded",
+		tel.String("file", r.file), tel.Int("version", r.version), tel.String("checksum", cfg.checksum))
+
+	return nil
+}
+
+// Run reloads the config on SIGHUP and on changes in its directory until ctx is done.
+// The directory is watched rather than the file: editors and Kubernetes volumes replace
+// the file, which drops a watch set on the file itself
+func (r *ConfigReloader) Run(ctx context.Context, hup <-chan os.Signal) {
+	var (
+		events <-chan fsnotify.Event
+		errs   <-chan error
+	)
+	if watcher, err := r.watch(); err != nil {
+		r.logger.Error("config is not watched, reload it with SIGHUP",
+			tel.String("file", r.file), tel.Error(err))
+	} else {
+		defer watcher.Close()
+		events, errs = watcher.Events, watcher.Errors
+	}
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.logger.Info("SIGHUP received, reloading config")
+			r.Reload()
+		case _, ok := <-events:
+			if !ok {
+				r.logger.Error("config watcher closed", tel.String("file", r.file))
+				return
+			}
+			debounce = time.After(configReloadDebounce)
+		case <-debounce:
+			debounce = nil
+			r.Reload()
+		case err, ok := <-errs:
+			if !ok {
+				r.logger.Error("config watcher closed", tel.String("file", r.file))
+				return
+			}
+			r.logger.Error("config watch error", tel.Error(err))
+		}
+	}
+}
+
+func (r *ConfigReloader) watch() (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := watcher.Add(filepath.Dir(r.file)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	r.logger.Info("watching config", tel.String("file", r.file))
+
+	return watcher, nil
+}
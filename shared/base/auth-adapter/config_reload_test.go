@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tel-io/tel/v2"
+)
+
+const testConfig = `
+api_route: /api/
+
+clusters:
+  - name: user-service
+    addr: "user-service-sv:8081"
+
+apis:
+  - name: UserService
+    cluster: user-service
+    auth: {policy: required, permission: ADMIN}
+    methods:
+      - name: Login
+        auth:
+          policy: no-need
+          rate_limit: {period: 1h, count: 1, burst: 1, key: ip}
+      - name: Register
+        auth:
+          policy: no-need
+          rate_limit: {period: 1m, count: 1, burst: 1, key: ip}
+`
+
+func writeTestConfig(t *testing.T, file, data string) {
+	t.Helper()
+
+	if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestReloader(t *testing.T) (*ConfigReloader, *server, string) {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestConfig(t, file, testConfig)
+
+	cfg, err := LoadConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := tel.NewNull()
+	s := &server{logger: &logger, rateLimitManager: NewRateLimitManager(cfg, &logger)}
+	s.authCfg.Store(cfg)
+	t.Cleanup(s.rateLimitManager.Stop)
+
+	return NewConfigReloader(file, cfg, s.UpdateConfig, &logger), s, file
+}
+
+func TestConfigReload(t *testing.T) {
+	r, s, file := newTestReloader(t)
+	rlm := s.rateLimitManager
+
+	rlm.Check("1.1.1.1", "UserService/Login")
+	rlm.Check("1.1.1.1", "UserService/Register")
+
+	// Register limit changes, Login one stays
+	writeTestConfig(t, file, strings.Replace(testConfig, "period: 1m", "period: 1h", 1)+`
+  - name: FakeService
+    cluster: user-service
+    auth: {policy: no-need}
+`)
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if r.version != 2 {
+		t.Errorf("Expected config version 2, got %d", r.version)
+	}
+
+	if s.authCfg.Load().GetRequestedPermissions("FakeService", "FakeService/Handle") == nil {
+		t.Error("New API should be known after reload")
+	}
+	if rlm.Check("1.1.1.1", "UserService/Login").Allowed {
+		t.Error("Counter of the unchanged limit should be kept")
+	}
+	if !rlm.Check("1.1.1.1", "UserService/Register").Allowed {
+		t.Error("Counter of the changed limit should be dropped")
+	}
+
+	// same content, nothing to apply
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if r.version != 2 {
+		t.Errorf("Unchanged config should keep version 2, got %d", r.version)
+	}
+}
+
+func TestConfigReloadRejectsInvalid(t *testing.T) {
+	r, s, file := newTestReloader(t)
+	cfg := s.authCfg.Load()
+
+	for _, data := range []string{
+		"api_route: [",
+		strings.Replace(testConfig, "cluster: user-service", "cluster: unknown", 1),
+		strings.Replace(testConfig, "count: 1", "count: 0", 1),
+	} {
+		writeTestConfig(t, file, data)
+		if err := r.Reload(); err == nil {
+			t.Errorf("Expected config to be rejected:\n%s", data)
+		}
+	}
+
+	if s.authCfg.Load() != cfg || r.version != 1 {
+		t.Error("Rejected config should not replace the current one")
+	}
+	if s.rateLimitManager.Key("UserService/Login") == "" {
+		t.Error("Rate limits of the current config should be kept")
+	}
+}
+
+func TestConfigReloadOnFileChange(t *testing.T) {
+	r, s, file := newTestReloader(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx, nil)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// let the watch start, then replace the file the way editors and Kubernetes volumes do
+	time.Sleep(50 * time.Millisecond)
+	tmp := file + ".tmp"
+	writeTestConfig(t, tmp, strings.Replace(testConfig, "  - name: Register", "  - name: SignUp", 1))
+	if err := os.Rename(tmp, file); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for s.rateLimitManager.Key("UserService/SignUp") == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("Config was not reloaded after the file change")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
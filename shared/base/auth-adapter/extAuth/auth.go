@@ -8,15 +8,28 @@ import (
 type AuthSessionServiceClient interface {
 	ValidateSession(ctx context.Context, req *ValidateSessionRequest, opt ...grpc.CallOption) (
 		*ValidateSessionResponse, error)
+	ValidateApiKey(ctx context.Context, req *ValidateApiKeyRequest, opt ...grpc.CallOption) (
+		*ValidateApiKeyResponse, error)
 }
 type ValidateSessionRequest struct {
 	SessionToken string
 }
 
 type ValidateSessionResponse struct {
-	UserId    string
-	SessionId string
-	Roles     []*Role
+	UserId      string
+	SessionId   string
+	Roles       []*Role
+	Permissions []*Permission // of all roles plus the ones granted to the user
+}
+
+type ValidateApiKeyRequest struct {
+	ApiKey string
+}
+
+type ValidateApiKeyResponse struct {
+	ClientId string
+	KeyId    string
+	Scopes   []*Permission // permission names
 }
 
 type Role struct {
@@ -40,9 +40,36 @@ func (c *grpcClient) ValidateSession(ctx context.Context, req *ValidateSessionRe
 		roles = append(roles, &Role{Name: r.Name, Permissions: perms})
 	}
 
+	permissions := make([]*Permission, 0, len(resp.Permissions))
+	for _, p := range resp.Permissions {
+		permissions = append(permissions, &Permission{Name: p.Name})
+	}
+
 	return &ValidateSessionResponse{
-		UserId:    resp.UserId,
-		SessionId: resp.SessionId,
-		Roles:     roles,
+		UserId:      resp.UserId,
+		SessionId:   resp.SessionId,
+		Roles:       roles,
+		Permissions: permissions,
+	}, nil
+}
+
+// ValidateApiKey validates a machine client API key by calling user-service
+func (c *grpcClient) ValidateApiKey(ctx context.Context, req *ValidateApiKeyRequest, opts ...grpc.CallOption) (*ValidateApiKeyResponse, error) {
+	resp, err := c.client.ValidateApiKey(ctx, &userv1.ValidateApiKeyRequest{
+		ApiKey: req.ApiKey,
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := make([]*Permission, 0, len(resp.Scopes))
+	for _, p := range resp.Scopes {
+		scopes = append(scopes, &Permission{Name: p.Name})
+	}
+
+	return &ValidateApiKeyResponse{
+		ClientId: resp.ClientId,
+		KeyId:    resp.KeyId,
+		Scopes:   scopes,
 	}, nil
 }
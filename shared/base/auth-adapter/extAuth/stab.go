@@ -54,5 +54,22 @@ func (s stab) ValidateSession(ctx context.Context, req *ValidateSessionRequest,
 				},
 			},
 		},
+		Permissions: []*Permission{
+			{Name: "read"},
+			{Name: "write"},
+		},
+	}, nil
+}
+
+// ValidateApiKey - demo stub, the only valid key is "demo-api-key"
+func (s stab) ValidateApiKey(ctx context.Context, req *ValidateApiKeyRequest, opt ...grpc.CallOption) (*ValidateApiKeyResponse, error) {
+	if req.ApiKey != "demo-api-key" {
+		return nil, errors.New("invalid api key")
+	}
+
+	return &ValidateApiKeyResponse{
+		ClientId: "demo-client",
+		KeyId:    "key-789",
+		Scopes:   []*Permission{{Name: "read"}},
 	}, nil
 }
@@ -2,21 +2,26 @@ module envoy.auth
 
 require (
 	github.com/envoyproxy/go-control-plane v0.13.0
+	github.com/fsnotify/fsnotify v1.8.0
+	github.com/golang-jwt/jwt/v5 v5.2.1
 	github.com/golang/protobuf v1.5.4
+	github.com/google/cel-go v0.23.2
 	github.com/grpc-ecosystem/go-grpc-prometheus v1.2.0
 	github.com/prometheus/client_golang v1.20.5
 	github.com/tel-io/instrumentation/middleware/grpc v1.1.2
 	github.com/tel-io/tel/v2 v2.2.4
 	gitlab.com/gitops-poc-dzha/api/gen/user-service/go v1.0.0
+	gitlab.com/gitops-poc-dzha/shared/base/apiconf v0.0.0-00010101000000-000000000000
 	go.opentelemetry.io/otel v1.11.2-0.20221111171059-308d0362e6c5
 	golang.org/x/net v0.32.0
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20241209162323-e6fa225c2576
 	google.golang.org/grpc v1.68.1
-	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
+	cel.dev/expr v0.19.1 // indirect
 	cloud.google.com/go/compute/metadata v0.5.0 // indirect
+	github.com/antlr4-go/antlr/v4 v4.13.0 // indirect
 	github.com/benbjohnson/clock v1.3.0 // indirect
 	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/cenkalti/backoff/v4 v4.1.3 // indirect
@@ -38,6 +43,7 @@ require (
 	github.com/prometheus/common v0.55.0 // indirect
 	github.com/prometheus/procfs v0.15.1 // indirect
 	github.com/shirou/gopsutil/v3 v3.22.9 // indirect
+	github.com/stoewer/go-strcase v1.2.0 // indirect
 	github.com/tel-io/otelgrpc v1.0.2-0.20220605174232-2f9b4153a0a4 // indirect
 	github.com/tklauser/go-sysconf v0.3.10 // indirect
 	github.com/tklauser/numcpus v0.4.0 // indirect
@@ -58,10 +64,19 @@ require (
 	go.uber.org/atomic v1.7.0 // indirect
 	go.uber.org/multierr v1.6.0 // indirect
 	go.uber.org/zap v1.21.0 // indirect
+	golang.org/x/exp v0.0.0-20230515195305-f3d0a9c9a5cc // indirect
 	golang.org/x/sys v0.28.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20240903143218-8af14fe29dc1 // indirect
-	google.golang.org/protobuf v1.35.2 // indirect
+	google.golang.org/protobuf v1.36.9 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
-go 1.23
+go 1.24.0
+
+// config schema shared with api-gateway-image, built from this checkout
+replace gitlab.com/gitops-poc-dzha/shared/base/apiconf => ../apiconf
+
+// Generated code of api/proto/user-service in this tree, drop once the proto-gen pipeline
+// publishes a version with the same RPCs
+replace gitlab.com/gitops-poc-dzha/api/gen/user-service/go => ../../../api/gen/user-service/go
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tel-io/tel/v2"
+)
+
+const (
+	jwksFetchTimeout = 5 * time.Second
+	// jwksMinRefreshInterval limits refreshes caused by tokens with an unknown kid,
+	// a client sending made up kids must not turn into a request per token to the issuer
+	jwksMinRefreshInterval = 30 * time.Second
+)
+
+var errUnknownKey = errors.New("unknown signing key")
+
+// KeySet is the JWKS the token issuer publishes its public keys with. It is refreshed
+// periodically and when a token is signed with a key it does not know yet (keys are rotated)
+type KeySet struct {
+	url    string
+	client *http.Client
+	logger *tel.Telemetry
+
+	mx   sync.RWMutex
+	keys map[string]publicKey
+
+	// fetchMx serializes refreshes, fetchedAt is guarded by it
+	fetchMx   sync.Mutex
+	fetchedAt time.Time
+
+	now  func() time.Time
+	stop chan struct{}
+}
+
+type publicKey struct {
+	// alg the key is restricted to, empty if any algorithm of its type is allowed
+	alg string
+	key crypto.PublicKey
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// NewKeySet fetches the keys and keeps them up to date until Stop. A failed first fetch
+// is not fatal: tokens are rejected until a refresh succeeds
+func NewKeySet(url string, refreshInterval time.Duration, logger *tel.Telemetry) *KeySet {
+	ks := &KeySet{
+		url:    url,
+		client: &http.Client{Timeout: jwksFetchTimeout},
+		logger: logger,
+		keys:   make(map[string]publicKey),
+		now:    time.Now,
+		stop:   make(chan struct{}),
+	}
+
+	if err := ks.Refresh(context.Background()); err != nil {
+		logger.Error("failed to fetch JWKS", tel.String("url", url), tel.Error(err))
+	}
+
+	go ks.refreshLoop(refreshInterval)
+
+	return ks
+}
+
+// Key returns the public key to verify a token signed with alg by the kid key
+func (ks *KeySet) Key(ctx context.Context, kid, alg string) (crypto.PublicKey, error) {
+	key, ok := ks.lookup(kid)
+	if !ok {
+		// may be a key rotated in after the last refresh
+		if err := ks.refreshIfStale(ctx); err != nil {
+			ks.logger.Error("failed to refresh JWKS", tel.String("url", ks.url), tel.Error(err))
+		}
+
+		if key, ok = ks.lookup(kid); !ok {
+			return nil, errUnknownKey
+		}
+	}
+
+	if key.alg != "" && key.alg != alg {
+		return nil, fmt.Errorf("key %s is not for %s", kid, alg)
+	}
+
+	return key.key, nil
+}
+
+func (ks *KeySet) lookup(kid string) (publicKey, bool) {
+	ks.mx.RLock()
+	defer ks.mx.RUnlock()
+
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// Refresh replaces the keys with the ones published now
+func (ks *KeySet) Refresh(ctx context.Context) error {
+	ks.fetchMx.Lock()
+	defer ks.fetchMx.Unlock()
+
+	return ks.fetch(ctx)
+}
+
+func (ks *KeySet) refreshIfStale(ctx context.Context) error {
+	ks.fetchMx.Lock()
+	defer ks.fetchMx.Unlock()
+
+	// refreshed meanwhile by another request or too recently to expect new keys
+	if ks.now().Sub(ks.fetchedAt) < jwksMinRefreshInterval {
+		return nil
+	}
+
+	return ks.fetch(ctx)
+}
+
+func (ks *KeySet) fetch(ctx context.Context) error {
+	// a failed attempt counts too, the issuer is not hammered while it is down
+	ks.fetchedAt = ks.now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]publicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			// one bad key must not take down the others
+			ks.logger.Warn("skip JWKS key", tel.String("kid", jwk.Kid), tel.Error(err))
+			continue
+		}
+		keys[jwk.Kid] = publicKey{alg: jwk.Alg, key: key}
+	}
+
+	ks.mx.Lock()
+	ks.keys = keys
+	ks.mx.Unlock()
+
+	ks.logger.Debug("JWKS refreshed", tel.String("url", ks.url), tel.Int("keys", len(keys)))
+
+	return nil
+}
+
+// Stop stops the background refresh
+func (ks *KeySet) Stop() {
+	close(ks.stop)
+}
+
+func (ks *KeySet) refreshLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := ks.Refresh(context.Background()); err != nil {
+				ks.logger.Error("failed to refresh JWKS", tel.String("url", ks.url), tel.Error(err))
+			}
+		case <-ks.stop:
+			return
+		}
+	}
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty key parameter")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	grpcprometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -18,6 +20,8 @@ import (
 	envoy_service_auth_v3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
 )
 
+const configFile = "/opt/auth-adapter/config.yaml"
+
 func parseRCConf() *RCConf {
 	rcConf := &RCConf{}
 
@@ -29,6 +33,25 @@ func parseRCConf() *RCConf {
 	return rcConf
 }
 
+// parseJWTConf enables local token verification with JWT_SECRET (HS256) and/or JWKS_URL
+func parseJWTConf() (*JWTConf, error) {
+	jwtConf := &JWTConf{
+		Secret:  os.Getenv("JWT_SECRET"),
+		JWKSURL: os.Getenv("JWKS_URL"),
+		Issuer:  getEnvVar("JWT_ISSUER", "user-service"),
+	}
+
+	var err error
+	if jwtConf.JWKSRefreshInterval, err = time.ParseDuration(getEnvVar("JWKS_REFRESH_INTERVAL", "5m")); err != nil {
+		return nil, fmt.Errorf("invalid JWKS_REFRESH_INTERVAL: %w", err)
+	}
+	if jwtConf.SessionCacheTTL, err = time.ParseDuration(getEnvVar("SESSION_CACHE_TTL", "30s")); err != nil {
+		return nil, fmt.Errorf("invalid SESSION_CACHE_TTL: %w", err)
+	}
+
+	return jwtConf, nil
+}
+
 func main() {
 	logg, closer := tel.New(context.Background(), tel.GetConfigFromEnv())
 	defer closer()
@@ -39,12 +62,37 @@ func main() {
 
 	signal.Notify(sigs, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
 	// load auth config
-	authCfg, err := LoadConfig("/opt/auth-adapter/config.yaml")
+	authCfg, err := LoadConfig(configFile)
+	if err != nil {
+		panic(err)
+	}
+
+	jwtConf, err := parseJWTConf()
 	if err != nil {
 		panic(err)
 	}
 
+	tokenSources, err := parseTokenSources(getEnvVar("TOKEN_SOURCES", "cookie,bearer"))
+	if err != nil {
+		panic(fmt.Errorf("invalid TOKEN_SOURCES: %w", err))
+	}
+
+	s, err := NewServer(&logg, os.Getenv("AUTH_SERVICE_ADDR"), authCfg, parseRCConf(), jwtConf, tokenSources)
+	if err != nil {
+		panic(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// config changes are applied without restart, an invalid config keeps the current one
+	reloader := NewConfigReloader(configFile, authCfg, s.UpdateConfig, &logg)
+	go reloader.Run(ctx, hup)
+
 	grpcServer := grpc.NewServer(
 		grpc.ChainUnaryInterceptor(
 			grpcprometheus.UnaryServerInterceptor,
@@ -69,11 +117,6 @@ func main() {
 			grpclog.Fatalf("failed to listen: %v", err)
 		}
 
-		s, err := NewServer(&logg, os.Getenv("AUTH_SERVICE_ADDR"), authCfg, parseRCConf())
-		if err != nil {
-			panic(err)
-		}
-
 		envoy_service_auth_v3.RegisterAuthorizationServer(grpcServer, s)
 
 		// Register gRPC metrics
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+
+	"envoy.auth/extAuth"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
+)
+
+// methodPolicy is the compiled auth of a method with the required, api-key or mtls policy.
+// A session passes when it has all of allOf, one of anyOf, one of roles
+// and the condition evaluates to true, an empty rule is not checked
+type methodPolicy struct {
+	allOf     []string
+	anyOf     []string
+	roles     []string
+	condition cel.Program
+}
+
+// policyRequest is the part of the request conditions can see
+type policyRequest struct {
+	// Method is "service/method" as in config.yaml
+	Method string
+	// Path is the full request path with the query
+	Path    string
+	Headers map[string]string
+	// ClientID is the API key client, empty for sessions
+	ClientID string
+	// Service is the client certificate service of the mtls policy
+	Service string
+}
+
+// policyEnv declares the variables of the conditions:
+//
+//	request.method    string               "service/method"
+//	request.path      string               path without the query
+//	request.segments  list(string)         path segments after the method
+//	request.query     map(string, string)  first value of every query parameter
+//	request.headers   map(string, string)  request headers, lower case
+//	request.client_id string               API key client, empty for sessions
+//	request.service   string               client certificate service, mtls policy only
+//	session.user_id, session.session_id    string
+//	session.roles, session.permissions     list(string)
+var policyEnv = sync.OnceValues(func() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("session", cel.MapType(cel.StringType, cel.DynType)),
+	)
+})
+
+// compilePolicy compiles the rules of an auth, the condition must be a boolean expression
+func compilePolicy(auth *apiconf.Auth) (*methodPolicy, error) {
+	p := &methodPolicy{
+		allOf: auth.AllOf,
+		anyOf: auth.AnyOf,
+		roles: auth.Roles,
+	}
+	if auth.Permission != "" {
+		p.allOf = append([]string{auth.Permission}, auth.AllOf...)
+	}
+
+	if auth.Condition == "" {
+		return p, nil
+	}
+
+	env, err := policyEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	ast, issues := env.Compile(auth.Condition)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("condition %q: %w", auth.Condition, issues.Err())
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, fmt.Errorf("condition %q is %s, not bool", auth.Condition, ast.OutputType())
+	}
+
+	p.condition, err = env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("condition %q: %w", auth.Condition, err)
+	}
+
+	return p, nil
+}
+
+// Allow checks the session against the policy, reason tells why it is denied
+func (p *methodPolicy) Allow(req *policyRequest, session *extAuth.ValidateSessionResponse) (allowed bool, reason string) {
+	for _, perm := range p.allOf {
+		if !authorize(perm, session) {
+			return false, "missing permission " + perm
+		}
+	}
+
+	if len(p.anyOf) > 0 && !anyOf(p.anyOf, func(perm string) bool { return authorize(perm, session) }) {
+		return false, "none of permissions " + strings.Join(p.anyOf, ", ")
+	}
+
+	if len(p.roles) > 0 && !anyOf(p.roles, func(role string) bool { return hasRole(session, role) }) {
+		return false, "none of roles " + strings.Join(p.roles, ", ")
+	}
+
+	if p.condition == nil {
+		return true, ""
+	}
+
+	out, _, err := p.condition.Eval(map[string]interface{}{
+		"request": req.activation(),
+		"session": sessionActivation(session),
+	})
+	if err != nil {
+		// a missing header or segment fails the condition
+		return false, "condition: " + err.Error()
+	}
+	if ok, _ := out.Value().(bool); !ok {
+		return false, "condition is false"
+	}
+
+	return true, ""
+}
+
+func (r *policyRequest) activation() map[string]interface{} {
+	path, rawQuery, _ := strings.Cut(r.Path, "?")
+
+	query := make(map[string]string)
+	if values, err := url.ParseQuery(rawQuery); err == nil {
+		for k, v := range values {
+			query[k] = v[0]
+		}
+	}
+
+	// /api/{service}/{method}/{segments...}
+	segments := []string{}
+	parts := strings.Split(path, "/")
+	if len(parts) > 4 {
+		for _, s := range parts[4:] {
+			if s != "" {
+				segments = append(segments, s)
+			}
+		}
+	}
+
+	return map[string]interface{}{
+		"method":    r.Method,
+		"path":      path,
+		"segments":  segments,
+		"query":     query,
+		"headers":   r.Headers,
+		"client_id": r.ClientID,
+		"service":   r.Service,
+	}
+}
+
+func sessionActivation(session *extAuth.ValidateSessionResponse) map[string]interface{} {
+	roles := make([]string, 0, len(session.Roles))
+	for _, r := range session.Roles {
+		roles = append(roles, r.Name)
+	}
+
+	permissions := make([]string, 0, len(session.Permissions))
+	for _, p := range session.Permissions {
+		permissions = append(permissions, p.Name)
+	}
+	if len(permissions) == 0 {
+		// older user-service, only the role permissions
+		for _, r := range session.Roles {
+			for _, p := range r.Permissions {
+				permissions = append(permissions, p.Name)
+			}
+		}
+	}
+
+	return map[string]interface{}{
+		"user_id":     session.UserId,
+		"session_id":  session.SessionId,
+		"roles":       roles,
+		"permissions": permissions,
+	}
+}
+
+func hasRole(session *extAuth.ValidateSessionResponse, role string) bool {
+	for _, r := range session.Roles {
+		if r.Name == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+func anyOf(values []string, match func(string) bool) bool {
+	for _, v := range values {
+		if match(v) {
+			return true
+		}
+	}
+
+	return false
+}
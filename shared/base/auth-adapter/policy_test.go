@@ -0,0 +1,184 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"envoy.auth/extAuth"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
+)
+
+func TestMethodPolicy(t *testing.T) {
+	session := &extAuth.ValidateSessionResponse{
+		UserId:    "user-1",
+		SessionId: "session-1",
+		Roles:     []*extAuth.Role{{Name: "SUPPORT"}},
+		Permissions: []*extAuth.Permission{
+			{Name: "read"}, {Name: "tickets"},
+		},
+	}
+	req := &policyRequest{
+		Method:  "wallet/users",
+		Path:    "/api/wallet/users/user-1/balance?currency=EUR",
+		Headers: map[string]string{"x-tenant": "acme"},
+	}
+
+	tests := []struct {
+		name   string
+		auth   apiconf.Auth
+		allow  bool
+		reason string
+	}{
+		{
+			name:  "no rules",
+			auth:  apiconf.Auth{},
+			allow: true,
+		},
+		{
+			name:  "permission",
+			auth:  apiconf.Auth{Permission: "tickets"},
+			allow: true,
+		},
+		{
+			name:   "missing permission",
+			auth:   apiconf.Auth{Permission: "admin"},
+			reason: "missing permission admin",
+		},
+		{
+			name:  "all of",
+			auth:  apiconf.Auth{AllOf: []string{"read", "tickets"}},
+			allow: true,
+		},
+		{
+			name:   "all of, one missing",
+			auth:   apiconf.Auth{Permission: "read", AllOf: []string{"tickets", "refunds"}},
+			reason: "missing permission refunds",
+		},
+		{
+			name:  "any of",
+			auth:  apiconf.Auth{AnyOf: []string{"admin", "tickets"}},
+			allow: true,
+		},
+		{
+			name:   "any of, none",
+			auth:   apiconf.Auth{AnyOf: []string{"admin", "refunds"}},
+			reason: "none of permissions admin, refunds",
+		},
+		{
+			name:  "role",
+			auth:  apiconf.Auth{Roles: []string{"ADMIN", "SUPPORT"}},
+			allow: true,
+		},
+		{
+			name:   "missing role",
+			auth:   apiconf.Auth{Roles: []string{"ADMIN"}},
+			reason: "none of roles ADMIN",
+		},
+		{
+			name:  "condition on path segment",
+			auth:  apiconf.Auth{Condition: `request.segments[0] == session.user_id`},
+			allow: true,
+		},
+		{
+			name:   "condition on path segment of another user",
+			auth:   apiconf.Auth{Condition: `request.segments[0] == "user-2"`},
+			reason: "condition is false",
+		},
+		{
+			name:  "condition on header and query",
+			auth:  apiconf.Auth{Condition: `request.headers["x-tenant"] == "acme" && request.query.currency == "EUR"`},
+			allow: true,
+		},
+		{
+			name:   "condition on missing header",
+			auth:   apiconf.Auth{Condition: `request.headers["x-user"] == session.user_id`},
+			reason: "condition: no such key",
+		},
+		{
+			name:  "condition checking a header exists",
+			auth:  apiconf.Auth{Condition: `!("x-user" in request.headers) || request.headers["x-user"] == session.user_id`},
+			allow: true,
+		},
+		{
+			name:  "condition on session",
+			auth:  apiconf.Auth{Condition: `"tickets" in session.permissions && request.method.startsWith("wallet/")`},
+			allow: true,
+		},
+		{
+			name:   "rules and condition together",
+			auth:   apiconf.Auth{Roles: []string{"SUPPORT"}, Condition: `size(request.segments) > 2`},
+			reason: "condition is false",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := compilePolicy(&tt.auth)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			allow, reason := p.Allow(req, session)
+			if allow != tt.allow {
+				t.Fatalf("Allow() = %v (%s), want %v", allow, reason, tt.allow)
+			}
+			if !strings.Contains(reason, tt.reason) {
+				t.Errorf("reason = %q, want %q", reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestMethodPolicyRoleFallback(t *testing.T) {
+	// older user-service without resolved permissions
+	session := &extAuth.ValidateSessionResponse{
+		Roles: []*extAuth.Role{{Name: "CLIENT", Permissions: []*extAuth.Permission{{Name: "write"}}}},
+	}
+
+	p, err := compilePolicy(&apiconf.Auth{Condition: `"write" in session.permissions`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if allow, reason := p.Allow(&policyRequest{Path: "/api/a/b"}, session); !allow {
+		t.Errorf("role permissions should be used, denied: %s", reason)
+	}
+}
+
+func TestCompilePolicyErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition string
+		err       string
+	}{
+		{"syntax", `request.segments[0] ==`, "Syntax error"},
+		{"not bool", `size(request.segments) + 1`, "not bool"},
+		{"unknown variable", `user == "1"`, "undeclared reference"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compilePolicy(&apiconf.Auth{Condition: tt.condition})
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("compilePolicy(%q) error = %v, want %q", tt.condition, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseConfigRejectsBadCondition(t *testing.T) {
+	conf := `
+api_route: /api/
+clusters:
+  - name: web
+    addr: "web-sv:8080"
+apis:
+  - name: wallet
+    cluster: web
+    auth: {policy: required, condition: "request.segments[0] =="}
+`
+	if _, err := ParseConfig([]byte(conf)); err == nil || !strings.Contains(err.Error(), "invalid auth for wallet") {
+		t.Errorf("Config with a bad condition should be rejected, got %v", err)
+	}
+}
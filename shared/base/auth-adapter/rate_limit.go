@@ -1,102 +1,264 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/tel-io/tel/v2"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
+)
+
+// rateLimitEvictInterval is how often idle clients are dropped from memory
+const rateLimitEvictInterval = time.Minute
+
+var (
+	rateLimitActiveKeys = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "auth_adapter_rate_limit_active_keys",
+		Help: "Clients with rate limit state per method, as of the last eviction run",
+	}, []string{"method"})
+
+	rateLimitEvictedKeys = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "auth_adapter_rate_limit_evicted_keys_total",
+		Help: "Idle clients dropped from the rate limit state",
+	})
 )
 
+// RateLimitManager limits requests per method and client with GCRA (generic cell rate algorithm):
+// requests are spaced by Period/Count, up to Burst of them may come at once. Unlike fixed windows
+// there is no boundary to fire 2*Count requests across, and the state of a client expires as soon
+// as its bucket is full again
 type RateLimitManager struct {
 	logger *tel.Telemetry
-	rlConf map[string]*rateLimitConf
 
-	mx         *sync.Mutex
-	rlProgress map[string]*rateLimitProgress
+	// mx guards the limits too, they are swapped on config reload
+	mx      *sync.Mutex
+	rlConf  map[string]*apiconf.RateLimit
+	clients map[rateLimitKey]*rateLimitState
+
+	now func() time.Time
+	// sleep holds a delayed response, see RateLimitResult.Delay
+	sleep func(ctx context.Context, d time.Duration)
+	stop  chan struct{}
+}
+
+type rateLimitKey struct {
+	method string
+	client string
 }
 
-type rateLimitProgress struct {
-	IPRate    map[string]int
-	PeriodEnd time.Time
+type rateLimitState struct {
+	// theoretical arrival time of the next request, the bucket is full once it has passed
+	tat time.Time
+	// requests denied in a row
+	denied int
 }
 
 func NewRateLimitManager(conf *APIConf, logger *tel.Telemetry) *RateLimitManager {
-	rlConf := make(map[string]*rateLimitConf)
+	rlm := &RateLimitManager{
+		logger: logger,
+		rlConf: rateLimits(conf, logger),
 
-	for _, api := range conf.APIsDescr {
-		for _, method := range api.Methods {
-			fullPath := fmt.Sprintf("%s/%s", api.Name, method.Name)
+		clients: make(map[rateLimitKey]*rateLimitState),
+		mx:      &sync.Mutex{},
+
+		now:   time.Now,
+		sleep: sleep,
+		stop:  make(chan struct{}),
+	}
+
+	go rlm.evictLoop()
+
+	return rlm
+}
+
+// rateLimits are the limits of the config auth-adapter counts itself
+func rateLimits(conf *APIConf, logger *tel.Telemetry) map[string]*apiconf.RateLimit {
+	rlConf := make(map[string]*apiconf.RateLimit)
+
+	if conf.RateLimitService != nil {
+		// limits are counted cluster-wide by the rate limit service Envoy calls after us
+		logger.Info("rate limits are counted by rate limit service",
+			tel.String("addr", conf.RateLimitService.Addr))
+		return rlConf
+	}
 
-			if method.Auth != nil && method.Auth.RateLimit != nil {
-				logger.Info("add rate limit config",
-					tel.String("method", fullPath), tel.Any("limit", method.Auth.RateLimit))
-				rlConf[fullPath] = method.Auth.RateLimit
-			}
+	for method, limit := range conf.RateLimits() {
+		// route keyed limits are a token bucket shared by all clients, Envoy counts them
+		if limit.Key == apiconf.RateLimitKeyRoute {
+			continue
 		}
+
+		logger.Info("add rate limit config",
+			tel.String("method", method), tel.Any("limit", limit))
+		rlConf[method] = limit
 	}
 
-	return &RateLimitManager{
-		logger: logger,
-		rlConf: rlConf,
+	return rlConf
+}
+
+// Update switches to the limits of a reloaded config. Clients keep their state for methods
+// whose limit is unchanged, the state of changed and removed limits is dropped
+func (rlm *RateLimitManager) Update(conf *APIConf) {
+	rlConf := rateLimits(conf, rlm.logger)
+
+	rlm.mx.Lock()
+	defer rlm.mx.Unlock()
+
+	changed := make(map[string]bool)
+	for method, old := range rlm.rlConf {
+		limit, ok := rlConf[method]
+		if !ok {
+			rateLimitActiveKeys.DeleteLabelValues(method)
+		}
+		if !ok || *limit != *old {
+			changed[method] = true
+		}
+	}
 
-		rlProgress: make(map[string]*rateLimitProgress),
-		mx:         &sync.Mutex{},
+	for key := range rlm.clients {
+		if changed[key.method] {
+			delete(rlm.clients, key)
+		}
 	}
+
+	rlm.rlConf = rlConf
 }
 
-func (rlm *RateLimitManager) Check(ip, method string) bool {
-	cfg, ok := rlm.rlConf[method]
+// Key returns what the method limit is counted per, empty if the method is not limited
+func (rlm *RateLimitManager) Key(method string) string {
+	rlm.mx.Lock()
+	defer rlm.mx.Unlock()
+
+	_, cfg, ok := lookupMethod(rlm.rlConf, method)
 	if !ok {
-		//no need rate limit
-		return true
+		return ""
 	}
 
-	rlm.logger.Debug("checking rate limit for method=%s and IP=%s",
-		tel.String("method", method), tel.String("ip", ip))
+	return cfg.Key
+}
+
+// RateLimitResult is the decision on a request
+type RateLimitResult struct {
+	Allowed bool
+	// RetryAfter is the wait until the next request of the client is allowed
+	RetryAfter time.Duration
+	// Delay is the penalty to hold a denied response for, applied by the caller
+	// so that no lock is held while waiting
+	Delay time.Duration
+}
 
+// Check counts a request of the client (IP, user id or API key, see Key) to the method
+// and decides whether it is within the limit
+func (rlm *RateLimitManager) Check(client, method string) RateLimitResult {
 	rlm.mx.Lock()
 	defer rlm.mx.Unlock()
 
-	var progress *rateLimitProgress
+	method, cfg, ok := lookupMethod(rlm.rlConf, method)
+	if !ok {
+		//no need rate limit
+		return RateLimitResult{Allowed: true}
+	}
 
-	now := time.Now()
-	progress, ok = rlm.rlProgress[method]
-	if !ok || now.After(progress.PeriodEnd) {
-		rlm.logger.Debug("create new rate limit progress", tel.String("method", method))
+	rlm.logger.Debug("checking rate limit",
+		tel.String("method", method), tel.String("client", client))
 
-		progress = &rateLimitProgress{
-			IPRate:    make(map[string]int),
-			PeriodEnd: now.Add(cfg.Period),
-		}
+	key := rateLimitKey{method: method, client: client}
+	now := rlm.now()
+	interval := cfg.Period / time.Duration(cfg.Count)
 
-		rlm.rlProgress[method] = progress
+	state, ok := rlm.clients[key]
+	if !ok {
+		state = &rateLimitState{tat: now}
+		rlm.clients[key] = state
+	}
+
+	tat := state.tat
+	if tat.Before(now) {
+		tat = now
 	}
 
-	progress.IPRate[ip] += 1
-	if progress.IPRate[ip] > cfg.Count {
+	newTat := tat.Add(interval)
+	if allowAt := newTat.Add(-interval * time.Duration(cfg.Burst)); allowAt.After(now) {
+		state.denied++
+
 		rlm.logger.Error("rate limit reached",
-			tel.String("method", method), tel.String("ip", ip))
+			tel.String("method", method), tel.String("client", client))
 
-		if cfg.Delay > 0 && progress.IPRate[ip] > cfg.Count+2 {
+		res := RateLimitResult{RetryAfter: allowAt.Sub(now)}
+		if state.denied > 2 {
 			// NOTICE: we should skip first rate limit for faster reCaptcha v2 display and validate
-			time.Sleep(cfg.Delay)
+			res.Delay = cfg.Delay
 		}
 
-		return false
+		return res
 	}
 
-	return true
+	state.tat = newTat
+	state.denied = 0
+
+	return RateLimitResult{Allowed: true}
 }
 
-func (rlm *RateLimitManager) Reset(ip, method string) {
+// Reset forgets the client state of the method, the client gets a full bucket
+// (used once it has passed reCAPTCHA v2)
+func (rlm *RateLimitManager) Reset(client, method string) {
 	rlm.mx.Lock()
 	defer rlm.mx.Unlock()
 
-	progress, ok := rlm.rlProgress[method]
-	if !ok {
-		return
+	delete(rlm.clients, rateLimitKey{method: method, client: client})
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// Stop stops the background eviction
+func (rlm *RateLimitManager) Stop() {
+	close(rlm.stop)
+}
+
+func (rlm *RateLimitManager) evictLoop() {
+	ticker := time.NewTicker(rateLimitEvictInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			rlm.evictIdle()
+		case <-rlm.stop:
+			return
+		}
 	}
+}
+
+// evictIdle drops clients whose bucket is full again, they are in the same state as unknown ones
+func (rlm *RateLimitManager) evictIdle() {
+	rlm.mx.Lock()
+	defer rlm.mx.Unlock()
 
-	delete(progress.IPRate, ip)
+	now := rlm.now()
+	active := make(map[string]int)
+	for key, state := range rlm.clients {
+		if !state.tat.After(now) {
+			delete(rlm.clients, key)
+			rateLimitEvictedKeys.Inc()
+			continue
+		}
+		active[key.method]++
+	}
+
+	for method := range rlm.rlConf {
+		rateLimitActiveKeys.WithLabelValues(method).Set(float64(active[method]))
+	}
 }
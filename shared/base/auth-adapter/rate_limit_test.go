@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tel-io/tel/v2"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
+)
+
+func newTestRateLimitManager(t *testing.T, rl *apiconf.RateLimit) (*RateLimitManager, *time.Time) {
+	t.Helper()
+
+	logger := tel.NewNull()
+	rlm := NewRateLimitManager(&APIConf{Config: &apiconf.Config{APIs: []apiconf.API{{
+		Name:    "UserService",
+		Methods: []apiconf.Method{{Name: "Login", Auth: &apiconf.Auth{Policy: apiconf.PolicyNoNeed, RateLimit: rl}}},
+	}}}}, &logger)
+	t.Cleanup(rlm.Stop)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	rlm.now = func() time.Time { return now }
+
+	return rlm, &now
+}
+
+func TestRateLimitNoWindowBoundaryBurst(t *testing.T) {
+	rlm, now := newTestRateLimitManager(t, &apiconf.RateLimit{Period: time.Minute, Count: 10, Burst: 10, Key: apiconf.RateLimitKeyIP})
+
+	// a fixed window lets count requests at its end and count more right after the reset
+	*now = now.Add(59 * time.Second)
+	allowed := 0
+	for i := 0; i < 30; i++ {
+		if rlm.Check("1.1.1.1", "UserService/Login").Allowed {
+			allowed++
+		}
+		*now = now.Add(100 * time.Millisecond)
+	}
+
+	// the burst, then nothing until the first 6s interval refills
+	if allowed != 10 {
+		t.Errorf("Expected 10 allowed requests in 3s, got %d", allowed)
+	}
+
+	*now = now.Add(6 * time.Second)
+	if !rlm.Check("1.1.1.1", "UserService/Login").Allowed {
+		t.Error("Request should be allowed after the refill interval")
+	}
+	if rlm.Check("1.1.1.1", "UserService/Login").Allowed {
+		t.Error("Only one request should be refilled")
+	}
+
+	if !rlm.Check("2.2.2.2", "UserService/Login").Allowed {
+		t.Error("Other clients should not be limited")
+	}
+	if !rlm.Check("1.1.1.1", "UserService/Logout").Allowed {
+		t.Error("Methods without limit should not be limited")
+	}
+}
+
+func TestRateLimitReset(t *testing.T) {
+	rlm, _ := newTestRateLimitManager(t, &apiconf.RateLimit{Period: time.Hour, Count: 1, Burst: 1, Key: apiconf.RateLimitKeyIP})
+
+	rlm.Check("1.1.1.1", "UserService/Login")
+	if rlm.Check("1.1.1.1", "UserService/Login").Allowed {
+		t.Fatal("Second request should be limited")
+	}
+
+	// reCAPTCHA v2 passed
+	rlm.Reset("1.1.1.1", "UserService/Login")
+	if !rlm.Check("1.1.1.1", "UserService/Login").Allowed {
+		t.Error("Request after Reset should be allowed")
+	}
+}
+
+func TestRateLimitEvictIdle(t *testing.T) {
+	rlm, now := newTestRateLimitManager(t, &apiconf.RateLimit{Period: time.Minute, Count: 2, Burst: 2, Key: apiconf.RateLimitKeyIP})
+
+	rlm.Check("1.1.1.1", "UserService/Login")
+	rlm.Check("2.2.2.2", "UserService/Login")
+	rlm.Check("2.2.2.2", "UserService/Login")
+
+	// 1.1.1.1 is refilled after 30s, 2.2.2.2 after a minute
+	*now = now.Add(45 * time.Second)
+	rlm.evictIdle()
+
+	if len(rlm.clients) != 1 {
+		t.Fatalf("Expected one active client, got %d", len(rlm.clients))
+	}
+	if _, ok := rlm.clients[rateLimitKey{method: "UserService/Login", client: "2.2.2.2"}]; !ok {
+		t.Error("Client with a partly used bucket should be kept")
+	}
+}
+
+func TestRateLimitRetryAfterAndDelay(t *testing.T) {
+	rlm, _ := newTestRateLimitManager(t, &apiconf.RateLimit{Period: time.Minute, Count: 2, Burst: 2, Key: apiconf.RateLimitKeyIP, Delay: time.Second})
+
+	rlm.Check("1.1.1.1", "UserService/Login")
+	rlm.Check("1.1.1.1", "UserService/Login")
+
+	res := rlm.Check("1.1.1.1", "UserService/Login")
+	if res.Allowed || res.RetryAfter != 30*time.Second {
+		t.Errorf("Expected denied with retry after 30s, got %+v", res)
+	}
+	// first denials are answered at once for the reCAPTCHA v2 challenge
+	if res.Delay != 0 {
+		t.Errorf("Expected no delay on the first denial, got %s", res.Delay)
+	}
+
+	rlm.Check("1.1.1.1", "UserService/Login")
+	if res := rlm.Check("1.1.1.1", "UserService/Login"); res.Delay != time.Second {
+		t.Errorf("Expected the configured delay once the client keeps going, got %s", res.Delay)
+	}
+}
+
+func TestRateLimitDelayDoesNotBlockOtherClients(t *testing.T) {
+	rlm, _ := newTestRateLimitManager(t, &apiconf.RateLimit{Period: time.Hour, Count: 1, Burst: 1, Key: apiconf.RateLimitKeyIP, Delay: time.Second})
+
+	// delayed requests wait until released
+	waiting := make(chan time.Duration)
+	release := make(chan struct{})
+	rlm.sleep = func(ctx context.Context, d time.Duration) {
+		waiting <- d
+		<-release
+	}
+
+	logger := tel.NewNull()
+	s := &server{
+		logger:             &logger,
+		recaptchaProcessor: &RecaptchaProcessor{},
+		rateLimitManager:   rlm,
+	}
+	check := func(ip string) bool {
+		_, denied := s.checkRateLimit(context.Background(), map[string]string{}, ip, "UserService/Login", nil)
+		return denied == nil
+	}
+
+	// abusive client up to the free denials, every further request is delayed
+	for i := 0; i < 3; i++ {
+		check("6.6.6.6")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			check("6.6.6.6")
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		if d := <-waiting; d != time.Second {
+			t.Errorf("Delay = %s, want 1s", d)
+		}
+	}
+
+	// the delayed requests are still waiting, checks of other clients must not
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			ip := fmt.Sprintf("10.0.0.%d", i)
+			if !check(ip) {
+				t.Errorf("Client %s should not be limited", ip)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("Unrelated clients are blocked by the delayed ones")
+	}
+
+	close(release)
+	wg.Wait()
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"envoy.auth/extAuth"
@@ -22,23 +23,31 @@ import (
 	envoy_api_v3_core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	envoy_service_auth_v3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
 	v3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
 )
 
 type server struct {
 	conn    *grpc.ClientConn
 	client  extAuth.AuthSessionServiceClient
-	authCfg *APIConf
+	authCfg atomic.Pointer[APIConf]
 	logger  *tel.Telemetry
 
 	recaptchaProcessor *RecaptchaProcessor
 	disabledRecaptcha  bool
 
 	rateLimitManager *RateLimitManager
+
+	// nil unless tokens are verified locally
+	tokenVerifier *TokenVerifier
+
+	// where the token is looked for, first found wins
+	tokenSources []string
 }
 
 var _ envoy_service_auth_v3.AuthorizationServer = &server{}
 
-func NewServer(logger *tel.Telemetry, extAuthAddr string, authCfg *APIConf, rcConf *RCConf) (*server, error) {
+func NewServer(logger *tel.Telemetry, extAuthAddr string, authCfg *APIConf, rcConf *RCConf, jwtConf *JWTConf, tokenSources []string) (*server, error) {
 	conn, err := grpc.Dial(
 		extAuthAddr,
 		grpc.WithInsecure(),
@@ -65,20 +74,45 @@ func NewServer(logger *tel.Telemetry, extAuthAddr string, authCfg *APIConf, rcCo
 		recaptchaProcessor = NewRecaptchaProcessor(rcConf, logger)
 	}
 
-	return &server{
-		conn:    conn,
-		client:  extAuth.NewAuthSessionServiceClient(conn),
-		authCfg: authCfg,
-		logger:  logger,
+	var (
+		client        = extAuth.NewAuthSessionServiceClient(conn)
+		tokenVerifier *TokenVerifier
+	)
+	if jwtConf.Enabled() {
+		// user-service is asked about valid tokens only, once per session cache TTL
+		tokenVerifier = NewTokenVerifier(jwtConf, logger)
+		client = newLocalSessionClient(tokenVerifier, client, jwtConf.SessionCacheTTL)
+	}
+
+	s := &server{
+		conn:   conn,
+		client: client,
+		logger: logger,
 
 		recaptchaProcessor: recaptchaProcessor,
 		disabledRecaptcha:  disabledRecaptcha,
 
 		rateLimitManager: NewRateLimitManager(authCfg, logger),
-	}, nil
+
+		tokenVerifier: tokenVerifier,
+		tokenSources:  tokenSources,
+	}
+	s.authCfg.Store(authCfg)
+
+	return s, nil
+}
+
+// UpdateConfig switches to a reloaded config, requests in flight finish with the previous one
+func (s *server) UpdateConfig(authCfg *APIConf) {
+	s.rateLimitManager.Update(authCfg)
+	s.authCfg.Store(authCfg)
 }
 
 func (s *server) Close() error {
+	s.rateLimitManager.Stop()
+	if s.tokenVerifier != nil {
+		s.tokenVerifier.Stop()
+	}
 	return s.conn.Close()
 }
 
@@ -88,9 +122,19 @@ func formCheckResponse(code v3.StatusCode, message string, headers []*envoy_api_
 	if code == 0 {
 		// Allow request
 		resp.Status = &status1.Status{Code: int32(code1.Code_OK), Message: message}
-		resp.HttpResponse = &envoy_service_auth_v3.CheckResponse_OkResponse{
-			OkResponse: &envoy_service_auth_v3.OkHttpResponse{Headers: headers},
+		okResp := &envoy_service_auth_v3.OkHttpResponse{Headers: headers}
+		// identity headers come from a validated session, API key or certificate only, never
+		// from the client: upstreams and user-id keyed rate limits trust them
+		if !hasHeader(headers, "user-id") {
+			okResp.HeadersToRemove = append(okResp.HeadersToRemove, "user-id", "session-id")
+		}
+		if !hasHeader(headers, "client-id") {
+			okResp.HeadersToRemove = append(okResp.HeadersToRemove, "client-id")
+		}
+		if !hasHeader(headers, "service-id") {
+			okResp.HeadersToRemove = append(okResp.HeadersToRemove, "service-id")
 		}
+		resp.HttpResponse = &envoy_service_auth_v3.CheckResponse_OkResponse{OkResponse: okResp}
 	} else {
 		// Deny request - Status must be non-OK for Envoy to deny
 		resp.Status = &status1.Status{Code: int32(code1.Code_PERMISSION_DENIED), Message: message}
@@ -157,17 +201,19 @@ func (s *server) Check(ctx context.Context, in *envoy_service_auth_v3.CheckReque
 		s.logger.Warn("client IP not found in headers (x-real-ip or x-forwarded-for)")
 	}
 
+	// user-id and api-key keyed limits are checked once the session or the key is validated
+	rlKey := s.rateLimitManager.Key(method)
 	v2RepatchaPassed := false
-	if !s.rateLimitManager.Check(clientIP, method) {
-		v2RepatchaPassed = s.checkReCaptcha(headers, true /*v2*/)
-		if v2RepatchaPassed {
-			s.rateLimitManager.Reset(clientIP, method)
-		} else {
-			return formCheckResponse(v3.StatusCode_TooManyRequests, "rate limit is reached", respHeaders), nil
+	if rlKey != "" && !identityRateLimitKey(rlKey) {
+		var denied *envoy_service_auth_v3.CheckResponse
+		v2RepatchaPassed, denied = s.checkRateLimit(ccx, headers, clientIP, method, respHeaders)
+		if denied != nil {
+			return denied, nil
 		}
 	}
 
-	reqPermission := s.authCfg.GetRequestedPermissions(service, method)
+	authCfg := s.authCfg.Load()
+	reqPermission := authCfg.GetRequestedPermissions(service, method)
 	s.logger.Debug("requested permissions",
 		tel.String("method", path), tel.Any("permissions", reqPermission))
 
@@ -180,16 +226,36 @@ func (s *server) Check(ctx context.Context, in *envoy_service_auth_v3.CheckReque
 			return formCheckResponse(v3.StatusCode_PreconditionFailed, "", respHeaders), nil
 		}
 	}
+
+	if reqPermission.APIKey() {
+		policyReq := &policyRequest{Method: method, Path: path, Headers: headers}
+		return s.checkAPIKey(ccx, authCfg.Policy(reqPermission), policyReq, clientIP, rlKey, respHeaders), nil
+	}
+
+	if reqPermission.MTLS() {
+		// Envoy sets the principal from the SAN of the validated client certificate
+		principal := in.GetAttributes().GetSource().GetPrincipal()
+		policyReq := &policyRequest{Method: method, Path: path, Headers: headers}
+		return s.checkService(ccx, authCfg, reqPermission, policyReq, principal, rlKey, respHeaders), nil
+	}
+
 	// Always parse token first - even for no-need/optional policies
 	// If token is present, we MUST validate it and enrich headers
-	token, err := parseTokenCookie(headers["cookie"])
-	s.logger.Debug("token", tel.String("token", token), tel.Error(err))
+	token, tokenSource, err := extractToken(headers, s.tokenSources)
+	s.logger.Debug("token", tel.String("token_sha256", tokenFingerprint(token)), tel.String("source", tokenSource), tel.Error(err))
 	if err != nil {
 		return formCheckResponse(v3.StatusCode_BadRequest, err.Error(), respHeaders), nil
 	}
 
 	// No token provided
 	if token == "" {
+		if identityRateLimitKey(rlKey) {
+			// anonymous requests are counted per client IP
+			if _, denied := s.checkRateLimit(ccx, headers, clientIP, method, respHeaders); denied != nil {
+				return denied, nil
+			}
+		}
+
 		if reqPermission.Required() {
 			return formCheckResponse(v3.StatusCode_Unauthorized, "token required", respHeaders), nil
 		}
@@ -211,14 +277,22 @@ func (s *server) Check(ctx context.Context, in *envoy_service_auth_v3.CheckReque
 	s.logger.Debug("AuthService", tel.Any("response", resp), tel.Error(err))
 
 	if err != nil {
-		// Token is invalid - clear the cookie
-		respHeaders = append(respHeaders, &envoy_api_v3_core.HeaderValueOption{
-			Header: &envoy_api_v3_core.HeaderValue{Key: "set-cookie", Value: "token=; Path=/; Max-Age=0; HttpOnly"},
-			Append: &wrappers.BoolValue{Value: false},
-		})
+		// Token is invalid - clear the cookie, a bearer token is the client's business
+		if tokenSource == TokenSourceCookie {
+			respHeaders = append(respHeaders, &envoy_api_v3_core.HeaderValueOption{
+				Header: &envoy_api_v3_core.HeaderValue{Key: "set-cookie", Value: "token=; Path=/; Max-Age=0; HttpOnly"},
+				Append: &wrappers.BoolValue{Value: false},
+			})
+		}
 
 		// For NoNeed or Optional - allow through even with invalid token
 		if reqPermission.NoNeed() || reqPermission.Optional() {
+			if identityRateLimitKey(rlKey) {
+				if _, denied := s.checkRateLimit(ccx, headers, clientIP, method, respHeaders); denied != nil {
+					return denied, nil
+				}
+			}
+
 			return formCheckResponse(0, "", respHeaders), nil
 		}
 
@@ -230,8 +304,18 @@ func (s *server) Check(ctx context.Context, in *envoy_service_auth_v3.CheckReque
 		attribute.String("sessionid", resp.SessionId),
 	)
 
-	if reqPermission.Required() && !authorize(reqPermission.Permission, resp.Roles) {
-		return formCheckResponse(v3.StatusCode_Forbidden, "access denied", respHeaders), nil
+	if reqPermission.Required() {
+		policyReq := &policyRequest{Method: method, Path: path, Headers: headers}
+		if allowed, reason := authCfg.Policy(reqPermission).Allow(policyReq, resp); !allowed {
+			s.logger.Debug("access denied", tel.String("method", method), tel.String("reason", reason))
+			return formCheckResponse(v3.StatusCode_Forbidden, "access denied", respHeaders), nil
+		}
+	}
+
+	if identityRateLimitKey(rlKey) {
+		if _, denied := s.checkRateLimit(ccx, headers, rateLimitClient(rlKey, clientIP, resp.UserId), method, respHeaders); denied != nil {
+			return denied, nil
+		}
 	}
 
 	respHeaders = append(respHeaders, &envoy_api_v3_core.HeaderValueOption{
@@ -247,6 +331,119 @@ func (s *server) Check(ctx context.Context, in *envoy_service_auth_v3.CheckReque
 	return formCheckResponse(0, "", respHeaders), nil
 }
 
+// checkAPIKey authenticates a machine client by its x-api-key header, the key scopes are its
+// permissions. The client is passed upstream in the client-id header
+func (s *server) checkAPIKey(ctx context.Context, policy *methodPolicy, req *policyRequest, clientIP, rlKey string, respHeaders []*envoy_api_v3_core.HeaderValueOption) *envoy_service_auth_v3.CheckResponse {
+	key := req.Headers["x-api-key"]
+	if key == "" {
+		return s.apiKeyUnauthorized(ctx, req, clientIP, rlKey, "api key required", respHeaders)
+	}
+
+	resp, err := s.client.ValidateApiKey(ctx, &extAuth.ValidateApiKeyRequest{ApiKey: key}, grpc.WaitForReady(true))
+	s.logger.Debug("AuthService api key", tel.Any("response", resp), tel.Error(err))
+	if err != nil {
+		return s.apiKeyUnauthorized(ctx, req, clientIP, rlKey, "invalid api key", respHeaders)
+	}
+
+	req.ClientID = resp.ClientId
+	if allowed, reason := policy.Allow(req, &extAuth.ValidateSessionResponse{Permissions: resp.Scopes}); !allowed {
+		s.logger.Debug("access denied", tel.String("method", req.Method), tel.String("client", resp.ClientId), tel.String("reason", reason))
+		return formCheckResponse(v3.StatusCode_Forbidden, "access denied", respHeaders)
+	}
+
+	if identityRateLimitKey(rlKey) {
+		// the client is the identity of an API key
+		if _, denied := s.checkRateLimit(ctx, req.Headers, "client:"+resp.ClientId, req.Method, respHeaders); denied != nil {
+			return denied
+		}
+	}
+
+	respHeaders = append(respHeaders, &envoy_api_v3_core.HeaderValueOption{
+		Header: &envoy_api_v3_core.HeaderValue{Key: "client-id", Value: resp.ClientId},
+		Append: &wrappers.BoolValue{Value: false},
+	})
+
+	return formCheckResponse(0, "", respHeaders)
+}
+
+// apiKeyUnauthorized rejects a request without a valid API key. Identity keyed limits count
+// it per client IP, so guessing keys is limited too
+func (s *server) apiKeyUnauthorized(ctx context.Context, req *policyRequest, clientIP, rlKey, reason string, respHeaders []*envoy_api_v3_core.HeaderValueOption) *envoy_service_auth_v3.CheckResponse {
+	if identityRateLimitKey(rlKey) {
+		if _, denied := s.checkRateLimit(ctx, req.Headers, clientIP, req.Method, respHeaders); denied != nil {
+			return denied
+		}
+	}
+
+	return formCheckResponse(v3.StatusCode_Unauthorized, reason, respHeaders)
+}
+
+// checkService authenticates an internal service by its client certificate principal mapped in
+// downstream_tls.identities, the identity permissions are its permissions. The service is
+// passed upstream in the service-id header
+func (s *server) checkService(ctx context.Context, authCfg *APIConf, auth *apiconf.Auth, req *policyRequest, principal, rlKey string, respHeaders []*envoy_api_v3_core.HeaderValueOption) *envoy_service_auth_v3.CheckResponse {
+	if principal == "" {
+		return formCheckResponse(v3.StatusCode_Unauthorized, "client certificate required", respHeaders)
+	}
+
+	id := authCfg.DownstreamTLS.Identity(principal)
+	if id == nil {
+		s.logger.Debug("unknown service identity", tel.String("principal", principal))
+		return formCheckResponse(v3.StatusCode_Forbidden, "unknown service identity", respHeaders)
+	}
+
+	permissions := make([]*extAuth.Permission, 0, len(id.Permissions))
+	for _, p := range id.Permissions {
+		permissions = append(permissions, &extAuth.Permission{Name: p})
+	}
+
+	req.Service = id.Service
+	if allowed, reason := authCfg.Policy(auth).Allow(req, &extAuth.ValidateSessionResponse{Permissions: permissions}); !allowed {
+		s.logger.Debug("access denied", tel.String("method", req.Method), tel.String("service", id.Service), tel.String("reason", reason))
+		return formCheckResponse(v3.StatusCode_Forbidden, "access denied", respHeaders)
+	}
+
+	if identityRateLimitKey(rlKey) {
+		if _, denied := s.checkRateLimit(ctx, req.Headers, "service:"+id.Service, req.Method, respHeaders); denied != nil {
+			return denied
+		}
+	}
+
+	respHeaders = append(respHeaders, &envoy_api_v3_core.HeaderValueOption{
+		Header: &envoy_api_v3_core.HeaderValue{Key: "service-id", Value: id.Service},
+		Append: &wrappers.BoolValue{Value: false},
+	})
+
+	return formCheckResponse(0, "", respHeaders)
+}
+
+// checkRateLimit counts the request of the client against the method limit. A client over
+// the limit passes with a valid reCAPTCHA v2 token, which also resets its counter.
+// Returns whether reCAPTCHA v2 was passed and the response for a denied request
+func (s *server) checkRateLimit(ctx context.Context, headers map[string]string, client, method string, respHeaders []*envoy_api_v3_core.HeaderValueOption) (bool, *envoy_service_auth_v3.CheckResponse) {
+	res := s.rateLimitManager.Check(client, method)
+	if res.Allowed {
+		return false, nil
+	}
+
+	if s.checkReCaptcha(headers, true /*v2*/) {
+		s.rateLimitManager.Reset(client, method)
+		return true, nil
+	}
+
+	if res.Delay > 0 {
+		// penalty for a client that keeps going over the limit, only this request waits
+		s.rateLimitManager.sleep(ctx, res.Delay)
+	}
+
+	respHeaders = append(respHeaders, &envoy_api_v3_core.HeaderValueOption{
+		Header: &envoy_api_v3_core.HeaderValue{Key: "retry-after", Value: retryAfter(res.RetryAfter)},
+		Append: &wrappers.BoolValue{Value: false},
+	})
+
+	return false, formCheckResponse(v3.StatusCode_TooManyRequests, "rate limit is reached", respHeaders)
+}
+
 func (s *server) checkReCaptcha(headers map[string]string, v2 bool) bool {
 	if s.disabledRecaptcha {
 		return true
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	envoy_service_auth_v3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/tel-io/tel/v2"
+)
+
+func newTestServer(t *testing.T, client *fakeSessionClient, tokenSources []string) *server {
+	t.Helper()
+
+	cfg, err := ParseConfig([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := tel.NewNull()
+	s := &server{
+		client:           client,
+		logger:           &logger,
+		rateLimitManager: NewRateLimitManager(cfg, &logger),
+		tokenSources:     tokenSources,
+	}
+	s.authCfg.Store(cfg)
+	t.Cleanup(s.rateLimitManager.Stop)
+
+	return s
+}
+
+func checkRequest(path string, headers map[string]string) *envoy_service_auth_v3.CheckRequest {
+	return &envoy_service_auth_v3.CheckRequest{Attributes: &envoy_service_auth_v3.AttributeContext{
+		Request: &envoy_service_auth_v3.AttributeContext_Request{
+			Http: &envoy_service_auth_v3.AttributeContext_HttpRequest{Path: path, Headers: headers},
+		},
+	}}
+}
+
+func TestCheckInvalidTokenCookieCleanup(t *testing.T) {
+	tests := []struct {
+		name      string
+		headers   map[string]string
+		setCookie bool
+	}{
+		{"cookie token", map[string]string{"cookie": "token=bad"}, true},
+		{"bearer token", map[string]string{"authorization": "Bearer bad"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeSessionClient{err: errors.New("invalid token")}
+			s := newTestServer(t, client, []string{TokenSourceCookie, TokenSourceBearer})
+
+			resp, err := s.Check(context.Background(), checkRequest("/api/UserService/GetProfile", tt.headers))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			denied := resp.GetDeniedResponse()
+			if denied == nil || denied.Status.Code != 401 {
+				t.Fatalf("Invalid token should be unauthorized, got %v", resp)
+			}
+			if client.token != "bad" {
+				t.Errorf("Token %q sent to user-service", client.token)
+			}
+			if got := hasHeader(denied.Headers, "set-cookie"); got != tt.setCookie {
+				t.Errorf("set-cookie emitted: %v, want %v", got, tt.setCookie)
+			}
+		})
+	}
+}
+
+func TestCheckAPIKey(t *testing.T) {
+	const conf = `
+api_route: /api/
+clusters:
+  - name: reports
+    addr: "reports-sv:8080"
+apis:
+  - name: ReportService
+    cluster: reports
+    auth: {policy: api-key, permission: reports}
+    methods:
+      - name: Export
+        auth: {policy: api-key, permission: export}
+`
+	cfg, err := ParseConfig([]byte(conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		code    int32
+	}{
+		{"valid key", "/api/ReportService/List", map[string]string{"x-api-key": "key-1"}, 0},
+		{"missing key", "/api/ReportService/List", map[string]string{}, 401},
+		{"session token is not a key", "/api/ReportService/List", map[string]string{"authorization": "Bearer tok"}, 401},
+		{"invalid key", "/api/ReportService/List", map[string]string{"x-api-key": "key-2"}, 401},
+		{"missing scope", "/api/ReportService/Export", map[string]string{"x-api-key": "key-1"}, 403},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, &fakeSessionClient{}, []string{TokenSourceCookie, TokenSourceBearer})
+			s.authCfg.Store(cfg)
+
+			headers := map[string]string{"user-id": "spoofed", "client-id": "spoofed"}
+			for k, v := range tt.headers {
+				headers[k] = v
+			}
+
+			resp, err := s.Check(context.Background(), checkRequest(tt.path, headers))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.code != 0 {
+				denied := resp.GetDeniedResponse()
+				if denied == nil || int32(denied.Status.Code) != tt.code {
+					t.Fatalf("Expected %d, got %v", tt.code, resp)
+				}
+				return
+			}
+
+			ok := resp.GetOkResponse()
+			if ok == nil {
+				t.Fatalf("Request should be allowed, got %v", resp)
+			}
+			clientID := ""
+			for _, h := range ok.Headers {
+				if h.GetHeader().GetKey() == "client-id" {
+					clientID = h.GetHeader().GetValue()
+				}
+			}
+			if clientID != "client-1" {
+				t.Errorf("client-id = %q, want client-1", clientID)
+			}
+			for _, h := range []string{"user-id", "session-id"} {
+				if !slices.Contains(ok.HeadersToRemove, h) {
+					t.Errorf("%s should be removed, removed %v", h, ok.HeadersToRemove)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckMTLS(t *testing.T) {
+	const conf = `
+api_route: /api/
+downstream_tls:
+  cert: /etc/envoy/tls/tls.crt
+  key: /etc/envoy/tls/tls.key
+  client_ca: /etc/envoy/tls/ca.crt
+  identities:
+    - san: spiffe://cluster.local/ns/billing/sa/billing
+      service: billing
+      permissions: [reports]
+    - san: spiffe://cluster.local/ns/mailer/sa/mailer
+      service: mailer
+clusters:
+  - name: reports
+    addr: "reports-sv:8080"
+apis:
+  - name: ReportService
+    cluster: reports
+    auth: {policy: mtls, permission: reports}
+    methods:
+      - name: Audit
+        auth: {policy: mtls, condition: 'request.service == "mailer"'}
+`
+	cfg, err := ParseConfig([]byte(conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		principal string
+		code      int32
+		service   string
+	}{
+		{"known service", "/api/ReportService/List", "spiffe://cluster.local/ns/billing/sa/billing", 0, "billing"},
+		{"no certificate", "/api/ReportService/List", "", 401, ""},
+		{"unknown service", "/api/ReportService/List", "spiffe://cluster.local/ns/other/sa/other", 403, ""},
+		{"missing permission", "/api/ReportService/List", "spiffe://cluster.local/ns/mailer/sa/mailer", 403, ""},
+		{"condition on service", "/api/ReportService/Audit", "spiffe://cluster.local/ns/mailer/sa/mailer", 0, "mailer"},
+		{"condition on another service", "/api/ReportService/Audit", "spiffe://cluster.local/ns/billing/sa/billing", 403, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, &fakeSessionClient{}, []string{TokenSourceCookie})
+			s.authCfg.Store(cfg)
+
+			req := checkRequest(tt.path, map[string]string{"service-id": "spoofed"})
+			req.Attributes.Source = &envoy_service_auth_v3.AttributeContext_Peer{Principal: tt.principal}
+
+			resp, err := s.Check(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.code != 0 {
+				denied := resp.GetDeniedResponse()
+				if denied == nil || int32(denied.Status.Code) != tt.code {
+					t.Fatalf("Expected %d, got %v", tt.code, resp)
+				}
+				return
+			}
+
+			ok := resp.GetOkResponse()
+			if ok == nil {
+				t.Fatalf("Request should be allowed, got %v", resp)
+			}
+			service := ""
+			for _, h := range ok.Headers {
+				if h.GetHeader().GetKey() == "service-id" {
+					service = h.GetHeader().GetValue()
+				}
+			}
+			if service != tt.service {
+				t.Errorf("service-id = %q, want %q", service, tt.service)
+			}
+		})
+	}
+}
+
+func TestCheckRateLimitKeys(t *testing.T) {
+	const conf = `
+api_route: /api/
+clusters:
+  - name: user-service
+    addr: "user-service-sv:8081"
+  - name: reports
+    addr: "reports-sv:8080"
+apis:
+  - name: UserService
+    cluster: user-service
+    auth: {policy: required}
+    methods:
+      - name: Login
+        auth:
+          policy: no-need
+          rate_limit: {period: 1h, count: 1, burst: 1, key: ip}
+      - name: GetProfile
+        auth:
+          policy: required
+          rate_limit: {period: 1h, count: 1, burst: 1, key: user-id}
+      - name: Search
+        auth:
+          policy: optional
+          rate_limit: {period: 1h, count: 1, burst: 1, key: api-key}
+  - name: ReportService
+    cluster: reports
+    auth: {policy: api-key, permission: reports}
+    methods:
+      - name: List
+        auth:
+          policy: api-key
+          permission: reports
+          rate_limit: {period: 1h, count: 1, burst: 1, key: api-key}
+`
+	cfg, err := ParseConfig([]byte(conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		client  string
+	}{
+		{"ip", "/api/UserService/Login", map[string]string{"authorization": "Bearer tok"}, "1.2.3.4"},
+		{"user-id", "/api/UserService/GetProfile", map[string]string{"authorization": "Bearer tok"}, "user-1"},
+		{"user-id anonymous", "/api/UserService/GetProfile", map[string]string{}, "1.2.3.4"},
+		{"api-key", "/api/ReportService/List", map[string]string{"x-api-key": "key-1"}, "client:client-1"},
+		{"api-key invalid", "/api/ReportService/List", map[string]string{"x-api-key": "key-2"}, "1.2.3.4"},
+		{"api-key missing", "/api/ReportService/List", map[string]string{}, "1.2.3.4"},
+		{"api-key with a session", "/api/UserService/Search", map[string]string{"x-api-key": "key-1", "authorization": "Bearer tok"}, "1.2.3.4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, &fakeSessionClient{}, []string{TokenSourceBearer})
+			s.authCfg.Store(cfg)
+			s.rateLimitManager.Update(cfg)
+
+			headers := map[string]string{"x-real-ip": "1.2.3.4"}
+			for k, v := range tt.headers {
+				headers[k] = v
+			}
+
+			if _, err := s.Check(context.Background(), checkRequest(tt.path, headers)); err != nil {
+				t.Fatal(err)
+			}
+
+			var clients []string
+			for key := range s.rateLimitManager.clients {
+				clients = append(clients, key.client)
+			}
+			if len(clients) != 1 || clients[0] != tt.client {
+				t.Errorf("Request counted for %v, want %q", clients, tt.client)
+			}
+
+			resp, err := s.Check(context.Background(), checkRequest(tt.path, headers))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if denied := resp.GetDeniedResponse(); denied == nil || denied.Status.Code != 429 {
+				t.Errorf("Second request should be over the limit, got %v", resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/tel-io/tel/v2"
+	"google.golang.org/grpc"
+
+	"envoy.auth/extAuth"
+)
+
+// sessionCacheMaxSize bounds the cache, sessions over it are checked by user-service on every request
+const sessionCacheMaxSize = 100000
+
+var sessionChecks = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "auth_adapter_session_checks_total",
+	Help: "Locally verified tokens by session check source: cache or user-service",
+}, []string{"source"})
+
+// JWTConf enables local verification of the access tokens user-service issues
+type JWTConf struct {
+	// Secret is the HS256 secret shared with user-service
+	Secret string
+	// JWKSURL is where the issuer publishes its public keys
+	JWKSURL             string
+	JWKSRefreshInterval time.Duration
+	Issuer              string
+	// SessionCacheTTL is how long a session stays checked, a revoked session
+	// keeps passing for at most that long
+	SessionCacheTTL time.Duration
+}
+
+func (c *JWTConf) Enabled() bool {
+	return c.Secret != "" || c.JWKSURL != ""
+}
+
+// TokenClaims are the access token claims set by user-service
+type TokenClaims struct {
+	UserID    string   `json:"user_id"`
+	SessionID string   `json:"session_id"`
+	Roles     []string `json:"roles"`
+	jwt.RegisteredClaims
+}
+
+// TokenVerifier checks access token signature, issuer and expiration without calling user-service
+type TokenVerifier struct {
+	secret []byte
+	keys   *KeySet
+	parser *jwt.Parser
+}
+
+func NewTokenVerifier(conf *JWTConf, logger *tel.Telemetry) *TokenVerifier {
+	v := &TokenVerifier{}
+
+	var methods []string
+	if conf.Secret != "" {
+		v.secret = []byte(conf.Secret)
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if conf.JWKSURL != "" {
+		v.keys = NewKeySet(conf.JWKSURL, conf.JWKSRefreshInterval, logger)
+		methods = append(methods,
+			jwt.SigningMethodRS256.Alg(),
+			jwt.SigningMethodES256.Alg(),
+			jwt.SigningMethodEdDSA.Alg(),
+		)
+	}
+
+	v.parser = jwt.NewParser(
+		jwt.WithValidMethods(methods),
+		jwt.WithIssuer(conf.Issuer),
+		jwt.WithExpirationRequired(),
+	)
+
+	logger.Info("access tokens are verified locally",
+		tel.Strings("methods", methods), tel.String("jwks", conf.JWKSURL))
+
+	return v
+}
+
+func (v *TokenVerifier) Verify(ctx context.Context, token string) (*TokenClaims, error) {
+	claims := &TokenClaims{}
+
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		// the parser has checked the algorithm is one of the enabled ones
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+			return v.secret, nil
+		}
+
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.Key(ctx, kid, t.Method.Alg())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.UserID == "" || claims.SessionID == "" {
+		return nil, errors.New("token has no session")
+	}
+
+	return claims, nil
+}
+
+func (v *TokenVerifier) Stop() {
+	if v.keys != nil {
+		v.keys.Stop()
+	}
+}
+
+// localSessionClient rejects invalid tokens without a network call and asks user-service about
+// valid ones (revoked sessions, roles with permissions) at most once per cache TTL
+type localSessionClient struct {
+	verifier *TokenVerifier
+	remote   extAuth.AuthSessionServiceClient
+	ttl      time.Duration
+
+	mx    sync.Mutex
+	cache map[string]*sessionCacheEntry
+
+	now func() time.Time
+}
+
+type sessionCacheEntry struct {
+	resp    *extAuth.ValidateSessionResponse
+	expires time.Time
+}
+
+func newLocalSessionClient(verifier *TokenVerifier, remote extAuth.AuthSessionServiceClient, ttl time.Duration) *localSessionClient {
+	return &localSessionClient{
+		verifier: verifier,
+		remote:   remote,
+		ttl:      ttl,
+		cache:    make(map[string]*sessionCacheEntry),
+		now:      time.Now,
+	}
+}
+
+func (c *localSessionClient) ValidateSession(ctx context.Context, req *extAuth.ValidateSessionRequest, opts ...grpc.CallOption) (*extAuth.ValidateSessionResponse, error) {
+	claims, err := c.verifier.Verify(ctx, req.SessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp := c.cached(req.SessionToken); resp != nil {
+		sessionChecks.WithLabelValues("cache").Inc()
+		return resp, nil
+	}
+
+	sessionChecks.WithLabelValues("user-service").Inc()
+	resp, err := c.remote.ValidateSession(ctx, req, opts...)
+	if err != nil {
+		// not cached: the session may be revoked or user-service unavailable for a moment
+		return nil, err
+	}
+
+	// a token never outlives its expiration in the cache
+	expires := c.now().Add(c.ttl)
+	if exp := claims.ExpiresAt.Time; exp.Before(expires) {
+		expires = exp
+	}
+	c.store(req.SessionToken, &sessionCacheEntry{resp: resp, expires: expires})
+
+	return resp, nil
+}
+
+// ValidateApiKey is not cached, API keys are not tokens the verifier knows about
+func (c *localSessionClient) ValidateApiKey(ctx context.Context, req *extAuth.ValidateApiKeyRequest, opts ...grpc.CallOption) (*extAuth.ValidateApiKeyResponse, error) {
+	return c.remote.ValidateApiKey(ctx, req, opts...)
+}
+
+func (c *localSessionClient) cached(token string) *extAuth.ValidateSessionResponse {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	entry, ok := c.cache[token]
+	if !ok {
+		return nil
+	}
+
+	if !entry.expires.After(c.now()) {
+		delete(c.cache, token)
+		return nil
+	}
+
+	return entry.resp
+}
+
+func (c *localSessionClient) store(token string, entry *sessionCacheEntry) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if len(c.cache) >= sessionCacheMaxSize {
+		now := c.now()
+		for t, e := range c.cache {
+			if !e.expires.After(now) {
+				delete(c.cache, t)
+			}
+		}
+
+		if len(c.cache) >= sessionCacheMaxSize {
+			return
+		}
+	}
+
+	c.cache[token] = entry
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/tel-io/tel/v2"
+	"google.golang.org/grpc"
+
+	"envoy.auth/extAuth"
+)
+
+const testJWTSecret = "test-secret"
+
+func testToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, expiresIn time.Duration) string {
+	t.Helper()
+
+	now := time.Now()
+	token := jwt.NewWithClaims(method, TokenClaims{
+		UserID:    "user-1",
+		SessionID: "session-1",
+		Roles:     []string{"CLIENT"},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "user-service",
+		},
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+type fakeSessionClient struct {
+	mx    sync.Mutex
+	calls int
+	token string // of the last call
+	err   error
+}
+
+func (f *fakeSessionClient) ValidateSession(ctx context.Context, req *extAuth.ValidateSessionRequest, opts ...grpc.CallOption) (*extAuth.ValidateSessionResponse, error) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	f.calls++
+	f.token = req.SessionToken
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	return &extAuth.ValidateSessionResponse{UserId: "user-1", SessionId: "session-1"}, nil
+}
+
+func (f *fakeSessionClient) ValidateApiKey(ctx context.Context, req *extAuth.ValidateApiKeyRequest, opts ...grpc.CallOption) (*extAuth.ValidateApiKeyResponse, error) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	f.calls++
+	if req.ApiKey != "key-1" {
+		return nil, errors.New("invalid api key")
+	}
+
+	return &extAuth.ValidateApiKeyResponse{ClientId: "client-1", KeyId: "k1", Scopes: []*extAuth.Permission{{Name: "reports"}}}, nil
+}
+
+func TestLocalSessionClientHS256(t *testing.T) {
+	logger := tel.NewNull()
+	verifier := NewTokenVerifier(&JWTConf{Secret: testJWTSecret, Issuer: "user-service"}, &logger)
+	remote := &fakeSessionClient{}
+	c := newLocalSessionClient(verifier, remote, 30*time.Second)
+
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	valid := testToken(t, jwt.SigningMethodHS256, "", []byte(testJWTSecret), 15*time.Minute)
+	for i := 0; i < 3; i++ {
+		resp, err := c.ValidateSession(context.Background(), &extAuth.ValidateSessionRequest{SessionToken: valid})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.UserId != "user-1" {
+			t.Errorf("Unexpected user %s", resp.UserId)
+		}
+	}
+	if remote.calls != 1 {
+		t.Errorf("Expected one user-service call within cache TTL, got %d", remote.calls)
+	}
+
+	now = now.Add(31 * time.Second)
+	if _, err := c.ValidateSession(context.Background(), &extAuth.ValidateSessionRequest{SessionToken: valid}); err != nil {
+		t.Fatal(err)
+	}
+	if remote.calls != 2 {
+		t.Errorf("Expected user-service call after cache TTL, got %d calls", remote.calls)
+	}
+
+	for name, token := range map[string]string{
+		"expired":      testToken(t, jwt.SigningMethodHS256, "", []byte(testJWTSecret), -time.Minute),
+		"wrong secret": testToken(t, jwt.SigningMethodHS256, "", []byte("other"), 15*time.Minute),
+		"alg none":     testToken(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, 15*time.Minute),
+		"garbage":      "demo-token",
+	} {
+		if _, err := c.ValidateSession(context.Background(), &extAuth.ValidateSessionRequest{SessionToken: token}); err == nil {
+			t.Errorf("Token should be rejected: %s", name)
+		}
+	}
+	if remote.calls != 2 {
+		t.Errorf("Invalid tokens should not reach user-service, got %d calls", remote.calls)
+	}
+}
+
+func TestLocalSessionClientRevokedSession(t *testing.T) {
+	logger := tel.NewNull()
+	verifier := NewTokenVerifier(&JWTConf{Secret: testJWTSecret, Issuer: "user-service"}, &logger)
+	remote := &fakeSessionClient{err: errors.New("session revoked")}
+	c := newLocalSessionClient(verifier, remote, 30*time.Second)
+
+	token := testToken(t, jwt.SigningMethodHS256, "", []byte(testJWTSecret), 15*time.Minute)
+	for i := 0; i < 2; i++ {
+		if _, err := c.ValidateSession(context.Background(), &extAuth.ValidateSessionRequest{SessionToken: token}); err == nil {
+			t.Error("Revoked session should be rejected")
+		}
+	}
+	if remote.calls != 2 {
+		t.Errorf("Failed checks should not be cached, got %d calls", remote.calls)
+	}
+}
+
+type testJWKS struct {
+	mx    sync.Mutex
+	keys  []map[string]string
+	calls int
+}
+
+func (s *testJWKS) add(kid string, key crypto.PublicKey) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	enc := base64.RawURLEncoding.EncodeToString
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		s.keys = append(s.keys, map[string]string{"kty": "RSA", "kid": kid, "alg": "RS256", "use": "sig",
+			"n": enc(k.N.Bytes()), "e": enc(big.NewInt(int64(k.E)).Bytes())})
+	case ed25519.PublicKey:
+		s.keys = append(s.keys, map[string]string{"kty": "OKP", "kid": kid, "crv": "Ed25519", "x": enc(k)})
+	}
+}
+
+func (s *testJWKS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.calls++
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": s.keys})
+}
+
+func TestTokenVerifierJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := &testJWKS{}
+	jwks.add("rsa-1", &rsaKey.PublicKey)
+	srv := httptest.NewServer(jwks)
+	defer srv.Close()
+
+	logger := tel.NewNull()
+	verifier := NewTokenVerifier(&JWTConf{JWKSURL: srv.URL, JWKSRefreshInterval: time.Hour, Issuer: "user-service"}, &logger)
+	defer verifier.Stop()
+
+	ctx := context.Background()
+	if _, err := verifier.Verify(ctx, testToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	// HS256 signed with the public key must not pass as RS256
+	hmacToken := testToken(t, jwt.SigningMethodHS256, "rsa-1", []byte(testJWTSecret), time.Minute)
+	if _, err := verifier.Verify(ctx, hmacToken); err == nil {
+		t.Error("HS256 token should be rejected without a shared secret")
+	}
+
+	// rotated in after the last refresh, unknown kids refresh at most once per interval
+	jwks.add("ed-1", edPub)
+	edToken := testToken(t, jwt.SigningMethodEdDSA, "ed-1", edKey, time.Minute)
+	if _, err := verifier.Verify(ctx, edToken); !errors.Is(err, errUnknownKey) {
+		t.Errorf("Expected unknown key right after a refresh, got %v", err)
+	}
+
+	later := time.Now().Add(jwksMinRefreshInterval)
+	verifier.keys.now = func() time.Time { return later }
+	if _, err := verifier.Verify(ctx, edToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(ctx, testToken(t, jwt.SigningMethodEdDSA, "ed-2", edKey, time.Minute)); err == nil {
+		t.Error("Token with unknown kid should be rejected")
+	}
+	if jwks.calls != 2 {
+		t.Errorf("Expected 2 JWKS fetches, got %d", jwks.calls)
+	}
+}
@@ -1,14 +1,84 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	envoy_api_v3_core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 
 	"envoy.auth/extAuth"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
+)
+
+// token sources, where the session token is looked for
+const (
+	TokenSourceCookie = "cookie" // token cookie, set by the web frontend
+	TokenSourceBearer = "bearer" // Authorization: Bearer header, mobile and service clients
 )
 
+// parseTokenSources parses the comma separated token source precedence, e.g. "bearer,cookie"
+func parseTokenSources(raw string) ([]string, error) {
+	var sources []string
+	for _, src := range strings.Split(raw, ",") {
+		src = strings.ToLower(strings.TrimSpace(src))
+		switch src {
+		case TokenSourceCookie, TokenSourceBearer:
+		default:
+			return nil, fmt.Errorf("unknown token source %q", src)
+		}
+		for _, s := range sources {
+			if s == src {
+				return nil, fmt.Errorf("token source %s is listed twice", src)
+			}
+		}
+		sources = append(sources, src)
+	}
+
+	return sources, nil
+}
+
+// extractToken returns the token of the first source in the order that has one and that source
+func extractToken(headers map[string]string, sources []string) (token, source string, err error) {
+	for _, source := range sources {
+		switch source {
+		case TokenSourceCookie:
+			token, err = parseTokenCookie(headers["cookie"])
+		case TokenSourceBearer:
+			token, err = parseBearerToken(headers["authorization"])
+		}
+		if err != nil || token != "" {
+			return token, source, err
+		}
+	}
+
+	return "", "", nil
+}
+
+// parseBearerToken returns the token of an Authorization header with the Bearer scheme,
+// other schemes are not ours and are ignored
+func parseBearerToken(raw string) (string, error) {
+	scheme, token, _ := strings.Cut(strings.TrimSpace(raw), " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", nil
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", errors.New("empty bearer token")
+	}
+
+	return token, nil
+}
+
 func parseTokenCookie(raw string) (string, error) {
 	header := http.Header{}
 	header.Add("Cookie", raw)
@@ -26,13 +96,24 @@ func parseTokenCookie(raw string) (string, error) {
 	return c.Value, nil
 }
 
-func authorize(perm string, roles []*extAuth.Role) bool {
-	for _, r := range roles {
-		// hack for "CLIENT" role (user on the site)
-		if perm == "" && r.Name == "CLIENT" {
+// authorize checks the session has the permission, a method without one is open to any session.
+// The permissions resolved by user-service are used, the role permissions with an older user-service
+func authorize(perm string, session *extAuth.ValidateSessionResponse) bool {
+	if perm == "" {
+		return true
+	}
+
+	for _, p := range session.Permissions {
+		if p.Name == perm {
 			return true
 		}
+	}
 
+	if len(session.Permissions) > 0 {
+		return false
+	}
+
+	for _, r := range session.Roles {
 		for _, p := range r.Permissions {
 			if p.Name == perm {
 				return true
@@ -49,8 +130,9 @@ func parsePath(path string) (service string, method string) {
 		path = path[:idx]
 	}
 
-	parts := strings.Split(path, "/")
-	// Expected format: /api/{service}/{method}/...
+	parts := strings.SplitN(path, "/", 4)
+	// Expected format: /api/{service}/{method}, the method is the rest of the path,
+	// e.g. user.v1.AdminService/SetRoles of a Connect API
 	// parts[0] = "", parts[1] = "api", parts[2] = service, parts[3] = method
 	if len(parts) < 4 {
 		return
@@ -67,6 +149,65 @@ func parsePath(path string) (service string, method string) {
 	return
 }
 
+// lookupMethod finds a method parsed by parsePath in an index keyed by {service}/{method name}.
+// A path below a configured method, e.g. a REST resource, falls back to the method like the
+// prefix routes of Envoy do. It returns the configured name the entry was found by
+func lookupMethod[T any](index map[string]T, method string) (string, T, bool) {
+	for {
+		if v, ok := index[method]; ok {
+			return method, v, true
+		}
+
+		i := strings.LastIndex(method, "/")
+		if i == -1 {
+			var zero T
+			return "", zero, false
+		}
+		method = method[:i]
+	}
+}
+
+// identityRateLimitKey reports whether the limit key counts the authenticated caller, which
+// is known only after the session, API key or client certificate is validated
+func identityRateLimitKey(key string) bool {
+	return key == apiconf.RateLimitKeyUserID || key == apiconf.RateLimitKeyAPIKey
+}
+
+// rateLimitClient returns what a validated session is counted by for the method rate limit key:
+// the user for user-id limits. api-key limits count the client of a validated API key, a session
+// has none and is counted per client IP
+func rateLimitClient(key, clientIP, userID string) string {
+	if key == apiconf.RateLimitKeyUserID {
+		return userID
+	}
+
+	return clientIP
+}
+
+// tokenFingerprint identifies a token in logs without revealing it: the first 8 bytes of its sha256
+func tokenFingerprint(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// retryAfter formats a wait as Retry-After seconds, rounded up so the client doesn't come back too early
+func retryAfter(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+func hasHeader(headers []*envoy_api_v3_core.HeaderValueOption, key string) bool {
+	for _, h := range headers {
+		if h.GetHeader().GetKey() == key {
+			return true
+		}
+	}
+
+	return false
+}
+
 func getEnvVar(varName, defaultVal string) string {
 	val := os.Getenv(varName)
 	if val == "" {
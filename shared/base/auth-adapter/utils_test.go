@@ -0,0 +1,189 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"envoy.auth/extAuth"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
+)
+
+func TestAuthorize(t *testing.T) {
+	client := &extAuth.Role{Name: "CLIENT", Permissions: []*extAuth.Permission{{Name: "read"}, {Name: "write"}}}
+	support := &extAuth.Role{Name: "SUPPORT", Permissions: []*extAuth.Permission{{Name: "read"}, {Name: "tickets"}}}
+
+	tests := []struct {
+		name    string
+		perm    string
+		session *extAuth.ValidateSessionResponse
+		want    bool
+	}{
+		{
+			name:    "no permission required, any role",
+			session: &extAuth.ValidateSessionResponse{Roles: []*extAuth.Role{support}},
+			want:    true,
+		},
+		{
+			name:    "no permission required, no roles",
+			session: &extAuth.ValidateSessionResponse{},
+			want:    true,
+		},
+		{
+			name: "resolved permission",
+			perm: "refunds",
+			session: &extAuth.ValidateSessionResponse{
+				Roles:       []*extAuth.Role{client},
+				Permissions: []*extAuth.Permission{{Name: "read"}, {Name: "write"}, {Name: "refunds"}},
+			},
+			want: true,
+		},
+		{
+			name: "resolved permissions win over roles",
+			perm: "tickets",
+			session: &extAuth.ValidateSessionResponse{
+				Roles:       []*extAuth.Role{support},
+				Permissions: []*extAuth.Permission{{Name: "read"}},
+			},
+			want: false,
+		},
+		{
+			name:    "role permission without resolved set",
+			perm:    "tickets",
+			session: &extAuth.ValidateSessionResponse{Roles: []*extAuth.Role{client, support}},
+			want:    true,
+		},
+		{
+			name:    "missing permission",
+			perm:    "admin",
+			session: &extAuth.ValidateSessionResponse{Roles: []*extAuth.Role{client}},
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := authorize(tt.perm, tt.session); got != tt.want {
+				t.Errorf("authorize(%q) = %v, want %v", tt.perm, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractToken(t *testing.T) {
+	bothFirst := []string{TokenSourceCookie, TokenSourceBearer}
+	bearerFirst := []string{TokenSourceBearer, TokenSourceCookie}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		sources []string
+		token   string
+		source  string
+	}{
+		{"cookie", map[string]string{"cookie": "a=1; token=c-tok"}, bothFirst, "c-tok", TokenSourceCookie},
+		{"bearer", map[string]string{"authorization": "Bearer b-tok"}, bothFirst, "b-tok", TokenSourceBearer},
+		{"bearer scheme case", map[string]string{"authorization": "bearer b-tok"}, bothFirst, "b-tok", TokenSourceBearer},
+		{"cookie first", map[string]string{"cookie": "token=c-tok", "authorization": "Bearer b-tok"}, bothFirst, "c-tok", TokenSourceCookie},
+		{"bearer first", map[string]string{"cookie": "token=c-tok", "authorization": "Bearer b-tok"}, bearerFirst, "b-tok", TokenSourceBearer},
+		{"other scheme", map[string]string{"authorization": "Basic dXNlcjpwYXNz"}, bothFirst, "", ""},
+		{"source disabled", map[string]string{"authorization": "Bearer b-tok"}, []string{TokenSourceCookie}, "", ""},
+		{"none", map[string]string{}, bothFirst, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, source, err := extractToken(tt.headers, tt.sources)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token != tt.token || source != tt.source {
+				t.Errorf("extractToken() = %q from %q, want %q from %q", token, source, tt.token, tt.source)
+			}
+		})
+	}
+
+	if _, _, err := extractToken(map[string]string{"authorization": "Bearer "}, bothFirst); err == nil {
+		t.Error("Empty bearer token should be rejected")
+	}
+}
+
+func TestParseTokenSources(t *testing.T) {
+	sources, err := parseTokenSources(" Bearer, cookie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 2 || sources[0] != TokenSourceBearer || sources[1] != TokenSourceCookie {
+		t.Errorf("Unexpected sources %v", sources)
+	}
+
+	for _, raw := range []string{"cookie,header", "cookie,cookie", ""} {
+		if _, err := parseTokenSources(raw); err == nil {
+			t.Errorf("%q should be rejected", raw)
+		}
+	}
+}
+
+func TestTokenFingerprint(t *testing.T) {
+	if got := tokenFingerprint(""); got != "" {
+		t.Errorf("tokenFingerprint of no token = %q, want empty", got)
+	}
+
+	token := "eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiJ1c2VyLTEifQ.sig"
+	got := tokenFingerprint(token)
+	if len(got) != 16 || strings.Contains(token, got) {
+		t.Errorf("tokenFingerprint = %q, want 16 hex digits not taken from the token", got)
+	}
+	if got != tokenFingerprint(token) || got == tokenFingerprint(token+"x") {
+		t.Error("tokenFingerprint should tell tokens apart and be stable")
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path        string
+		wantService string
+		wantMethod  string
+	}{
+		{"/api/user/user.v1.AdminService/SetRoles", "user", "user/user.v1.AdminService/SetRoles"},
+		{"/api/UserService/GetProfile?lang=en", "UserService", "UserService/GetProfile"},
+		{"/api/HttpService/protected/items/1", "HttpService", "HttpService/protected/items/1"},
+		{"/api/UserService", "", ""},
+		{"/other/UserService/GetProfile", "", ""},
+	}
+
+	for _, tt := range tests {
+		service, method := parsePath(tt.path)
+		if service != tt.wantService || method != tt.wantMethod {
+			t.Errorf("parsePath(%q) = %q, %q, want %q, %q", tt.path, service, method, tt.wantService, tt.wantMethod)
+		}
+	}
+}
+
+// TestGatewayConfigMethodAuth checks the methods of the deployed config get their own auth,
+// not the one of their API
+func TestGatewayConfigMethodAuth(t *testing.T) {
+	cfg, err := LoadConfig("../../../services/api-gw/config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path           string
+		wantPolicy     string
+		wantPermission string
+	}{
+		{"/api/user/user.v1.AdminService/SetRoles", apiconf.PolicyRequired, "admin"},
+		{"/api/user/user.v1.UserService/GetProfile", apiconf.PolicyRequired, ""},
+		{"/api/user/user.v1.UserService/Login", apiconf.PolicyNoNeed, ""},
+		// below a configured method, like the Envoy prefix route
+		{"/api/HttpService/protected/items/1", apiconf.PolicyRequired, ""},
+	}
+
+	for _, tt := range tests {
+		auth := cfg.GetRequestedPermissions(parsePath(tt.path))
+		if auth == nil || auth.Policy != tt.wantPolicy || auth.Permission != tt.wantPermission {
+			t.Errorf("Auth of %s = %+v, want policy %s, permission %q", tt.path, auth, tt.wantPolicy, tt.wantPermission)
+		}
+	}
+}
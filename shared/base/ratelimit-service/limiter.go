@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
+)
+
+// gcraScript is GCRA (generic cell rate algorithm) over the theoretical arrival time (TAT) of the
+// key: requests are spaced by interval = period/count, up to burst of them may arrive at once.
+// Times are milliseconds, ARGV: now, interval, burst, hits.
+// Returns {allowed, remaining, ms until the next allowed request (denied) or until the bucket is full}
+const gcraScript = `
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local hits = tonumber(ARGV[4])
+
+local tat = tonumber(redis.call("GET", KEYS[1]))
+if not tat or tat < now then
+	tat = now
+end
+
+local new_tat = tat + interval * hits
+local allow_at = new_tat - interval * burst
+if allow_at > now then
+	return {0, 0, math.ceil(allow_at - now)}
+end
+
+local ttl = math.ceil(new_tat - now)
+redis.call("SET", KEYS[1], tostring(new_tat), "PX", ttl)
+
+return {1, math.floor((now - allow_at) / interval), ttl}
+`
+
+// Limiter counts requests in Redis, so a limit holds across all gateway and service replicas
+type Limiter struct {
+	rdb    redis.Scripter
+	script *redis.Script
+
+	now func() time.Time
+}
+
+// Result of a limit check
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// ResetAfter is the wait until the next request is allowed for a denied request,
+	// and until the whole burst is available again for an allowed one
+	ResetAfter time.Duration
+}
+
+func NewLimiter(rdb redis.Scripter) *Limiter {
+	return &Limiter{
+		rdb:    rdb,
+		script: redis.NewScript(gcraScript),
+		now:    time.Now,
+	}
+}
+
+// Allow counts hits requests of key against rl
+func (l *Limiter) Allow(ctx context.Context, key string, rl *apiconf.RateLimit, hits int) (Result, error) {
+	interval := float64(rl.Period) / float64(rl.Count) / float64(time.Millisecond)
+	now := l.now().UnixMilli()
+
+	res, err := l.script.Run(ctx, l.rdb, []string{key}, now, interval, rl.Burst, hits).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Allowed:    res[0] == 1,
+		Remaining:  int(res[1]),
+		ResetAfter: time.Duration(res[2]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
+)
+
+func newTestLimiter(t *testing.T) (*Limiter, *time.Time) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewLimiter(rdb)
+	l.now = func() time.Time { return now }
+
+	return l, &now
+}
+
+func TestLimiterBurstAndRefill(t *testing.T) {
+	l, now := newTestLimiter(t)
+	ctx := context.Background()
+
+	// 20 logins per 5 minutes, all of them at once
+	rl := &apiconf.RateLimit{Period: 5 * time.Minute, Count: 20, Burst: 20}
+
+	for i := 0; i < 20; i++ {
+		res, err := l.Allow(ctx, "k", rl, 1)
+		if err != nil {
+			t.Fatalf("Allow failed: %v", err)
+		}
+		if !res.Allowed || res.Remaining != 19-i {
+			t.Fatalf("Request %d: expected allowed with %d remaining, got %+v", i, 19-i, res)
+		}
+	}
+
+	res, err := l.Allow(ctx, "k", rl, 1)
+	if err != nil {
+		t.Fatalf("Allow failed: %v", err)
+	}
+	if res.Allowed {
+		t.Fatal("Request over burst should be denied")
+	}
+	// one request per 15s is refilled
+	if res.ResetAfter != 15*time.Second {
+		t.Errorf("Expected retry after 15s, got %s", res.ResetAfter)
+	}
+
+	*now = now.Add(15 * time.Second)
+	if res, _ := l.Allow(ctx, "k", rl, 1); !res.Allowed {
+		t.Error("Request should be allowed after the refill interval")
+	}
+	if res, _ := l.Allow(ctx, "k", rl, 1); res.Allowed {
+		t.Error("Only one request should be refilled")
+	}
+
+	// other keys are counted on their own
+	if res, _ := l.Allow(ctx, "other", rl, 1); !res.Allowed || res.Remaining != 19 {
+		t.Errorf("Other key should have a full bucket, got %+v", res)
+	}
+}
+
+func TestLimiterNoWindowBoundaryBurst(t *testing.T) {
+	l, now := newTestLimiter(t)
+	ctx := context.Background()
+
+	rl := &apiconf.RateLimit{Period: time.Minute, Count: 10, Burst: 10}
+
+	allowed := 0
+	// a fixed window would let 2*count through around its boundary
+	for i := 0; i < 40; i++ {
+		if res, _ := l.Allow(ctx, "k", rl, 1); res.Allowed {
+			allowed++
+		}
+		*now = now.Add(time.Second)
+	}
+
+	// 10 at once, then one per 6s over the remaining 39s
+	if allowed != 16 {
+		t.Errorf("Expected 16 allowed requests in 40s, got %d", allowed)
+	}
+}
+
+func TestLimiterHits(t *testing.T) {
+	l, _ := newTestLimiter(t)
+	ctx := context.Background()
+
+	rl := &apiconf.RateLimit{Period: time.Second, Count: 10, Burst: 10}
+
+	if res, _ := l.Allow(ctx, "k", rl, 8); !res.Allowed || res.Remaining != 2 {
+		t.Errorf("Expected 8 hits allowed with 2 remaining, got %+v", res)
+	}
+	if res, _ := l.Allow(ctx, "k", rl, 3); res.Allowed {
+		t.Error("3 hits should not fit into the 2 remaining")
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
+)
+
+var (
+	apiConfPath string
+	listenAddr  string
+	redisAddr   string
+)
+
+func init() {
+	flag.StringVar(&apiConfPath, "api-conf", "/opt/ratelimit-service/config.yaml", "API config file path (the api-gw config.yaml)")
+	flag.StringVar(&listenAddr, "listen", ":8081", "gRPC listen address")
+	flag.StringVar(&redisAddr, "redis-addr", "127.0.0.1:6379", "Redis address")
+}
+
+func main() {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("[FATAL] %s\n", r)
+			os.Exit(1)
+		}
+	}()
+
+	flag.Parse()
+
+	// Override from environment
+	if envRedis := os.Getenv("REDIS_ADDR"); envRedis != "" {
+		redisAddr = envRedis
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := apiconf.Load(apiConfPath)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		panic(err)
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     redisAddr,
+		Password: os.Getenv("REDIS_PASSWORD"),
+	})
+	defer rdb.Close()
+
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		panic(fmt.Errorf("redis %s: %w", redisAddr, err))
+	}
+
+	srv, err := newRateLimitServer(cfg, NewLimiter(rdb))
+	if err != nil {
+		panic(err)
+	}
+
+	lis, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		panic(err)
+	}
+
+	grpcServer := grpc.NewServer()
+	rlsv3.RegisterRateLimitServiceServer(grpcServer, srv)
+	healthpb.RegisterHealthServer(grpcServer, health.NewServer())
+
+	go func() {
+		<-ctx.Done()
+		grpcServer.GracefulStop()
+	}()
+
+	fmt.Printf("[INFO] rate limit service for domain %s listening on %s, %d limits\n", srv.domain, listenAddr, len(srv.limits))
+
+	if err := grpcServer.Serve(lis); err != nil {
+		panic(err)
+	}
+
+	fmt.Println("done")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	commonratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
+)
+
+// descriptorRoute is the descriptor entry the gateway puts the "API/method" route name into
+const descriptorRoute = "route"
+
+// rateLimitServer answers Envoy ratelimit filter requests. Descriptors come from the gateway
+// routes, {route: "UserService/Login", remote_address: "1.2.3.4"}, the limit is looked up by
+// the route entry in the same config.yaml the gateway was generated from
+type rateLimitServer struct {
+	domain  string
+	limits  map[string]*apiconf.RateLimit
+	limiter *Limiter
+}
+
+var _ rlsv3.RateLimitServiceServer = &rateLimitServer{}
+
+func newRateLimitServer(cfg *apiconf.Config, limiter *Limiter) (*rateLimitServer, error) {
+	if cfg.RateLimitService == nil {
+		return nil, fmt.Errorf("rate_limit_service is not configured in API config")
+	}
+
+	return &rateLimitServer{
+		domain:  cfg.RateLimitService.Domain,
+		limits:  cfg.RateLimits(),
+		limiter: limiter,
+	}, nil
+}
+
+func (s *rateLimitServer) ShouldRateLimit(ctx context.Context, req *rlsv3.RateLimitRequest) (*rlsv3.RateLimitResponse, error) {
+	if req.Domain != s.domain {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown domain %s", req.Domain)
+	}
+
+	hits := int(req.HitsAddend)
+	if hits == 0 {
+		hits = 1
+	}
+
+	resp := &rlsv3.RateLimitResponse{OverallCode: rlsv3.RateLimitResponse_OK}
+	for _, d := range req.Descriptors {
+		st, err := s.checkDescriptor(ctx, d, hits)
+		if err != nil {
+			// Envoy applies failure_mode_deny to errors
+			fmt.Printf("[ERROR] rate limit check failed: %s\n", err)
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+
+		if st.Code == rlsv3.RateLimitResponse_OVER_LIMIT {
+			resp.OverallCode = rlsv3.RateLimitResponse_OVER_LIMIT
+		}
+		resp.Statuses = append(resp.Statuses, st)
+	}
+
+	return resp, nil
+}
+
+func (s *rateLimitServer) checkDescriptor(ctx context.Context, d *commonratelimitv3.RateLimitDescriptor, hits int) (*rlsv3.RateLimitResponse_DescriptorStatus, error) {
+	var route string
+	for _, e := range d.Entries {
+		if e.Key == descriptorRoute {
+			route = e.Value
+		}
+	}
+
+	rl, ok := s.limits[route]
+	if !ok {
+		// not a gateway route limit
+		return &rlsv3.RateLimitResponse_DescriptorStatus{Code: rlsv3.RateLimitResponse_OK}, nil
+	}
+
+	res, err := s.limiter.Allow(ctx, s.descriptorKey(d), rl, hits)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &rlsv3.RateLimitResponse_DescriptorStatus{
+		Code:               rlsv3.RateLimitResponse_OK,
+		CurrentLimit:       currentLimit(rl),
+		LimitRemaining:     uint32(res.Remaining),
+		DurationUntilReset: durationpb.New(res.ResetAfter),
+	}
+	if !res.Allowed {
+		st.Code = rlsv3.RateLimitResponse_OVER_LIMIT
+	}
+
+	return st, nil
+}
+
+// descriptorKey is the Redis key of a descriptor, e.g. "ratelimit:api-gateway:route=UserService/Login,remote_address=1.2.3.4"
+func (s *rateLimitServer) descriptorKey(d *commonratelimitv3.RateLimitDescriptor) string {
+	entries := make([]string, 0, len(d.Entries))
+	for _, e := range d.Entries {
+		entries = append(entries, e.Key+"="+e.Value)
+	}
+
+	return "ratelimit:" + s.domain + ":" + strings.Join(entries, ",")
+}
+
+var limitUnits = map[time.Duration]rlsv3.RateLimitResponse_RateLimit_Unit{
+	time.Second:    rlsv3.RateLimitResponse_RateLimit_SECOND,
+	time.Minute:    rlsv3.RateLimitResponse_RateLimit_MINUTE,
+	time.Hour:      rlsv3.RateLimitResponse_RateLimit_HOUR,
+	24 * time.Hour: rlsv3.RateLimitResponse_RateLimit_DAY,
+}
+
+// currentLimit reports the limit for X-RateLimit-Limit, only periods of a whole unit can be expressed
+func currentLimit(rl *apiconf.RateLimit) *rlsv3.RateLimitResponse_RateLimit {
+	unit, ok := limitUnits[rl.Period]
+	if !ok {
+		return nil
+	}
+
+	return &rlsv3.RateLimitResponse_RateLimit{
+		Name:            fmt.Sprintf("%d/%s", rl.Count, rl.Period),
+		RequestsPerUnit: uint32(rl.Count),
+		Unit:            unit,
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	commonratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+
+	"gitlab.com/gitops-poc-dzha/shared/base/apiconf"
+)
+
+const serviceTestConfig = `
+api_route: /api/
+rate_limit_service: {addr: "ratelimit-sv:8081"}
+
+clusters:
+  - name: user-service
+    addr: "user-service-sv:8081"
+
+apis:
+  - name: UserService
+    cluster: user-service
+    auth: {policy: no-need}
+    methods:
+      - name: Login
+        auth:
+          policy: no-need
+          rate_limit: {period: 5m, count: 2, burst: 2}
+      - name: Register
+        auth:
+          policy: no-need
+          rate_limit: {period: 1m, count: 1, burst: 1, key: route}
+`
+
+func newTestServer(t *testing.T) *rateLimitServer {
+	t.Helper()
+
+	cfg, err := apiconf.Parse([]byte(serviceTestConfig))
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	l, _ := newTestLimiter(t)
+	s, err := newRateLimitServer(cfg, l)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	return s
+}
+
+func descriptor(entries ...string) *commonratelimitv3.RateLimitDescriptor {
+	d := &commonratelimitv3.RateLimitDescriptor{}
+	for i := 0; i < len(entries); i += 2 {
+		d.Entries = append(d.Entries, &commonratelimitv3.RateLimitDescriptor_Entry{Key: entries[i], Value: entries[i+1]})
+	}
+	return d
+}
+
+func shouldRateLimit(t *testing.T, s *rateLimitServer, d *commonratelimitv3.RateLimitDescriptor) *rlsv3.RateLimitResponse {
+	t.Helper()
+
+	resp, err := s.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{
+		Domain:      "api-gateway",
+		Descriptors: []*commonratelimitv3.RateLimitDescriptor{d},
+	})
+	if err != nil {
+		t.Fatalf("ShouldRateLimit failed: %v", err)
+	}
+
+	return resp
+}
+
+func TestShouldRateLimitPerKey(t *testing.T) {
+	s := newTestServer(t)
+
+	first := descriptor("route", "UserService/Login", "remote_address", "1.1.1.1")
+	second := descriptor("route", "UserService/Login", "remote_address", "2.2.2.2")
+
+	for i := 0; i < 2; i++ {
+		if resp := shouldRateLimit(t, s, first); resp.OverallCode != rlsv3.RateLimitResponse_OK {
+			t.Fatalf("Request %d should be allowed, got %v", i, resp)
+		}
+	}
+
+	resp := shouldRateLimit(t, s, first)
+	if resp.OverallCode != rlsv3.RateLimitResponse_OVER_LIMIT {
+		t.Fatalf("Third request of the IP should be over limit, got %v", resp)
+	}
+	if reset := resp.Statuses[0].DurationUntilReset.AsDuration(); reset != 150*time.Second {
+		t.Errorf("Expected reset in 150s, got %s", reset)
+	}
+	// 5m is not a whole unit
+	if resp.Statuses[0].CurrentLimit != nil {
+		t.Errorf("Unexpected current limit %v", resp.Statuses[0].CurrentLimit)
+	}
+
+	if resp := shouldRateLimit(t, s, second); resp.OverallCode != rlsv3.RateLimitResponse_OK {
+		t.Errorf("Other IP should not be limited, got %v", resp)
+	}
+}
+
+func TestShouldRateLimitRouteKey(t *testing.T) {
+	s := newTestServer(t)
+
+	d := descriptor("route", "UserService/Register")
+	resp := shouldRateLimit(t, s, d)
+	if resp.OverallCode != rlsv3.RateLimitResponse_OK {
+		t.Fatalf("First request should be allowed, got %v", resp)
+	}
+	if l := resp.Statuses[0].CurrentLimit; l.GetRequestsPerUnit() != 1 || l.GetUnit() != rlsv3.RateLimitResponse_RateLimit_MINUTE {
+		t.Errorf("Unexpected current limit %v", l)
+	}
+
+	if resp := shouldRateLimit(t, s, d); resp.OverallCode != rlsv3.RateLimitResponse_OVER_LIMIT {
+		t.Errorf("Route limit is shared by all clients, got %v", resp)
+	}
+}
+
+func TestShouldRateLimitUnknown(t *testing.T) {
+	s := newTestServer(t)
+
+	if resp := shouldRateLimit(t, s, descriptor("route", "UserService/Logout")); resp.OverallCode != rlsv3.RateLimitResponse_OK {
+		t.Errorf("Route without limit should be allowed, got %v", resp)
+	}
+
+	_, err := s.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{Domain: "other"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for unknown domain, got %v", err)
+	}
+}
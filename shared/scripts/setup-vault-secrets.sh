@@ -174,6 +174,11 @@ for ENV in "${ENVIRONMENTS_ARR[@]}"; do
     vault kv put secret/${VAULT_PATH_PREFIX}/auth-adapter/${ENV}/config \
         VALID_TOKENS="${VALID_TOKENS}" \
         JWT_SECRET="${JWT_SECRET}"
+
+    # user-service signs the HS256 tokens auth-adapter verifies, and won't start without a secret
+    echo_info "Creating secret: user-service/${ENV}"
+    vault kv put secret/${VAULT_PATH_PREFIX}/user-service/${ENV}/config \
+        JWT_SECRET="${JWT_SECRET}"
 done
 
 # Web services (minimal secrets for demo)